@@ -17,9 +17,16 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"errors"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// MaxBackoffAnnotationKey overrides the longest wait between checks for the upstream secret while it is being issued, e.g. 5m
+var MaxBackoffAnnotationKey = GroupVersion.Group + "/max-backoff"
+
 // CachedCertificateSpec defines the desired state of CachedCertificate
 type CachedCertificateSpec struct {
 	// SecretName indicates the name of the secret which will be created once the upstream certificate has been generated
@@ -29,14 +36,118 @@ type CachedCertificateSpec struct {
 	// It is optional and will be defaulted to the CachedCertificate Name
 	SecretName string `json:"secretName,omitempty"`
 
+	// SecretType overrides the type of the target secret, e.g. Opaque for consumers that don't accept kubernetes.io/tls
+	// It is optional and the upstream secret type is kept when empty. Changing it re-creates the target secret
+	SecretType corev1.SecretType `json:"secretType,omitempty"`
+
+	// SecretOwnerRef makes another object in the same namespace, e.g. a parent Application, the owner of the target secret
+	// instead of the CachedCertificate, so deleting that object deletes the secret. It is optional and the CachedCertificate
+	// owns the secret when unset
+	SecretOwnerRef *SecretOwnerReference `json:"secretOwnerRef,omitempty"`
+
+	// SecretNamespaceSelector also copies the target secret into every namespace matching the selector, copies are added
+	// and removed as namespaces gain or lose matching labels. The operator must allow it. It is optional and only the
+	// CachedCertificate's namespace gets the secret when unset
+	SecretNamespaceSelector *metav1.LabelSelector `json:"secretNamespaceSelector,omitempty"`
+
 	// IssuerRef identifies a single issuer to use when generating the cert
 	// Changing this field may cause a new upstream certificate to be created in the cache namespace
 	IssuerRef IssuerRef `json:"issuerRef"`
 
+	// IssuerRefs are fallback issuers tried in order when the upstream certificate from the previous issuer
+	// isn't ready within the operator's issuer fallback timeout, e.g. when an ACME issuer is rate limited
+	// Each fallback gets its own upstream certificate in the cache namespace
+	IssuerRefs []IssuerRef `json:"issuerRefs,omitempty"`
+
 	//+kubebuilder:validation:MinItems=1
 	// DNSNames is a list of unique dns names for the cert
 	// Changing this field may cause a new upstream certificate to be created in the cache namespace
-	DNSNames []string `json:"dnsNames"`
+	// It is optional when DNSNamesFrom is set
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// DNSNamesFrom reads more dns names from a ConfigMap key in the same namespace, merged with DNSNames
+	// The value is a newline or comma separated list, changes to it are handled like changes to DNSNames
+	DNSNamesFrom *ConfigMapKeyRef `json:"dnsNamesFrom,omitempty"`
+
+	//+kubebuilder:validation:MaxLength=64
+	// CommonName is passed to the upstream Certificate for consumers that check the subject common name
+	// It must be one of DNSNames unless the operator allows it to differ. It is optional and no common name is requested
+	// when empty. It changes the issued certificate so CachedCertificates only share an upstream with the same common name
+	CommonName string `json:"commonName,omitempty"`
+
+	// AnnotationPrefixAllowlist limits the upstream secret annotations copied to the target secret to those starting with one of the prefixes
+	// Annotations set by the operator are always kept. It is optional and all annotations are copied when empty
+	AnnotationPrefixAllowlist []string `json:"annotationPrefixAllowlist,omitempty"`
+
+	// PropagateLabels copies the CachedCertificate's own labels onto the target secret, e.g. team or app labels
+	// Labels from the upstream secret and the operator win on conflict
+	PropagateLabels bool `json:"propagateLabels,omitempty"`
+
+	//+kubebuilder:validation:MinItems=1
+	// Keys limits the upstream secret keys synced to the target secret, e.g. only tls.key for a secret picked up by a vault sync
+	// Every listed key must be in the upstream secret and KeyMapping still renames them
+	// It is optional and every key is synced when empty
+	Keys []SecretKey `json:"keys,omitempty"`
+
+	// KeyMapping renames keys from the upstream secret data to new names in the synced secret
+	// Keys not present in the mapping are copied as is, no two keys may end up with the same name
+	KeyMapping map[string]string `json:"keyMapping,omitempty"`
+
+	//+kubebuilder:validation:Enum=leaf-first;root-first
+	// ChainOrder re-orders the certificate chain in tls.crt before it is synced
+	// It is optional and the upstream order is kept when empty
+	ChainOrder ChainOrder `json:"chainOrder,omitempty"`
+
+	// SyncPaused holds off writing the target secret while still creating the upstream certificate and waiting for it to be ready
+	// Clearing the field syncs the secret
+	SyncPaused bool `json:"syncPaused,omitempty"`
+
+	// PublishCAConfigMap is the name of a ConfigMap to also publish the public tls.crt and ca.crt to
+	// for consumers that can't read secrets. The private key is never published
+	// It is optional and no ConfigMap is created when empty
+	PublishCAConfigMap string `json:"publishCAConfigMap,omitempty"`
+
+	// PublishMetadata adds a metadata.json key to the PublishCAConfigMap ConfigMap naming the paired target secret, its keys
+	// and the certificate validity, and mirrors the secret's validity annotations onto the ConfigMap. An init container can
+	// then materialize the certificate into a shared volume without parsing it. It has no effect without PublishCAConfigMap
+	PublishMetadata bool `json:"publishMetadata,omitempty"`
+
+	// OmitCA leaves ca.crt out of the target secret for consumers that fail when it is present
+	// tls.crt and tls.key are still required upstream
+	OmitCA bool `json:"omitCA,omitempty"`
+
+	// TrustBundleFrom adds a trust-bundle.pem key to the target secret holding ca.crt followed by the extra CAs in a
+	// ConfigMap key in the same namespace, a missing ConfigMap or key leaves just ca.crt in the bundle
+	// It is optional and no bundle is added when unset
+	TrustBundleFrom *ConfigMapKeyRef `json:"trustBundleFrom,omitempty"`
+
+	// IssuanceTimeout is how long to wait for the upstream certificate to be ready before moving to the Error state
+	// It is optional and the CachedCertificate waits indefinitely when unset
+	IssuanceTimeout *metav1.Duration `json:"issuanceTimeout,omitempty"`
+
+	// RenewBefore is passed to the upstream Certificate, how long before expiry cert-manager renews it
+	// It is optional and cert-manager's default is used when unset. It can't be set together with RenewBeforePercentage
+	// Renewal timing doesn't change the issued certificate, so it doesn't affect which upstream is used and an upstream
+	// shared by several CachedCertificates keeps the value of the one that created it
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=99
+	// RenewBeforePercentage is passed to the upstream Certificate, the percentage of the certificate's duration left when
+	// cert-manager renews it. It needs a cert-manager version supporting the field and can't be set together with RenewBefore
+	// Like RenewBefore, a shared upstream keeps the value of the CachedCertificate that created it
+	RenewBeforePercentage *int32 `json:"renewBeforePercentage,omitempty"`
+
+	// RequiredUsages are key usages the issued certificate must have, checked before each sync since some issuers
+	// drop usages they don't support. The target secret isn't synced while any are missing
+	// It is optional and nothing is checked when empty
+	RequiredUsages []KeyUsage `json:"requiredUsages,omitempty"`
+
+	//+kubebuilder:validation:Enum=watch;poll
+	// UpstreamSecretSync picks how upstream secret renewals reach the target secret
+	// watch syncs as soon as the upstream secret changes, poll only re-syncs on the operator's poll interval to cut API load
+	// It is optional and defaults to watch
+	UpstreamSecretSync UpstreamSecretSync `json:"upstreamSecretSync,omitempty"`
 }
 
 // IssuerRef points to a CertManger issuer
@@ -51,19 +162,201 @@ type IssuerRef struct {
 	Group string `json:"group,omitempty"`
 }
 
+// SecretOwnerReference points to an object in the same namespace as the CachedCertificate
+type SecretOwnerReference struct {
+	// APIVersion of the owner, e.g. argoproj.io/v1alpha1
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the owner
+	Kind string `json:"kind"`
+
+	// Name of the owner
+	Name string `json:"name"`
+}
+
+// ConfigMapKeyRef points to a key of a ConfigMap in the same namespace
+type ConfigMapKeyRef struct {
+	// Name is the name of the ConfigMap
+	Name string `json:"name"`
+
+	// Key is the data key holding the value
+	Key string `json:"key"`
+}
+
 // CachedCertificateStatus defines the observed state of CachedCertificate
 type CachedCertificateStatus struct {
 	UpstreamReady bool                   `json:"upstreamReady"`
 	UpstreamRef   *ObjectReference       `json:"upstreamRef,omitempty"`
 	State         CachedCertificateState `json:"state"`
+
+	// InSync is true when the target secret content matches the upstream secret as of the last reconcile
+	// It is false while waiting on the upstream, while the sync is paused and the content differs, or after a failed sync
+	InSync bool `json:"inSync,omitempty"`
+
+	// ObservedGeneration is the generation of the CachedCertificate as of the last sync of the target secret
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// SecretHash is the hash of the target secret data written by the last sync
+	// Reconciles are skipped while the generation matches ObservedGeneration and the target secret still has this hash
+	SecretHash string `json:"secretHash,omitempty"`
+
+	// ResyncNonce is the value of the cache.weavelab.xyz/resync annotation as of the last sync
+	// Changing the annotation to any other value forces a sync, re-reading the upstream secret and re-writing the target secret
+	ResyncNonce string `json:"resyncNonce,omitempty"`
+
+	// LastTransitionTime is when State last changed
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// IssuerIndex is the issuer in use, 0 is IssuerRef and anything above is the matching fallback in IssuerRefs
+	IssuerIndex int `json:"issuerIndex,omitempty"`
+
+	// IssuanceStartTime is when the operator started waiting on the current upstream certificate to be ready
+	IssuanceStartTime *metav1.Time `json:"issuanceStartTime,omitempty"`
+
+	// ConflictingNamespaces are the namespaces selected by SecretNamespaceSelector that already have a secret with the target
+	// name which isn't a copy made for this CachedCertificate, those secrets are left alone and get no copy
+	ConflictingNamespaces []string `json:"conflictingNamespaces,omitempty"`
+
+	// ConsumerNamespaces are the namespaces a secret synced from this CachedCertificate was found in on the last sync, the
+	// target secret's own and those with a copy
+	ConsumerNamespaces []string `json:"consumerNamespaces,omitempty"`
+
+	// SyncedNamespaces are the namespaces selected by SecretNamespaceSelector holding an up to date copy of the target secret
+	// A sync limited to some namespaces at a time resumes from them until every selected namespace has its copy
+	SyncedNamespaces []string `json:"syncedNamespaces,omitempty"`
+
+	// SyncedNamespacesHash is the hash of the copy written to SyncedNamespaces, a different copy is written to every namespace again
+	SyncedNamespacesHash string `json:"syncedNamespacesHash,omitempty"`
+
+	// EffectiveDNSNames are the dnsNames the upstream Certificate was chosen for, after resolving dnsNamesFrom and
+	// trimming blank and duplicate names
+	EffectiveDNSNames []string `json:"effectiveDNSNames,omitempty"`
+
+	// Conditions holds the Ready condition, its reason tells apart errors needing different fixes
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// ConditionReady is true when the target secret is synced from a ready upstream
+	// Its reason is the State unless one of the reasons below applies
+	ConditionReady = "Ready"
+
+	// ReasonInvalidSpec means the CachedCertificate failed validation and must be fixed by its owner
+	ReasonInvalidSpec = "InvalidSpec"
+
+	// ReasonUpstreamInvalid means the upstream Certificate can't be synced from, e.g. it has no secretName
+	// This needs fixing by cert-manager or an operator admin rather than the CachedCertificate owner
+	ReasonUpstreamInvalid = "UpstreamInvalid"
+
+	// ReasonSecretConflict means the target secret or ConfigMap already exists and wasn't created by the controller
+	// This needs fixing by the CachedCertificate owner, either by removing the object or choosing another name
+	ReasonSecretConflict = "SecretConflict"
+
+	// ReasonIssuanceTimeout means the upstream wasn't ready within IssuanceTimeout
+	ReasonIssuanceTimeout = "IssuanceTimeout"
+
+	// ReasonIssuanceCircuitOpen means upstream issuance failed too many times in a row, so no upstreams are created for the
+	// CachedCertificate until the circuit breaker cooldown is over
+	ReasonIssuanceCircuitOpen = "IssuanceCircuitOpen"
+
+	// ReasonDNSNamesFromInvalid means the ConfigMap key in DNSNamesFrom is missing or has no dns names
+	ReasonDNSNamesFromInvalid = "DNSNamesFromInvalid"
+
+	// ReasonUsagesMissing means the issued certificate lacks some of RequiredUsages, usually because the issuer dropped them
+	ReasonUsagesMissing = "UsagesMissing"
+
+	// ReasonDNSNamesMissing means the issued certificate doesn't cover some of the dnsNames even though the upstream
+	// Certificate requested them, i.e. the issuer left them out
+	ReasonDNSNamesMissing = "DNSNamesMissing"
+
+	// ReasonKeyPairMismatch means tls.key in the upstream secret doesn't belong to the certificate in tls.crt
+	// This needs the upstream secret re-issued, e.g. by deleting it so cert-manager issues a new one
+	ReasonKeyPairMismatch = "KeyPairMismatch"
+
+	// ReasonSecretTooLarge means the target secret would be over the api server's 1MiB secret size limit, e.g. from large
+	// keystores in the upstream secret. Leaving keys out with Keys brings it back under
+	ReasonSecretTooLarge = "SecretTooLarge"
+
+	// ReasonQuotaExceeded means a ResourceQuota in the namespace doesn't leave room for the target secret
+	// The write is retried with a backoff since the quota may be raised or other secrets removed
+	ReasonQuotaExceeded = "QuotaExceeded"
+
+	// ReasonUpstreamNotFound means the upstream Certificate doesn't exist in a read-only upstream cluster
+	// The operator can't create it there, it has to be created by whoever manages that cluster
+	ReasonUpstreamNotFound = "UpstreamNotFound"
+
+	// ReasonNamespaceTerminating means the namespace is being deleted so the target secret is no longer written
+	ReasonNamespaceTerminating = "NamespaceTerminating"
+
+	// ReasonSyncError is any other error while syncing
+	ReasonSyncError = "SyncError"
+)
+
+// ChainOrder is the order of certificates in a PEM chain
+type ChainOrder string
+
+const (
+	// ChainOrderLeafFirst puts the leaf first followed by each issuer up to the root
+	ChainOrderLeafFirst ChainOrder = "leaf-first"
+
+	// ChainOrderRootFirst puts the root or topmost issuer first down to the leaf
+	ChainOrderRootFirst ChainOrder = "root-first"
+)
+
+//+kubebuilder:validation:Enum="digital signature";"content commitment";"key encipherment";"data encipherment";"key agreement";"cert sign";"crl sign";"encipher only";"decipher only";"server auth";"client auth";"code signing";"email protection";"timestamping";"ocsp signing"
+// KeyUsage is a certificate key usage or extended key usage using the cert-manager names
+type KeyUsage string
+
+const (
+	KeyUsageDigitalSignature  KeyUsage = "digital signature"
+	KeyUsageContentCommitment KeyUsage = "content commitment"
+	KeyUsageKeyEncipherment   KeyUsage = "key encipherment"
+	KeyUsageDataEncipherment  KeyUsage = "data encipherment"
+	KeyUsageKeyAgreement      KeyUsage = "key agreement"
+	KeyUsageCertSign          KeyUsage = "cert sign"
+	KeyUsageCRLSign           KeyUsage = "crl sign"
+	KeyUsageEncipherOnly      KeyUsage = "encipher only"
+	KeyUsageDecipherOnly      KeyUsage = "decipher only"
+	KeyUsageServerAuth        KeyUsage = "server auth"
+	KeyUsageClientAuth        KeyUsage = "client auth"
+	KeyUsageCodeSigning       KeyUsage = "code signing"
+	KeyUsageEmailProtection   KeyUsage = "email protection"
+	KeyUsageTimestamping      KeyUsage = "timestamping"
+	KeyUsageOCSPSigning       KeyUsage = "ocsp signing"
+)
+
+//+kubebuilder:validation:Enum=tls.crt;tls.key;ca.crt
+// SecretKey is a key of the upstream secret issued by cert-manager
+type SecretKey string
+
+const (
+	SecretKeyCert SecretKey = "tls.crt"
+	SecretKeyKey  SecretKey = "tls.key"
+	SecretKeyCA   SecretKey = "ca.crt"
+)
+
+// UpstreamSecretSync is how a CachedCertificate notices upstream secret changes
+type UpstreamSecretSync string
+
+const (
+	// UpstreamSecretSyncWatch re-syncs on every upstream secret change
+	UpstreamSecretSyncWatch UpstreamSecretSync = "watch"
+
+	// UpstreamSecretSyncPoll re-syncs periodically and ignores upstream secret changes
+	UpstreamSecretSyncPoll UpstreamSecretSync = "poll"
+)
+
 type CachedCertificateState string
 
 const (
 	CachedCertificateStatePending CachedCertificateState = "Pending"
 	CachedCertificateStateSynced  CachedCertificateState = "Synced"
 	CachedCertificateStateError   CachedCertificateState = "Error"
+
+	// CachedCertificateStateSyncPaused indicates the upstream is ready but the sync is paused by the spec
+	CachedCertificateStateSyncPaused CachedCertificateState = "SyncPaused"
 )
 
 // ObjectReference is a reference to an object with a given name and Namespace
@@ -98,6 +391,23 @@ type CachedCertificateList struct {
 	Items           []CachedCertificate `json:"items"`
 }
 
+// MaxBackoff returns the duration in MaxBackoffAnnotationKey, zero when the annotation isn't set
+func (c *CachedCertificate) MaxBackoff() (time.Duration, error) {
+	value, ok := c.GetAnnotations()[MaxBackoffAnnotationKey]
+	if !ok {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.New("must be greater than zero")
+	}
+	return d, nil
+}
+
 func init() {
 	SchemeBuilder.Register(&CachedCertificate{}, &CachedCertificateList{})
 }
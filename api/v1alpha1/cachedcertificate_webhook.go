@@ -0,0 +1,384 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// maxDNSNameLength is the longest full dns name allowed
+	maxDNSNameLength = 253
+
+	// maxDNSLabelLength is the longest single label in a dns name allowed
+	maxDNSLabelLength = 63
+
+	// validatePath is the path the validating webhook is served on
+	validatePath = "/validate-cache-weavelab-xyz-v1alpha1-cachedcertificate"
+
+	// defaultIssuerGroup is the group cert-manager uses when an issuerRef has none
+	defaultIssuerGroup = "cert-manager.io"
+)
+
+// log is for logging in this package.
+var cachedcertificatelog = logf.Log.WithName("cachedcertificate-resource")
+
+//+kubebuilder:webhook:path=/validate-cache-weavelab-xyz-v1alpha1-cachedcertificate,mutating=false,failurePolicy=fail,sideEffects=None,groups=cache.weavelab.xyz,resources=cachedcertificates,verbs=create;update,versions=v1alpha1,name=vcachedcertificate.kb.io,admissionReviewVersions={v1,v1beta1}
+
+// CachedCertificateValidator rejects CachedCertificates that cert-manager would fail to issue
+type CachedCertificateValidator struct {
+	// MaxDNSNames limits the number of dnsNames on a single CachedCertificate, zero means no limit
+	MaxDNSNames int
+
+	// AllowedIssuers limits the issuers CachedCertificates may reference, empty allows any issuer
+	AllowedIssuers []IssuerRef
+
+	// AllowedDNSSuffixes limits dnsNames to the given domains and their subdomains, e.g. internal.example.com
+	// A wildcard is only allowed when everything it matches is allowed. Empty allows any dns name
+	AllowedDNSSuffixes []string
+
+	// AllowCommonNameOutsideDNSNames lets the commonName differ from every dnsName
+	// Off by default since some TLS stacks reject certificates with a common name that isn't also a SAN
+	AllowCommonNameOutsideDNSNames bool
+
+	// AllowSecretNamespaceSelector lets CachedCertificates copy their target secret into other namespaces
+	// Off by default since it hands the private key to namespaces the CachedCertificate's author may not control
+	AllowSecretNamespaceSelector bool
+
+	// ImmutableDNSNames rejects updates changing the dnsNames of a CachedCertificate, so moving to new names takes a new
+	// CachedCertificate. Only checked by the webhook as it needs the previous object. Off by default
+	ImmutableDNSNames bool
+
+	decoder *admission.Decoder
+}
+
+// SetupWebhookWithManager registers the validating webhook with the Manager.
+func (v *CachedCertificateValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(validatePath, &webhook.Admission{Handler: v})
+	return nil
+}
+
+// InjectDecoder is called by the webhook server to provide a decoder
+func (v *CachedCertificateValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle validates CachedCertificates on create and update
+func (v *CachedCertificateValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	cert := &CachedCertificate{}
+	if err := v.decoder.Decode(req, cert); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	errs := v.Validate(cert)
+	if req.Operation == admissionv1.Update && v.ImmutableDNSNames {
+		old := &CachedCertificate{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		errs = append(errs, v.ValidateUpdate(old, cert)...)
+	}
+
+	if len(errs) > 0 {
+		cachedcertificatelog.Info("rejecting invalid CachedCertificate", "name", cert.GetName(), "namespace", cert.GetNamespace(), "errors", errs.ToAggregate().Error())
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// Validate returns all problems with the CachedCertificate spec
+func (v *CachedCertificateValidator) Validate(cert *CachedCertificate) field.ErrorList {
+	var errs field.ErrorList
+
+	dnsNamesPath := field.NewPath("spec", "dnsNames")
+	if len(cert.Spec.DNSNames) == 0 && cert.Spec.DNSNamesFrom == nil {
+		errs = append(errs, field.Required(dnsNamesPath, "dnsNames or dnsNamesFrom must be set"))
+	}
+
+	if v.MaxDNSNames > 0 && len(cert.Spec.DNSNames) > v.MaxDNSNames {
+		errs = append(errs, field.TooMany(dnsNamesPath, len(cert.Spec.DNSNames), v.MaxDNSNames))
+	}
+
+	for i, name := range cert.Spec.DNSNames {
+		errs = append(errs, validateDNSName(dnsNamesPath.Index(i), name)...)
+		errs = append(errs, v.validateDNSSuffix(dnsNamesPath.Index(i), name)...)
+	}
+
+	if cn := cert.Spec.CommonName; cn != "" && !v.AllowCommonNameOutsideDNSNames && !containsFold(cert.Spec.DNSNames, cn) {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "commonName"), cn, "must be one of dnsNames"))
+	}
+
+	// the upstream name is sanitized by the operator but secretName is used as is for the target secret
+	if cert.Spec.SecretName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(cert.Spec.SecretName) {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "secretName"), cert.Spec.SecretName, msg))
+		}
+	}
+
+	if cert.Spec.OmitCA {
+		for i, key := range cert.Spec.Keys {
+			if key == SecretKeyCA {
+				errs = append(errs, field.Forbidden(field.NewPath("spec", "keys").Index(i), "ca.crt may not be listed with omitCA"))
+			}
+		}
+	}
+
+	errs = append(errs, validateKeyMapping(cert)...)
+
+	if cert.Spec.RenewBefore != nil && cert.Spec.RenewBeforePercentage != nil {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "renewBeforePercentage"), "may not be set together with renewBefore"))
+	}
+
+	if ref := cert.Spec.SecretOwnerRef; ref != nil {
+		if _, err := schema.ParseGroupVersion(ref.APIVersion); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "secretOwnerRef", "apiVersion"), ref.APIVersion, err.Error()))
+		}
+	}
+
+	if selector := cert.Spec.SecretNamespaceSelector; selector != nil {
+		path := field.NewPath("spec", "secretNamespaceSelector")
+		if !v.AllowSecretNamespaceSelector {
+			errs = append(errs, field.Forbidden(path, "copying the target secret into other namespaces is not allowed by the operator"))
+		} else if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+			errs = append(errs, field.Invalid(path, selector.String(), err.Error()))
+		}
+	}
+
+	if _, err := cert.MaxBackoff(); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "annotations").Key(MaxBackoffAnnotationKey), cert.GetAnnotations()[MaxBackoffAnnotationKey], err.Error()))
+	}
+
+	errs = append(errs, v.validateIssuer(field.NewPath("spec", "issuerRef"), cert.Spec.IssuerRef)...)
+	for i, ref := range cert.Spec.IssuerRefs {
+		errs = append(errs, v.validateIssuer(field.NewPath("spec", "issuerRefs").Index(i), ref)...)
+	}
+
+	return errs
+}
+
+// validateKeyMapping checks no two keys end up under the same name in the target secret, either by mapping to the same key
+// or by mapping onto a synced key that is copied as is. Otherwise which value wins changes between syncs
+func validateKeyMapping(cert *CachedCertificate) field.ErrorList {
+	var errs field.ErrorList
+	path := field.NewPath("spec", "keyMapping")
+
+	// the upstream keys synced unless renamed, the ones cert-manager writes unless Keys limits them
+	synced := map[string]bool{}
+	if len(cert.Spec.Keys) > 0 {
+		for _, key := range cert.Spec.Keys {
+			synced[string(key)] = true
+		}
+	} else {
+		for _, key := range []SecretKey{SecretKeyCert, SecretKeyKey, SecretKeyCA} {
+			synced[string(key)] = true
+		}
+	}
+	if cert.Spec.OmitCA {
+		delete(synced, string(SecretKeyCA))
+	}
+
+	sources := make([]string, 0, len(cert.Spec.KeyMapping))
+	for source := range cert.Spec.KeyMapping {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	mappedFrom := map[string]string{}
+	for _, source := range sources {
+		target := cert.Spec.KeyMapping[source]
+		if previous, ok := mappedFrom[target]; ok {
+			errs = append(errs, field.Invalid(path.Key(source), target, "maps to the same key as "+previous))
+			continue
+		}
+		mappedFrom[target] = source
+
+		if _, renamed := cert.Spec.KeyMapping[target]; target != source && synced[target] && !renamed {
+			errs = append(errs, field.Invalid(path.Key(source), target, "maps onto "+target+" which is also synced as is, map it to another key too"))
+		}
+	}
+
+	return errs
+}
+
+// validateIssuer checks the issuer is in the allow list
+func (v *CachedCertificateValidator) validateIssuer(path *field.Path, ref IssuerRef) field.ErrorList {
+	if len(v.AllowedIssuers) == 0 {
+		return nil
+	}
+
+	for _, allowed := range v.AllowedIssuers {
+		if issuerRefsEqual(allowed, ref) {
+			return nil
+		}
+	}
+
+	return field.ErrorList{field.Forbidden(path, "issuer "+FormatIssuerRef(ref)+" is not in the allowed issuers")}
+}
+
+// validateDNSSuffix checks the dns name is within one of the allowed suffixes
+func (v *CachedCertificateValidator) validateDNSSuffix(path *field.Path, name string) field.ErrorList {
+	if len(v.AllowedDNSSuffixes) == 0 {
+		return nil
+	}
+
+	// a wildcard covers every name directly under its parent, so the parent is what must be allowed
+	domain := strings.ToLower(strings.TrimPrefix(name, "*."))
+	for _, suffix := range v.AllowedDNSSuffixes {
+		suffix = strings.ToLower(strings.TrimPrefix(suffix, "."))
+		if domain == suffix || strings.HasSuffix(domain, "."+suffix) {
+			return nil
+		}
+	}
+
+	return field.ErrorList{field.Forbidden(path, "dns name "+name+" is not within the allowed suffixes "+strings.Join(v.AllowedDNSSuffixes, ", "))}
+}
+
+// issuerRefsEqual compares issuers treating an empty group as the cert-manager default
+func issuerRefsEqual(a, b IssuerRef) bool {
+	if a.Group == "" {
+		a.Group = defaultIssuerGroup
+	}
+	if b.Group == "" {
+		b.Group = defaultIssuerGroup
+	}
+
+	return a == b
+}
+
+// FormatIssuerRef formats the issuer as kind/name with the group appended as kind.group/name when set
+func FormatIssuerRef(ref IssuerRef) string {
+	if ref.Group == "" {
+		return ref.Kind + "/" + ref.Name
+	}
+	return ref.Kind + "." + ref.Group + "/" + ref.Name
+}
+
+// ValidateUpdate returns the problems with changing old into cert that Validate can't see on its own
+func (v *CachedCertificateValidator) ValidateUpdate(old, cert *CachedCertificate) field.ErrorList {
+	var errs field.ErrorList
+
+	// the order, padding and duplicates don't change the upstream, only the set of names does
+	if v.ImmutableDNSNames && !sameDNSNames(old.Spec.DNSNames, cert.Spec.DNSNames) {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "dnsNames"), "dnsNames can't be changed, create a new CachedCertificate instead"))
+	}
+
+	return errs
+}
+
+// ParseIssuerRefs parses a comma separated list of issuers in the FormatIssuerRef format, e.g. ClusterIssuer/letsencrypt
+func ParseIssuerRefs(s string) ([]IssuerRef, error) {
+	var refs []IssuerRef
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("issuer " + item + " must be in the form kind/name or kind.group/name")
+		}
+
+		ref := IssuerRef{Kind: parts[0], Name: parts[1]}
+		if i := strings.Index(ref.Kind, "."); i >= 0 {
+			ref.Kind, ref.Group = ref.Kind[:i], ref.Kind[i+1:]
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// ParseDNSSuffixes parses a comma separated list of dns suffixes, blank entries are skipped
+func ParseDNSSuffixes(s string) []string {
+	var suffixes []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			suffixes = append(suffixes, item)
+		}
+	}
+	return suffixes
+}
+
+// sameDNSNames reports if both lists hold the same names, ignoring order, blanks, surrounding whitespace, duplicates and case
+// as dns names are case insensitive
+func sameDNSNames(a, b []string) bool {
+	set := func(names []string) map[string]bool {
+		out := map[string]bool{}
+		for _, name := range names {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				out[name] = true
+			}
+		}
+		return out
+	}
+
+	setA, setB := set(a), set(b)
+	if len(setA) != len(setB) {
+		return false
+	}
+	for name := range setA {
+		if !setB[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports if name is in names ignoring case, as dns names are
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDNSName checks the name fits within dns length limits
+func validateDNSName(path *field.Path, name string) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(name) > maxDNSNameLength {
+		errs = append(errs, field.TooLong(path, name, maxDNSNameLength))
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) > maxDNSLabelLength {
+			errs = append(errs, field.Invalid(path, name, "label "+label+" must be no more than "+strconv.Itoa(maxDNSLabelLength)+" characters"))
+		}
+	}
+
+	return errs
+}
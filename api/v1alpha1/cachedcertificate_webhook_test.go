@@ -0,0 +1,571 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newCachedCertificate(dnsNames ...string) *CachedCertificate {
+	return &CachedCertificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cert",
+			Namespace: "testing",
+		},
+		Spec: CachedCertificateSpec{
+			IssuerRef: IssuerRef{
+				Name: "my-issuer",
+				Kind: "Issuer",
+			},
+			DNSNames: dnsNames,
+		},
+	}
+}
+
+func TestCachedCertificateValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator CachedCertificateValidator
+		cert      *CachedCertificate
+		wantErr   string
+	}{
+		{
+			"valid",
+			CachedCertificateValidator{MaxDNSNames: 2},
+			newCachedCertificate("example.com", "*.example.com"),
+			"",
+		},
+		{
+			"name too long",
+			CachedCertificateValidator{},
+			newCachedCertificate(strings.Repeat(strings.Repeat("a", 60)+".", 5) + "com"),
+			"must have at most 253 bytes",
+		},
+		{
+			"label too long",
+			CachedCertificateValidator{},
+			newCachedCertificate(strings.Repeat("a", 64) + ".example.com"),
+			"must be no more than 63 characters",
+		},
+		{
+			"too many names",
+			CachedCertificateValidator{MaxDNSNames: 1},
+			newCachedCertificate("a.example.com", "b.example.com"),
+			"must have at most 1 items",
+		},
+		{
+			"allowed issuer",
+			CachedCertificateValidator{AllowedIssuers: []IssuerRef{{Name: "my-issuer", Kind: "Issuer", Group: "cert-manager.io"}}},
+			newCachedCertificate("example.com"),
+			"",
+		},
+		{
+			"disallowed issuer",
+			CachedCertificateValidator{AllowedIssuers: []IssuerRef{{Name: "letsencrypt", Kind: "ClusterIssuer"}}},
+			newCachedCertificate("example.com"),
+			"spec.issuerRef: Forbidden: issuer Issuer/my-issuer is not in the allowed issuers",
+		},
+		{
+			"disallowed fallback issuer",
+			CachedCertificateValidator{AllowedIssuers: []IssuerRef{{Name: "my-issuer", Kind: "Issuer"}}},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.IssuerRefs = []IssuerRef{{Name: "internal-ca", Kind: "ClusterIssuer"}}
+				return cert
+			}(),
+			"spec.issuerRefs[0]: Forbidden",
+		},
+		{
+			"allowed dns suffix",
+			CachedCertificateValidator{AllowedDNSSuffixes: []string{".internal.example.com"}},
+			newCachedCertificate("internal.example.com", "a.internal.example.com", "A.B.Internal.Example.com"),
+			"",
+		},
+		{
+			"disallowed dns suffix",
+			CachedCertificateValidator{AllowedDNSSuffixes: []string{"internal.example.com", "corp.example.com"}},
+			newCachedCertificate("a.internal.example.com", "www.example.com"),
+			"spec.dnsNames[1]: Forbidden: dns name www.example.com is not within the allowed suffixes internal.example.com, corp.example.com",
+		},
+		{
+			"suffix matches whole labels only",
+			CachedCertificateValidator{AllowedDNSSuffixes: []string{"example.com"}},
+			newCachedCertificate("badexample.com"),
+			"spec.dnsNames[0]: Forbidden",
+		},
+		{
+			"allowed wildcard",
+			CachedCertificateValidator{AllowedDNSSuffixes: []string{"internal.example.com"}},
+			newCachedCertificate("*.internal.example.com", "*.svc.internal.example.com"),
+			"",
+		},
+		{
+			"wildcard wider than the suffix",
+			CachedCertificateValidator{AllowedDNSSuffixes: []string{"internal.example.com"}},
+			newCachedCertificate("*.example.com"),
+			"spec.dnsNames[0]: Forbidden: dns name *.example.com is not within the allowed suffixes",
+		},
+		{
+			"valid secretName",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretName = "example-com.tls"
+				return cert
+			}(),
+			"",
+		},
+		{
+			"uppercase secretName",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretName = "Example-TLS"
+				return cert
+			}(),
+			"spec.secretName: Invalid value: \"Example-TLS\": a lowercase RFC 1123 subdomain",
+		},
+		{
+			"underscore secretName",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretName = "example_tls"
+				return cert
+			}(),
+			"spec.secretName: Invalid value",
+		},
+		{
+			"secretName too long",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretName = strings.Repeat("a", 254)
+				return cert
+			}(),
+			"must be no more than 253 characters",
+		},
+		{
+			"no dns names",
+			CachedCertificateValidator{},
+			newCachedCertificate(),
+			"spec.dnsNames: Required value",
+		},
+		{
+			"dns names from a ConfigMap only",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate()
+				cert.Spec.DNSNamesFrom = &ConfigMapKeyRef{Name: "names", Key: "dnsNames"}
+				return cert
+			}(),
+			"",
+		},
+		{
+			"secret owner",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretOwnerRef = &SecretOwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Application", Name: "app"}
+				return cert
+			}(),
+			"",
+		},
+		{
+			"invalid secret owner apiVersion",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretOwnerRef = &SecretOwnerReference{APIVersion: "argoproj.io/v1alpha1/extra", Kind: "Application", Name: "app"}
+				return cert
+			}(),
+			"spec.secretOwnerRef.apiVersion: Invalid value",
+		},
+		{
+			"common name in dns names",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com", "www.example.com")
+				cert.Spec.CommonName = "WWW.example.com"
+				return cert
+			}(),
+			"",
+		},
+		{
+			"common name outside dns names",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.CommonName = "legacy-service"
+				return cert
+			}(),
+			"spec.commonName: Invalid value",
+		},
+		{
+			"common name allowed to differ",
+			CachedCertificateValidator{AllowCommonNameOutsideDNSNames: true},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.CommonName = "legacy-service"
+				return cert
+			}(),
+			"",
+		},
+		{
+			"secret namespace selector not allowed",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+				return cert
+			}(),
+			"spec.secretNamespaceSelector: Forbidden",
+		},
+		{
+			"secret namespace selector allowed",
+			CachedCertificateValidator{AllowSecretNamespaceSelector: true},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+				return cert
+			}(),
+			"",
+		},
+		{
+			"invalid secret namespace selector",
+			CachedCertificateValidator{AllowSecretNamespaceSelector: true},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.SecretNamespaceSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "team", Operator: metav1.LabelSelectorOpIn},
+				}}
+				return cert
+			}(),
+			"spec.secretNamespaceSelector: Invalid value",
+		},
+		{
+			"key only",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.Keys = []SecretKey{SecretKeyKey}
+				return cert
+			}(),
+			"",
+		},
+		{
+			"ca with omitCA",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.OmitCA = true
+				cert.Spec.Keys = []SecretKey{SecretKeyCert, SecretKeyCA}
+				return cert
+			}(),
+			"spec.keys[1]: Forbidden",
+		},
+		{
+			"key mapping swap",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.KeyMapping = map[string]string{"tls.crt": "ca.crt", "ca.crt": "tls.crt"}
+				return cert
+			}(),
+			"",
+		},
+		{
+			"key mapping onto a key left out",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.OmitCA = true
+				cert.Spec.KeyMapping = map[string]string{"tls.crt": "ca.crt"}
+				return cert
+			}(),
+			"",
+		},
+		{
+			"key mapping duplicate target",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.KeyMapping = map[string]string{"tls.crt": "bundle.pem", "ca.crt": "bundle.pem"}
+				return cert
+			}(),
+			"spec.keyMapping[tls.crt]: Invalid value: \"bundle.pem\": maps to the same key as ca.crt",
+		},
+		{
+			"key mapping onto an unmapped key",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.KeyMapping = map[string]string{"tls.crt": "ca.crt"}
+				return cert
+			}(),
+			"spec.keyMapping[tls.crt]: Invalid value: \"ca.crt\": maps onto ca.crt which is also synced as is",
+		},
+		{
+			"renew before",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Spec.RenewBefore = &metav1.Duration{Duration: 720 * time.Hour}
+				return cert
+			}(),
+			"",
+		},
+		{
+			"renew before percentage",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				percentage := int32(33)
+				cert.Spec.RenewBeforePercentage = &percentage
+				return cert
+			}(),
+			"",
+		},
+		{
+			"renew before and percentage",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				percentage := int32(33)
+				cert.Spec.RenewBefore = &metav1.Duration{Duration: 720 * time.Hour}
+				cert.Spec.RenewBeforePercentage = &percentage
+				return cert
+			}(),
+			"spec.renewBeforePercentage: Forbidden: may not be set together with renewBefore",
+		},
+		{
+			"max backoff",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Annotations = map[string]string{MaxBackoffAnnotationKey: "5m"}
+				return cert
+			}(),
+			"",
+		},
+		{
+			"unparsable max backoff",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Annotations = map[string]string{MaxBackoffAnnotationKey: "five minutes"}
+				return cert
+			}(),
+			"metadata.annotations[cache.weavelab.xyz/max-backoff]: Invalid value",
+		},
+		{
+			"negative max backoff",
+			CachedCertificateValidator{},
+			func() *CachedCertificate {
+				cert := newCachedCertificate("example.com")
+				cert.Annotations = map[string]string{MaxBackoffAnnotationKey: "-1s"}
+				return cert
+			}(),
+			"must be greater than zero",
+		},
+		{
+			"zero max is unlimited",
+			CachedCertificateValidator{},
+			newCachedCertificate("a.example.com", "b.example.com", "c.example.com"),
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.validator.Validate(tt.cert)
+			if tt.wantErr == "" {
+				if len(errs) > 0 {
+					t.Errorf("Validate() unexpected errs %v", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || !strings.Contains(errs.ToAggregate().Error(), tt.wantErr) {
+				t.Errorf("Validate() errs = %v, want %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCachedCertificateValidator_Handle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &CachedCertificateValidator{MaxDNSNames: 1}
+	if err := v.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(cert *CachedCertificate) admission.Request {
+		raw, err := json.Marshal(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	if resp := v.Handle(context.Background(), request(newCachedCertificate("example.com"))); !resp.Allowed {
+		t.Errorf("Handle() denied a valid CachedCertificate: %v", resp.Result)
+	}
+
+	if resp := v.Handle(context.Background(), request(newCachedCertificate("a.example.com", "b.example.com"))); resp.Allowed {
+		t.Error("Handle() allowed a CachedCertificate over the dnsNames limit")
+	}
+}
+
+func TestCachedCertificateValidator_ValidateUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		immutable bool
+		old, new  []string
+		wantErr   bool
+	}{
+		{name: "unchanged", immutable: true, old: []string{"a.example.com", "b.example.com"}, new: []string{"a.example.com", "b.example.com"}},
+		{name: "reordered and padded", immutable: true, old: []string{"a.example.com", "b.example.com"}, new: []string{" b.example.com", "a.example.com", "a.example.com"}},
+		{name: "case changed", immutable: true, old: []string{"a.example.com", "B.example.com"}, new: []string{"A.Example.com", "b.example.com"}},
+		{name: "case changed and duplicated", immutable: true, old: []string{"a.example.com"}, new: []string{"a.example.com", " A.EXAMPLE.COM"}},
+		{name: "added", immutable: true, old: []string{"a.example.com"}, new: []string{"a.example.com", "b.example.com"}, wantErr: true},
+		{name: "replaced", immutable: true, old: []string{"a.example.com"}, new: []string{"b.example.com"}, wantErr: true},
+		{name: "changed while disabled", old: []string{"a.example.com"}, new: []string{"b.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &CachedCertificateValidator{ImmutableDNSNames: tt.immutable}
+			errs := v.ValidateUpdate(newCachedCertificate(tt.old...), newCachedCertificate(tt.new...))
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("ValidateUpdate() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCachedCertificateValidator_HandleUpdate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(old, cert *CachedCertificate) admission.Request {
+		oldRaw, err := json.Marshal(old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := json.Marshal(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Update,
+			Object:    runtime.RawExtension{Raw: raw},
+			OldObject: runtime.RawExtension{Raw: oldRaw},
+		}}
+	}
+	changed := request(newCachedCertificate("a.example.com"), newCachedCertificate("b.example.com"))
+
+	v := &CachedCertificateValidator{}
+	if err := v.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+	if resp := v.Handle(context.Background(), changed); !resp.Allowed {
+		t.Errorf("Handle() denied a dnsNames change with immutable dnsNames off: %v", resp.Result)
+	}
+
+	v.ImmutableDNSNames = true
+	if resp := v.Handle(context.Background(), changed); resp.Allowed {
+		t.Error("Handle() allowed a dnsNames change with immutable dnsNames on")
+	}
+
+	unchanged := request(newCachedCertificate("a.example.com"), newCachedCertificate("a.example.com"))
+	if resp := v.Handle(context.Background(), unchanged); !resp.Allowed {
+		t.Errorf("Handle() denied an update keeping the dnsNames: %v", resp.Result)
+	}
+}
+
+func TestParseIssuerRefs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []IssuerRef
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"ClusterIssuer/letsencrypt", []IssuerRef{{Kind: "ClusterIssuer", Name: "letsencrypt"}}, false},
+		{
+			"ClusterIssuer/letsencrypt, Issuer.example.com/internal",
+			[]IssuerRef{{Kind: "ClusterIssuer", Name: "letsencrypt"}, {Kind: "Issuer", Group: "example.com", Name: "internal"}},
+			false,
+		},
+		{"letsencrypt", nil, true},
+		{"ClusterIssuer/", nil, true},
+		{"a/b/c", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseIssuerRefs(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseIssuerRefs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseIssuerRefs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDNSSuffixes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"internal.example.com", []string{"internal.example.com"}},
+		{" internal.example.com, ,.corp.example.com ", []string{"internal.example.com", ".corp.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := ParseDNSSuffixes(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDNSSuffixes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -22,6 +22,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -87,12 +88,74 @@ func (in *CachedCertificateList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CachedCertificateSpec) DeepCopyInto(out *CachedCertificateSpec) {
 	*out = *in
+	if in.SecretOwnerRef != nil {
+		in, out := &in.SecretOwnerRef, &out.SecretOwnerRef
+		*out = new(SecretOwnerReference)
+		**out = **in
+	}
+	if in.SecretNamespaceSelector != nil {
+		in, out := &in.SecretNamespaceSelector, &out.SecretNamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	out.IssuerRef = in.IssuerRef
+	if in.IssuerRefs != nil {
+		in, out := &in.IssuerRefs, &out.IssuerRefs
+		*out = make([]IssuerRef, len(*in))
+		copy(*out, *in)
+	}
 	if in.DNSNames != nil {
 		in, out := &in.DNSNames, &out.DNSNames
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DNSNamesFrom != nil {
+		in, out := &in.DNSNamesFrom, &out.DNSNamesFrom
+		*out = new(ConfigMapKeyRef)
+		**out = **in
+	}
+	if in.AnnotationPrefixAllowlist != nil {
+		in, out := &in.AnnotationPrefixAllowlist, &out.AnnotationPrefixAllowlist
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]SecretKey, len(*in))
+		copy(*out, *in)
+	}
+	if in.KeyMapping != nil {
+		in, out := &in.KeyMapping, &out.KeyMapping
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TrustBundleFrom != nil {
+		in, out := &in.TrustBundleFrom, &out.TrustBundleFrom
+		*out = new(ConfigMapKeyRef)
+		**out = **in
+	}
+	if in.IssuanceTimeout != nil {
+		in, out := &in.IssuanceTimeout, &out.IssuanceTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewBeforePercentage != nil {
+		in, out := &in.RenewBeforePercentage, &out.RenewBeforePercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RequiredUsages != nil {
+		in, out := &in.RequiredUsages, &out.RequiredUsages
+		*out = make([]KeyUsage, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CachedCertificateSpec.
@@ -113,6 +176,41 @@ func (in *CachedCertificateStatus) DeepCopyInto(out *CachedCertificateStatus) {
 		*out = new(ObjectReference)
 		**out = **in
 	}
+	if in.LastTransitionTime != nil {
+		in, out := &in.LastTransitionTime, &out.LastTransitionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.IssuanceStartTime != nil {
+		in, out := &in.IssuanceStartTime, &out.IssuanceStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ConflictingNamespaces != nil {
+		in, out := &in.ConflictingNamespaces, &out.ConflictingNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConsumerNamespaces != nil {
+		in, out := &in.ConsumerNamespaces, &out.ConsumerNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SyncedNamespaces != nil {
+		in, out := &in.SyncedNamespaces, &out.SyncedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EffectiveDNSNames != nil {
+		in, out := &in.EffectiveDNSNames, &out.EffectiveDNSNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CachedCertificateStatus.
@@ -125,6 +223,21 @@ func (in *CachedCertificateStatus) DeepCopy() *CachedCertificateStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapKeyRef) DeepCopyInto(out *ConfigMapKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapKeyRef.
+func (in *ConfigMapKeyRef) DeepCopy() *ConfigMapKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IssuerRef) DeepCopyInto(out *IssuerRef) {
 	*out = *in
@@ -154,3 +267,18 @@ func (in *ObjectReference) DeepCopy() *ObjectReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretOwnerReference) DeepCopyInto(out *SecretOwnerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretOwnerReference.
+func (in *SecretOwnerReference) DeepCopy() *SecretOwnerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretOwnerReference)
+	in.DeepCopyInto(out)
+	return out
+}
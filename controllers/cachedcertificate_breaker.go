@@ -0,0 +1,104 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// issuanceBreaker tracks the failed issuance attempts of the upstream each CachedCertificate waits on, and opens once too
+// many failed in a row so no more upstreams are created for it until a cooldown is over
+// The zero value is ready to use and it is safe for concurrent use
+type issuanceBreaker struct {
+	mu     sync.Mutex
+	states map[types.NamespacedName]breakerState
+}
+
+// breakerState is what a breaker last saw for a CachedCertificate
+type breakerState struct {
+	// upstream is the upstream Certificate whose failures last tripped the breaker
+	upstream string
+
+	// failures is how many failed attempts the upstream had when it tripped, only later failures count towards the next trip
+	failures int64
+
+	// openedAt is when the breaker tripped, zero while closed
+	openedAt time.Time
+}
+
+// observe records failures failed issuance attempts of upstream and trips the breaker once threshold of them happened since
+// the last trip. cert-manager counts consecutive failures and resets the count on success
+func (b *issuanceBreaker) observe(key types.NamespacedName, upstream string, failures int64, threshold int, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.states[key]
+	if !state.openedAt.IsZero() {
+		return
+	}
+
+	var baseline int64
+	if state.upstream == upstream && state.failures <= failures {
+		baseline = state.failures
+	}
+	if failures-baseline < int64(threshold) {
+		return
+	}
+
+	if b.states == nil {
+		b.states = map[types.NamespacedName]breakerState{}
+	}
+	b.states[key] = breakerState{upstream: upstream, failures: failures, openedAt: now}
+}
+
+// remaining returns how much longer the breaker stays open, zero when closed. It closes once the cooldown is over
+func (b *issuanceBreaker) remaining(key types.NamespacedName, now time.Time, cooldown time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.states[key]
+	if !ok || state.openedAt.IsZero() {
+		return 0
+	}
+
+	if remaining := state.openedAt.Add(cooldown).Sub(now); remaining > 0 {
+		return remaining
+	}
+
+	// keep the failures so the same upstream needs threshold more of them to trip again
+	state.openedAt = time.Time{}
+	b.states[key] = state
+	return 0
+}
+
+// forget drops what was seen, e.g. once the upstream was issued or the CachedCertificate deleted
+func (b *issuanceBreaker) forget(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.states, key)
+}
+
+// upstreamFailedIssuanceAttempts returns status.failedIssuanceAttempts of an upstream Certificate, zero when unset
+// e.g. before cert-manager 1.6
+func upstreamFailedIssuanceAttempts(upstreamCert *unstructured.Unstructured) int64 {
+	failures, _, _ := unstructured.NestedInt64(upstreamCert.Object, "status", "failedIssuanceAttempts")
+	return failures
+}
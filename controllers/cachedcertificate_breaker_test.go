@@ -0,0 +1,167 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+func Test_issuanceBreaker(t *testing.T) {
+	key := types.NamespacedName{Name: "a", Namespace: "testing"}
+	start := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	b := &issuanceBreaker{}
+
+	b.observe(key, "cc-a", 2, 3, start)
+	if wait := b.remaining(key, start, time.Hour); wait != 0 {
+		t.Errorf("remaining() = %v below the threshold, want 0", wait)
+	}
+
+	b.observe(key, "cc-a", 3, 3, start)
+	if wait := b.remaining(key, start.Add(time.Minute), time.Hour); wait != time.Hour-time.Minute {
+		t.Errorf("remaining() = %v after tripping, want %v", wait, time.Hour-time.Minute)
+	}
+
+	// an open breaker keeps its trip time
+	b.observe(key, "cc-a", 10, 3, start.Add(time.Minute))
+	if wait := b.remaining(key, start.Add(time.Minute), time.Hour); wait != time.Hour-time.Minute {
+		t.Errorf("remaining() = %v after more failures, want %v", wait, time.Hour-time.Minute)
+	}
+
+	if wait := b.remaining(key, start.Add(time.Hour), time.Hour); wait != 0 {
+		t.Errorf("remaining() = %v after the cooldown, want 0", wait)
+	}
+
+	// failures from before the reset don't trip it again
+	b.observe(key, "cc-a", 3, 3, start.Add(time.Hour))
+	if wait := b.remaining(key, start.Add(time.Hour), time.Hour); wait != 0 {
+		t.Errorf("remaining() = %v for failures before the reset, want 0", wait)
+	}
+	b.observe(key, "cc-a", 6, 3, start.Add(2*time.Hour))
+	if wait := b.remaining(key, start.Add(2*time.Hour), time.Hour); wait != time.Hour {
+		t.Errorf("remaining() = %v after more failures since the reset, want %v", wait, time.Hour)
+	}
+
+	b.forget(key)
+	if wait := b.remaining(key, start.Add(2*time.Hour), time.Hour); wait != 0 {
+		t.Errorf("remaining() = %v after forget, want 0", wait)
+	}
+
+	// another upstream counts from zero
+	b.observe(key, "cc-a", 5, 3, start)
+	b.remaining(key, start.Add(time.Hour), time.Hour)
+	b.observe(key, "cc-b", 3, 3, start.Add(time.Hour))
+	if wait := b.remaining(key, start.Add(time.Hour), time.Hour); wait != time.Hour {
+		t.Errorf("remaining() = %v for another upstream, want %v", wait, time.Hour)
+	}
+}
+
+func Test_ReconcileCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFakeClock(time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC))
+
+	cachedCert := newTestCachedCertificate("failing", "failing.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace:          "cache",
+		CircuitBreakerThreshold: 3,
+		CircuitBreakerCooldown:  time.Hour,
+		Clock:                   fakeClock,
+		Client:                  newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "failing", Namespace: "testing"}
+	upstreamKey := types.NamespacedName{Name: "cc-failing.example.com", Namespace: "cache"}
+	reconcile := func() ctrl.Result {
+		t.Helper()
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		if err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+		return result
+	}
+	setFailures := func(failures int64) {
+		t.Helper()
+		upstream := newUpstreamCertificate()
+		if err := r.Get(ctx, upstreamKey, upstream); err != nil {
+			t.Fatalf("unable to get upstream Certificate %v", err)
+		}
+		if err := unstructured.SetNestedField(upstream.Object, failures, "status", "failedIssuanceAttempts"); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Update(ctx, upstream); err != nil {
+			t.Fatalf("unable to update upstream Certificate %v", err)
+		}
+	}
+	status := func() cachev1alpha1.CachedCertificateStatus {
+		t.Helper()
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got.Status
+	}
+
+	reconcile()
+	setFailures(2)
+	reconcile()
+	if got := status(); got.State != cachev1alpha1.CachedCertificateStatePending {
+		t.Errorf("Reconcile() state = %v below the threshold, want Pending", got.State)
+	}
+
+	setFailures(3)
+	if result := reconcile(); result.RequeueAfter != time.Hour {
+		t.Errorf("Reconcile() RequeueAfter = %v after tripping, want the cooldown", result.RequeueAfter)
+	}
+	if got := status(); got.State != cachev1alpha1.CachedCertificateStateError || readyReason(&got) != cachev1alpha1.ReasonIssuanceCircuitOpen {
+		t.Errorf("Reconcile() status = %v after tripping, want an IssuanceCircuitOpen error", got)
+	}
+
+	// a deleted upstream isn't re-created while the breaker is open
+	upstream := newUpstreamCertificate()
+	upstream.SetName(upstreamKey.Name)
+	upstream.SetNamespace(upstreamKey.Namespace)
+	if err := r.Delete(ctx, upstream); err != nil {
+		t.Fatalf("unable to delete upstream Certificate %v", err)
+	}
+	fakeClock.Step(time.Minute)
+	if result := reconcile(); result.RequeueAfter != time.Hour-time.Minute {
+		t.Errorf("Reconcile() RequeueAfter = %v while open, want the rest of the cooldown", result.RequeueAfter)
+	}
+	if err := r.Get(ctx, upstreamKey, newUpstreamCertificate()); !k8serr.IsNotFound(err) {
+		t.Errorf("upstream Certificate get err = %v, want not found while the breaker is open", err)
+	}
+
+	// the breaker resets after the cooldown
+	fakeClock.Step(time.Hour)
+	reconcile()
+	if err := r.Get(ctx, upstreamKey, newUpstreamCertificate()); err != nil {
+		t.Errorf("upstream Certificate get err = %v, want it re-created after the cooldown", err)
+	}
+	reconcile()
+	if got := status(); got.State != cachev1alpha1.CachedCertificateStatePending {
+		t.Errorf("Reconcile() state = %v after the cooldown, want Pending", got.State)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// NewNamespacedCache returns a cache limited to the cache namespace and the given watched namespaces.
+// This allows running the operator without cluster-wide access to secrets.
+// It returns nil when no namespaces are watched, which keeps the default cluster-wide cache.
+func NewNamespacedCache(cacheNamespace string, watchNamespaces []string) cache.NewCacheFunc {
+	namespaces := cachedNamespaces(cacheNamespace, watchNamespaces)
+	if namespaces == nil {
+		return nil
+	}
+
+	return cache.MultiNamespacedCacheBuilder(namespaces)
+}
+
+// inWatchedNamespace reports if the namespace is the cache namespace or one of WatchNamespaces, always true without WatchNamespaces
+func (r *CachedCertificateReconciler) inWatchedNamespace(namespace string) bool {
+	namespaces := cachedNamespaces(r.CacheNamespace, r.WatchNamespaces)
+	if namespaces == nil {
+		return true
+	}
+
+	i := sort.SearchStrings(namespaces, namespace)
+	return i < len(namespaces) && namespaces[i] == namespace
+}
+
+// cachedNamespaces returns the sorted unique set of namespaces to cache, the cache namespace is always included.
+// nil is returned when no namespaces are watched.
+func cachedNamespaces(cacheNamespace string, watchNamespaces []string) []string {
+	seen := map[string]bool{}
+	for _, namespace := range watchNamespaces {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" {
+			seen[namespace] = true
+		}
+	}
+
+	if len(seen) == 0 {
+		return nil
+	}
+	seen[cacheNamespace] = true
+
+	namespaces := make([]string, 0, len(seen))
+	for namespace := range seen {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces
+}
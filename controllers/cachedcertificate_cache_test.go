@@ -0,0 +1,161 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+var _ = Describe("The namespaced cache", func() {
+	It("should only read secrets from the cache and watched namespaces", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		for _, namespace := range []string{"cache-watched", "cache-out-of-scope"} {
+			Expect(k8sClient.Create(ctx, &v1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: namespace},
+			})).Should(Succeed())
+		}
+
+		for _, namespace := range []string{"testing", "cache-watched", "cache-out-of-scope"} {
+			Expect(k8sClient.Create(ctx, &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "namespaced-cache", Namespace: namespace},
+			})).Should(Succeed())
+		}
+
+		newCache := NewNamespacedCache("testing", []string{"cache-watched"})
+		Expect(newCache).NotTo(BeNil())
+
+		namespacedCache, err := newCache(cfg, cache.Options{Scheme: scheme.Scheme})
+		Expect(err).NotTo(HaveOccurred())
+		go func() {
+			_ = namespacedCache.Start(ctx)
+		}()
+
+		// the informers start lazily on first read so allow them time to sync
+		for _, namespace := range []string{"testing", "cache-watched"} {
+			key := types.NamespacedName{Name: "namespaced-cache", Namespace: namespace}
+			Eventually(func() error {
+				return namespacedCache.Get(ctx, key, &v1.Secret{})
+			}, time.Second*10, time.Millisecond*250).Should(Succeed())
+		}
+		Expect(namespacedCache.Get(ctx, types.NamespacedName{Name: "namespaced-cache", Namespace: "cache-out-of-scope"}, &v1.Secret{})).ShouldNot(Succeed())
+	})
+
+	It("should keep the default cache when no namespaces are watched", func() {
+		Expect(NewNamespacedCache("testing", nil)).To(BeNil())
+	})
+})
+
+// namespaceRecordingClient records the namespace of every object read or written through it
+type namespaceRecordingClient struct {
+	client.Client
+	namespaces map[string]bool
+}
+
+func (c *namespaceRecordingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	c.namespaces[key.Namespace] = true
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c *namespaceRecordingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	c.namespaces[listOpts.Namespace] = true
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *namespaceRecordingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.namespaces[obj.GetNamespace()] = true
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *namespaceRecordingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.namespaces[obj.GetNamespace()] = true
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *namespaceRecordingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.namespaces[obj.GetNamespace()] = true
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func Test_ReconcileWatchNamespaces(t *testing.T) {
+	ctx := context.Background()
+
+	watched := newTestCachedCertificate("watched", "watched.example.com")
+	outOfScope := newTestCachedCertificate("out-of-scope", "out-of-scope.example.com")
+	outOfScope.Namespace = "other"
+	recorder := &namespaceRecordingClient{Client: newFakeClient(watched, outOfScope), namespaces: map[string]bool{}}
+	r := &CachedCertificateReconciler{
+		CacheNamespace:  "cache",
+		WatchNamespaces: []string{"testing", ""},
+		Client:          recorder,
+	}
+
+	key := types.NamespacedName{Name: "watched", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, recorder.Client, types.NamespacedName{Name: "cc-watched.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if err := recorder.Get(ctx, key, &v1.Secret{}); err != nil {
+		t.Errorf("target secret get err = %v, want it synced in a watched namespace", err)
+	}
+
+	outOfScopeKey := types.NamespacedName{Name: "out-of-scope", Namespace: "other"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: outOfScopeKey}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	// no namespace is the Namespace read and lists across namespaces, which the namespaced cache limits to its namespaces
+	for namespace := range recorder.namespaces {
+		if namespace != "" && namespace != "testing" && namespace != "cache" {
+			t.Errorf("Reconcile() accessed namespace %q outside the watched namespaces", namespace)
+		}
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := recorder.Client.Get(ctx, outOfScopeKey, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.UpstreamRef != nil {
+		t.Errorf("Reconcile() status = %v, want the out of scope CachedCertificate left alone", got.Status)
+	}
+	if r.watches(got) {
+		t.Error("watches() = true for a CachedCertificate outside the watched namespaces")
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// orderChain parses the PEM chain and re-encodes it in the given order
+func orderChain(chains *ParsedChainCache, chain []byte, order cachev1alpha1.ChainOrder) ([]byte, error) {
+	certs, err := chains.parse(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := sortLeafFirst(certs)
+	if order == cachev1alpha1.ChainOrderRootFirst {
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	}
+
+	out := &bytes.Buffer{}
+	for _, cert := range ordered {
+		if err := pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return nil, err
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// leafNotBefore returns the NotBefore of the leaf in the PEM chain, ok is false when the chain can't be parsed
+func leafNotBefore(chains *ParsedChainCache, chain []byte) (notBefore time.Time, ok bool) {
+	notBefore, _, ok = leafValidity(chains, chain)
+	return notBefore, ok
+}
+
+// leafValidity returns the NotBefore and NotAfter of the leaf in the PEM chain, ok is false when the chain can't be parsed
+func leafValidity(chains *ParsedChainCache, chain []byte) (notBefore, notAfter time.Time, ok bool) {
+	certs, err := chains.parse(chain)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	leaf := sortLeafFirst(certs)[0]
+	return leaf.NotBefore, leaf.NotAfter, true
+}
+
+// validityAnnotations returns the leaf validity of the PEM chain formatted as RFC3339, falling back to the upstream
+// Certificate's status.notBefore and status.notAfter when the chain can't be parsed. Values are empty when neither is known
+func validityAnnotations(chains *ParsedChainCache, chain []byte, upstreamCert *unstructured.Unstructured) (notBefore, notAfter string) {
+	if start, end, ok := leafValidity(chains, chain); ok {
+		return start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339)
+	}
+
+	notBefore, _, _ = unstructured.NestedString(upstreamCert.Object, "status", "notBefore")
+	notAfter, _, _ = unstructured.NestedString(upstreamCert.Object, "status", "notAfter")
+	return notBefore, notAfter
+}
+
+// verifyKeyPair checks the PEM private key belongs to the leaf in the PEM chain, the chain may be in any order
+func verifyKeyPair(chains *ParsedChainCache, chain, key []byte) error {
+	certs, err := chains.parse(chain)
+	if err != nil {
+		return err
+	}
+
+	// X509KeyPair compares the key against the first certificate only
+	leaf := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: sortLeafFirst(certs)[0].Raw})
+	_, err = tls.X509KeyPair(leaf, key)
+	return err
+}
+
+// missingDNSNames returns the dnsNames the leaf certificate of the PEM chain doesn't cover. A name is covered by the same SAN
+// or, unless it is a wildcard itself, by a wildcard SAN matching it
+func missingDNSNames(chains *ParsedChainCache, chain []byte, dnsNames []string) ([]string, error) {
+	certs, err := chains.parse(chain)
+	if err != nil {
+		return nil, err
+	}
+	leaf := sortLeafFirst(certs)[0]
+
+	var missing []string
+	for _, name := range dnsNames {
+		if !hasDNSName(leaf, name) && (strings.HasPrefix(name, "*.") || leaf.VerifyHostname(name) != nil) {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing, nil
+}
+
+// hasDNSName reports if the certificate has the dns name as a SAN, ignoring case and a trailing dot
+func hasDNSName(cert *x509.Certificate, name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	for _, san := range cert.DNSNames {
+		if strings.EqualFold(strings.TrimSuffix(san, "."), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeChain decodes every certificate in the PEM data, anything that isn't a certificate is an error
+func decodeChain(chain []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	rest := chain
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.New("unexpected PEM block " + block.Type + " in certificate chain")
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.New("invalid certificate in chain: " + err.Error())
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, errors.New("certificate chain has trailing data that is not PEM encoded")
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("certificate chain has no PEM encoded certificates")
+	}
+
+	return certs, nil
+}
+
+// sortLeafFirst walks from the leaf up through each issuer
+// certificates that aren't part of the walk keep their original order at the end
+func sortLeafFirst(certs []*x509.Certificate) []*x509.Certificate {
+	// the leaf is the only certificate that didn't issue another one in the chain
+	leaf := -1
+	for i, cert := range certs {
+		issuedOther := false
+		for j, other := range certs {
+			if i != j && bytes.Equal(other.RawIssuer, cert.RawSubject) {
+				issuedOther = true
+				break
+			}
+		}
+
+		if !issuedOther {
+			if leaf != -1 {
+				// more than one candidate, the chain can't be walked so keep it as is
+				return certs
+			}
+			leaf = i
+		}
+	}
+
+	if leaf == -1 {
+		return certs
+	}
+
+	used := make([]bool, len(certs))
+	ordered := make([]*x509.Certificate, 0, len(certs))
+
+	for current := leaf; current != -1; {
+		used[current] = true
+		ordered = append(ordered, certs[current])
+
+		next := -1
+		for i, cert := range certs {
+			if !used[i] && bytes.Equal(cert.RawSubject, certs[current].RawIssuer) {
+				next = i
+				break
+			}
+		}
+		current = next
+	}
+
+	for i, cert := range certs {
+		if !used[i] {
+			ordered = append(ordered, cert)
+		}
+	}
+
+	return ordered
+}
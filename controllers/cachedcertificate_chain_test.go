@@ -0,0 +1,325 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+// testCert is a generated certificate with its key so it can issue others
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate signed by the parent, or self signed when parent is nil
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	return newTestCertWithNotBefore(t, name, parent, isCA, time.Now().Add(-time.Hour))
+}
+
+// newTestCertWithNotBefore creates a certificate like newTestCert that is valid from notBefore
+func newTestCertWithNotBefore(t *testing.T, name string, parent *testCert, isCA bool, notBefore time.Time) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(2 * time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key}
+}
+
+// encodeChain PEM encodes the certs in the given order
+func encodeChain(certs ...*testCert) []byte {
+	var out []byte
+	for _, c := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})...)
+	}
+	return out
+}
+
+func Test_orderChain(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	intermediate := newTestCert(t, "intermediate", root, true)
+	leaf := newTestCert(t, "leaf", intermediate, false)
+
+	leafFirst := encodeChain(leaf, intermediate, root)
+	rootFirst := encodeChain(root, intermediate, leaf)
+
+	tests := []struct {
+		name    string
+		chain   []byte
+		order   cachev1alpha1.ChainOrder
+		want    []byte
+		wantErr bool
+	}{
+		{"leaf-first from leaf-first", leafFirst, cachev1alpha1.ChainOrderLeafFirst, leafFirst, false},
+		{"root-first from leaf-first", leafFirst, cachev1alpha1.ChainOrderRootFirst, rootFirst, false},
+		{"leaf-first from root-first", rootFirst, cachev1alpha1.ChainOrderLeafFirst, leafFirst, false},
+		{"leaf-first from shuffled", encodeChain(intermediate, leaf, root), cachev1alpha1.ChainOrderLeafFirst, leafFirst, false},
+		{"root-first without the root", encodeChain(leaf, intermediate), cachev1alpha1.ChainOrderRootFirst, encodeChain(intermediate, leaf), false},
+		{"single cert", encodeChain(leaf), cachev1alpha1.ChainOrderRootFirst, encodeChain(leaf), false},
+		{"empty chain", nil, cachev1alpha1.ChainOrderLeafFirst, nil, true},
+		{"not pem", []byte("not a certificate"), cachev1alpha1.ChainOrderLeafFirst, nil, true},
+		{"trailing garbage", append(encodeChain(leaf), []byte("garbage")...), cachev1alpha1.ChainOrderLeafFirst, nil, true},
+		{"wrong block type", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}), cachev1alpha1.ChainOrderLeafFirst, nil, true},
+		{"bad certificate bytes", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("cert")}), cachev1alpha1.ChainOrderLeafFirst, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderChain(nil, tt.chain, tt.order)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("orderChain() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != string(tt.want) {
+				t.Errorf("orderChain() returned an unexpected chain")
+			}
+		})
+	}
+}
+
+func Test_genSecretForSyncChainOrder(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	leaf := newTestCert(t, "leaf", root, false)
+
+	cachedCert := &cachev1alpha1.CachedCertificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "testing"},
+		Spec: cachev1alpha1.CachedCertificateSpec{
+			SecretName: "test",
+			ChainOrder: cachev1alpha1.ChainOrderRootFirst,
+		},
+	}
+	upstreamCert := &unstructured.Unstructured{}
+	upstreamCert.SetName("upstream")
+
+	upstreamChain := encodeChain(leaf, root)
+	upstreamSecret := &v1.Secret{
+		Data: map[string][]byte{
+			"tls.crt": upstreamChain,
+			"tls.key": []byte("key"),
+		},
+	}
+
+	secret, err := genSecretForSync(cachedCert, upstreamCert, upstreamSecret, ownerReference(cachedCert, true), nil)
+	if err != nil {
+		t.Fatalf("genSecretForSync(, nil) error = %v", err)
+	}
+
+	if diff := deep.Equal(secret.Data, map[string][]byte{
+		"tls.crt": encodeChain(root, leaf),
+		"tls.key": []byte("key"),
+	}); diff != nil {
+		t.Errorf("genSecretForSync(, nil) diff %v", diff)
+	}
+
+	if string(upstreamSecret.Data["tls.crt"]) != string(upstreamChain) {
+		t.Error("genSecretForSync(, nil) modified the upstream secret")
+	}
+
+	upstreamSecret.Data["tls.crt"] = []byte("not a certificate")
+	if _, err := genSecretForSync(cachedCert, upstreamCert, upstreamSecret, ownerReference(cachedCert, true), nil); err == nil {
+		t.Error("genSecretForSync(, nil) expected an error for a malformed chain")
+	}
+}
+
+func Test_genSecretForSyncValidity(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	leaf := newTestCertWithNotBefore(t, "leaf", root, false, time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC))
+
+	cachedCert := &cachev1alpha1.CachedCertificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "testing"},
+		Spec:       cachev1alpha1.CachedCertificateSpec{SecretName: "test"},
+	}
+	issued := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{"notBefore": "2021-10-01T00:00:00Z", "notAfter": "2021-12-30T00:00:00Z"},
+	}}
+
+	tests := []struct {
+		name          string
+		chain         []byte
+		upstreamCert  *unstructured.Unstructured
+		wantNotBefore string
+		wantNotAfter  string
+	}{
+		{
+			"parsed from the leaf",
+			encodeChain(root, leaf),
+			issued,
+			"2021-11-01T12:00:00Z",
+			"2021-11-01T14:00:00Z",
+		},
+		{
+			"upstream status when the chain can't be parsed",
+			[]byte("not a certificate"),
+			issued,
+			"2021-10-01T00:00:00Z",
+			"2021-12-30T00:00:00Z",
+		},
+		{
+			"omitted when neither is known",
+			[]byte("not a certificate"),
+			&unstructured.Unstructured{Object: map[string]interface{}{}},
+			"",
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// stale values copied from the upstream secret must not survive
+			upstreamSecret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{NotBeforeAnnotationKey: "stale", NotAfterAnnotationKey: "stale"}},
+				Data:       map[string][]byte{"tls.crt": tt.chain, "tls.key": []byte("key")},
+			}
+
+			got, err := genSecretForSync(cachedCert, tt.upstreamCert, upstreamSecret, ownerReference(cachedCert, true), nil)
+			if err != nil {
+				t.Fatalf("genSecretForSync(, nil) error = %v", err)
+			}
+			if notBefore, found := got.Annotations[NotBeforeAnnotationKey]; notBefore != tt.wantNotBefore || found != (tt.wantNotBefore != "") {
+				t.Errorf("genSecretForSync(, nil) not before = %q (found %v), want %q", notBefore, found, tt.wantNotBefore)
+			}
+			if notAfter, found := got.Annotations[NotAfterAnnotationKey]; notAfter != tt.wantNotAfter || found != (tt.wantNotAfter != "") {
+				t.Errorf("genSecretForSync(, nil) not after = %q (found %v), want %q", notAfter, found, tt.wantNotAfter)
+			}
+		})
+	}
+}
+
+// encodeKey PEM encodes the private key of the cert
+func encodeKey(t *testing.T, c *testCert) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func Test_verifyKeyPair(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	leaf := newTestCert(t, "leaf", root, false)
+	other := newTestCert(t, "other", root, false)
+
+	tests := []struct {
+		name    string
+		chain   []byte
+		key     []byte
+		wantErr bool
+	}{
+		{"matching", encodeChain(leaf, root), encodeKey(t, leaf), false},
+		{"matching root first", encodeChain(root, leaf), encodeKey(t, leaf), false},
+		{"key of another certificate", encodeChain(leaf, root), encodeKey(t, other), true},
+		{"key of the issuer", encodeChain(leaf, root), encodeKey(t, root), true},
+		{"corrupt key", encodeChain(leaf, root), []byte("not a key"), true},
+		{"corrupt chain", []byte("not a certificate"), encodeKey(t, leaf), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyKeyPair(nil, tt.chain, tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("verifyKeyPair() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_missingDNSNames(t *testing.T) {
+	// issued through testutil since newTestCert doesn't set SANs
+	issued := func(dnsNames ...interface{}) []byte {
+		t.Helper()
+		upstreamCert := newUpstreamCertificate()
+		upstreamCert.SetName("sans")
+		if err := unstructured.SetNestedField(upstreamCert.Object, "sans", "spec", "secretName"); err != nil {
+			t.Fatal(err)
+		}
+		if err := unstructured.SetNestedSlice(upstreamCert.Object, dnsNames, "spec", "dnsNames"); err != nil {
+			t.Fatal(err)
+		}
+		secret, err := testutil.NewCertificateSecret(upstreamCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secret.Data["tls.crt"]
+	}
+
+	tests := []struct {
+		name     string
+		chain    []byte
+		dnsNames []string
+		want     []string
+		wantErr  bool
+	}{
+		{"all covered", issued("a.example.com", "b.example.com"), []string{"b.example.com", "a.example.com"}, nil, false},
+		{"one missing", issued("a.example.com"), []string{"a.example.com", "b.example.com"}, []string{"b.example.com"}, false},
+		{"case and trailing dot", issued("A.example.com"), []string{"a.example.com."}, nil, false},
+		{"covered by a wildcard", issued("*.example.com"), []string{"a.example.com"}, nil, false},
+		{"wildcard not covered by a name", issued("a.example.com"), []string{"*.example.com"}, []string{"*.example.com"}, false},
+		{"wildcard doesn't cover the apex", issued("*.example.com"), []string{"example.com"}, []string{"example.com"}, false},
+		{"corrupt chain", []byte("not a certificate"), []string{"a.example.com"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := missingDNSNames(nil, tt.chain, tt.dnsNames)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("missingDNSNames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Errorf("missingDNSNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"crypto/x509"
+	"sync"
+)
+
+// ParsedChainCache keeps the certificates parsed from the most recently used PEM chains keyed by the sha256 of the chain, so
+// reconciling an unchanged secret doesn't parse tls.crt again for every check. Renewed content hashes to another key so it
+// is always parsed, the entry for the replaced content is evicted once enough newer chains were used
+// A nil cache parses every time. It is safe for concurrent use
+type ParsedChainCache struct {
+	// Size is how many chains are kept
+	Size int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     list.List
+}
+
+// parsedChainEntry is a cached parse, the value of the lru elements
+type parsedChainEntry struct {
+	sum   [sha256.Size]byte
+	certs []*x509.Certificate
+}
+
+// NewParsedChainCache returns an empty cache keeping size chains
+func NewParsedChainCache(size int) *ParsedChainCache {
+	return &ParsedChainCache{Size: size}
+}
+
+// parse returns the certificates in the PEM chain, reusing an earlier parse of the same content. Errors aren't cached
+func (c *ParsedChainCache) parse(chain []byte) ([]*x509.Certificate, error) {
+	if c == nil || c.Size <= 0 {
+		return decodeChain(chain)
+	}
+
+	sum := sha256.Sum256(chain)
+	if certs, ok := c.lookup(sum); ok {
+		return certs, nil
+	}
+
+	certs, err := decodeChain(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[sum]; !ok {
+		if c.entries == nil {
+			c.entries = map[[sha256.Size]byte]*list.Element{}
+		}
+		c.entries[sum] = c.lru.PushFront(&parsedChainEntry{sum: sum, certs: certs})
+		c.trim()
+	}
+
+	// callers reorder the slice they get back, e.g. orderChain
+	return append([]*x509.Certificate(nil), certs...), nil
+}
+
+// lookup returns a copy of the cached certificates and marks them as recently used
+func (c *ParsedChainCache) lookup(sum [sha256.Size]byte) ([]*x509.Certificate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[sum]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return append([]*x509.Certificate(nil), elem.Value.(*parsedChainEntry).certs...), true
+}
+
+// trim evicts the least recently used chains over the size. c.mu must be held
+func (c *ParsedChainCache) trim() {
+	for c.lru.Len() > c.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*parsedChainEntry).sum)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func Test_parsedChainCache(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	first := encodeChain(newTestCert(t, "first", root, false), root)
+	renewed := encodeChain(newTestCert(t, "renewed", root, false), root)
+
+	c := NewParsedChainCache(1)
+	parsed, err := c.parse(first)
+	if err != nil {
+		t.Fatalf("parse() unexpected err %v", err)
+	}
+
+	// the same content is reused, the certificates aren't parsed again
+	again, err := c.parse(first)
+	if err != nil {
+		t.Fatalf("parse() unexpected err %v", err)
+	}
+	if again[0] != parsed[0] || again[1] != parsed[1] {
+		t.Errorf("parse() parsed unchanged content again")
+	}
+
+	// reordering the result doesn't change the cached parse
+	again[0], again[1] = again[1], again[0]
+	if cached, _ := c.parse(first); cached[0] != parsed[0] {
+		t.Errorf("parse() returned the reordered certificates")
+	}
+
+	// renewed content is parsed and replaces the previous entry
+	got, err := c.parse(renewed)
+	if err != nil {
+		t.Fatalf("parse() unexpected err %v", err)
+	}
+	if got[0].Subject.CommonName != "renewed" {
+		t.Errorf("parse() leaf = %v for renewed content, want renewed", got[0].Subject.CommonName)
+	}
+	if reparsed, _ := c.parse(first); reparsed[0] == parsed[0] {
+		t.Errorf("parse() reused an evicted parse")
+	}
+
+	// errors aren't cached
+	if _, err = c.parse([]byte("not pem")); err == nil {
+		t.Errorf("parse() expected an error for invalid content")
+	}
+	if len(c.entries) != 1 || c.lru.Len() != 1 {
+		t.Errorf("parse() kept %d entries, want 1", len(c.entries))
+	}
+
+	// a nil cache parses every time
+	var disabled *ParsedChainCache
+	uncached, _ := disabled.parse(first)
+	if reparsed, _ := disabled.parse(first); reparsed[0] == uncached[0] {
+		t.Errorf("parse() reused a parse without a cache")
+	}
+}
+
+func Test_ReconcileParsedChainCache(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("parsed", "parsed.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace:   "cache",
+		VerifyKeyPair:    true,
+		ParsedChainCache: NewParsedChainCache(4),
+		Client:           newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "parsed", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-parsed.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	// the key pair check and the validity annotations parse the same upstream tls.crt
+	if got := r.ParsedChainCache.lru.Len(); got != 1 {
+		t.Errorf("ParsedChainCache kept %d chains, want the upstream chain once", got)
+	}
+}
+
+func Benchmark_parseChain(b *testing.B) {
+	upstreamCert := newUpstreamCertificate()
+	upstreamCert.SetName("cc-bench.example.com")
+	upstreamCert.SetNamespace("cache")
+	_ = unstructured.SetNestedField(upstreamCert.Object, "cc-bench.example.com", "spec", "secretName")
+	_ = unstructured.SetNestedStringSlice(upstreamCert.Object, []string{"bench.example.com"}, "spec", "dnsNames")
+	secret, err := testutil.NewCertificateSecret(upstreamCert)
+	if err != nil {
+		b.Fatal(err)
+	}
+	chain := secret.Data["tls.crt"]
+
+	benchmarks := []struct {
+		name  string
+		cache *ParsedChainCache
+	}{
+		{"uncached", nil},
+		{"cached", NewParsedChainCache(16)},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			// every iteration stands for another reconcile of the same secret
+			for i := 0; i < b.N; i++ {
+				if _, err := bm.cache.parse(chain); err != nil {
+					b.Fatalf("parse() unexpected err %v", err)
+				}
+			}
+		})
+	}
+}
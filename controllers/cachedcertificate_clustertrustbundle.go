@@ -0,0 +1,112 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newClusterTrustBundle returns an empty ClusterTrustBundle, the api is alpha so there are no typed objects for it
+func newClusterTrustBundle() *unstructured.Unstructured {
+	bundle := &unstructured.Unstructured{}
+	bundle.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "certificates.k8s.io",
+		Kind:    "ClusterTrustBundle",
+		Version: "v1alpha1",
+	})
+	return bundle
+}
+
+// exportClusterTrustBundle adds the certificates in caPEM to the ClusterTrustBundle named ClusterTrustBundleName, creating
+// it when missing. CAs are only ever added so certificates issued before a CA rotation stay trusted
+func (r *CachedCertificateReconciler) exportClusterTrustBundle(ctx context.Context, reqLog logr.Logger, caPEM []byte) error {
+	if len(bytes.TrimSpace(caPEM)) == 0 {
+		return nil
+	}
+
+	bundle := newClusterTrustBundle()
+	err := r.Get(ctx, types.NamespacedName{Name: r.ClusterTrustBundleName}, bundle)
+	if k8serr.IsNotFound(err) {
+		merged, _ := mergeCertificatePEM("", caPEM)
+		if merged == "" {
+			return nil
+		}
+		bundle = newClusterTrustBundle()
+		bundle.SetName(r.ClusterTrustBundleName)
+		bundle.SetLabels(map[string]string{SyncedLabelKey: "true"})
+		if err = unstructured.SetNestedField(bundle.Object, merged, "spec", "trustBundle"); err != nil {
+			return err
+		}
+		reqLog.Info("creating ClusterTrustBundle", "name", r.ClusterTrustBundleName)
+		return r.Create(ctx, bundle)
+	} else if err != nil {
+		reqLog.Error(err, "unexpected error getting ClusterTrustBundle")
+		return err
+	}
+
+	// refuse to update a bundle we didn't make
+	if _, ok := bundle.GetLabels()[SyncedLabelKey]; !ok {
+		return fmt.Errorf("refusing to update ClusterTrustBundle %s: %w", r.ClusterTrustBundleName, ErrSecretOwnershipConflict)
+	}
+
+	existing, _, _ := unstructured.NestedString(bundle.Object, "spec", "trustBundle")
+	merged, changed := mergeCertificatePEM(existing, caPEM)
+	if !changed {
+		return nil
+	}
+	if err = unstructured.SetNestedField(bundle.Object, merged, "spec", "trustBundle"); err != nil {
+		return err
+	}
+	reqLog.Info("adding CA to ClusterTrustBundle", "name", r.ClusterTrustBundleName)
+	return r.Update(ctx, bundle)
+}
+
+// mergeCertificatePEM appends the certificates in addPEM missing from bundlePEM, changed is false when all were already there
+// Blocks that aren't certificates are dropped since the api server rejects bundles holding anything else
+func mergeCertificatePEM(bundlePEM string, addPEM []byte) (merged string, changed bool) {
+	var out []byte
+	seen := map[string]bool{}
+	add := func(rest []byte) bool {
+		added := false
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				return added
+			}
+			if block.Type != "CERTIFICATE" || seen[string(block.Bytes)] {
+				continue
+			}
+			seen[string(block.Bytes)] = true
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})...)
+			added = true
+		}
+	}
+
+	add([]byte(bundlePEM))
+	changed = add(addPEM)
+	return string(out), changed
+}
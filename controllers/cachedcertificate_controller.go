@@ -19,18 +19,33 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"text/template"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	v1 "k8s.io/api/core/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
 )
@@ -41,12 +56,225 @@ var (
 
 	// SourceAnnotationKey holds the namespace and name that matches the original source of the secret
 	SourceAnnotationKey = cachev1alpha1.GroupVersion.Group + "/source"
+
+	// ReferencedByAnnotationKey lists the CachedCertificates using an upstream Certificate
+	ReferencedByAnnotationKey = cachev1alpha1.GroupVersion.Group + "/referenced-by"
+
+	// OrphanedAtAnnotationKey marks an upstream Certificate without CachedCertificates using it, holding when that was first seen
+	OrphanedAtAnnotationKey = cachev1alpha1.GroupVersion.Group + "/orphaned-at"
+
+	// CopyOfLabelKey holds the uid of the CachedCertificate on copies of its target secret in other namespaces
+	// a label rather than the source annotation so the copies can be listed
+	CopyOfLabelKey = cachev1alpha1.GroupVersion.Group + "/copy-of"
+
+	// UpstreamAnnotationKey holds the namespace and name of the upstream Certificate the target secret was last synced from
+	UpstreamAnnotationKey = cachev1alpha1.GroupVersion.Group + "/upstream"
+
+	// RenewalTimeAnnotationKey holds the upstream Certificate's status.renewalTime so consumers can reload ahead of renewals
+	RenewalTimeAnnotationKey = cachev1alpha1.GroupVersion.Group + "/renewal-time"
+
+	// NotBeforeAnnotationKey holds when the synced leaf certificate becomes valid, so consumers don't have to parse the PEM
+	NotBeforeAnnotationKey = cachev1alpha1.GroupVersion.Group + "/not-before"
+
+	// NotAfterAnnotationKey holds when the synced leaf certificate expires
+	NotAfterAnnotationKey = cachev1alpha1.GroupVersion.Group + "/not-after"
+
+	// SecretProviderClassAnnotationKey asks for a secrets-store CSI driver SecretProviderClass pointing at the target secret
+	// when SecretProviderClassProvider is set. Its value names the SecretProviderClass, empty uses the target secret name
+	SecretProviderClassAnnotationKey = cachev1alpha1.GroupVersion.Group + "/secret-provider-class"
+
+	// UpstreamNameLabelKey holds the name of the upstream Certificate derived from a CachedCertificate's spec, so the
+	// CachedCertificates sharing an upstream can be selected. Names too long for a label value aren't labeled
+	UpstreamNameLabelKey = cachev1alpha1.GroupVersion.Group + "/upstream-name"
+
+	// ResyncAnnotationKey forces a CachedCertificate to re-read its upstream secret and re-write its target secret whenever
+	// its value changes, e.g. set it to the current time. The last value handled is kept in status.resyncNonce
+	ResyncAnnotationKey = cachev1alpha1.GroupVersion.Group + "/resync"
+)
+
+const (
+	// EventReasonRecovered is the reason of the event emitted when a CachedCertificate is synced after being in the Error state
+	EventReasonRecovered = "Recovered"
+
+	// upstreamRefNameIndexKey is used to index CachedCertificates by the name of their upstream Certificate
+	upstreamRefNameIndexKey = "status.upstreamRef.name"
+
+	// sourceIndexKey is used to index secrets by the CachedCertificate in their SourceAnnotationKey
+	sourceIndexKey = "metadata.annotations.source"
+
+	// defaultUpstreamPollInterval is used when UpstreamPollInterval isn't set
+	defaultUpstreamPollInterval = time.Hour
+
+	// minWaitBackoff is the first wait between checks for the upstream secret while it is being issued
+	minWaitBackoff = time.Second * 2
+
+	// waitForIssuancePoll is how often the upstream secret is checked during WaitForIssuance
+	waitForIssuancePoll = time.Millisecond * 250
+
+	// defaultCircuitBreakerCooldown is used when CircuitBreakerCooldown isn't set
+	defaultCircuitBreakerCooldown = time.Hour
+
+	// defaultQuotaExceededBackoff is used when QuotaExceededBackoff isn't set
+	defaultQuotaExceededBackoff = time.Minute * 5
+
+	// namespaceCopiesRequeueAfter is the wait between reconciles writing namespace copies NamespaceCopiesPerReconcile at a time
+	namespaceCopiesRequeueAfter = time.Second
+
+	// defaultMaxWaitBackoff is the longest wait between checks for the upstream secret unless MaxBackoffAnnotationKey is set
+	defaultMaxWaitBackoff = time.Minute
 )
 
 // CachedCertificateReconciler reconciles a CachedCertificate object
 type CachedCertificateReconciler struct {
 	CacheNamespace string
 
+	// WatchAllUpstreamSecretEvents disables the event filtering on the upstream secret watch, intended for debugging
+	WatchAllUpstreamSecretEvents bool
+
+	// WatchLabelSelector limits this instance to CachedCertificates with matching labels, nil matches everything
+	WatchLabelSelector labels.Selector
+
+	// WatchNamespaces limits this instance to CachedCertificates in these namespaces and the cache namespace, matching the
+	// cache from NewNamespacedCache so requests from other sources don't reach outside it. Empty watches every namespace
+	WatchNamespaces []string
+
+	// SharedUpstreamStrategy decides which CachedCertificates share an upstream Certificate, empty behaves as SharedUpstreamStrategyDNSOnly
+	SharedUpstreamStrategy SharedUpstreamStrategy
+
+	// UpstreamNaming decides how upstream Certificate names are built from dnsNames, empty behaves as UpstreamNamingJoined
+	// Changing it moves CachedCertificates with several dnsNames to new upstreams, which are issued again
+	UpstreamNaming UpstreamNamingStrategy
+
+	// DisambiguateWildcardNames adds a marker to upstream names with a hashed wildcard so they can't collide with literal dns names
+	// It changes the name of every wildcard upstream, so it is off by default to keep existing upstreams
+	DisambiguateWildcardNames bool
+
+	// UpstreamNameFunc overrides the name of the upstream Certificate a CachedCertificate uses, e.g. to follow an existing naming
+	// convention or force sharing. CachedCertificates given the same name share an upstream. Upstreams are never changed in place,
+	// so the name has to change along with the dnsNames, commonName and active issuer (status.issuerIndex). It is only called
+	// while there is no upstream in the status, changing it doesn't move existing CachedCertificates. nil or an empty name uses the default
+	UpstreamNameFunc func(cachedCert *cachev1alpha1.CachedCertificate) string
+
+	// ReKeyDebounce waits for the generation of a CachedCertificate to stay unchanged this long before moving it to a new
+	// upstream after a dnsNames or commonName change, so a burst of edits doesn't issue an upstream for every intermediate
+	// spec. The target secret keeps the previous certificate meanwhile. Zero moves right away
+	ReKeyDebounce time.Duration
+
+	// IssuerFallbackTimeout is how long to wait for an upstream to be ready before moving on to the next issuer in IssuerRefs, zero disables fallback
+	IssuerFallbackTimeout time.Duration
+
+	// CircuitBreakerThreshold is how many failed issuance attempts in a row, as counted by cert-manager on the upstream
+	// Certificate, put a CachedCertificate in the Error state and stop new upstreams being created for it until
+	// CircuitBreakerCooldown is over, so dnsNames churn doesn't keep using up ACME quota on a broken issuer. Zero disables it
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerCooldown is how long an open circuit breaker waits before trying again, zero uses an hour
+	CircuitBreakerCooldown time.Duration
+
+	// Validator rejects invalid CachedCertificates at reconcile time for resources the webhook didn't see, nil skips validation
+	Validator *cachev1alpha1.CachedCertificateValidator
+
+	// ResyncEvents enqueues CachedCertificates on demand, see ResyncHandler. nil disables on demand resyncs
+	ResyncEvents <-chan event.GenericEvent
+
+	// NonBlockingOwnerReferences sets blockOwnerDeletion=false on the owner references of synced objects
+	// to avoid foreground deletion of a CachedCertificate waiting on them
+	NonBlockingOwnerReferences bool
+
+	// FieldManager writes target secrets with server-side apply under this field manager, so fields set by others
+	// such as extra labels, annotations or data keys are kept. Empty falls back to create and update
+	FieldManager string
+
+	// CertificateNameAnnotation is the annotation cert-manager sets on secrets pointing at their Certificate
+	// Empty uses CertificateNameAnnotationKey, this only needs changing for forks of cert-manager
+	CertificateNameAnnotation string
+
+	// UpstreamPollInterval is how often CachedCertificates using UpstreamSecretSyncPoll re-sync, zero uses an hour
+	UpstreamPollInterval time.Duration
+
+	// QuotaExceededBackoff is how long to wait before writing the target secret again after a ResourceQuota in its namespace
+	// refused it. The CachedCertificate reports the QuotaExceeded reason meanwhile. Zero uses five minutes
+	QuotaExceededBackoff time.Duration
+
+	// WaitForIssuance keeps a reconcile polling for the upstream secret for up to this long before requeueing,
+	// so a fresh CachedCertificate syncs as soon as it is issued. Intended for CI, zero disables the wait
+	WaitForIssuance time.Duration
+
+	// AuditLog gets a line for every write creating a target secret or changing its data, nil disables the audit log
+	AuditLog logr.Logger
+
+	// UpstreamReader reads upstream Certificates and their secrets when they live in another cluster that can only be read
+	// from here, e.g. the hub of a hub and spoke setup. Upstreams are then managed in that cluster: missing ones aren't
+	// created, references aren't recorded on them and there's nothing to watch, so synced CachedCertificates re-sync every
+	// UpstreamPollInterval. Nil reads and manages upstreams through Client
+	UpstreamReader client.Reader
+
+	// NamespaceReader reads the Namespace of a CachedCertificate before syncing to skip writes while it is terminating
+	// nil uses the Client, which caches Namespaces cluster wide
+	NamespaceReader client.Reader
+
+	// WatchIssuers reconciles the CachedCertificates referencing a cert-manager Issuer or ClusterIssuer when it becomes ready
+	// so they don't wait for their next requeue. It needs the cert-manager issuer CRDs installed
+	WatchIssuers bool
+
+	// UpstreamSecretCache reuses upstream secret reads across CachedCertificates sharing an upstream, nil reads every time
+	UpstreamSecretCache *UpstreamSecretCache
+
+	// ParsedChainCache reuses the certificates parsed from unchanged tls.crt chains across reconciles, nil parses every time
+	ParsedChainCache *ParsedChainCache
+
+	// NamespaceCopies copies target secrets into the namespaces matching a CachedCertificate's SecretNamespaceSelector
+	// and watches namespaces to add and remove copies. It needs the cluster wide cache, the selector is ignored when false
+	NamespaceCopies bool
+
+	// NamespaceCopiesPerReconcile is the most namespaces a reconcile writes or removes copies in, so a selector matching
+	// many namespaces doesn't burst writes to the api server. The rest are written on the following reconciles, resuming
+	// from status.syncedNamespaces. Zero writes every namespace in one reconcile
+	NamespaceCopiesPerReconcile int
+
+	// VerifyKeyPair checks tls.key belongs to the certificate in tls.crt before every sync, so a corrupt upstream secret
+	// isn't synced. It parses both keys on every sync so it is off by default
+	VerifyKeyPair bool
+
+	// VerifyDNSNames checks the certificate in tls.crt covers every dnsName before every sync, so an issuer leaving names
+	// out of the certificate isn't synced. It parses the chain on every sync so it is off by default
+	VerifyDNSNames bool
+
+	// DefaultSecretNameTemplate renders the secretName of CachedCertificates that don't set one, see ParseSecretNameTemplate
+	// nil defaults secretName to the CachedCertificate name
+	DefaultSecretNameTemplate *template.Template
+
+	// UpstreamSecretNameTemplate renders the secretName of new upstream Certificates from their name, for secret naming
+	// conventions in the cache namespace. Existing upstreams keep their secretName. Nil uses the upstream name
+	UpstreamSecretNameTemplate *template.Template
+
+	// SecretProviderClassProvider is the secrets-store CSI driver provider set on the SecretProviderClasses generated for
+	// CachedCertificates annotated with SecretProviderClassAnnotationKey. Empty disables generating them
+	SecretProviderClassProvider string
+
+	// ClusterTrustBundleName adds the ca.crt of every synced upstream secret to a ClusterTrustBundle of this name, so
+	// workloads can trust the issuers through the native trust distribution. The api is alpha, empty disables it
+	ClusterTrustBundleName string
+
+	// Recorder emits events on CachedCertificates, nil disables events
+	Recorder record.EventRecorder
+
+	// TracerProvider creates the reconcile spans, nil uses the otel global provider
+	TracerProvider trace.TracerProvider
+
+	// IssuanceLatency observes how long upstream Certificates took to get their secret, from IssuanceStartTime to the secret
+	// first being seen, labeled by issuer kind. Upstreams that were already issued aren't observed. Nil disables it
+	IssuanceLatency *prometheus.HistogramVec
+
+	// Clock is used to time issuance, nil uses the real clock
+	Clock clock.Clock
+
+	// rekeys tracks CachedCertificates waiting out ReKeyDebounce
+	rekeys rekeyDebouncer
+
+	// breaker tracks failed issuance for CircuitBreakerThreshold
+	breaker issuanceBreaker
+
 	client.Client
 	Scheme *runtime.Scheme
 }
@@ -56,11 +284,32 @@ type CachedCertificateReconciler struct {
 //+kubebuilder:rbac:groups=cache.weavelab.xyz,resources=cachedcertificates/finalizers,verbs=update
 
 //+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=issuers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cert-manager.io,resources=clusterissuers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=certificates.k8s.io,resources=clustertrustbundles,verbs=get;create;update
+//+kubebuilder:rbac:groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasses,verbs=get;create;update
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *CachedCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if !r.inWatchedNamespace(req.Namespace) {
+		// the namespaced cache can't read it and the operator may not have access to the namespace at all
+		return ctrl.Result{}, nil
+	}
+
+	ctx = context.WithValue(ctx, spanKeyContextKey{}, req.NamespacedName)
+	ctx, span := r.startSpan(ctx, "Reconcile")
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+// reconcile does the work of Reconcile within its span
+func (r *CachedCertificateReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	reqLog := log.FromContext(ctx)
 
 	cachedCert := &cachev1alpha1.CachedCertificate{}
@@ -68,35 +317,124 @@ func (r *CachedCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	switch {
 	case k8serr.IsNotFound(err):
 		// nothing to do so exit with requeue and no err
+		r.rekeys.forget(req.NamespacedName)
+		r.breaker.forget(req.NamespacedName)
 		return ctrl.Result{}, nil
 	case err != nil:
 		return ctrl.Result{}, err
 	}
 
-	// default secretName to match the resource name
-	if cachedCert.Spec.SecretName == "" {
-		cachedCert.Spec.SecretName = cachedCert.GetName()
+	if !r.watches(cachedCert) {
+		// handled by another instance of the operator
+		return ctrl.Result{}, nil
+	}
+
+	// the state as of the last reconcile, the status is changed in memory as the reconcile goes on
+	previousState := cachedCert.Status.State
+
+	// merge in dns names from a ConfigMap before validating so the combined set is checked
+	if err := r.resolveDNSNames(ctx, cachedCert); errors.Is(err, errDNSNamesFromInvalid) {
+		// nothing is issued or synced until the ConfigMap is fixed, which triggers a new reconcile
+		return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonDNSNamesFromInvalid, err.Error())
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// blank names would otherwise make a malformed upstream, the CRD only guards against an empty list
+	cachedCert.Spec.DNSNames = normalizeDNSNames(cachedCert.Spec.DNSNames)
+	if len(cachedCert.Spec.DNSNames) == 0 {
+		return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonInvalidSpec, "no dnsNames left after removing blank and duplicate names")
+	}
+	// written with the next status update so users can see what the upstream name was derived from
+	cachedCert.Status.EffectiveDNSNames = append([]string{}, cachedCert.Spec.DNSNames...)
+
+	if r.Validator != nil {
+		if errs := r.Validator.Validate(cachedCert); len(errs) > 0 {
+			// nothing is issued or synced until the spec is fixed, which triggers a new reconcile
+			return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonInvalidSpec, errs.ToAggregate().Error())
+		}
+	}
+
+	// default secretName from the template or to match the resource name
+	secretName, err := targetSecretName(r.DefaultSecretNameTemplate, cachedCert)
+	if err != nil {
+		return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonInvalidSpec, err.Error())
+	}
+	cachedCert.Spec.SecretName = secretName
+
+	// labeled before the up to date check so CachedCertificates synced before the label existed get it too
+	if err = r.labelUpstreamName(ctx, cachedCert); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if r.upToDate(ctx, cachedCert) {
+		// nothing that could change the target secret happened since the last sync
+		reqLog.V(1).Info("spec unchanged and target secret fresh, skipping sync")
+		return ctrl.Result{}, nil
+	}
+
+	if ref := cachedCert.Status.UpstreamRef; ref != nil && ref.Namespace != r.CacheNamespace {
+		// the cache namespace changed since the upstream was made, move over to an upstream in the new namespace
+		// the old upstream is left in place like any other unused upstream
+		reqLog.Info("cache namespace changed, migrating upstream Certificate", "previousNamespace", ref.Namespace, "upstream", ref.Name)
+		setState(&cachedCert.Status, cachev1alpha1.CachedCertificateStatePending)
+		cachedCert.Status.UpstreamReady = false
+		cachedCert.Status.UpstreamRef = nil
+		cachedCert.Status.IssuanceStartTime = nil
 	}
 
 	if cachedCert.Status.UpstreamRef == nil {
 		// speculatively set the upstream if it's not already set
 		cachedCert.Status.UpstreamRef = &cachev1alpha1.ObjectReference{
-			Name:      getUpstreamCertificateName(cachedCert.Spec.DNSNames...),
+			Name:      r.upstreamCertificateName(cachedCert),
 			Namespace: r.CacheNamespace,
 		}
 	}
 
 	// try to get the upstream cert
 	upstreamCert, err := r.getUpstreamCertificate(ctx, cachedCert)
-	if k8serr.IsNotFound(err) {
+	if k8serr.IsNotFound(err) && r.UpstreamReader != nil {
+		// upstreams are created in the upstream cluster, keep checking until it shows up there
+		if readyReason(&cachedCert.Status) != cachev1alpha1.ReasonUpstreamNotFound || cachedCert.Status.IssuanceStartTime == nil {
+			reqLog.Info("upstream Certificate not found in the upstream cluster", "upstream", cachedCert.Status.UpstreamRef.Name)
+			setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStatePending, cachev1alpha1.ReasonUpstreamNotFound,
+				"upstream Certificate "+cachedCert.Status.UpstreamRef.Namespace+"/"+cachedCert.Status.UpstreamRef.Name+" not found in the upstream cluster")
+			cachedCert.Status.UpstreamReady = false
+			cachedCert.Status.InSync = false
+			if cachedCert.Status.IssuanceStartTime == nil {
+				now := metav1.NewTime(r.now())
+				cachedCert.Status.IssuanceStartTime = &now
+			}
+			if err = r.updateStatus(ctx, cachedCert); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{RequeueAfter: r.waitBackoff(reqLog, cachedCert)}, nil
+	} else if k8serr.IsNotFound(err) {
+		if wait := r.breakerWait(req.NamespacedName, nil); wait > 0 {
+			// don't issue again while the breaker is open, even after dnsNames changes or a manual delete
+			return r.breakerOpen(ctx, cachedCert, wait)
+		}
+
 		// create if not found
 		err = r.createUpstreamCertificate(ctx, cachedCert)
-		if err != nil {
+		if errors.Is(err, ErrUpstreamSecretNameTaken) {
+			// needs the other Certificate removed or a different template, the error is returned so the retry picks up a fix
+			setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
+			cachedCert.Status.InSync = false
+			if statusErr := r.updateStatus(ctx, cachedCert); statusErr != nil {
+				return ctrl.Result{}, statusErr
+			}
+			return ctrl.Result{}, err
+		} else if err != nil {
 			return ctrl.Result{}, err
 		}
 
 		// after upstream create, set the update the status and requeue the resource
-		err = r.Status().Update(ctx, cachedCert)
+		// issuance is timed from the create so IssuanceLatency covers all of it
+		now := metav1.NewTime(r.now())
+		cachedCert.Status.IssuanceStartTime = &now
+		err = r.updateStatus(ctx, cachedCert)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -107,54 +445,155 @@ func (r *CachedCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, err
 	}
 
-	upstreamDNSNames, found, err := unstructured.NestedStringSlice(upstreamCert.Object, "spec", "dnsNames")
-	if err != nil {
-		reqLog.Error(err, "upstream Certificate has bad dnsNames")
-		return ctrl.Result{}, err
+	upstreamDNSNames, err := checkUpstreamDNSNames(upstreamCert, cachedCert.Spec.DNSNames)
+	if err == nil {
+		err = checkUpstreamCommonName(upstreamCert, cachedCert.Spec.CommonName)
 	}
-
-	if !found {
-		reqLog.Error(err, "upstream Certificate has no dnsNames")
-		return ctrl.Result{}, err
+	if err == nil {
+		// checked after the names so a broken upstream the spec has moved away from is left behind instead of reported
+		err = checkUpstreamIssuerRef(upstreamCert)
 	}
+	if errors.Is(err, ErrUpstreamDNSMismatch) || errors.Is(err, ErrUpstreamCommonNameMismatch) {
+		if r.ReKeyDebounce > 0 {
+			if wait := r.rekeys.wait(req.NamespacedName, cachedCert.GetGeneration(), r.now(), r.ReKeyDebounce); wait > 0 {
+				// an edit during the wait starts it over, the previous certificate stays synced meanwhile
+				reqLog.V(1).Info("upstream Certificate differs from the spec, waiting for the spec to settle", "upstream", upstreamCert.GetName(), "wait", wait)
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+		}
+
+		if errors.Is(err, ErrUpstreamDNSMismatch) {
+			added, removed := diffDNSNames(upstreamDNSNames, cachedCert.Spec.DNSNames)
+			reqLog.V(1).Info("upstream Certificate dnsNames differ, moving to a new upstream", "upstream", upstreamCert.GetName(), "added", added, "removed", removed)
+		} else {
+			reqLog.V(1).Info("upstream Certificate commonName differs, moving to a new upstream", "upstream", upstreamCert.GetName(), "commonName", cachedCert.Spec.CommonName)
+		}
 
-	if !slicesEqualAfterSort(upstreamDNSNames, cachedCert.Spec.DNSNames) {
 		// set and go back through the system to issue / re-use as needed
-		cachedCert.Status.State = cachev1alpha1.CachedCertificateStatePending
+		setState(&cachedCert.Status, cachev1alpha1.CachedCertificateStatePending)
 		cachedCert.Status.UpstreamReady = false
 		cachedCert.Status.UpstreamRef = nil
 
-		err = r.Status().Update(ctx, cachedCert)
+		// new dnsNames start over with the primary issuer
+		cachedCert.Status.IssuerIndex = 0
+		cachedCert.Status.IssuanceStartTime = nil
+
+		err = r.updateStatus(ctx, cachedCert)
 		if err != nil {
 			return ctrl.Result{RequeueAfter: time.Second * 2}, err
 		}
 
+		// this CachedCertificate no longer uses the old upstream
+		if err = r.updateUpstreamReferences(ctx, cachedCert, upstreamCert, false); err != nil {
+			reqLog.Error(err, "unable to update references on previous upstream Certificate")
+		}
+
 		return ctrl.Result{}, nil
+	} else if err != nil {
+		// dnsNames or issuerRef missing or of the wrong type, the error is returned so the retry backoff picks up a fix
+		// since the upstream Certificate watch only passes deletes, secretName and issuer changes
+		reqLog.Error(err, "upstream Certificate is invalid", "upstream", upstreamCert.GetName())
+		setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
+		cachedCert.Status.UpstreamReady = false
+		cachedCert.Status.InSync = false
+		if statusErr := r.updateStatus(ctx, cachedCert); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{}, err
+	}
+
+	// a spec reverted during the debounce no longer needs to move
+	r.rekeys.forget(req.NamespacedName)
+
+	// keep track of who is using the upstream, this is informational only so failures do not stop the sync
+	if err = r.updateUpstreamReferences(ctx, cachedCert, upstreamCert, true); err != nil {
+		reqLog.Error(err, "unable to update references on upstream Certificate")
 	}
 
 	// TODO handle Changes in the cachedcert spec?
 	// TODO handle DIFFS in the CachedCertificate spec between CachedCertificates
 
+	if resyncRequested(cachedCert) {
+		// a cached read may be what the resync is meant to get past
+		reqLog.Info("resync requested", "nonce", cachedCert.GetAnnotations()[ResyncAnnotationKey])
+		if r.UpstreamSecretCache != nil {
+			r.UpstreamSecretCache.Forget(types.NamespacedName{Name: upstreamSecretName(upstreamCert), Namespace: upstreamCert.GetNamespace()})
+		}
+	}
+
 	// try to get the secret used from which we will sync
 	upstreamSecret, err := r.getUpstreamSecret(ctx, reqLog, upstreamCert)
+	if k8serr.IsNotFound(err) && r.WaitForIssuance > 0 {
+		upstreamSecret, err = r.waitForUpstreamSecret(ctx, reqLog, upstreamCert)
+	}
 	if k8serr.IsNotFound(err) {
+		if wait := r.breakerWait(req.NamespacedName, upstreamCert); wait > 0 {
+			// cert-manager keeps retrying the upstream on its own backoff, the upstream secret watch picks up a success
+			return r.breakerOpen(ctx, cachedCert, wait)
+		}
+
+		if r.issuanceTimedOut(cachedCert) {
+			// move on to the next issuer, the next reconcile creates its upstream
+			reqLog.Info("upstream Certificate not ready in time, falling back to the next issuer", "upstream", upstreamCert.GetName())
+			setState(&cachedCert.Status, cachev1alpha1.CachedCertificateStatePending)
+			cachedCert.Status.UpstreamReady = false
+			cachedCert.Status.UpstreamRef = nil
+			cachedCert.Status.IssuerIndex++
+			cachedCert.Status.IssuanceStartTime = nil
+
+			err = r.updateStatus(ctx, cachedCert)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+
+			if err = r.updateUpstreamReferences(ctx, cachedCert, upstreamCert, false); err != nil {
+				reqLog.Error(err, "unable to update references on previous upstream Certificate")
+			}
+
+			return ctrl.Result{Requeue: true}, nil
+		}
+
+		if r.issuanceExpired(cachedCert) {
+			// give up until the upstream secret shows up, the upstream secret watch triggers the next reconcile
+			if cachedCert.Status.State != cachev1alpha1.CachedCertificateStateError {
+				reqLog.Info("upstream Certificate not ready within the issuance timeout", "upstream", upstreamCert.GetName())
+				setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, cachev1alpha1.ReasonIssuanceTimeout,
+					"upstream Certificate "+upstreamCert.GetName()+" not ready within "+cachedCert.Spec.IssuanceTimeout.Duration.String())
+				cachedCert.Status.UpstreamReady = false
+				cachedCert.Status.InSync = false
+				if err = r.updateStatus(ctx, cachedCert); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			return ctrl.Result{}, nil
+		}
+
 		// update status if required
-		if cachedCert.Status.State != cachev1alpha1.CachedCertificateStatePending || cachedCert.Status.UpstreamReady {
-			cachedCert.Status.State = cachev1alpha1.CachedCertificateStatePending
+		if cachedCert.Status.State != cachev1alpha1.CachedCertificateStatePending || cachedCert.Status.UpstreamReady || cachedCert.Status.InSync || cachedCert.Status.IssuanceStartTime == nil {
+			setState(&cachedCert.Status, cachev1alpha1.CachedCertificateStatePending)
 			cachedCert.Status.UpstreamReady = false
-			err = r.Status().Update(ctx, cachedCert)
+			cachedCert.Status.InSync = false
+			if cachedCert.Status.IssuanceStartTime == nil {
+				now := metav1.NewTime(r.now())
+				cachedCert.Status.IssuanceStartTime = &now
+			}
+			err = r.updateStatus(ctx, cachedCert)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
 		}
 
 		// requeue and wait for secret to be created
-		// TODO: exponential backoff
-		return ctrl.Result{Requeue: true, RequeueAfter: time.Second * 2}, nil
+		return ctrl.Result{Requeue: true, RequeueAfter: r.waitBackoff(reqLog, cachedCert)}, nil
+	} else if errors.Is(err, errUpstreamInvalid) {
+		// retrying won't help until the upstream is fixed, the upstream Certificate watch triggers the next reconcile
+		// only ever set ready along with another reason, so it is already false when the reason is reported
+		cachedCert.Status.UpstreamReady = false
+		return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonUpstreamInvalid, err.Error())
 	} else if err != nil {
-		cachedCert.Status.State = cachev1alpha1.CachedCertificateStateError
+		setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
 		cachedCert.Status.UpstreamReady = false
-		if statusErr := r.Status().Update(ctx, cachedCert); statusErr != nil {
+		if statusErr := r.updateStatus(ctx, cachedCert); statusErr != nil {
 			reqLog.Error(err, "unable to update status on CachedCertificate")
 			return ctrl.Result{}, statusErr
 		}
@@ -162,29 +601,136 @@ func (r *CachedCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	}
 
 	// secret found, upstream is "ready"
+	r.breaker.forget(req.NamespacedName)
+
 	// update status if required
-	if !cachedCert.Status.UpstreamReady {
+	if !cachedCert.Status.UpstreamReady || cachedCert.Status.IssuanceStartTime != nil {
+		issuanceStart := cachedCert.Status.IssuanceStartTime
 		cachedCert.Status.UpstreamReady = true
-		err = r.Status().Update(ctx, cachedCert)
+		cachedCert.Status.IssuanceStartTime = nil
+		err = r.updateStatus(ctx, cachedCert)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
+		// only after the start time is cleared so a failed status write isn't observed twice
+		r.observeIssuanceLatency(cachedCert, issuanceStart)
+	}
+
+	if r.namespaceTerminating(ctx, reqLog, cachedCert.GetNamespace()) {
+		// creates are refused in a terminating namespace and everything in it is about to be deleted anyway
+		if readyReason(&cachedCert.Status) != cachev1alpha1.ReasonNamespaceTerminating {
+			reqLog.Info("namespace is terminating, skipping sync")
+			setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStatePending, cachev1alpha1.ReasonNamespaceTerminating, "namespace "+cachedCert.GetNamespace()+" is terminating")
+			cachedCert.Status.InSync = false
+			if err = r.updateStatus(ctx, cachedCert); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
 	}
 
-	// get and validate upstream secret
-	secret, err := genSecretForSync(cachedCert, upstreamCert, upstreamSecret)
+	owner, err := r.secretOwnerReference(ctx, cachedCert)
 	if err != nil {
-		return ctrl.Result{RequeueAfter: time.Second * 3}, err
+		setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
+		cachedCert.Status.InSync = false
+		if statusErr := r.updateStatus(ctx, cachedCert); statusErr != nil {
+			reqLog.Error(err, "unable to update status on CachedCertificate")
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{}, err
 	}
 
-	if err = validateSecret(secret); err != nil {
+	// generate the target secret, this fails when it's missing any of the expected keys
+	secret, err := genSecretForSync(cachedCert, upstreamCert, upstreamSecret, owner, r.ParsedChainCache)
+	if err != nil {
 		return ctrl.Result{RequeueAfter: time.Second * 3}, err
 	}
+	if cachedCert.Spec.TrustBundleFrom != nil {
+		extraCAs, err := r.resolveTrustBundle(ctx, reqLog, cachedCert)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		// bundled from the upstream ca.crt so omitCA or keys leaving it out of the secret don't empty the bundle
+		addTrustBundle(secret, upstreamSecret.Data["ca.crt"], extraCAs)
+	}
 
-	err = r.upsertTargetSecret(ctx, reqLog, secret)
-	if err != nil {
-		cachedCert.Status.State = cachev1alpha1.CachedCertificateStateError
-		err = r.Status().Update(ctx, cachedCert)
+	// checked once the secret is fully assembled, the api server would reject it anyway and retrying won't shrink it
+	if err := checkSecretSize(secret); err != nil {
+		return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonSecretTooLarge, err.Error())
+	}
+
+	if len(cachedCert.Spec.RequiredUsages) > 0 {
+		// an issuer dropping usages won't fix itself, the next renewal of the upstream secret triggers a re-check
+		msg := ""
+		// checked on the upstream secret since Keys may leave tls.crt out of the target secret
+		missing, err := missingUsages(r.ParsedChainCache, upstreamSecret.Data["tls.crt"], cachedCert.Spec.RequiredUsages)
+		if err != nil {
+			msg = "unable to check usages: " + err.Error()
+		} else if len(missing) > 0 {
+			msg = fmt.Sprintf("upstream Certificate %s was issued without usages %q", upstreamCert.GetName(), missing)
+		}
+
+		if msg != "" {
+			return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonUsagesMissing, msg)
+		}
+	}
+
+	if r.VerifyKeyPair {
+		// a corrupt upstream secret won't fix itself, re-issuing it triggers a re-check through the upstream secret watch
+		// checked on the upstream secret since Keys may leave either key out of the target secret
+		if err := verifyKeyPair(r.ParsedChainCache, upstreamSecret.Data["tls.crt"], upstreamSecret.Data["tls.key"]); err != nil {
+			return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonKeyPairMismatch,
+				"upstream secret "+upstreamSecret.GetName()+" failed key pair verification: "+err.Error())
+		}
+	}
+
+	if r.VerifyDNSNames {
+		// the Certificate spec already matched the dnsNames, so this is the issuer misbehaving and re-issuing triggers a re-check
+		// checked on the upstream secret since Keys may leave tls.crt out of the target secret
+		msg := ""
+		missing, err := missingDNSNames(r.ParsedChainCache, upstreamSecret.Data["tls.crt"], cachedCert.Spec.DNSNames)
+		if err != nil {
+			msg = "unable to check dnsNames: " + err.Error()
+		} else if len(missing) > 0 {
+			msg = fmt.Sprintf("upstream Certificate %s was issued without dnsNames %q", upstreamCert.GetName(), missing)
+		}
+
+		if msg != "" {
+			return r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonDNSNamesMissing, msg)
+		}
+	}
+
+	if cachedCert.Spec.SyncPaused {
+		// the upstream is ready but the target secret is left alone until the sync is unpaused
+		inSync, err := r.targetSecretInSync(ctx, secret)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if cachedCert.Status.State != cachev1alpha1.CachedCertificateStateSyncPaused || cachedCert.Status.InSync != inSync {
+			setState(&cachedCert.Status, cachev1alpha1.CachedCertificateStateSyncPaused)
+			cachedCert.Status.InSync = inSync
+			err = r.updateStatus(ctx, cachedCert)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
+		return r.syncedResult(cachedCert), nil
+	}
+
+	inSync, err := r.upsertTargetSecret(ctx, reqLog, secret, mappedKey(cachedCert.Spec.KeyMapping, "tls.crt"))
+	if isQuotaExceeded(err) {
+		// may clear once the quota is raised or other secrets are removed, nothing about the quota triggers a reconcile
+		// so retry on a fixed backoff rather than the rate limiter's quickly growing one
+		if result, err := r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonQuotaExceeded, err.Error()); err != nil {
+			return result, err
+		}
+		return ctrl.Result{RequeueAfter: r.quotaExceededBackoff()}, nil
+	} else if err != nil {
+		setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
+		cachedCert.Status.InSync = false
+		err = r.updateStatus(ctx, cachedCert)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -192,32 +738,358 @@ func (r *CachedCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, err
 	}
 
+	// only publish what was actually synced so the ConfigMap never rolls back either
+	if cachedCert.Spec.PublishCAConfigMap != "" && inSync {
+		if err = r.upsertConfigMap(ctx, reqLog, genConfigMapForSync(cachedCert, secret, !r.NonBlockingOwnerReferences)); err != nil {
+			setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
+			if statusErr := r.updateStatus(ctx, cachedCert); statusErr != nil {
+				reqLog.Error(err, "unable to update status on CachedCertificate")
+				return ctrl.Result{}, statusErr
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	// like the ConfigMap, only generated once the secret it points at is synced
+	if spcName, ok := secretProviderClassName(cachedCert); ok && r.SecretProviderClassProvider != "" && inSync {
+		spc := genSecretProviderClassForSync(cachedCert, secret, spcName, r.SecretProviderClassProvider, !r.NonBlockingOwnerReferences)
+		if err = r.upsertSecretProviderClass(ctx, reqLog, spc); err != nil {
+			setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
+			if statusErr := r.updateStatus(ctx, cachedCert); statusErr != nil {
+				reqLog.Error(err, "unable to update status on CachedCertificate")
+				return ctrl.Result{}, statusErr
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	// read from the upstream secret since omitCA or keys may leave ca.crt out of the target secret
+	if r.ClusterTrustBundleName != "" && inSync {
+		if err = r.exportClusterTrustBundle(ctx, reqLog, upstreamSecret.Data["ca.crt"]); err != nil {
+			setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
+			if statusErr := r.updateStatus(ctx, cachedCert); statusErr != nil {
+				reqLog.Error(err, "unable to update status on CachedCertificate")
+				return ctrl.Result{}, statusErr
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	// like the ConfigMap, copies only get what was actually synced
+	copiesDone := true
+	if !r.NamespaceCopies {
+		cachedCert.Status.ConflictingNamespaces = nil
+		cachedCert.Status.SyncedNamespaces = nil
+		cachedCert.Status.SyncedNamespacesHash = ""
+	} else if inSync {
+		copiesDone, err = r.syncNamespaceCopies(ctx, reqLog, cachedCert, secret)
+		if err != nil {
+			setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, errorReason(err), err.Error())
+			if statusErr := r.updateStatus(ctx, cachedCert); statusErr != nil {
+				reqLog.Error(err, "unable to update status on CachedCertificate")
+				return ctrl.Result{}, statusErr
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	// informational only like the upstream references, the previous list is kept when it can't be read
+	if inSync {
+		if namespaces, err := r.consumerNamespaces(ctx, cachedCert); err != nil {
+			reqLog.Error(err, "unable to list secrets synced from CachedCertificate")
+		} else {
+			cachedCert.Status.ConsumerNamespaces = namespaces
+		}
+	}
+
 	// set status on cachedcertificate resource
-	cachedCert.Status.State = cachev1alpha1.CachedCertificateStateSynced
-	err = r.Status().Update(ctx, cachedCert)
+	setState(&cachedCert.Status, cachev1alpha1.CachedCertificateStateSynced)
+	cachedCert.Status.InSync = inSync
+	cachedCert.Status.ObservedGeneration = cachedCert.GetGeneration()
+	cachedCert.Status.ResyncNonce = cachedCert.GetAnnotations()[ResyncAnnotationKey]
+	cachedCert.Status.SecretHash = ""
+	if inSync {
+		cachedCert.Status.SecretHash = secretDataHash(secret.Data)
+	}
+	err = r.updateStatus(ctx, cachedCert)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	if previousState == cachev1alpha1.CachedCertificateStateError {
+		r.event(cachedCert, v1.EventTypeNormal, EventReasonRecovered, "Synced again after an error")
+	}
+
+	if !copiesDone {
+		// the rest of the namespaces are written on the next reconcile, resuming from status.syncedNamespaces
+		return ctrl.Result{RequeueAfter: namespaceCopiesRequeueAfter}, nil
+	}
+
+	return r.syncedResult(cachedCert), nil
 }
 
-func (r *CachedCertificateReconciler) upsertTargetSecret(ctx context.Context, reqLog logr.Logger, secret *v1.Secret) error {
+// resyncRequested is true while the ResyncAnnotationKey differs from the last value synced, including when it was removed
+func resyncRequested(cachedCert *cachev1alpha1.CachedCertificate) bool {
+	return cachedCert.GetAnnotations()[ResyncAnnotationKey] != cachedCert.Status.ResyncNonce
+}
+
+// syncedResult requeues CachedCertificates that poll for upstream changes rather than rely on the upstream secret watch,
+// which is all of them when reading upstreams through UpstreamReader
+func (r *CachedCertificateReconciler) syncedResult(cachedCert *cachev1alpha1.CachedCertificate) ctrl.Result {
+	if cachedCert.Spec.UpstreamSecretSync != cachev1alpha1.UpstreamSecretSyncPoll && r.UpstreamReader == nil {
+		return ctrl.Result{}
+	}
+
+	if r.UpstreamPollInterval <= 0 {
+		return ctrl.Result{RequeueAfter: defaultUpstreamPollInterval}
+	}
+	return ctrl.Result{RequeueAfter: r.UpstreamPollInterval}
+}
+
+// upsertTargetSecret creates or updates the target secret, certKey is the data key holding the certificate chain
+// inSync reports if the target secret content matches the given secret afterwards. This is decided from the write
+// rather than read back since the cached client may not have seen the write yet
+func (r *CachedCertificateReconciler) upsertTargetSecret(ctx context.Context, reqLog logr.Logger, secret *v1.Secret, certKey string) (inSync bool, err error) {
+	ctx, span := r.startSpan(ctx, "upsertTargetSecret")
+	defer func() { endSpan(span, err) }()
+
+	if err = ctx.Err(); err != nil {
+		return false, err
+	}
+
+	key := types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}
 	existingSecret := &v1.Secret{}
-	err := r.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, existingSecret)
+	err = r.Get(ctx, key, existingSecret)
 	if k8serr.IsNotFound(err) {
-		return r.Create(ctx, secret)
+		err = r.writeTargetSecret(ctx, secret, false)
+		if err == nil {
+			r.audit(secret, "create")
+			return true, nil
+		}
+		if !k8serr.IsAlreadyExists(err) {
+			return false, err
+		}
+
+		// the secret was created since the get, possibly by someone else, so it gets the same checks as an existing secret
+		reqLog.V(1).Info("target Secret created concurrently, checking its owner")
+		if getErr := r.Get(ctx, key, existingSecret); getErr != nil {
+			// the cache hasn't caught up yet, the retry will see it
+			return false, err
+		}
 	} else if err != nil {
 		reqLog.Error(err, "unexpected error getting target Secret for sync")
-		return err
+		return false, err
 	}
 
 	// refuse to update a secret we didn't make
-	if _, ok := existingSecret.GetLabels()[SyncedLabelKey]; !ok {
-		return errors.New("refusing to update a secret not created by the controller")
+	if !syncedFrom(existingSecret, secret) {
+		return false, fmt.Errorf("refusing to update secret %s: %w", secret.Name, ErrSecretOwnershipConflict)
 	}
 
-	return r.Update(ctx, secret)
+	// never roll back to an older certificate of the same upstream, e.g. from a stale cache read during renewal
+	// an older certificate from another upstream is synced, e.g. after reverting dnsNames or falling back to another issuer
+	sameUpstream := existingSecret.Annotations[UpstreamAnnotationKey] != "" &&
+		existingSecret.Annotations[UpstreamAnnotationKey] == secret.Annotations[UpstreamAnnotationKey]
+	if existingNotBefore, ok := leafNotBefore(r.ParsedChainCache, existingSecret.Data[certKey]); ok && sameUpstream {
+		if newNotBefore, ok := leafNotBefore(r.ParsedChainCache, secret.Data[certKey]); ok && newNotBefore.Before(existingNotBefore) {
+			reqLog.Info("skipping sync of an older certificate", "notBefore", newNotBefore, "existingNotBefore", existingNotBefore)
+			return secretDataHash(existingSecret.Data) == secretDataHash(secret.Data), nil
+		}
+	}
+
+	if existingSecret.Type != secret.Type {
+		// the type of a secret can't be updated, replace the secret to change it
+		reqLog.Info("re-creating target Secret to change its type", "type", secret.Type, "previousType", existingSecret.Type)
+		if err = r.Delete(ctx, existingSecret, client.Preconditions{UID: &existingSecret.UID}); err != nil && !k8serr.IsNotFound(err) {
+			return false, err
+		}
+		if err = r.writeTargetSecret(ctx, secret, false); err != nil {
+			return false, err
+		}
+		r.audit(secret, "recreate")
+		return true, nil
+	}
+
+	if err = r.writeTargetSecret(ctx, secret, true); err != nil {
+		return false, err
+	}
+	if secretDataHash(existingSecret.Data) != secretDataHash(secret.Data) {
+		r.audit(secret, "update")
+	}
+
+	return true, nil
+}
+
+// audit records a write of the target secret to the AuditLog when set
+func (r *CachedCertificateReconciler) audit(secret *v1.Secret, action string) {
+	if r.AuditLog == nil {
+		return
+	}
+
+	r.AuditLog.Info("wrote target secret",
+		"action", action,
+		"cachedCertificate", secret.Annotations[SourceAnnotationKey],
+		"secret", secret.Namespace+"/"+secret.Name,
+		"hash", secretDataHash(secret.Data),
+		"time", r.now().UTC().Format(time.RFC3339),
+	)
+}
+
+// namespaceTerminating reports if the namespace is being deleted. Errors reading it are logged and treated as not
+// terminating so a missing permission doesn't stop syncs
+func (r *CachedCertificateReconciler) namespaceTerminating(ctx context.Context, reqLog logr.Logger, name string) bool {
+	reader := r.NamespaceReader
+	if reader == nil {
+		reader = r.Client
+	}
+
+	namespace := &v1.Namespace{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+		if !k8serr.IsNotFound(err) {
+			reqLog.V(1).Info("unable to check if the namespace is terminating", "error", err.Error())
+		}
+		return false
+	}
+
+	return namespace.Status.Phase == v1.NamespaceTerminating || namespace.GetDeletionTimestamp() != nil
+}
+
+// secretOwnerReference returns the owner reference for the target secret, the CachedCertificate unless SecretOwnerRef is set
+// The owner from SecretOwnerRef is looked up in the CachedCertificate's namespace for its uid. It isn't a controller reference
+// since the operator still manages the secret, and it doesn't block owner deletion as that needs access to the owner's finalizers
+func (r *CachedCertificateReconciler) secretOwnerReference(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) (metav1.OwnerReference, error) {
+	ref := cachedCert.Spec.SecretOwnerRef
+	if ref == nil {
+		return ownerReference(cachedCert, !r.NonBlockingOwnerReferences), nil
+	}
+
+	owner := &unstructured.Unstructured{}
+	owner.SetAPIVersion(ref.APIVersion)
+	owner.SetKind(ref.Kind)
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cachedCert.GetNamespace()}, owner); err != nil {
+		return metav1.OwnerReference{}, fmt.Errorf("unable to get secret owner %s %s: %w", ref.Kind, ref.Name, err)
+	}
+
+	return metav1.OwnerReference{
+		APIVersion: ref.APIVersion,
+		Kind:       ref.Kind,
+		Name:       owner.GetName(),
+		UID:        owner.GetUID(),
+	}, nil
+}
+
+// writeTargetSecret applies the secret when a FieldManager is set, otherwise it is created or, when it exists, updated
+func (r *CachedCertificateReconciler) writeTargetSecret(ctx context.Context, secret *v1.Secret, exists bool) error {
+	if r.FieldManager != "" {
+		// apply needs the type set and the secret holds only the fields we manage
+		secret.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("Secret"))
+		return r.Patch(ctx, secret, client.Apply, client.FieldOwner(r.FieldManager), client.ForceOwnership)
+	}
+
+	if exists {
+		return r.Update(ctx, secret)
+	}
+	return r.Create(ctx, secret)
+}
+
+// upsertConfigMap creates or updates the ConfigMap of public certificate material
+func (r *CachedCertificateReconciler) upsertConfigMap(ctx context.Context, reqLog logr.Logger, configMap *v1.ConfigMap) error {
+	existingConfigMap := &v1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}, existingConfigMap)
+	if k8serr.IsNotFound(err) {
+		return r.Create(ctx, configMap)
+	} else if err != nil {
+		reqLog.Error(err, "unexpected error getting ConfigMap for sync")
+		return err
+	}
+
+	// refuse to update a ConfigMap we didn't make
+	if !syncedFrom(existingConfigMap, configMap) {
+		return fmt.Errorf("refusing to update ConfigMap %s: %w", configMap.Name, ErrSecretOwnershipConflict)
+	}
+
+	return r.Update(ctx, configMap)
+}
+
+// targetSecretInSync compares the existing target secret content with the given secret
+func (r *CachedCertificateReconciler) targetSecretInSync(ctx context.Context, secret *v1.Secret) (bool, error) {
+	existingSecret := &v1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, existingSecret)
+	if k8serr.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return secretDataHash(existingSecret.Data) == secretDataHash(secret.Data), nil
+}
+
+// upToDate reports if the last sync still stands so the upstream secret lookup and sync can be skipped
+// Anything that could change the target secret data bumps the generation, moves the state off Synced like the upstream secret
+// watch does, or changes the target secret itself. Its labels and annotations are compared with what a sync would write. Polling, published ConfigMaps, SecretProviderClasses, namespace copies and
+// trust bundles, including the ClusterTrustBundle, need a full reconcile so they are never skipped, neither are objects
+// without a generation
+func (r *CachedCertificateReconciler) upToDate(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) bool {
+	status := &cachedCert.Status
+	if cachedCert.GetGeneration() == 0 || status.ObservedGeneration != cachedCert.GetGeneration() || status.SecretHash == "" ||
+		status.State != cachev1alpha1.CachedCertificateStateSynced || !status.InSync {
+		return false
+	}
+
+	// polling is the only way to notice upstream secret changes without a watch
+	if cachedCert.Spec.UpstreamSecretSync == cachev1alpha1.UpstreamSecretSyncPoll || r.UpstreamReader != nil || cachedCert.Spec.PublishCAConfigMap != "" ||
+		cachedCert.Spec.SecretNamespaceSelector != nil || cachedCert.Spec.TrustBundleFrom != nil || r.ClusterTrustBundleName != "" {
+		return false
+	}
+	if _, ok := secretProviderClassName(cachedCert); ok && r.SecretProviderClassProvider != "" {
+		return false
+	}
+
+	if status.UpstreamRef == nil || status.UpstreamRef.Namespace != r.CacheNamespace {
+		return false
+	}
+
+	if resyncRequested(cachedCert) {
+		return false
+	}
+
+	// synced before effective dnsNames were reported, or dnsNames from a ConfigMap changed
+	if !slicesEqualAfterSort(status.EffectiveDNSNames, cachedCert.Spec.DNSNames) {
+		return false
+	}
+
+	// the upstream Certificate watch enqueues deletes and secretName changes without touching the status
+	// and dnsNames from a ConfigMap change without a new generation, so the upstream still has to match
+	upstreamCert, err := r.getUpstreamCertificate(ctx, cachedCert)
+	if err != nil || upstreamSecretName(upstreamCert) == "" {
+		return false
+	}
+	if _, err := checkUpstreamDNSNames(upstreamCert, cachedCert.Spec.DNSNames); err != nil {
+		return false
+	}
+	if err := checkUpstreamCommonName(upstreamCert, cachedCert.Spec.CommonName); err != nil {
+		return false
+	}
+
+	existingSecret := &v1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: cachedCert.Spec.SecretName, Namespace: cachedCert.GetNamespace()}, existingSecret); err != nil {
+		return false
+	}
+	if secretDataHash(existingSecret.Data) != status.SecretHash {
+		return false
+	}
+
+	// label edits on the CachedCertificate, upstream secret metadata, the renewal time and the validity annotations change
+	// neither the generation nor the data, so the target secret has to carry the metadata a sync would write now
+	upstreamSecret, err := r.getUpstreamSecret(ctx, log.FromContext(ctx).V(1), upstreamCert)
+	if err != nil {
+		return false
+	}
+	expected, err := genSecretForSync(cachedCert, upstreamCert, upstreamSecret, metav1.OwnerReference{}, r.ParsedChainCache)
+	if err != nil {
+		return false
+	}
+	return secretMetadataInSync(existingSecret, expected, r.FieldManager == "")
 }
 
 func (r *CachedCertificateReconciler) getUpstreamCertificate(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) (*unstructured.Unstructured, error) {
@@ -225,29 +1097,49 @@ func (r *CachedCertificateReconciler) getUpstreamCertificate(ctx context.Context
 		return nil, errors.New(".Status.UpstreamRef is required")
 	}
 
-	var upstreamCert unstructured.Unstructured
-	upstreamCert.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "cert-manager.io",
-		Kind:    "Certificate",
-		Version: "v1",
-	})
-
-	err := r.Get(ctx, types.NamespacedName{
+	upstreamCert := newUpstreamCertificate()
+	err := r.upstreamReader().Get(ctx, types.NamespacedName{
 		Name:      cachedCert.Status.UpstreamRef.Name,
 		Namespace: cachedCert.Status.UpstreamRef.Namespace,
-	}, &upstreamCert)
+	}, upstreamCert)
 	if err != nil {
 		return nil, err
 	}
 
-	return &upstreamCert, nil
+	return upstreamCert, nil
 }
 
-func (r *CachedCertificateReconciler) createUpstreamCertificate(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) error {
+func (r *CachedCertificateReconciler) createUpstreamCertificate(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) (err error) {
+	ctx, span := r.startSpan(ctx, "createUpstreamCertificate")
+	defer func() { endSpan(span, err) }()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if cachedCert.Status.UpstreamRef == nil {
 		return errors.New(".Status.UpstreamRef is required")
 	}
 
+	if len(cachedCert.Spec.DNSNames) == 0 {
+		return errors.New(".Spec.DNSNames is required")
+	}
+
+	issuerRef, _ := activeIssuer(cachedCert)
+
+	// The secretName of the cachedCert is for the *target* secret
+	// Upstreams use their own name for secret names, or a name rendered from it, to ensure uniqueness in the cache namespace
+	secretName, err := upstreamSecretNameFor(r.UpstreamSecretNameTemplate, cachedCert.Status.UpstreamRef.Name)
+	if err != nil {
+		return err
+	}
+	if secretName != cachedCert.Status.UpstreamRef.Name {
+		// a template can still clash with a Certificate made before it was set, or by hand
+		if err = r.checkUpstreamSecretNameFree(ctx, cachedCert.Status.UpstreamRef, secretName); err != nil {
+			return err
+		}
+	}
+
 	upstreamCert := unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "cert-manager.io/v1",
@@ -256,56 +1148,407 @@ func (r *CachedCertificateReconciler) createUpstreamCertificate(ctx context.Cont
 				"name":      cachedCert.Status.UpstreamRef.Name,
 				"namespace": cachedCert.Status.UpstreamRef.Namespace,
 
-				// we intentially *do not* set ownerReferences and do not do *any* automated removal of the "Certificates" made here
+				// we intentially *do not* set ownerReferences, the "Certificates" made here are only removed by the
+				// OrphanCollector when it is enabled
 			},
 			"spec": map[string]interface{}{
-				"dnsNames":  cachedCert.Spec.DNSNames,
-				"issuerRef": cachedCert.Spec.IssuerRef,
-
-				// The secretName of the cachedCert is for the *target* secret
-				// Upstreams use their own name for secret names to ensure uniqueness in the cache namespace
-				"secretName": cachedCert.Status.UpstreamRef.Name,
+				"dnsNames":   stringsToUnstructured(cachedCert.Spec.DNSNames),
+				"issuerRef":  issuerRefToUnstructured(issuerRef),
+				"secretName": secretName,
 			},
 		},
 	}
 
-	return r.Create(ctx, &upstreamCert)
+	// renewal timing doesn't change what is issued, so sharing CachedCertificates keep whatever the creator set
+	if cachedCert.Spec.CommonName != "" {
+		_ = unstructured.SetNestedField(upstreamCert.Object, cachedCert.Spec.CommonName, "spec", "commonName")
+	}
+	if renewBefore := cachedCert.Spec.RenewBefore; renewBefore != nil {
+		_ = unstructured.SetNestedField(upstreamCert.Object, renewBefore.Duration.String(), "spec", "renewBefore")
+	}
+	if percentage := cachedCert.Spec.RenewBeforePercentage; percentage != nil {
+		_ = unstructured.SetNestedField(upstreamCert.Object, int64(*percentage), "spec", "renewBeforePercentage")
+	}
+
+	err = r.Create(ctx, &upstreamCert)
+	if k8serr.IsAlreadyExists(err) {
+		// another CachedCertificate with the same dnsNames won the race to create it
+		// which is just as good, the requeue after create will pick up the existing one
+		return nil
+	}
+
+	return err
+}
+
+// updateStatus writes the status, on conflict the latest CachedCertificate is fetched and the status re-applied to it
+// rather than failing the whole reconcile. A Pending set by the upstream secret watch in the meantime is kept, see
+// markedPendingSince
+func (r *CachedCertificateReconciler) updateStatus(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) error {
+	// don't start writes while shutting down, the next leader picks up from the last complete status
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	status := cachedCert.Status.DeepCopy()
+
+	err := r.Status().Update(ctx, cachedCert)
+	if !k8serr.IsConflict(err) {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(cachedCert), latest); err != nil {
+			return err
+		}
+
+		previous := latest.Status.DeepCopy()
+		status.DeepCopyInto(&latest.Status)
+		if markedPendingSince(previous, status) {
+			// this reconcile may have synced the upstream secret from before the change, so the next one has to sync again
+			setState(&latest.Status, cachev1alpha1.CachedCertificateStatePending)
+			latest.Status.InSync = false
+			latest.Status.UpstreamReady = previous.UpstreamReady
+		}
+		if err := r.Status().Update(ctx, latest); err != nil {
+			return err
+		}
+
+		// later writes in the same reconcile build on the new version and status
+		cachedCert.SetResourceVersion(latest.GetResourceVersion())
+		latest.Status.DeepCopyInto(&cachedCert.Status)
+		return nil
+	})
+}
+
+// checkUpstreamSecretNameFree returns ErrUpstreamSecretNameTaken wrapped in the error when a Certificate other than the
+// upstream in ref already uses secretName in the cache namespace
+func (r *CachedCertificateReconciler) checkUpstreamSecretNameFree(ctx context.Context, ref *cachev1alpha1.ObjectReference, secretName string) error {
+	certList := &unstructured.UnstructuredList{}
+	certList.SetGroupVersionKind(newUpstreamCertificate().GroupVersionKind().GroupVersion().WithKind("CertificateList"))
+	if err := r.List(ctx, certList, client.InNamespace(ref.Namespace)); err != nil {
+		return err
+	}
+
+	for i := range certList.Items {
+		if cert := &certList.Items[i]; cert.GetName() != ref.Name && upstreamSecretName(cert) == secretName {
+			return fmt.Errorf("secret %s for upstream Certificate %s is already used by Certificate %s: %w", secretName, ref.Name, cert.GetName(), ErrUpstreamSecretNameTaken)
+		}
+	}
+	return nil
+}
+
+// markedPendingSince reports if the stored status was moved to Pending by someone else, i.e. the upstream secret watch,
+// while status was about to report the CachedCertificate as synced. Writes of this reconcile move the resource version
+// along so only others' writes conflict. A spec edit conflicting right after a Pending of this reconcile also matches,
+// which only costs another sync
+func markedPendingSince(stored, status *cachev1alpha1.CachedCertificateStatus) bool {
+	return stored.State == cachev1alpha1.CachedCertificateStatePending && !stored.InSync &&
+		(status.State == cachev1alpha1.CachedCertificateStateSynced || status.InSync)
+}
+
+// upstreamCertificateName is the upstream for the active issuer
+// fallback issuers always include the issuer in the name so they never share an upstream with the failed issuer
+// a commonName is included as a hashed name so it's never shared with CachedCertificates without it
+func (r *CachedCertificateReconciler) upstreamCertificateName(cachedCert *cachev1alpha1.CachedCertificate) string {
+	if r.UpstreamNameFunc != nil {
+		if name := r.UpstreamNameFunc(cachedCert); name != "" {
+			return name
+		}
+	}
+
+	var extraNames []string
+	if cachedCert.Spec.CommonName != "" {
+		extraNames = append(extraNames, "cn-"+genHash(cachedCert.Spec.CommonName))
+	}
+	if marker := wildcardMarker(cachedCert.Spec.DNSNames); r.DisambiguateWildcardNames && marker != "" {
+		extraNames = append(extraNames, marker)
+	}
+
+	strategy := r.SharedUpstreamStrategy
+	issuerRef, index := activeIssuer(cachedCert)
+	if index > 0 {
+		strategy = SharedUpstreamStrategyDNSPlusIssuer
+	}
+
+	if r.UpstreamNaming == UpstreamNamingFirstPlusHash {
+		return getFirstPlusHashUpstreamCertificateName(strategy, issuerRef, cachedCert.Spec.DNSNames, extraNames...)
+	}
+	return getUpstreamCertificateName(strategy, issuerRef, append(append([]string{}, cachedCert.Spec.DNSNames...), extraNames...)...)
+}
+
+// labelUpstreamName keeps UpstreamNameLabelKey on the CachedCertificate matching the upstream name derived from its spec
+// Only the label is patched since the spec was changed in memory, e.g. the normalized dnsNames and defaulted secretName
+func (r *CachedCertificateReconciler) labelUpstreamName(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) error {
+	name := r.upstreamCertificateName(cachedCert)
+	if len(validation.IsValidLabelValue(name)) > 0 {
+		name = ""
+	}
+	if current, ok := cachedCert.GetLabels()[UpstreamNameLabelKey]; current == name && ok == (name != "") {
+		return nil
+	}
+
+	patch := client.MergeFrom(cachedCert.DeepCopy())
+	labeled := cachedCert.DeepCopy()
+	certLabels := labeled.GetLabels()
+	if certLabels == nil {
+		certLabels = map[string]string{}
+	}
+	if name == "" {
+		delete(certLabels, UpstreamNameLabelKey)
+	} else {
+		certLabels[UpstreamNameLabelKey] = name
+	}
+	labeled.SetLabels(certLabels)
+
+	if err := r.Patch(ctx, labeled, patch); err != nil {
+		return err
+	}
+	// the patched object has the stored spec, keep the in memory one
+	cachedCert.SetLabels(labeled.GetLabels())
+	cachedCert.SetResourceVersion(labeled.GetResourceVersion())
+	return nil
+}
+
+// issuanceTimedOut checks if the upstream has been waited on for too long and there is another issuer to try
+func (r *CachedCertificateReconciler) issuanceTimedOut(cachedCert *cachev1alpha1.CachedCertificate) bool {
+	if r.IssuerFallbackTimeout <= 0 || cachedCert.Status.IssuanceStartTime == nil {
+		return false
+	}
+
+	if _, index := activeIssuer(cachedCert); index >= len(cachedCert.Spec.IssuerRefs) {
+		// already on the last issuer
+		return false
+	}
+
+	return r.now().Sub(cachedCert.Status.IssuanceStartTime.Time) > r.IssuerFallbackTimeout
+}
+
+// issuanceExpired checks if the upstream has been waited on for longer than the IssuanceTimeout in the spec
+func (r *CachedCertificateReconciler) issuanceExpired(cachedCert *cachev1alpha1.CachedCertificate) bool {
+	timeout := cachedCert.Spec.IssuanceTimeout
+	if timeout == nil || timeout.Duration <= 0 || cachedCert.Status.IssuanceStartTime == nil {
+		return false
+	}
+
+	return r.now().Sub(cachedCert.Status.IssuanceStartTime.Time) > timeout.Duration
+}
+
+// quotaExceededBackoff returns QuotaExceededBackoff or its default
+func (r *CachedCertificateReconciler) quotaExceededBackoff() time.Duration {
+	if r.QuotaExceededBackoff <= 0 {
+		return defaultQuotaExceededBackoff
+	}
+	return r.QuotaExceededBackoff
+}
+
+// breakerWait returns how much longer the circuit breaker of a CachedCertificate stays open, zero when closed or disabled
+// The failed issuance attempts of upstreamCert, the upstream it waits on, can trip it. nil only checks whether it is open
+func (r *CachedCertificateReconciler) breakerWait(key types.NamespacedName, upstreamCert *unstructured.Unstructured) time.Duration {
+	if r.CircuitBreakerThreshold <= 0 {
+		return 0
+	}
+
+	cooldown := r.CircuitBreakerCooldown
+	if cooldown <= 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+
+	now := r.now()
+	if wait := r.breaker.remaining(key, now, cooldown); wait > 0 || upstreamCert == nil {
+		return wait
+	}
+
+	r.breaker.observe(key, upstreamCert.GetName(), upstreamFailedIssuanceAttempts(upstreamCert), r.CircuitBreakerThreshold, now)
+	return r.breaker.remaining(key, now, cooldown)
+}
+
+// breakerOpen sets the Error state for an open circuit breaker and requeues once it is over
+func (r *CachedCertificateReconciler) breakerOpen(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate, wait time.Duration) (ctrl.Result, error) {
+	cachedCert.Status.UpstreamReady = false
+	if result, err := r.failTerminal(ctx, cachedCert, cachev1alpha1.ReasonIssuanceCircuitOpen,
+		"upstream Certificate failed issuance "+strconv.Itoa(r.CircuitBreakerThreshold)+" times in a row, not issuing until "+
+			r.now().Add(wait).UTC().Format(time.RFC3339)); err != nil {
+		return result, err
+	}
+	return ctrl.Result{RequeueAfter: wait}, nil
+}
+
+// event records an event on the CachedCertificate when a Recorder is set
+func (r *CachedCertificateReconciler) event(cachedCert *cachev1alpha1.CachedCertificate, eventType, reason, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Event(cachedCert, eventType, reason, message)
+}
+
+// waitBackoff doubles the wait between checks for the upstream secret as issuance takes longer, up to
+// MaxBackoffAnnotationKey or defaultMaxWaitBackoff. The upstream secret watch still triggers a reconcile as soon as it is created
+func (r *CachedCertificateReconciler) waitBackoff(reqLog logr.Logger, cachedCert *cachev1alpha1.CachedCertificate) time.Duration {
+	ceiling, err := cachedCert.MaxBackoff()
+	if err != nil {
+		reqLog.Error(err, "ignoring invalid annotation", "annotation", cachev1alpha1.MaxBackoffAnnotationKey)
+	}
+	if ceiling <= 0 {
+		ceiling = defaultMaxWaitBackoff
+	}
+
+	backoff := minWaitBackoff
+	if start := cachedCert.Status.IssuanceStartTime; start != nil {
+		for elapsed := r.now().Sub(start.Time); backoff*2 <= elapsed && backoff < ceiling; {
+			backoff *= 2
+		}
+	}
+
+	if backoff > ceiling {
+		return ceiling
+	}
+	return backoff
+}
+
+// observeIssuanceLatency records the time since start in IssuanceLatency, if both are set
+func (r *CachedCertificateReconciler) observeIssuanceLatency(cachedCert *cachev1alpha1.CachedCertificate, start *metav1.Time) {
+	if r.IssuanceLatency == nil || start == nil {
+		return
+	}
+
+	issuerRef, _ := activeIssuer(cachedCert)
+	r.IssuanceLatency.WithLabelValues(issuerRef.Kind).Observe(r.now().Sub(start.Time).Seconds())
+}
+
+// now returns the current time from the Clock when set
+func (r *CachedCertificateReconciler) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock.Now()
+}
+
+// updateUpstreamReferences sets an annotation on the upstream Certificate listing all CachedCertificates using it.
+// The given CachedCertificate is listed based on inUse rather than the index since its status may not be persisted yet.
+// Deleted CachedCertificates drop out of the list the next time a remaining one reconciles.
+func (r *CachedCertificateReconciler) updateUpstreamReferences(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate, upstreamCert *unstructured.Unstructured, inUse bool) error {
+	if r.UpstreamReader != nil {
+		// upstreams in a read-only cluster are tracked there
+		return nil
+	}
+
+	certList := &cachev1alpha1.CachedCertificateList{}
+	err := r.List(ctx, certList, client.MatchingFields{upstreamRefNameIndexKey: upstreamCert.GetName()})
+	if err != nil {
+		return err
+	}
+
+	refs := []string{}
+	if inUse {
+		refs = append(refs, cachedCert.GetNamespace()+"/"+cachedCert.GetName())
+	}
+	for _, cert := range certList.Items {
+		// the index only matches on name, and CachedCertificates moving between upstreams must not be counted on both
+		ref := cert.Status.UpstreamRef
+		if cert.GetDeletionTimestamp() != nil || ref == nil || ref.Name != upstreamCert.GetName() || ref.Namespace != upstreamCert.GetNamespace() {
+			continue
+		}
+		if cert.GetNamespace() == cachedCert.GetNamespace() && cert.GetName() == cachedCert.GetName() {
+			continue
+		}
+		refs = append(refs, cert.GetNamespace()+"/"+cert.GetName())
+	}
+
+	value := formatReferences(refs)
+	_, orphaned := upstreamCert.GetAnnotations()[OrphanedAtAnnotationKey]
+	reclaimed := orphaned && len(refs) > 0
+	if upstreamCert.GetAnnotations()[ReferencedByAnnotationKey] == value && !reclaimed {
+		return nil
+	}
+
+	patch := client.MergeFrom(upstreamCert.DeepCopy())
+	annotations := upstreamCert.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[ReferencedByAnnotationKey] = value
+	if reclaimed {
+		// used again within the orphan grace period, see OrphanCollector
+		delete(annotations, OrphanedAtAnnotationKey)
+	}
+	upstreamCert.SetAnnotations(annotations)
+
+	return r.Patch(ctx, upstreamCert, patch)
 }
 
-func (r *CachedCertificateReconciler) getUpstreamSecret(ctx context.Context, reqLog logr.Logger, upstreamCert *unstructured.Unstructured) (*v1.Secret, error) {
+func (r *CachedCertificateReconciler) getUpstreamSecret(ctx context.Context, reqLog logr.Logger, upstreamCert *unstructured.Unstructured) (secret *v1.Secret, err error) {
+	ctx, span := r.startSpan(ctx, "getUpstreamSecret", upstreamNameKey.String(upstreamCert.GetName()))
+	defer func() { endSpan(span, err) }()
+
 	secretName, found, err := unstructured.NestedString(upstreamCert.Object, "spec", "secretName")
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%v: %w", err, errUpstreamInvalid)
 	}
 	if !found {
-		return nil, errors.New("unable to find secretName in upstream Certificate")
+		return nil, fmt.Errorf("unable to find secretName in upstream Certificate %s: %w", upstreamCert.GetName(), ErrUpstreamNoSecretName)
 	}
 	if secretName == "" {
-		return nil, errors.New("secretName not set in upstream Certificate")
+		return nil, fmt.Errorf("secretName not set in upstream Certificate %s: %w", upstreamCert.GetName(), ErrUpstreamNoSecretName)
 	}
 
 	reqLog.Info("checking for secret " + secretName + " referenced by upstream Certificate")
 
 	// get secret
-	secret := &v1.Secret{}
-	err = r.Get(ctx, types.NamespacedName{
-		Name:      secretName,
-		Namespace: upstreamCert.GetNamespace(),
-	}, secret)
-	if err != nil {
+	key := types.NamespacedName{Name: secretName, Namespace: upstreamCert.GetNamespace()}
+	if r.UpstreamSecretCache != nil {
+		return r.UpstreamSecretCache.Get(ctx, r.upstreamReader(), key)
+	}
+
+	secret = &v1.Secret{}
+	if err = r.upstreamReader().Get(ctx, key, secret); err != nil {
 		return nil, err
 	}
 
 	return secret, nil
 }
 
+// waitForUpstreamSecret polls for the upstream secret until it exists or WaitForIssuance passes, returning the last result
+func (r *CachedCertificateReconciler) waitForUpstreamSecret(ctx context.Context, reqLog logr.Logger, upstreamCert *unstructured.Unstructured) (*v1.Secret, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.WaitForIssuance)
+	defer cancel()
+
+	ticker := time.NewTicker(waitForIssuancePoll)
+	defer ticker.Stop()
+
+	for {
+		secret, err := r.getUpstreamSecret(ctx, reqLog.V(1), upstreamCert)
+		if !k8serr.IsNotFound(err) {
+			return secret, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-ticker.C:
+		}
+	}
+}
+
+// upstreamReader returns the reader for upstream Certificates and their secrets
+func (r *CachedCertificateReconciler) upstreamReader() client.Reader {
+	if r.UpstreamReader == nil {
+		return r.Client
+	}
+	return r.UpstreamReader
+}
+
+// watches reports whether this instance is responsible for the given CachedCertificate
+func (r *CachedCertificateReconciler) watches(obj client.Object) bool {
+	return r.inWatchedNamespace(obj.GetNamespace()) && (r.WatchLabelSelector == nil || r.WatchLabelSelector.Matches(labels.Set(obj.GetLabels())))
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CachedCertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	indexer := mgr.GetFieldIndexer()
 
 	// index cachedcertificates by upstream ref name when set
-	certNameIndexKey := "status.upstreamRef.name"
-	err := indexer.IndexField(context.Background(), &cachev1alpha1.CachedCertificate{}, certNameIndexKey, func(o client.Object) []string {
+	err := indexer.IndexField(context.Background(), &cachev1alpha1.CachedCertificate{}, upstreamRefNameIndexKey, func(o client.Object) []string {
 		cert := o.(*cachev1alpha1.CachedCertificate)
 		if cert.Status.UpstreamRef != nil && cert.Status.UpstreamRef.Name != "" {
 			return []string{cert.Status.UpstreamRef.Name}
@@ -316,23 +1559,124 @@ func (r *CachedCertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	// setup the upstream secret reconciler
-	// it is a component of this operator and therefore started here
-	// rather than independently
-	upstreamSecretReconciler := &UpstreamSecretReconciler{
-		CacheNamespace:   r.CacheNamespace,
-		CertNameIndexKey: certNameIndexKey,
-		Client:           r.Client,
-		Scheme:           r.Scheme,
+	// index cachedcertificates by the ConfigMap they read dns names from
+	err = indexer.IndexField(context.Background(), &cachev1alpha1.CachedCertificate{}, dnsNamesFromIndexKey, func(o client.Object) []string {
+		cert := o.(*cachev1alpha1.CachedCertificate)
+		if cert.Spec.DNSNamesFrom != nil && cert.Spec.DNSNamesFrom.Name != "" {
+			return []string{cert.Spec.DNSNamesFrom.Name}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// index cachedcertificates by the ConfigMap they read extra CAs from
+	err = indexer.IndexField(context.Background(), &cachev1alpha1.CachedCertificate{}, trustBundleFromIndexKey, func(o client.Object) []string {
+		cert := o.(*cachev1alpha1.CachedCertificate)
+		if cert.Spec.TrustBundleFrom != nil && cert.Spec.TrustBundleFrom.Name != "" {
+			return []string{cert.Spec.TrustBundleFrom.Name}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	err = upstreamSecretReconciler.SetupWithManager(mgr)
+	// index synced secrets and their copies by the CachedCertificate they were synced from
+	err = indexer.IndexField(context.Background(), &v1.Secret{}, sourceIndexKey, func(o client.Object) []string {
+		if source := o.GetAnnotations()[SourceAnnotationKey]; source != "" {
+			return []string{source}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&cachev1alpha1.CachedCertificate{}).
+	if r.WatchIssuers {
+		// index cachedcertificates by the issuers they reference
+		err = indexer.IndexField(context.Background(), &cachev1alpha1.CachedCertificate{}, issuerIndexKey, func(o client.Object) []string {
+			return issuerIndexValues(o.(*cachev1alpha1.CachedCertificate))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&cachev1alpha1.CachedCertificate{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.watches))).
 		Owns(&v1.Secret{}).
-		Complete(r)
+		Owns(&v1.ConfigMap{}).
+		// re-reconcile when the dns names read from a ConfigMap change
+		Watches(
+			&source.Kind{Type: &v1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.dnsNamesConfigMapDependents),
+		).
+		// and when the extra CAs of a trust bundle change
+		Watches(
+			&source.Kind{Type: &v1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.trustBundleConfigMapDependents),
+		)
+
+	// upstreams in another cluster aren't in the manager cache, syncedResult polls them instead
+	if r.UpstreamReader == nil {
+		// setup the upstream secret reconciler
+		// it is a component of this operator and therefore started here
+		// rather than independently
+		upstreamSecretReconciler := &UpstreamSecretReconciler{
+			CacheNamespace:        r.CacheNamespace,
+			CertNameIndexKey:      upstreamRefNameIndexKey,
+			CertNameAnnotationKey: r.CertificateNameAnnotation,
+			AllEvents:             r.WatchAllUpstreamSecretEvents,
+			Watches:               r.watches,
+			SecretCache:           r.UpstreamSecretCache,
+			Client:                r.Client,
+			Scheme:                r.Scheme,
+		}
+
+		err = upstreamSecretReconciler.SetupWithManager(mgr)
+		if err != nil {
+			return err
+		}
+
+		// re-create upstream Certificates deleted out from under their dependents
+		b = b.Watches(
+			&source.Kind{Type: newUpstreamCertificate()},
+			handler.EnqueueRequestsFromMapFunc(r.upstreamCertificateDependents),
+			builder.WithPredicates(r.upstreamCertificateChanged()),
+		)
+	}
+
+	if r.ResyncEvents != nil {
+		b = b.Watches(&source.Channel{Source: r.ResyncEvents}, &handler.EnqueueRequestForObject{})
+	}
+
+	if r.NamespaceCopies {
+		b = b.
+			// add and remove copies as namespaces start or stop matching a SecretNamespaceSelector
+			Watches(
+				&source.Kind{Type: &v1.Namespace{}},
+				handler.EnqueueRequestsFromMapFunc(r.namespaceSelectorDependents),
+				builder.WithPredicates(namespaceLabelsChanged()),
+			).
+			// restore deleted copies, they have no owner reference for Owns to follow
+			Watches(
+				&source.Kind{Type: &v1.Secret{}},
+				handler.EnqueueRequestsFromMapFunc(namespaceCopySource),
+				builder.WithPredicates(namespaceCopyDeleted()),
+			)
+	}
+
+	if r.WatchIssuers {
+		for _, kind := range []string{"Issuer", "ClusterIssuer"} {
+			b = b.Watches(
+				&source.Kind{Type: newIssuer(kind)},
+				handler.EnqueueRequestsFromMapFunc(r.issuerDependents),
+				builder.WithPredicates(issuerBecameReady()),
+			)
+		}
+	}
+
+	return b.Complete(r)
 }
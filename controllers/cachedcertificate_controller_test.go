@@ -30,8 +30,33 @@ import (
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
 )
 
+// ignoreTimestamps clears the timestamps so statuses can be compared directly
+func ignoreTimestamps(status cachev1alpha1.CachedCertificateStatus) cachev1alpha1.CachedCertificateStatus {
+	status.LastTransitionTime = nil
+	status.IssuanceStartTime = nil
+	if status.Conditions != nil {
+		conditions := make([]metav1.Condition, len(status.Conditions))
+		for i, condition := range status.Conditions {
+			condition.LastTransitionTime = metav1.Time{}
+			conditions[i] = condition
+		}
+		status.Conditions = conditions
+	}
+	return status
+}
+
+// readyConditions is the expected Ready condition for a state reached without an error
+func readyConditions(state cachev1alpha1.CachedCertificateState) []metav1.Condition {
+	ready := metav1.ConditionFalse
+	if state == cachev1alpha1.CachedCertificateStateSynced {
+		ready = metav1.ConditionTrue
+	}
+	return []metav1.Condition{{Type: cachev1alpha1.ConditionReady, Status: ready, Reason: string(state)}}
+}
+
 var _ = Describe("The CachedCertificate controller", func() {
 	// Define utility constants for object names and testing timeouts/durations and intervals.
 	const (
@@ -68,7 +93,7 @@ var _ = Describe("The CachedCertificate controller", func() {
 			}
 			Expect(k8sClient.Create(ctx, cachedCert)).Should(Succeed())
 
-			upstreamCertName := getUpstreamCertificateName(cachedCert.Spec.DNSNames...)
+			upstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachedCert.Spec.IssuerRef, cachedCert.Spec.DNSNames...)
 			By("creating the upstream Certificate", func() {
 				upstreamCertLookupKey := types.NamespacedName{Name: upstreamCertName, Namespace: "testing"}
 				upstreamCert := &unstructured.Unstructured{}
@@ -83,24 +108,11 @@ var _ = Describe("The CachedCertificate controller", func() {
 				}, timeout, interval).Should(Succeed())
 			})
 
-			// Manually create the secret that would normally be provisioned by cert-manager
+			// Simulate cert-manager issuing the upstream Certificate
 			// save it for later use to test change syncs
-			upstreamSecret = &v1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      upstreamCertName,
-					Namespace: "testing",
-					Annotations: map[string]string{
-						// Cert-manager creates this annotation and we depend on it for fast
-						// reconciliation of secrets as they change
-						CertificateNameAnnotationKey: upstreamCertName,
-					},
-				},
-				Data: map[string][]byte{
-					"tls.crt": nil,
-					"tls.key": nil,
-				},
-			}
-			Expect(k8sClient.Create(ctx, upstreamSecret)).Should(Succeed())
+			var err error
+			upstreamSecret, err = testutil.IssueCertificate(ctx, k8sClient, types.NamespacedName{Name: upstreamCertName, Namespace: "testing"})
+			Expect(err).ShouldNot(HaveOccurred())
 
 			By("ensuring the downstream secret is created", func() {
 				downstreamSecretLookupKey = types.NamespacedName{Name: CachedCertificateName, Namespace: CachedCertificateNamespace}
@@ -119,14 +131,16 @@ var _ = Describe("The CachedCertificate controller", func() {
 					return createdCachedCert.Status.State
 				}, timeout, interval).Should(Equal(cachev1alpha1.CachedCertificateStateSynced))
 
-				Expect(createdCachedCert.Status).To(Equal(
+				Expect(ignoreTimestamps(createdCachedCert.Status)).To(Equal(
 					cachev1alpha1.CachedCertificateStatus{
 						UpstreamReady: true,
 						UpstreamRef: &cachev1alpha1.ObjectReference{
 							Name:      upstreamCertName,
 							Namespace: "testing",
 						},
-						State: cachev1alpha1.CachedCertificateStateSynced,
+						State:      cachev1alpha1.CachedCertificateStateSynced,
+						InSync:     true,
+						Conditions: readyConditions(cachev1alpha1.CachedCertificateStateSynced),
 					},
 				))
 			})
@@ -150,11 +164,37 @@ var _ = Describe("The CachedCertificate controller", func() {
 				return downstreamSecret.Data, nil
 			}, timeout, interval).Should(Equal(newData))
 		})
+
+		It("must move to pending when the upstream secret is deleted and resync once it returns", func() {
+			cachedCertLookupKey := types.NamespacedName{Name: "new-cachedcertificate", Namespace: "testing"}
+			cachedCert := &cachev1alpha1.CachedCertificate{}
+
+			Expect(k8sClient.Delete(ctx, upstreamSecret)).Should(Succeed())
+
+			Eventually(func() interface{} {
+				_ = k8sClient.Get(ctx, cachedCertLookupKey, cachedCert)
+				return cachedCert.Status.State
+			}, timeout, interval).Should(Equal(cachev1alpha1.CachedCertificateStatePending))
+
+			// cert-manager would re-issue the secret
+			upstreamSecret = &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        upstreamSecret.Name,
+					Namespace:   upstreamSecret.Namespace,
+					Annotations: upstreamSecret.Annotations,
+				},
+				Data: upstreamSecret.Data,
+			}
+			Expect(k8sClient.Create(ctx, upstreamSecret)).Should(Succeed())
+
+			Eventually(func() interface{} {
+				_ = k8sClient.Get(ctx, cachedCertLookupKey, cachedCert)
+				return cachedCert.Status.State
+			}, timeout, interval).Should(Equal(cachev1alpha1.CachedCertificateStateSynced))
+		})
 	})
 
 	When("syncing a synced CachedCertificate", func() {
-		var upstreamSecret *v1.Secret
-
 		It("should handle dnsNames changes", func() {
 			const (
 				CachedCertificateName      = "cachedcertificate-dnsnameschange"
@@ -178,7 +218,7 @@ var _ = Describe("The CachedCertificate controller", func() {
 			}
 			Expect(k8sClient.Create(ctx, cachedCert)).Should(Succeed())
 
-			upstreamCertName := getUpstreamCertificateName(cachedCert.Spec.DNSNames...)
+			upstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachedCert.Spec.IssuerRef, cachedCert.Spec.DNSNames...)
 			By("creating the upstream Certificate", func() {
 				upstreamCertLookupKey := types.NamespacedName{Name: upstreamCertName, Namespace: "testing"}
 				upstreamCert := &unstructured.Unstructured{}
@@ -193,24 +233,9 @@ var _ = Describe("The CachedCertificate controller", func() {
 				}, timeout, interval).Should(Succeed())
 			})
 
-			// Manually create the secret that would normally be provisioned by cert-manager
-			// save it for later use to test change syncs
-			upstreamSecret = &v1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      upstreamCertName,
-					Namespace: "testing",
-					Annotations: map[string]string{
-						// Cert-manager creates this annotation and we depend on it for fast
-						// reconciliation of secrets as they change
-						CertificateNameAnnotationKey: upstreamCertName,
-					},
-				},
-				Data: map[string][]byte{
-					"tls.crt": nil,
-					"tls.key": nil,
-				},
-			}
-			Expect(k8sClient.Create(ctx, upstreamSecret)).Should(Succeed())
+			// Simulate cert-manager issuing the upstream Certificate
+			_, err := testutil.IssueCertificate(ctx, k8sClient, types.NamespacedName{Name: upstreamCertName, Namespace: "testing"})
+			Expect(err).ShouldNot(HaveOccurred())
 
 			By("ensuring final status on the CachedCertificate", func() {
 				cachedCertLookupKey := types.NamespacedName{Name: CachedCertificateName, Namespace: CachedCertificateNamespace}
@@ -221,14 +246,16 @@ var _ = Describe("The CachedCertificate controller", func() {
 					return createdCachedCert.Status.State
 				}, timeout, interval).Should(Equal(cachev1alpha1.CachedCertificateStateSynced))
 
-				Expect(createdCachedCert.Status).To(Equal(
+				Expect(ignoreTimestamps(createdCachedCert.Status)).To(Equal(
 					cachev1alpha1.CachedCertificateStatus{
 						UpstreamReady: true,
 						UpstreamRef: &cachev1alpha1.ObjectReference{
 							Name:      upstreamCertName,
 							Namespace: "testing",
 						},
-						State: cachev1alpha1.CachedCertificateStateSynced,
+						State:      cachev1alpha1.CachedCertificateStateSynced,
+						InSync:     true,
+						Conditions: readyConditions(cachev1alpha1.CachedCertificateStateSynced),
 					},
 				))
 
@@ -237,30 +264,16 @@ var _ = Describe("The CachedCertificate controller", func() {
 				Expect(k8sClient.Update(ctx, createdCachedCert)).Should(Succeed())
 
 				// store new cert name
-				newUpstreamCertName := getUpstreamCertificateName(createdCachedCert.Spec.DNSNames...)
+				newUpstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, createdCachedCert.Spec.IssuerRef, createdCachedCert.Spec.DNSNames...)
 
-				// Manually create the secret that would normally be provisioned by cert-manager
-				newUpstreamSecret := &v1.Secret{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      newUpstreamCertName,
-						Namespace: "testing",
-						Annotations: map[string]string{
-							// Cert-manager creates this annotation and we depend on it for fast
-							// reconciliation of secrets as they change
-							CertificateNameAnnotationKey: newUpstreamCertName,
-						},
-					},
-					Data: map[string][]byte{
-						"tls.crt": nil,
-						"tls.key": nil,
-					},
-				}
-				Expect(k8sClient.Create(ctx, newUpstreamSecret)).Should(Succeed())
+				// Simulate cert-manager issuing the upstream Certificate
+				_, err := testutil.IssueCertificate(ctx, k8sClient, types.NamespacedName{Name: newUpstreamCertName, Namespace: "testing"})
+				Expect(err).ShouldNot(HaveOccurred())
 
 				// wait for the ref to change
 				Eventually(func() interface{} {
 					_ = k8sClient.Get(ctx, cachedCertLookupKey, createdCachedCert)
-					return createdCachedCert.Status
+					return ignoreTimestamps(createdCachedCert.Status)
 				}, timeout, interval).Should(Equal(
 					cachev1alpha1.CachedCertificateStatus{
 						UpstreamReady: true,
@@ -268,7 +281,9 @@ var _ = Describe("The CachedCertificate controller", func() {
 							Name:      newUpstreamCertName,
 							Namespace: "testing",
 						},
-						State: cachev1alpha1.CachedCertificateStateSynced,
+						State:      cachev1alpha1.CachedCertificateStateSynced,
+						InSync:     true,
+						Conditions: readyConditions(cachev1alpha1.CachedCertificateStateSynced),
 					},
 				))
 
@@ -282,10 +297,10 @@ var _ = Describe("The CachedCertificate controller", func() {
 				Expect(k8sClient.Update(ctx, createdCachedCert)).Should(Succeed())
 
 				// wait for the ref to change
-				revertedUpstreamCertName := getUpstreamCertificateName(createdCachedCert.Spec.DNSNames...)
+				revertedUpstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, createdCachedCert.Spec.IssuerRef, createdCachedCert.Spec.DNSNames...)
 				Eventually(func() interface{} {
 					_ = k8sClient.Get(ctx, cachedCertLookupKey, createdCachedCert)
-					return createdCachedCert.Status
+					return ignoreTimestamps(createdCachedCert.Status)
 				}, timeout, interval).Should(Equal(
 					cachev1alpha1.CachedCertificateStatus{
 						UpstreamReady: true,
@@ -293,7 +308,9 @@ var _ = Describe("The CachedCertificate controller", func() {
 							Name:      revertedUpstreamCertName,
 							Namespace: "testing",
 						},
-						State: cachev1alpha1.CachedCertificateStateSynced,
+						State:      cachev1alpha1.CachedCertificateStateSynced,
+						InSync:     true,
+						Conditions: readyConditions(cachev1alpha1.CachedCertificateStateSynced),
 					},
 				))
 			})
@@ -324,7 +341,7 @@ var _ = Describe("The CachedCertificate controller", func() {
 			}
 			Expect(k8sClient.Create(ctx, cachedCert)).Should(Succeed())
 
-			upstreamCertName := getUpstreamCertificateName(cachedCert.Spec.DNSNames...)
+			upstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachedCert.Spec.IssuerRef, cachedCert.Spec.DNSNames...)
 			By("creating an upstream cert", func() {
 				upstreamCertLookupKey := types.NamespacedName{Name: upstreamCertName, Namespace: "testing"}
 				upstreamCert := &unstructured.Unstructured{}
@@ -407,7 +424,7 @@ var _ = Describe("The CachedCertificate controller", func() {
 			}
 			Expect(k8sClient.Create(ctx, cachedCert)).Should(Succeed())
 
-			upstreamCertName := getUpstreamCertificateName(cachedCert.Spec.DNSNames...)
+			upstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachedCert.Spec.IssuerRef, cachedCert.Spec.DNSNames...)
 			By("creating an upstream cert", func() {
 				upstreamCertLookupKey := types.NamespacedName{Name: upstreamCertName, Namespace: "testing"}
 				upstreamCert := &unstructured.Unstructured{}
@@ -433,11 +450,7 @@ var _ = Describe("The CachedCertificate controller", func() {
 			cachedCertLookupKey := types.NamespacedName{Name: CachedCertificateName, Namespace: CachedCertificateNamespace}
 			createdCachedCert := &cachev1alpha1.CachedCertificate{}
 
-			// patch the cachedCert to trigger a resync
-			Expect(k8sClient.Get(ctx, cachedCertLookupKey, cachedCert)).Should(Succeed())
-			cachedCert.Annotations = map[string]string{"update": "now"}
-			Expect(k8sClient.Update(ctx, cachedCert)).Should(Succeed())
-
+			// the upstream Certificate watch picks up the missing secretName without a manual resync
 			By("ensuring error status on the CachedCertificate", func() {
 				Eventually(func() interface{} {
 					_ = k8sClient.Get(ctx, cachedCertLookupKey, createdCachedCert)
@@ -447,6 +460,278 @@ var _ = Describe("The CachedCertificate controller", func() {
 		})
 	})
 
+	When("an upstream secret is deleted", func() {
+		It("should move all dependent CachedCertificates back to pending", func() {
+			const CachedCertificateNamespace = "testing"
+			names := []string{"upstream-deleted-1", "upstream-deleted-2"}
+
+			for _, name := range names {
+				cachedCert := &cachev1alpha1.CachedCertificate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: CachedCertificateNamespace,
+					},
+					Spec: cachev1alpha1.CachedCertificateSpec{
+						IssuerRef: cachev1alpha1.IssuerRef{
+							Name: "my-issuer",
+							Kind: "Issuer",
+						},
+						DNSNames: []string{
+							"upstream-deleted.example.com",
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, cachedCert)).Should(Succeed())
+			}
+
+			upstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachev1alpha1.IssuerRef{}, "upstream-deleted.example.com")
+			By("creating the upstream Certificate", func() {
+				upstreamCertLookupKey := types.NamespacedName{Name: upstreamCertName, Namespace: "testing"}
+				upstreamCert := &unstructured.Unstructured{}
+				upstreamCert.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "cert-manager.io",
+					Kind:    "Certificate",
+					Version: "v1",
+				})
+
+				Eventually(func() error {
+					return k8sClient.Get(ctx, upstreamCertLookupKey, upstreamCert)
+				}, timeout, interval).Should(Succeed())
+			})
+
+			// Simulate cert-manager issuing the upstream Certificate
+			upstreamSecret, err := testutil.IssueCertificate(ctx, k8sClient, types.NamespacedName{Name: upstreamCertName, Namespace: "testing"})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			for _, name := range names {
+				cachedCertLookupKey := types.NamespacedName{Name: name, Namespace: CachedCertificateNamespace}
+				cachedCert := &cachev1alpha1.CachedCertificate{}
+				Eventually(func() interface{} {
+					_ = k8sClient.Get(ctx, cachedCertLookupKey, cachedCert)
+					return cachedCert.Status.State
+				}, timeout, interval).Should(Equal(cachev1alpha1.CachedCertificateStateSynced))
+			}
+
+			Expect(k8sClient.Delete(ctx, upstreamSecret)).Should(Succeed())
+
+			By("ensuring every dependent waits for re-issuance", func() {
+				for _, name := range names {
+					cachedCertLookupKey := types.NamespacedName{Name: name, Namespace: CachedCertificateNamespace}
+					cachedCert := &cachev1alpha1.CachedCertificate{}
+					Eventually(func() interface{} {
+						_ = k8sClient.Get(ctx, cachedCertLookupKey, cachedCert)
+						return ignoreTimestamps(cachedCert.Status)
+					}, timeout, interval).Should(Equal(
+						cachev1alpha1.CachedCertificateStatus{
+							UpstreamReady: false,
+							UpstreamRef: &cachev1alpha1.ObjectReference{
+								Name:      upstreamCertName,
+								Namespace: "testing",
+							},
+							State:      cachev1alpha1.CachedCertificateStatePending,
+							Conditions: readyConditions(cachev1alpha1.CachedCertificateStatePending),
+						},
+					))
+				}
+			})
+		})
+	})
+
+	When("multiple CachedCertificates share an upstream", func() {
+		It("should list all of them on the upstream Certificate", func() {
+			const CachedCertificateNamespace = "testing"
+			names := []string{"referenced-2", "referenced-1"}
+
+			for _, name := range names {
+				cachedCert := &cachev1alpha1.CachedCertificate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: CachedCertificateNamespace,
+					},
+					Spec: cachev1alpha1.CachedCertificateSpec{
+						IssuerRef: cachev1alpha1.IssuerRef{
+							Name: "my-issuer",
+							Kind: "Issuer",
+						},
+						DNSNames: []string{
+							"referenced.example.com",
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, cachedCert)).Should(Succeed())
+			}
+
+			upstreamCertLookupKey := types.NamespacedName{Name: getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachev1alpha1.IssuerRef{}, "referenced.example.com"), Namespace: "testing"}
+			upstreamCert := &unstructured.Unstructured{}
+			upstreamCert.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "cert-manager.io",
+				Kind:    "Certificate",
+				Version: "v1",
+			})
+
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, upstreamCertLookupKey, upstreamCert)
+				return upstreamCert.GetAnnotations()[ReferencedByAnnotationKey]
+			}, timeout, interval).Should(Equal("testing/referenced-1,testing/referenced-2"))
+		})
+	})
+
+	When("syncing a CachedCertificate with a paused sync", func() {
+		It("should wait for the upstream but not write the secret until unpaused", func() {
+			const (
+				CachedCertificateName      = "new-cachedcertificate-sync-paused"
+				CachedCertificateNamespace = "testing"
+			)
+
+			cachedCert := &cachev1alpha1.CachedCertificate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      CachedCertificateName,
+					Namespace: CachedCertificateNamespace,
+				},
+				Spec: cachev1alpha1.CachedCertificateSpec{
+					IssuerRef: cachev1alpha1.IssuerRef{
+						Name: "my-issuer",
+						Kind: "Issuer",
+					},
+					DNSNames: []string{
+						"sync-paused.example.com",
+					},
+					SyncPaused: true,
+				},
+			}
+			Expect(k8sClient.Create(ctx, cachedCert)).Should(Succeed())
+
+			upstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachedCert.Spec.IssuerRef, cachedCert.Spec.DNSNames...)
+			By("creating the upstream Certificate", func() {
+				upstreamCertLookupKey := types.NamespacedName{Name: upstreamCertName, Namespace: "testing"}
+				upstreamCert := &unstructured.Unstructured{}
+				upstreamCert.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "cert-manager.io",
+					Kind:    "Certificate",
+					Version: "v1",
+				})
+
+				Eventually(func() error {
+					return k8sClient.Get(ctx, upstreamCertLookupKey, upstreamCert)
+				}, timeout, interval).Should(Succeed())
+			})
+
+			// Simulate cert-manager issuing the upstream Certificate
+			_, err := testutil.IssueCertificate(ctx, k8sClient, types.NamespacedName{Name: upstreamCertName, Namespace: "testing"})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			cachedCertLookupKey := types.NamespacedName{Name: CachedCertificateName, Namespace: CachedCertificateNamespace}
+			downstreamSecretLookupKey := types.NamespacedName{Name: CachedCertificateName, Namespace: CachedCertificateNamespace}
+
+			By("ensuring the upstream is ready but the sync is paused", func() {
+				Eventually(func() interface{} {
+					_ = k8sClient.Get(ctx, cachedCertLookupKey, cachedCert)
+					return ignoreTimestamps(cachedCert.Status)
+				}, timeout, interval).Should(Equal(
+					cachev1alpha1.CachedCertificateStatus{
+						UpstreamReady: true,
+						UpstreamRef: &cachev1alpha1.ObjectReference{
+							Name:      upstreamCertName,
+							Namespace: "testing",
+						},
+						State:      cachev1alpha1.CachedCertificateStateSyncPaused,
+						Conditions: readyConditions(cachev1alpha1.CachedCertificateStateSyncPaused),
+					},
+				))
+
+				Consistently(func() error {
+					return k8sClient.Get(ctx, downstreamSecretLookupKey, &v1.Secret{})
+				}, time.Second, interval).ShouldNot(Succeed())
+			})
+
+			By("unpausing the sync", func() {
+				cachedCert.Spec.SyncPaused = false
+				Expect(k8sClient.Update(ctx, cachedCert)).Should(Succeed())
+
+				Eventually(func() interface{} {
+					_ = k8sClient.Get(ctx, cachedCertLookupKey, cachedCert)
+					return cachedCert.Status.State
+				}, timeout, interval).Should(Equal(cachev1alpha1.CachedCertificateStateSynced))
+
+				Expect(k8sClient.Get(ctx, downstreamSecretLookupKey, &v1.Secret{})).Should(Succeed())
+			})
+		})
+	})
+
+	When("another controller edits a synced secret", func() {
+		It("should keep the fields it doesn't manage on the next sync", func() {
+			const (
+				CachedCertificateName      = "new-cachedcertificate-shared-secret"
+				CachedCertificateNamespace = "testing"
+			)
+
+			cachedCert := &cachev1alpha1.CachedCertificate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      CachedCertificateName,
+					Namespace: CachedCertificateNamespace,
+				},
+				Spec: cachev1alpha1.CachedCertificateSpec{
+					IssuerRef: cachev1alpha1.IssuerRef{
+						Name: "my-issuer",
+						Kind: "Issuer",
+					},
+					DNSNames: []string{
+						"shared-secret.example.com",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cachedCert)).Should(Succeed())
+
+			upstreamCertName := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachedCert.Spec.IssuerRef, cachedCert.Spec.DNSNames...)
+			upstreamCertLookupKey := types.NamespacedName{Name: upstreamCertName, Namespace: "testing"}
+			Eventually(func() error {
+				_, err := testutil.IssueCertificate(ctx, k8sClient, upstreamCertLookupKey)
+				return err
+			}, timeout, interval).Should(Succeed())
+
+			downstreamSecretLookupKey := types.NamespacedName{Name: CachedCertificateName, Namespace: CachedCertificateNamespace}
+			downstreamSecret := &v1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, downstreamSecretLookupKey, downstreamSecret)
+			}, timeout, interval).Should(Succeed())
+
+			By("adding fields from another controller", func() {
+				Eventually(func() error {
+					if err := k8sClient.Get(ctx, downstreamSecretLookupKey, downstreamSecret); err != nil {
+						return err
+					}
+					downstreamSecret.Annotations["other.example.com/keep"] = "me"
+					downstreamSecret.Data["keystore.jks"] = []byte("added by another controller")
+					return k8sClient.Update(ctx, downstreamSecret)
+				}, timeout, interval).Should(Succeed())
+			})
+
+			renewed := &v1.Secret{}
+			By("renewing the upstream secret", func() {
+				upstreamCert := &unstructured.Unstructured{}
+				upstreamCert.SetGroupVersionKind(testutil.CertificateGVK)
+				Expect(k8sClient.Get(ctx, upstreamCertLookupKey, upstreamCert)).Should(Succeed())
+
+				issued, err := testutil.NewCertificateSecret(upstreamCert)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: issued.Name, Namespace: issued.Namespace}, renewed)).Should(Succeed())
+				renewed.Data = issued.Data
+				Expect(k8sClient.Update(ctx, renewed)).Should(Succeed())
+			})
+
+			By("ensuring the renewal is synced and the other fields are kept", func() {
+				Eventually(func() []byte {
+					_ = k8sClient.Get(ctx, downstreamSecretLookupKey, downstreamSecret)
+					return downstreamSecret.Data["tls.crt"]
+				}, timeout, interval).Should(Equal(renewed.Data["tls.crt"]))
+
+				Expect(downstreamSecret.Annotations).Should(HaveKeyWithValue("other.example.com/keep", "me"))
+				Expect(downstreamSecret.Data).Should(HaveKeyWithValue("keystore.jks", []byte("added by another controller")))
+			})
+		})
+	})
+
 	When("syncing a missing CachedCertificate", func() {
 		It("should exit without requeue or err", func() {
 			Expect(reconciler.Reconcile(ctx, controllerruntime.Request{
@@ -0,0 +1,68 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// rekeyDebouncer tracks since when each CachedCertificate has wanted to move to a new upstream at its current generation
+// A new generation starts the wait over, so a burst of edits only moves the upstream once the spec settles
+// The zero value is ready to use and it is safe for concurrent use
+type rekeyDebouncer struct {
+	mu   sync.Mutex
+	seen map[types.NamespacedName]rekeyObservation
+}
+
+// rekeyObservation is the generation a re-key was first seen at
+type rekeyObservation struct {
+	generation int64
+	since      time.Time
+}
+
+// wait returns how much longer the generation has to stay unchanged before the re-key goes ahead, zero once it has been
+// stable for the period. The observation is dropped when the wait is over so the next re-key waits again
+func (d *rekeyDebouncer) wait(key types.NamespacedName, generation int64, now time.Time, period time.Duration) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	observed, ok := d.seen[key]
+	if !ok || observed.generation != generation {
+		if d.seen == nil {
+			d.seen = map[types.NamespacedName]rekeyObservation{}
+		}
+		d.seen[key] = rekeyObservation{generation: generation, since: now}
+		return period
+	}
+
+	if remaining := observed.since.Add(period).Sub(now); remaining > 0 {
+		return remaining
+	}
+
+	delete(d.seen, key)
+	return 0
+}
+
+// forget drops the observation, e.g. once the spec was reverted or the CachedCertificate deleted
+func (d *rekeyDebouncer) forget(key types.NamespacedName) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, key)
+}
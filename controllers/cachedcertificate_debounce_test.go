@@ -0,0 +1,147 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func Test_ReconcileReKeyDebounce(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFakeClock(time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC))
+
+	cachedCert := newTestCachedCertificate("burst", "a.example.com")
+	cachedCert.Generation = 1
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		ReKeyDebounce:  time.Minute,
+		Clock:          fakeClock,
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "burst", Namespace: "testing"}
+	reconcile := func() ctrl.Result {
+		t.Helper()
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		if err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+		return result
+	}
+	// the fake client doesn't bump the generation on spec changes
+	edit := func(dnsName string) {
+		t.Helper()
+		if err := r.Get(ctx, key, cachedCert); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		cachedCert.Spec.DNSNames = []string{dnsName}
+		cachedCert.Generation++
+		if err := r.Update(ctx, cachedCert); err != nil {
+			t.Fatalf("unable to update CachedCertificate %v", err)
+		}
+	}
+	upstreamRef := func() string {
+		t.Helper()
+		if err := r.Get(ctx, key, cachedCert); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		if cachedCert.Status.UpstreamRef == nil {
+			return ""
+		}
+		return cachedCert.Status.UpstreamRef.Name
+	}
+
+	reconcile()
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-a.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	reconcile()
+
+	// every edit in the burst starts the wait over
+	edit("b.example.com")
+	if result := reconcile(); result.RequeueAfter != time.Minute {
+		t.Errorf("Reconcile() requeueAfter = %v after an edit, want the full debounce", result.RequeueAfter)
+	}
+	fakeClock.Step(30 * time.Second)
+	edit("c.example.com")
+	if result := reconcile(); result.RequeueAfter != time.Minute {
+		t.Errorf("Reconcile() requeueAfter = %v after another edit, want the full debounce", result.RequeueAfter)
+	}
+	fakeClock.Step(30 * time.Second)
+	if result := reconcile(); result.RequeueAfter != 30*time.Second {
+		t.Errorf("Reconcile() requeueAfter = %v, want the rest of the debounce", result.RequeueAfter)
+	}
+	if got := upstreamRef(); got != "cc-a.example.com" {
+		t.Errorf("upstreamRef = %v during the debounce, want the previous upstream", got)
+	}
+
+	// settled, the upstream moves straight to the last spec
+	fakeClock.Step(30 * time.Second)
+	reconcile()
+	reconcile()
+	if got := upstreamRef(); got != "cc-c.example.com" {
+		t.Errorf("upstreamRef = %v after the debounce, want cc-c.example.com", got)
+	}
+
+	upstreams := &unstructured.UnstructuredList{}
+	upstreams.SetGroupVersionKind(schema.GroupVersionKind{Group: "cert-manager.io", Kind: "CertificateList", Version: "v1"})
+	if err := r.List(ctx, upstreams); err != nil {
+		t.Fatalf("unable to list upstream Certificates %v", err)
+	}
+	names := []string{}
+	for _, upstream := range upstreams.Items {
+		names = append(names, upstream.GetName())
+	}
+	sort.Strings(names)
+	if diff := deep.Equal(names, []string{"cc-a.example.com", "cc-c.example.com"}); diff != nil {
+		t.Errorf("upstream Certificates diff %v, want a single re-key", diff)
+	}
+}
+
+func Test_rekeyDebouncer(t *testing.T) {
+	key := types.NamespacedName{Name: "a", Namespace: "testing"}
+	start := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	var d rekeyDebouncer
+
+	if got := d.wait(key, 1, start, time.Minute); got != time.Minute {
+		t.Errorf("wait() = %v on first sight, want %v", got, time.Minute)
+	}
+	if got := d.wait(key, 1, start.Add(time.Minute), time.Minute); got != 0 {
+		t.Errorf("wait() = %v once stable, want 0", got)
+	}
+	// the next re-key waits again
+	if got := d.wait(key, 1, start.Add(time.Minute), time.Minute); got != time.Minute {
+		t.Errorf("wait() = %v after going ahead, want a new wait", got)
+	}
+
+	d.forget(key)
+	if got := d.wait(key, 2, start.Add(2*time.Minute), time.Minute); got != time.Minute {
+		t.Errorf("wait() = %v after forget, want a new wait", got)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+const (
+	// dnsNamesFromIndexKey is used to index CachedCertificates by the ConfigMap they read dns names from
+	dnsNamesFromIndexKey = "spec.dnsNamesFrom.name"
+)
+
+// errDNSNamesFromInvalid is wrapped by errors caused by the ConfigMap referenced in DNSNamesFrom
+var errDNSNamesFromInvalid = errors.New("dnsNamesFrom is invalid")
+
+// parseDNSNames splits a newline or comma separated list of dns names, blank entries are skipped
+func parseDNSNames(value string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// normalizeDNSNames trims the names and drops blanks and duplicates, keeping the order names were first seen
+func normalizeDNSNames(names []string) []string {
+	seen := map[string]bool{}
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	return normalized
+}
+
+// diffDNSNames returns the names in desired missing from current and the names in current no longer desired
+func diffDNSNames(current, desired []string) (added, removed []string) {
+	currentSet := map[string]bool{}
+	for _, name := range current {
+		currentSet[name] = true
+	}
+	desiredSet := map[string]bool{}
+	for _, name := range desired {
+		desiredSet[name] = true
+		if !currentSet[name] {
+			added = append(added, name)
+		}
+	}
+	for _, name := range current {
+		if !desiredSet[name] {
+			removed = append(removed, name)
+		}
+	}
+	return added, removed
+}
+
+// resolveDNSNames appends the dns names from DNSNamesFrom to the spec of the given CachedCertificate
+// The spec is only changed in memory, like the secretName default, so the ConfigMap stays the source of truth
+func (r *CachedCertificateReconciler) resolveDNSNames(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) error {
+	ref := cachedCert.Spec.DNSNamesFrom
+	if ref == nil {
+		return nil
+	}
+
+	configMap := &v1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cachedCert.GetNamespace()}, configMap)
+	if k8serr.IsNotFound(err) {
+		return fmt.Errorf("ConfigMap %s not found: %w", ref.Name, errDNSNamesFromInvalid)
+	} else if err != nil {
+		return err
+	}
+
+	value, ok := configMap.Data[ref.Key]
+	if !ok {
+		return fmt.Errorf("key %s not found in ConfigMap %s: %w", ref.Key, ref.Name, errDNSNamesFromInvalid)
+	}
+
+	names := parseDNSNames(value)
+	if len(names) == 0 {
+		return fmt.Errorf("key %s in ConfigMap %s has no dns names: %w", ref.Key, ref.Name, errDNSNamesFromInvalid)
+	}
+
+	cachedCert.Spec.DNSNames = append(append([]string{}, cachedCert.Spec.DNSNames...), names...)
+	return nil
+}
+
+// dnsNamesConfigMapDependents maps a ConfigMap to the CachedCertificates reading dns names from it
+func (r *CachedCertificateReconciler) dnsNamesConfigMapDependents(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+
+	certList := &cachev1alpha1.CachedCertificateList{}
+	err := r.List(ctx, certList, client.InNamespace(obj.GetNamespace()), client.MatchingFields{dnsNamesFromIndexKey: obj.GetName()})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to list CachedCertificates reading dns names from ConfigMap", "name", obj.GetName(), "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cert := range certList.Items {
+		ref := cert.Spec.DNSNamesFrom
+		if ref == nil || ref.Name != obj.GetName() || !r.watches(&cert) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: cert.Name, Namespace: cert.Namespace}})
+	}
+
+	return requests
+}
@@ -0,0 +1,313 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+func Test_parseDNSNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"empty", "", nil},
+		{"newlines", "a.example.com\nb.example.com\n", []string{"a.example.com", "b.example.com"}},
+		{"commas", "a.example.com,b.example.com", []string{"a.example.com", "b.example.com"}},
+		{"mixed with blanks", " a.example.com ,\n\n b.example.com,\r\n", []string{"a.example.com", "b.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := deep.Equal(parseDNSNames(tt.value), tt.want); diff != nil {
+				t.Errorf("parseDNSNames() diff %v", diff)
+			}
+		})
+	}
+}
+
+func Test_normalizeDNSNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"unchanged", []string{"a.example.com", "b.example.com"}, []string{"a.example.com", "b.example.com"}},
+		{"trimmed", []string{" a.example.com\t"}, []string{"a.example.com"}},
+		{"duplicates dropped", []string{"a.example.com", "b.example.com", "a.example.com", " b.example.com"}, []string{"a.example.com", "b.example.com"}},
+		{"whitespace only", []string{" ", "\t", ""}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := deep.Equal(normalizeDNSNames(tt.names), tt.want); diff != nil {
+				t.Errorf("normalizeDNSNames() diff %v", diff)
+			}
+		})
+	}
+}
+
+func Test_diffDNSNames(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     []string
+		desired     []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{"same", []string{"a.example.com"}, []string{"a.example.com"}, nil, nil},
+		{"added", []string{"a.example.com"}, []string{"a.example.com", "b.example.com"}, []string{"b.example.com"}, nil},
+		{"removed", []string{"a.example.com", "b.example.com"}, []string{"b.example.com"}, nil, []string{"a.example.com"}},
+		{"replaced", []string{"a.example.com"}, []string{"b.example.com"}, []string{"b.example.com"}, []string{"a.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := diffDNSNames(tt.current, tt.desired)
+			if diff := deep.Equal(added, tt.wantAdded); diff != nil {
+				t.Errorf("diffDNSNames() added diff %v", diff)
+			}
+			if diff := deep.Equal(removed, tt.wantRemoved); diff != nil {
+				t.Errorf("diffDNSNames() removed diff %v", diff)
+			}
+		})
+	}
+}
+
+// recordedLog is a single Info call seen by recordingLogger
+type recordedLog struct {
+	level         int
+	msg           string
+	keysAndValues []interface{}
+}
+
+// recordingLogger keeps every Info call so tests can assert on what was logged
+type recordingLogger struct {
+	level int
+	logs  *[]recordedLog
+}
+
+func (l recordingLogger) Enabled() bool { return true }
+func (l recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	*l.logs = append(*l.logs, recordedLog{level: l.level, msg: msg, keysAndValues: keysAndValues})
+}
+func (l recordingLogger) Error(err error, msg string, keysAndValues ...interface{}) {}
+func (l recordingLogger) V(level int) logr.Logger {
+	return recordingLogger{level: l.level + level, logs: l.logs}
+}
+func (l recordingLogger) WithValues(keysAndValues ...interface{}) logr.Logger { return l }
+func (l recordingLogger) WithName(name string) logr.Logger                    { return l }
+
+func Test_ReconcileLogsDNSNamesDiff(t *testing.T) {
+	var logs []recordedLog
+	ctx := log.IntoContext(context.Background(), recordingLogger{logs: &logs})
+
+	cachedCert := newTestCachedCertificate("diff", "a.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "diff", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	// swap a name while the status still points at the first upstream
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	got.Spec.DNSNames = []string{"b.example.com"}
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+
+	logs = nil
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	for _, l := range logs {
+		if l.msg != "upstream Certificate dnsNames differ, moving to a new upstream" {
+			continue
+		}
+		if l.level != 1 {
+			t.Errorf("dnsNames diff logged at level %d, want 1", l.level)
+		}
+		want := []interface{}{"upstream", "cc-a.example.com", "added", []string{"b.example.com"}, "removed", []string{"a.example.com"}}
+		if diff := deep.Equal(l.keysAndValues, want); diff != nil {
+			t.Errorf("dnsNames diff log diff %v", diff)
+		}
+		return
+	}
+	t.Errorf("dnsNames diff not logged, got %v", logs)
+}
+
+func Test_ReconcileDNSNamesFrom(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("from", "inline.example.com")
+	cachedCert.Spec.DNSNamesFrom = &cachev1alpha1.ConfigMapKeyRef{Name: "names", Key: "dnsNames"}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "names", Namespace: "testing"},
+		Data:       map[string]string{"dnsNames": "a.example.com\ninline.example.com\n"},
+	}
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         statusSubresourceClient{newFakeClient(cachedCert, configMap)},
+	}
+
+	key := types.NamespacedName{Name: "from", Namespace: "testing"}
+	reconcileUpstreamNames := func() []string {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		if got.Status.UpstreamRef == nil {
+			return nil
+		}
+
+		upstream := newUpstreamCertificate()
+		if err := r.Get(ctx, types.NamespacedName{Name: got.Status.UpstreamRef.Name, Namespace: "cache"}, upstream); err != nil {
+			return nil
+		}
+		names, _, _ := unstructured.NestedStringSlice(upstream.Object, "spec", "dnsNames")
+		return names
+	}
+
+	if diff := deep.Equal(reconcileUpstreamNames(), []string{"inline.example.com", "a.example.com"}); diff != nil {
+		t.Errorf("upstream dnsNames diff %v", diff)
+	}
+
+	configMap.Data["dnsNames"] = "b.example.com"
+	if err := r.Update(ctx, configMap); err != nil {
+		t.Fatalf("unable to update ConfigMap %v", err)
+	}
+
+	requests := r.dnsNamesConfigMapDependents(configMap)
+	if diff := deep.Equal(requests, []reconcile.Request{{NamespacedName: key}}); diff != nil {
+		t.Fatalf("dnsNamesConfigMapDependents() diff %v", diff)
+	}
+
+	// the first reconcile notices the change and the next one creates the new upstream
+	reconcileUpstreamNames()
+	if diff := deep.Equal(reconcileUpstreamNames(), []string{"inline.example.com", "b.example.com"}); diff != nil {
+		t.Errorf("upstream dnsNames after the ConfigMap change diff %v", diff)
+	}
+
+	if err := r.Delete(ctx, configMap); err != nil {
+		t.Fatalf("unable to delete ConfigMap %v", err)
+	}
+	reconcileUpstreamNames()
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&got.Status) != cachev1alpha1.ReasonDNSNamesFromInvalid {
+		t.Errorf("Reconcile() without the ConfigMap status = %v, want error %v", got.Status, cachev1alpha1.ReasonDNSNamesFromInvalid)
+	}
+}
+
+func Test_ReconcileBlankDNSNames(t *testing.T) {
+	ctx := context.Background()
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(newTestCachedCertificate("blank", " ", "\t")),
+	}
+
+	key := types.NamespacedName{Name: "blank", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&got.Status) != cachev1alpha1.ReasonInvalidSpec {
+		t.Errorf("Reconcile() status = %v, want error %v", got.Status, cachev1alpha1.ReasonInvalidSpec)
+	}
+	if got.Status.UpstreamRef != nil {
+		t.Error("Reconcile() should not pick an upstream without dns names")
+	}
+
+	upstreams := &unstructured.UnstructuredList{}
+	upstreams.SetGroupVersionKind(schema.GroupVersionKind{Group: "cert-manager.io", Kind: "CertificateList", Version: "v1"})
+	if err := r.List(ctx, upstreams); err != nil {
+		t.Fatalf("unable to list upstream Certificates %v", err)
+	}
+	if len(upstreams.Items) != 0 {
+		t.Errorf("Reconcile() created %v upstream Certificates, want none", len(upstreams.Items))
+	}
+}
+
+func Test_ReconcileEffectiveDNSNames(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("effective", " b.example.com", "a.example.com", "b.example.com", "")
+	cachedCert.Spec.DNSNamesFrom = &cachev1alpha1.ConfigMapKeyRef{Name: "names", Key: "dnsNames"}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "names", Namespace: "testing"},
+		Data:       map[string]string{"dnsNames": "a.example.com\nc.example.com\n"},
+	}
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         statusSubresourceClient{newFakeClient(cachedCert, configMap)},
+	}
+
+	key := types.NamespacedName{Name: "effective", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if diff := deep.Equal(got.Status.EffectiveDNSNames, []string{"b.example.com", "a.example.com", "c.example.com"}); diff != nil {
+		t.Errorf("status.effectiveDNSNames diff %v", diff)
+	}
+	// the spec itself is left as written
+	if diff := deep.Equal(got.Spec.DNSNames, []string{" b.example.com", "a.example.com", "b.example.com", ""}); diff != nil {
+		t.Errorf("spec.dnsNames diff %v", diff)
+	}
+	if got.Status.UpstreamRef == nil || got.Status.UpstreamRef.Name != getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, got.Spec.IssuerRef, got.Status.EffectiveDNSNames...) {
+		t.Errorf("status.upstreamRef = %v, want the upstream for the effective dnsNames", got.Status.UpstreamRef)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// DuplicatesPath is the path the DuplicatesHandler is served on
+const DuplicatesPath = "/duplicates"
+
+// DuplicatesHandler reports upstream Certificates in the cache namespace issuing the same dnsNames from the same issuer
+// under different names, e.g. after a change of naming strategy or a manual create. Each duplicate wastes an issuance
+// and CachedCertificates may sync from either one
+type DuplicatesHandler struct {
+	client.Reader
+
+	// CacheNamespace is the namespace holding the upstream Certificates
+	CacheNamespace string
+}
+
+// ServeHTTP lists the upstream Certificates and writes a line per set of duplicates, nothing is changed
+func (h *DuplicatesHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reqLog := log.FromContext(req.Context()).WithName("duplicates")
+
+	upstreamList := &unstructured.UnstructuredList{}
+	upstreamList.SetGroupVersionKind(schema.GroupVersionKind{Group: "cert-manager.io", Kind: "CertificateList", Version: "v1"})
+	if err := h.List(req.Context(), upstreamList, client.InNamespace(h.CacheNamespace)); err != nil {
+		reqLog.Error(err, "unable to list upstream Certificates")
+		http.Error(w, "unable to list upstream Certificates", http.StatusInternalServerError)
+		return
+	}
+
+	var lines []string
+	for _, duplicate := range findDuplicateUpstreams(upstreamList.Items) {
+		reqLog.Info("found duplicate upstream Certificates", "upstreams", duplicate.names, "dnsNames", duplicate.dnsNames, "issuer", duplicate.issuer)
+		lines = append(lines, strings.Join(duplicate.dnsNames, ",")+" "+duplicate.issuer+": "+strings.Join(duplicate.names, " ")+"\n")
+	}
+
+	_, _ = w.Write([]byte(strings.Join(lines, "")))
+}
+
+// duplicateUpstreams is a set of upstream Certificates issuing the same dnsNames from the same issuer
+type duplicateUpstreams struct {
+	dnsNames []string
+	issuer   string
+	names    []string
+}
+
+// findDuplicateUpstreams groups the upstream Certificates by their lower cased dnsNames, issuerRef and commonName, returning the
+// groups with more than one Certificate. dnsNames are compared as a set so differently ordered lists still match
+func findDuplicateUpstreams(upstreamCerts []unstructured.Unstructured) []duplicateUpstreams {
+	groups := map[string]*duplicateUpstreams{}
+	for i := range upstreamCerts {
+		upstreamCert := &upstreamCerts[i]
+		dnsNames, _, _ := unstructured.NestedStringSlice(upstreamCert.Object, "spec", "dnsNames")
+		if len(dnsNames) == 0 {
+			continue
+		}
+
+		normalized := make([]string, 0, len(dnsNames))
+		for _, name := range dnsNames {
+			normalized = append(normalized, strings.ToLower(name))
+		}
+		sort.Strings(normalized)
+
+		// a different commonName is a different certificate, not a duplicate
+		commonName, _, _ := unstructured.NestedString(upstreamCert.Object, "spec", "commonName")
+		issuer := upstreamIssuer(upstreamCert)
+		key := strings.Join(normalized, ",") + "|" + issuer + "|" + commonName
+		if groups[key] == nil {
+			groups[key] = &duplicateUpstreams{dnsNames: normalized, issuer: issuer}
+		}
+		groups[key].names = append(groups[key].names, upstreamCert.GetName())
+	}
+
+	var duplicates []duplicateUpstreams
+	for _, group := range groups {
+		if len(group.names) > 1 {
+			sort.Strings(group.names)
+			duplicates = append(duplicates, *group)
+		}
+	}
+
+	// stable output for the same set of upstreams
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].names[0] < duplicates[j].names[0]
+	})
+
+	return duplicates
+}
+
+// upstreamIssuer formats the issuerRef of the upstream Certificate with FormatIssuerRef, the default cert-manager group is
+// left out so it matches upstreams without a group
+func upstreamIssuer(upstreamCert *unstructured.Unstructured) string {
+	ref := cachev1alpha1.IssuerRef{}
+	ref.Name, _, _ = unstructured.NestedString(upstreamCert.Object, "spec", "issuerRef", "name")
+	ref.Kind, _, _ = unstructured.NestedString(upstreamCert.Object, "spec", "issuerRef", "kind")
+	ref.Group, _, _ = unstructured.NestedString(upstreamCert.Object, "spec", "issuerRef", "group")
+	return cachev1alpha1.FormatIssuerRef(normalizeIssuerRef(ref))
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// newDuplicateTestUpstream returns an upstream Certificate in the cache namespace for the issuer and dnsNames
+func newDuplicateTestUpstream(name string, issuerRef cachev1alpha1.IssuerRef, dnsNames ...string) *unstructured.Unstructured {
+	upstreamCert := newUpstreamCertificate()
+	upstreamCert.SetName(name)
+	upstreamCert.SetNamespace("cache")
+	_ = unstructured.SetNestedStringSlice(upstreamCert.Object, dnsNames, "spec", "dnsNames")
+	_ = unstructured.SetNestedMap(upstreamCert.Object, issuerRefToUnstructured(issuerRef), "spec", "issuerRef")
+	return upstreamCert
+}
+
+func Test_DuplicatesHandler(t *testing.T) {
+	issuer := cachev1alpha1.IssuerRef{Name: "my-issuer", Kind: "Issuer"}
+	otherIssuer := cachev1alpha1.IssuerRef{Name: "other-issuer", Kind: "ClusterIssuer"}
+	explicitGroupIssuer := cachev1alpha1.IssuerRef{Name: "my-issuer", Kind: "Issuer", Group: "cert-manager.io"}
+	externalIssuer := cachev1alpha1.IssuerRef{Name: "my-issuer", Kind: "Issuer", Group: "awspca.cert-manager.io"}
+
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"get lists duplicates",
+			http.MethodGet,
+			http.StatusOK,
+			"a.example.com,b.example.com Issuer/my-issuer: cc-a.example.com-b.example.com explicit-group-ab manual-ab\n",
+		},
+		{"post is rejected", http.MethodPost, http.StatusMethodNotAllowed, "method not allowed\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := newFakeClient()
+			for _, upstreamCert := range []*unstructured.Unstructured{
+				newDuplicateTestUpstream("cc-a.example.com-b.example.com", issuer, "a.example.com", "b.example.com"),
+				// same set in another order and case
+				newDuplicateTestUpstream("manual-ab", issuer, "B.example.com", "a.example.com"),
+				// same set from another issuer, e.g. a fallback
+				newDuplicateTestUpstream("cc-a.example.com-b.example.com-other", otherIssuer, "a.example.com", "b.example.com"),
+				// naming the default cert-manager group is the same issuer
+				newDuplicateTestUpstream("explicit-group-ab", explicitGroupIssuer, "a.example.com", "b.example.com"),
+				// an external issuer with the same kind and name is a different issuer
+				newDuplicateTestUpstream("external-ab", externalIssuer, "a.example.com", "b.example.com"),
+				// overlapping but different sets are expected
+				newDuplicateTestUpstream("cc-a.example.com", issuer, "a.example.com"),
+			} {
+				if err := c.Create(ctx, upstreamCert); err != nil {
+					t.Fatalf("unable to create upstream Certificate %v", err)
+				}
+			}
+
+			h := &DuplicatesHandler{Reader: c, CacheNamespace: "cache"}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, DuplicatesPath, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("ServeHTTP() body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+const (
+	// issuerIndexKey is used to index CachedCertificates by the kind/name of every cert-manager issuer they reference
+	issuerIndexKey = "spec.issuerRefs"
+
+	// certManagerGroup is the group of cert-manager issuers, issuerRefs without a group default to it
+	certManagerGroup = "cert-manager.io"
+)
+
+// newIssuer returns an empty cert-manager Issuer or ClusterIssuer for use with watches
+func newIssuer(kind string) *unstructured.Unstructured {
+	issuer := &unstructured.Unstructured{}
+	issuer.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   certManagerGroup,
+		Kind:    kind,
+		Version: "v1",
+	})
+	return issuer
+}
+
+// normalizeIssuerRef drops the cert-manager group, which is the default, so an issuerRef naming it explicitly is the same issuer
+// as one leaving it empty. Groups of external issuers, e.g. awspca.cert-manager.io, are kept
+func normalizeIssuerRef(ref cachev1alpha1.IssuerRef) cachev1alpha1.IssuerRef {
+	if ref.Group == certManagerGroup {
+		ref.Group = ""
+	}
+	return ref
+}
+
+// issuerIndexValues returns the kind/name of each cert-manager issuer the CachedCertificate references, fallbacks included
+// Issuers from other groups, e.g. external issuers, aren't watched so they are left out
+func issuerIndexValues(cert *cachev1alpha1.CachedCertificate) []string {
+	var values []string
+	for _, ref := range append([]cachev1alpha1.IssuerRef{cert.Spec.IssuerRef}, cert.Spec.IssuerRefs...) {
+		if ref.Group != "" && ref.Group != certManagerGroup {
+			continue
+		}
+		values = append(values, ref.Kind+"/"+ref.Name)
+	}
+	return values
+}
+
+// referencesIssuer checks the kind/name key is one of the issuerIndexValues of the CachedCertificate
+func referencesIssuer(cert *cachev1alpha1.CachedCertificate, key string) bool {
+	for _, value := range issuerIndexValues(cert) {
+		if value == key {
+			return true
+		}
+	}
+	return false
+}
+
+// issuerReady reports if the Ready condition of the issuer is True
+func issuerReady(obj client.Object) bool {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Ready" {
+			return condition["status"] == "True"
+		}
+	}
+	return false
+}
+
+// issuerBecameReady only passes issuers that are created ready or move to ready, the moments stuck CachedCertificates
+// can make progress again
+func issuerBecameReady() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return issuerReady(e.Object) },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return !issuerReady(e.ObjectOld) && issuerReady(e.ObjectNew) },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// issuerDependents maps an Issuer to the CachedCertificates in its namespace referencing it, and a ClusterIssuer to
+// those in any namespace
+func (r *CachedCertificateReconciler) issuerDependents(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	key := kind + "/" + obj.GetName()
+	opts := []client.ListOption{client.MatchingFields{issuerIndexKey: key}}
+	if kind == "Issuer" {
+		opts = append(opts, client.InNamespace(obj.GetNamespace()))
+	}
+
+	certList := &cachev1alpha1.CachedCertificateList{}
+	if err := r.List(ctx, certList, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list dependents of issuer", "kind", kind, "name", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range certList.Items {
+		cert := &certList.Items[i]
+		if kind == "Issuer" && cert.Namespace != obj.GetNamespace() {
+			continue
+		}
+		if !referencesIssuer(cert, key) || !r.watches(cert) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: cert.Name, Namespace: cert.Namespace}})
+	}
+
+	return requests
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// newTestIssuer returns an issuer of the kind with its Ready condition set to ready
+func newTestIssuer(kind, namespace, name string, ready bool) *unstructured.Unstructured {
+	status := "False"
+	if ready {
+		status = "True"
+	}
+
+	issuer := newIssuer(kind)
+	issuer.SetName(name)
+	issuer.SetNamespace(namespace)
+	_ = unstructured.SetNestedSlice(issuer.Object, []interface{}{
+		map[string]interface{}{"type": "Ready", "status": status},
+	}, "status", "conditions")
+	return issuer
+}
+
+func Test_issuerBecameReady(t *testing.T) {
+	notReady := newTestIssuer("Issuer", "testing", "my-issuer", false)
+	ready := newTestIssuer("Issuer", "testing", "my-issuer", true)
+
+	tests := []struct {
+		name  string
+		event func() bool
+		want  bool
+	}{
+		{"created ready", func() bool { return issuerBecameReady().Create(event.CreateEvent{Object: ready}) }, true},
+		{"created not ready", func() bool { return issuerBecameReady().Create(event.CreateEvent{Object: notReady}) }, false},
+		{"became ready", func() bool { return issuerBecameReady().Update(event.UpdateEvent{ObjectOld: notReady, ObjectNew: ready}) }, true},
+		{"stayed ready", func() bool { return issuerBecameReady().Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: ready}) }, false},
+		{"became not ready", func() bool { return issuerBecameReady().Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: notReady}) }, false},
+		{"deleted", func() bool { return issuerBecameReady().Delete(event.DeleteEvent{Object: ready}) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event(); got != tt.want {
+				t.Errorf("issuerBecameReady() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_issuerDependents(t *testing.T) {
+	// newTestCachedCertificate uses Issuer/my-issuer in the testing namespace
+	usesIssuer := newTestCachedCertificate("uses-issuer", "a.example.com")
+
+	otherNamespace := newTestCachedCertificate("other-namespace", "b.example.com")
+	otherNamespace.Namespace = "other"
+
+	fallback := newTestCachedCertificate("fallback", "c.example.com")
+	fallback.Spec.IssuerRef = cachev1alpha1.IssuerRef{Kind: "ClusterIssuer", Name: "letsencrypt"}
+	fallback.Spec.IssuerRefs = []cachev1alpha1.IssuerRef{{Kind: "Issuer", Name: "my-issuer", Group: "cert-manager.io"}}
+
+	clusterIssuer := newTestCachedCertificate("cluster-issuer", "d.example.com")
+	clusterIssuer.Namespace = "other"
+	clusterIssuer.Spec.IssuerRef = cachev1alpha1.IssuerRef{Kind: "ClusterIssuer", Name: "letsencrypt"}
+
+	external := newTestCachedCertificate("external", "e.example.com")
+	external.Spec.IssuerRef = cachev1alpha1.IssuerRef{Kind: "Issuer", Name: "my-issuer", Group: "example.com"}
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		WatchIssuers:   true,
+		Client:         newFakeClient(usesIssuer, otherNamespace, fallback, clusterIssuer, external),
+	}
+
+	tests := []struct {
+		name   string
+		issuer *unstructured.Unstructured
+		want   []reconcile.Request
+	}{
+		{
+			"issuer in its namespace only",
+			newTestIssuer("Issuer", "testing", "my-issuer", true),
+			[]reconcile.Request{
+				{NamespacedName: types.NamespacedName{Name: "fallback", Namespace: "testing"}},
+				{NamespacedName: types.NamespacedName{Name: "uses-issuer", Namespace: "testing"}},
+			},
+		},
+		{
+			"cluster issuer in every namespace",
+			newTestIssuer("ClusterIssuer", "", "letsencrypt", true),
+			[]reconcile.Request{
+				{NamespacedName: types.NamespacedName{Name: "cluster-issuer", Namespace: "other"}},
+				{NamespacedName: types.NamespacedName{Name: "fallback", Namespace: "testing"}},
+			},
+		},
+		{"unreferenced issuer", newTestIssuer("Issuer", "testing", "unused", true), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.issuerDependents(tt.issuer)
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Errorf("issuerDependents() diff %v", diff)
+			}
+		})
+	}
+}
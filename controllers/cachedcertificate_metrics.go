@@ -0,0 +1,182 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// metricsListTimeout bounds the cache read done on each scrape
+const metricsListTimeout = 10 * time.Second
+
+var (
+	// stateCountDesc is the low cardinality gauge, one series per state
+	stateCountDesc = prometheus.NewDesc(
+		"cached_certificate_state_count",
+		"Number of CachedCertificates in each state",
+		[]string{"state"}, nil,
+	)
+
+	// objectStateDesc is the high cardinality gauge, one series per CachedCertificate
+	objectStateDesc = prometheus.NewDesc(
+		"cached_certificate_object_state",
+		"State of each CachedCertificate, set to 1 for the current state",
+		[]string{"namespace", "name", "state"}, nil,
+	)
+
+	// expiryDesc is the high cardinality expiry of the synced leaf certificate, one series per CachedCertificate
+	expiryDesc = prometheus.NewDesc(
+		"cached_certificate_expiry_timestamp_seconds",
+		"Expiry of the certificate synced to each CachedCertificate's target secret in seconds since the epoch",
+		[]string{"namespace", "name"}, nil,
+	)
+
+	// metricStates are always reported so counts drop to zero rather than disappearing
+	metricStates = []cachev1alpha1.CachedCertificateState{
+		cachev1alpha1.CachedCertificateStatePending,
+		cachev1alpha1.CachedCertificateStateSynced,
+		cachev1alpha1.CachedCertificateStateError,
+		cachev1alpha1.CachedCertificateStateSyncPaused,
+	}
+)
+
+// NewIssuanceLatencyHistogram returns a histogram for CachedCertificateReconciler.IssuanceLatency, it still needs registering
+func NewIssuanceLatencyHistogram() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cached_certificate_issuance_latency_seconds",
+		Help: "Time from waiting on a new upstream Certificate to its secret being seen, by issuer kind",
+		// 5s to just over 40m, acme challenges usually land in the middle
+		Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{"issuer_kind"})
+}
+
+// MetricsCollector reports CachedCertificate metrics read from the manager cache on each scrape
+// Reading on scrape rather than tracking reconciles keeps the metrics correct after deletes and restarts
+type MetricsCollector struct {
+	client.Reader
+
+	// PerObject adds series for every CachedCertificate labeled by namespace and name, its state and the expiry of its synced
+	// certificate. This is useful for alerting on a single certificate but the number of series grows with the cluster,
+	// so it is off by default and only the per-state counts are reported
+	PerObject bool
+
+	// DefaultSecretNameTemplate has to match the reconciler's to find the target secrets of CachedCertificates without a secretName
+	DefaultSecretNameTemplate *template.Template
+}
+
+// Describe sends the descriptions of the enabled metrics
+func (c *MetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- stateCountDesc
+	if c.PerObject {
+		ch <- objectStateDesc
+		ch <- expiryDesc
+	}
+}
+
+// Collect lists all CachedCertificates and sends the enabled metrics
+func (c *MetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsListTimeout)
+	defer cancel()
+
+	certList := &cachev1alpha1.CachedCertificateList{}
+	if err := c.List(ctx, certList); err != nil {
+		log.Log.WithName("metrics").Error(err, "unable to list CachedCertificates for metrics")
+		ch <- prometheus.NewInvalidMetric(stateCountDesc, err)
+		return
+	}
+
+	if c.PerObject {
+		for _, cert := range certList.Items {
+			if cert.Status.State == "" {
+				// not reconciled yet
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(objectStateDesc, prometheus.GaugeValue, 1, cert.Namespace, cert.Name, string(cert.Status.State))
+		}
+
+		c.collectExpiry(ctx, ch, certList.Items)
+	}
+
+	for state, count := range countStates(certList.Items) {
+		ch <- prometheus.MustNewConstMetric(stateCountDesc, prometheus.GaugeValue, float64(count), string(state))
+	}
+}
+
+// countStates counts the CachedCertificates in each state, every state in metricStates is included even when zero
+// CachedCertificates that haven't been reconciled yet have no state and aren't counted
+func countStates(certs []cachev1alpha1.CachedCertificate) map[cachev1alpha1.CachedCertificateState]int {
+	counts := map[cachev1alpha1.CachedCertificateState]int{}
+	for _, state := range metricStates {
+		counts[state] = 0
+	}
+
+	for _, cert := range certs {
+		if cert.Status.State == "" {
+			continue
+		}
+		counts[cert.Status.State]++
+	}
+
+	return counts
+}
+
+// collectExpiry sends the expiry of each CachedCertificate's synced certificate, read from the NotAfterAnnotationKey of its
+// target secret so nothing is parsed on scrape. CachedCertificates without a synced secret or annotation have no series
+func (c *MetricsCollector) collectExpiry(ctx context.Context, ch chan<- prometheus.Metric, certs []cachev1alpha1.CachedCertificate) {
+	secretList := &v1.SecretList{}
+	if err := c.List(ctx, secretList, client.MatchingLabels{SyncedLabelKey: "true"}); err != nil {
+		log.Log.WithName("metrics").Error(err, "unable to list target secrets for metrics")
+		ch <- prometheus.NewInvalidMetric(expiryDesc, err)
+		return
+	}
+
+	secrets := make(map[types.NamespacedName]*v1.Secret, len(secretList.Items))
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		secrets[types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}] = secret
+	}
+
+	for i := range certs {
+		cert := &certs[i]
+		secretName, err := targetSecretName(c.DefaultSecretNameTemplate, cert)
+		if err != nil {
+			continue
+		}
+
+		// only the secret synced for this CachedCertificate counts, not another one using the same name
+		secret, ok := secrets[types.NamespacedName{Name: secretName, Namespace: cert.Namespace}]
+		if !ok || secret.Annotations[SourceAnnotationKey] != cert.Namespace+"/"+cert.Name {
+			continue
+		}
+		notAfter, err := time.Parse(time.RFC3339, secret.Annotations[NotAfterAnnotationKey])
+		if err != nil {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(expiryDesc, prometheus.GaugeValue, float64(notAfter.Unix()), cert.Namespace, cert.Name)
+	}
+}
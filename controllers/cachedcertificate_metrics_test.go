@@ -0,0 +1,201 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func newTestCachedCertificateInState(name string, state cachev1alpha1.CachedCertificateState) *cachev1alpha1.CachedCertificate {
+	cert := newTestCachedCertificate(name, name+".example.com")
+	cert.Status.State = state
+	return cert
+}
+
+func Test_MetricsCollector(t *testing.T) {
+	reader := newFakeClient(
+		newTestCachedCertificateInState("a", cachev1alpha1.CachedCertificateStateSynced),
+		newTestCachedCertificateInState("b", cachev1alpha1.CachedCertificateStateSynced),
+		newTestCachedCertificateInState("c", cachev1alpha1.CachedCertificateStateError),
+		newTestCachedCertificateInState("d", ""),
+	)
+
+	tests := []struct {
+		name          string
+		perObject     bool
+		wantPerObject map[string]float64
+	}{
+		{"low cardinality", false, nil},
+		{
+			"high cardinality",
+			true,
+			map[string]float64{
+				"testing/a/Synced": 1,
+				"testing/b/Synced": 1,
+				"testing/c/Error":  1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			reg.MustRegister(&MetricsCollector{Reader: reader, PerObject: tt.perObject})
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("Gather() error = %v", err)
+			}
+
+			stateCounts := map[string]float64{}
+			var perObject map[string]float64
+			for _, family := range families {
+				for _, m := range family.GetMetric() {
+					labels := map[string]string{}
+					for _, l := range m.GetLabel() {
+						labels[l.GetName()] = l.GetValue()
+					}
+
+					switch family.GetName() {
+					case "cached_certificate_state_count":
+						stateCounts[labels["state"]] = m.GetGauge().GetValue()
+					case "cached_certificate_object_state":
+						if perObject == nil {
+							perObject = map[string]float64{}
+						}
+						perObject[labels["namespace"]+"/"+labels["name"]+"/"+labels["state"]] = m.GetGauge().GetValue()
+					}
+				}
+			}
+
+			if diff := deep.Equal(stateCounts, map[string]float64{"Pending": 0, "Synced": 2, "Error": 1, "SyncPaused": 0}); diff != nil {
+				t.Errorf("state counts diff %v", diff)
+			}
+			if diff := deep.Equal(perObject, tt.wantPerObject); diff != nil {
+				t.Errorf("per object gauge diff %v", diff)
+			}
+		})
+	}
+}
+
+func Test_MetricsCollectorExpiry(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	leaf := newTestCertWithNotBefore(t, "leaf", root, false, time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC))
+
+	synced := newTestCachedCertificateInState("synced", cachev1alpha1.CachedCertificateStateSynced)
+	upstreamSecret := &v1.Secret{Data: map[string][]byte{"tls.crt": encodeChain(leaf, root), "tls.key": []byte("key")}}
+	secret, err := genSecretForSync(synced, &unstructured.Unstructured{}, upstreamSecret, ownerReference(synced, true), nil)
+	if err != nil {
+		t.Fatalf("genSecretForSync(, nil) error = %v", err)
+	}
+	// the reconciler defaults secretName before generating the secret
+	secret.Name = "synced"
+
+	// a secret with the right name that belongs to another CachedCertificate doesn't count
+	unsynced := newTestCachedCertificateInState("unsynced", cachev1alpha1.CachedCertificateStatePending)
+	unrelated := secret.DeepCopy()
+	unrelated.Name = "unsynced"
+	unrelated.Annotations[SourceAnnotationKey] = "testing/other"
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(&MetricsCollector{Reader: newFakeClient(synced, unsynced, secret, unrelated), PerObject: true})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	expiry := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "cached_certificate_expiry_timestamp_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			expiry[labels["namespace"]+"/"+labels["name"]] = m.GetGauge().GetValue()
+		}
+	}
+
+	// the leaf is valid for two hours from its notBefore
+	want := float64(time.Date(2021, 11, 1, 14, 0, 0, 0, time.UTC).Unix())
+	if diff := deep.Equal(expiry, map[string]float64{"testing/synced": want}); diff != nil {
+		t.Errorf("expiry gauge diff %v", diff)
+	}
+}
+
+func Test_ReconcileIssuanceLatency(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFakeClock(time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC))
+	cachedCert := newTestCachedCertificate("latency", "latency.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace:  "cache",
+		IssuanceLatency: NewIssuanceLatencyHistogram(),
+		Clock:           fakeClock,
+		Client:          newFakeClient(cachedCert),
+	}
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(r.IssuanceLatency)
+
+	key := types.NamespacedName{Name: "latency", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	fakeClock.Step(90 * time.Second)
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-latency.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	// the second reconcile after issuance has nothing left to observe
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	observed := map[string][2]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "issuer_kind" {
+					observed[l.GetValue()] = [2]float64{float64(m.GetHistogram().GetSampleCount()), m.GetHistogram().GetSampleSum()}
+				}
+			}
+		}
+	}
+	if diff := deep.Equal(observed, map[string][2]float64{"Issuer": {1, 90}}); diff != nil {
+		t.Errorf("issuance latency (count, sum) diff %v", diff)
+	}
+}
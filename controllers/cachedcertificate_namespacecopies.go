@@ -0,0 +1,321 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// selectedNamespaces returns the namespaces matching the SecretNamespaceSelector, other than the CachedCertificate's own
+// Terminating namespaces are left out since creates are refused there and everything in them is about to be deleted
+func (r *CachedCertificateReconciler) selectedNamespaces(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) (map[string]bool, error) {
+	selected := map[string]bool{}
+	if cachedCert.Spec.SecretNamespaceSelector == nil {
+		return selected, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(cachedCert.Spec.SecretNamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secretNamespaceSelector: %w", err)
+	}
+
+	namespaceList := &v1.NamespaceList{}
+	if err = r.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	for _, namespace := range namespaceList.Items {
+		if namespace.Name == cachedCert.GetNamespace() || namespace.Status.Phase == v1.NamespaceTerminating || namespace.GetDeletionTimestamp() != nil {
+			continue
+		}
+		selected[namespace.Name] = true
+	}
+
+	return selected, nil
+}
+
+// syncNamespaceCopies copies the target secret into every namespace selected by the SecretNamespaceSelector and removes
+// copies from namespaces that are no longer selected, or that still have the copy under a previous secretName
+// Copies can't be owned by the CachedCertificate since owner references don't cross namespaces, they are labeled with its
+// uid instead and the StaleSecretCollector removes them once it is deleted. A failure in one namespace doesn't stop the others
+// At most NamespaceCopiesPerReconcile namespaces are written, the namespaces with an up to date copy are kept in
+// status.syncedNamespaces so the next reconcile resumes from there, done is false while namespaces are left to write
+// The ownership check runs in every namespace reached, status.conflictingNamespaces keeps the others from earlier reconciles
+func (r *CachedCertificateReconciler) syncNamespaceCopies(ctx context.Context, reqLog logr.Logger, cachedCert *cachev1alpha1.CachedCertificate, secret *v1.Secret) (done bool, err error) {
+	uid := string(cachedCert.GetUID())
+	status := &cachedCert.Status
+
+	selected, err := r.selectedNamespaces(ctx, cachedCert)
+	if err != nil {
+		return false, err
+	}
+
+	copyList := &v1.SecretList{}
+	if err = r.List(ctx, copyList, client.MatchingLabels{CopyOfLabelKey: uid}); err != nil {
+		return false, err
+	}
+	current := map[string]string{}
+	for i := range copyList.Items {
+		if copied := &copyList.Items[i]; copied.Name == secret.Name {
+			current[copied.Namespace] = namespaceCopyHash(copied)
+		}
+	}
+
+	// progress only carries over while the same copy is being written, a copy deleted or changed since is written again
+	hash := namespaceCopyHash(genNamespaceCopy(secret, "", uid))
+	synced := map[string]bool{}
+	if status.SyncedNamespacesHash == hash {
+		for _, namespace := range status.SyncedNamespaces {
+			synced[namespace] = selected[namespace] && current[namespace] == hash
+		}
+	}
+	previousConflicts := map[string]bool{}
+	for _, namespace := range status.ConflictingNamespaces {
+		previousConflicts[namespace] = selected[namespace]
+	}
+
+	namespaces := make([]string, 0, len(selected))
+	for namespace := range selected {
+		if !synced[namespace] {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+
+	// written at the end so the progress is recorded whichever way the fan-out ends
+	writes := 0
+	done = true
+	conflicts := map[string]bool{}
+	defer func() {
+		status.SyncedNamespaces = sortedKeys(synced)
+		status.SyncedNamespacesHash = hash
+		status.ConflictingNamespaces = sortedKeys(conflicts)
+	}()
+
+	var errs []error
+	for _, namespace := range namespaces {
+		if r.NamespaceCopiesPerReconcile > 0 && writes >= r.NamespaceCopiesPerReconcile {
+			// not reached this time, a conflict seen earlier stays reported until the namespace is checked again
+			conflicts[namespace] = previousConflicts[namespace]
+			done = false
+			continue
+		}
+
+		written, err := r.upsertNamespaceCopy(ctx, genNamespaceCopy(secret, namespace, uid))
+		if written {
+			writes++
+		}
+		if err != nil {
+			reqLog.Error(err, "unable to copy target Secret", "namespace", namespace)
+			if errors.Is(err, ErrSecretOwnershipConflict) {
+				conflicts[namespace] = true
+			}
+			errs = append(errs, err)
+			continue
+		}
+		synced[namespace] = true
+	}
+
+	for i := range copyList.Items {
+		copied := &copyList.Items[i]
+		if selected[copied.Namespace] && copied.Name == secret.Name {
+			continue
+		}
+		if r.NamespaceCopiesPerReconcile > 0 && writes >= r.NamespaceCopiesPerReconcile {
+			done = false
+			continue
+		}
+
+		reqLog.Info("removing copy of target Secret", "namespace", copied.Namespace, "name", copied.Name)
+		writes++
+		if err = r.Delete(ctx, copied, client.Preconditions{UID: &copied.UID}); err != nil && !k8serr.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return done, utilerrors.NewAggregate(errs)
+}
+
+// namespaceCopyHash hashes everything a copy of the target secret is written with other than its namespace
+func namespaceCopyHash(copied *v1.Secret) string {
+	content := map[string][]byte{"type": []byte(copied.Type)}
+	for k, v := range copied.Data {
+		content["data/"+k] = v
+	}
+	for k, v := range copied.Labels {
+		content["labels/"+k] = []byte(v)
+	}
+	for k, v := range copied.Annotations {
+		content["annotations/"+k] = []byte(v)
+	}
+	return secretDataHash(content)
+}
+
+// sortedKeys returns the sorted keys set to true
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for k, ok := range set {
+		if ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// consumerNamespaces returns the sorted namespaces holding a secret synced from the CachedCertificate, found through the
+// index on the SourceAnnotationKey every synced secret and copy carries along with SyncedLabelKey
+func (r *CachedCertificateReconciler) consumerNamespaces(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate) ([]string, error) {
+	source := cachedCert.Namespace + "/" + cachedCert.Name
+	secretList := &v1.SecretList{}
+	if err := r.List(ctx, secretList, client.MatchingLabels{SyncedLabelKey: "true"}, client.MatchingFields{sourceIndexKey: source}); err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	for _, secret := range secretList.Items {
+		// the index narrows the list, the source is still checked like the other indexed lookups
+		if secret.Annotations[SourceAnnotationKey] == source {
+			found[secret.Namespace] = true
+		}
+	}
+
+	namespaces := make([]string, 0, len(found))
+	for namespace := range found {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// genNamespaceCopy returns the target secret moved to the namespace and labeled as a copy for the CachedCertificate uid
+func genNamespaceCopy(secret *v1.Secret, namespace, uid string) *v1.Secret {
+	copied := secret.DeepCopy()
+	copied.Namespace = namespace
+	copied.OwnerReferences = nil
+	copied.ResourceVersion = ""
+	copied.UID = ""
+	if copied.Labels == nil {
+		copied.Labels = map[string]string{}
+	}
+	copied.Labels[CopyOfLabelKey] = uid
+	return copied
+}
+
+// upsertNamespaceCopy creates or updates a copy of the target secret, a secret that isn't a copy for the same
+// CachedCertificate is never overwritten. written is true once a write was attempted, the ownership check alone isn't one
+func (r *CachedCertificateReconciler) upsertNamespaceCopy(ctx context.Context, copied *v1.Secret) (written bool, err error) {
+	existing := &v1.Secret{}
+	err = r.Get(ctx, types.NamespacedName{Name: copied.Name, Namespace: copied.Namespace}, existing)
+	if k8serr.IsNotFound(err) {
+		return true, r.writeTargetSecret(ctx, copied, false)
+	} else if err != nil {
+		return false, err
+	}
+
+	if existing.Labels[CopyOfLabelKey] != copied.Labels[CopyOfLabelKey] {
+		return false, fmt.Errorf("refusing to update secret %s/%s: %w", copied.Namespace, copied.Name, ErrSecretOwnershipConflict)
+	}
+
+	if existing.Type != copied.Type {
+		// the type of a secret can't be updated, replace the copy to change it
+		if err = r.Delete(ctx, existing, client.Preconditions{UID: &existing.UID}); err != nil && !k8serr.IsNotFound(err) {
+			return true, err
+		}
+		return true, r.writeTargetSecret(ctx, copied, false)
+	}
+
+	return true, r.writeTargetSecret(ctx, copied, true)
+}
+
+// namespaceLabelsChanged passes namespaces coming and going, or whose labels changed, as those can change which
+// namespaces a SecretNamespaceSelector matches
+func namespaceLabelsChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return true },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !labels.Equals(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return true },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// namespaceSelectorDependents maps a namespace to every CachedCertificate with a SecretNamespaceSelector
+// the selector isn't checked so a namespace that just lost a matching label also gets its copies removed
+func (r *CachedCertificateReconciler) namespaceSelectorDependents(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+
+	certList := &cachev1alpha1.CachedCertificateList{}
+	if err := r.List(ctx, certList); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list CachedCertificates copying secrets into namespace", "namespace", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cert := range certList.Items {
+		if cert.Spec.SecretNamespaceSelector == nil || !r.watches(&cert) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: cert.Name, Namespace: cert.Namespace}})
+	}
+
+	return requests
+}
+
+// namespaceCopyDeleted passes deleted copies of target secrets so they are restored
+func namespaceCopyDeleted() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		UpdateFunc: func(event.UpdateEvent) bool { return false },
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			_, ok := e.Object.GetLabels()[CopyOfLabelKey]
+			return ok
+		},
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// namespaceCopySource maps a copy of a target secret to the CachedCertificate in its source annotation
+func namespaceCopySource(obj client.Object) []reconcile.Request {
+	parts := strings.Split(obj.GetAnnotations()[SourceAnnotationKey], "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: parts[1], Namespace: parts[0]}}}
+}
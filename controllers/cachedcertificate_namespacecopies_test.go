@@ -0,0 +1,427 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func newTestNamespace(name string, labels map[string]string) *v1.Namespace {
+	return &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func Test_ReconcileNamespaceCopies(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("copied", "copied.example.com")
+	cachedCert.UID = "copied-uid"
+	cachedCert.Spec.SecretNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	r := &CachedCertificateReconciler{
+		CacheNamespace:  "cache",
+		NamespaceCopies: true,
+		Client: newFakeClient(
+			cachedCert,
+			// the CachedCertificate's own namespace matching doesn't make a copy of the target secret onto itself
+			newTestNamespace("testing", map[string]string{"team": "a"}),
+			newTestNamespace("team-a", map[string]string{"team": "a"}),
+			newTestNamespace("team-b", map[string]string{"team": "b"}),
+		),
+	}
+
+	key := types.NamespacedName{Name: "copied", Namespace: "testing"}
+	reconcile := func() {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+	}
+	relabel := func(name, team string) {
+		t.Helper()
+		namespace := &v1.Namespace{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+			t.Fatalf("unable to get namespace %v", err)
+		}
+		namespace.Labels = map[string]string{"team": team}
+		if err := r.Update(ctx, namespace); err != nil {
+			t.Fatalf("unable to update namespace %v", err)
+		}
+	}
+	copiedTo := func() []string {
+		t.Helper()
+		copyList := &v1.SecretList{}
+		if err := r.List(ctx, copyList, client.MatchingLabels{CopyOfLabelKey: "copied-uid"}); err != nil {
+			t.Fatalf("unable to list copies %v", err)
+		}
+		namespaces := []string{}
+		for _, copied := range copyList.Items {
+			namespaces = append(namespaces, copied.Namespace)
+		}
+		sort.Strings(namespaces)
+		return namespaces
+	}
+
+	reconcile()
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-copied.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	reconcile()
+
+	if diff := deep.Equal(copiedTo(), []string{"team-a"}); diff != nil {
+		t.Errorf("copies diff %v", diff)
+	}
+
+	secret := &v1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	copied := &v1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "copied", Namespace: "team-a"}, copied); err != nil {
+		t.Fatalf("unable to get copy %v", err)
+	}
+	if diff := deep.Equal(copied.Data, secret.Data); diff != nil {
+		t.Errorf("copy data diff %v", diff)
+	}
+	if len(copied.OwnerReferences) != 0 {
+		t.Errorf("copy ownerReferences = %v, want none across namespaces", copied.OwnerReferences)
+	}
+	if copied.Annotations[SourceAnnotationKey] != "testing/copied" {
+		t.Errorf("copy source = %q, want testing/copied", copied.Annotations[SourceAnnotationKey])
+	}
+
+	// a namespace gaining the label gets a copy
+	relabel("team-b", "a")
+	reconcile()
+	if diff := deep.Equal(copiedTo(), []string{"team-a", "team-b"}); diff != nil {
+		t.Errorf("copies after team-b gained the label diff %v", diff)
+	}
+
+	// a namespace losing the label has its copy removed
+	relabel("team-a", "b")
+	reconcile()
+	if diff := deep.Equal(copiedTo(), []string{"team-b"}); diff != nil {
+		t.Errorf("copies after team-a lost the label diff %v", diff)
+	}
+
+	// removing the selector removes every copy
+	if err := r.Get(ctx, key, cachedCert); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	cachedCert.Spec.SecretNamespaceSelector = nil
+	if err := r.Update(ctx, cachedCert); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+	reconcile()
+	if diff := deep.Equal(copiedTo(), []string{}); diff != nil {
+		t.Errorf("copies after removing the selector diff %v", diff)
+	}
+}
+
+func Test_ReconcileConsumerNamespaces(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("consumed", "consumed.example.com")
+	cachedCert.UID = "consumed-uid"
+	cachedCert.Spec.SecretNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	r := &CachedCertificateReconciler{
+		CacheNamespace:  "cache",
+		NamespaceCopies: true,
+		Client: newFakeClient(
+			cachedCert,
+			newTestNamespace("team-a", map[string]string{"team": "a"}),
+			newTestNamespace("team-b", map[string]string{"team": "a"}),
+			// synced from another CachedCertificate, not a consumer of this one
+			&v1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Name:        "consumed",
+				Namespace:   "team-c",
+				Labels:      map[string]string{SyncedLabelKey: "true"},
+				Annotations: map[string]string{SourceAnnotationKey: "team-c/consumed"},
+			}},
+		),
+	}
+
+	key := types.NamespacedName{Name: "consumed", Namespace: "testing"}
+	reconcile := func() []string {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got.Status.ConsumerNamespaces
+	}
+
+	if got := reconcile(); len(got) != 0 {
+		t.Errorf("Reconcile() consumerNamespaces = %v before the first sync, want none", got)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-consumed.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if diff := deep.Equal(reconcile(), []string{"team-a", "team-b", "testing"}); diff != nil {
+		t.Errorf("consumerNamespaces diff %v", diff)
+	}
+
+	// a namespace losing the label has its copy removed and is no longer listed
+	namespace := &v1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "team-b"}, namespace); err != nil {
+		t.Fatalf("unable to get namespace %v", err)
+	}
+	namespace.Labels = map[string]string{"team": "b"}
+	if err := r.Update(ctx, namespace); err != nil {
+		t.Fatalf("unable to update namespace %v", err)
+	}
+	if diff := deep.Equal(reconcile(), []string{"team-a", "testing"}); diff != nil {
+		t.Errorf("consumerNamespaces after team-b lost the label diff %v", diff)
+	}
+}
+
+func Test_ReconcileNamespaceCopyConflict(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("conflict", "conflict.example.com")
+	cachedCert.UID = "conflict-uid"
+	cachedCert.Spec.SecretNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	unrelated := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "conflict", Namespace: "team-a-2"}, Data: map[string][]byte{"keep": []byte("me")}}
+	r := &CachedCertificateReconciler{
+		CacheNamespace:  "cache",
+		NamespaceCopies: true,
+		Client: newFakeClient(cachedCert, unrelated,
+			newTestNamespace("team-a-1", map[string]string{"team": "a"}),
+			newTestNamespace("team-a-2", map[string]string{"team": "a"}),
+			newTestNamespace("team-a-3", map[string]string{"team": "a"}),
+		),
+	}
+
+	key := types.NamespacedName{Name: "conflict", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-conflict.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err == nil {
+		t.Fatal("Reconcile() expected an error for a secret that isn't a copy")
+	}
+
+	if err := r.Get(ctx, key, cachedCert); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if cachedCert.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&cachedCert.Status) != cachev1alpha1.ReasonSecretConflict {
+		t.Errorf("status = %v/%v, want Error/%v", cachedCert.Status.State, readyReason(&cachedCert.Status), cachev1alpha1.ReasonSecretConflict)
+	}
+	if diff := deep.Equal(cachedCert.Status.ConflictingNamespaces, []string{"team-a-2"}); diff != nil {
+		t.Errorf("status.conflictingNamespaces diff %v", diff)
+	}
+
+	// the conflict doesn't keep the other namespaces from getting their copy
+	for _, namespace := range []string{"team-a-1", "team-a-3"} {
+		copied := &v1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: "conflict", Namespace: namespace}, copied); err != nil {
+			t.Errorf("unable to get copy in %v %v", namespace, err)
+		} else if copied.Labels[CopyOfLabelKey] != "conflict-uid" {
+			t.Errorf("copy in %v labels = %v, want a copy of conflict-uid", namespace, copied.Labels)
+		}
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(unrelated), unrelated); err != nil {
+		t.Fatalf("unable to get unrelated secret %v", err)
+	}
+	if string(unrelated.Data["keep"]) != "me" || len(unrelated.Data) != 1 {
+		t.Errorf("unrelated secret data = %v, want it untouched", unrelated.Data)
+	}
+
+	// the conflict is cleared once the secret is out of the way
+	if err := r.Delete(ctx, unrelated); err != nil {
+		t.Fatalf("unable to delete unrelated secret %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if len(got.Status.ConflictingNamespaces) != 0 || got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("status = %v with conflicts %v after removing the secret, want Synced without conflicts", got.Status.State, got.Status.ConflictingNamespaces)
+	}
+}
+
+// namespaceFailingClient refuses secret creates in the failing namespace
+type namespaceFailingClient struct {
+	client.Client
+	failing string
+}
+
+func (c *namespaceFailingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*v1.Secret); ok && obj.GetNamespace() == c.failing {
+		return k8serr.NewServiceUnavailable("etcd is unavailable")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func Test_ReconcileNamespaceCopiesPerReconcile(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("batched", "batched.example.com")
+	cachedCert.UID = "batched-uid"
+	cachedCert.Spec.SecretNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	c := &namespaceFailingClient{Client: newFakeClient(cachedCert,
+		newTestNamespace("team-a-1", map[string]string{"team": "a"}),
+		newTestNamespace("team-a-2", map[string]string{"team": "a"}),
+		newTestNamespace("team-a-3", map[string]string{"team": "a"}),
+		newTestNamespace("team-a-4", map[string]string{"team": "a"}),
+		newTestNamespace("team-a-5", map[string]string{"team": "a"}),
+	)}
+	r := &CachedCertificateReconciler{
+		CacheNamespace:              "cache",
+		NamespaceCopies:             true,
+		NamespaceCopiesPerReconcile: 2,
+		Client:                      c,
+	}
+
+	key := types.NamespacedName{Name: "batched", Namespace: "testing"}
+	getStatus := func() cachev1alpha1.CachedCertificateStatus {
+		t.Helper()
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got.Status
+	}
+	copiedTo := func() []string {
+		t.Helper()
+		copyList := &v1.SecretList{}
+		if err := r.List(ctx, copyList, client.MatchingLabels{CopyOfLabelKey: "batched-uid"}); err != nil {
+			t.Fatalf("unable to list copies %v", err)
+		}
+		namespaces := []string{}
+		for _, copied := range copyList.Items {
+			namespaces = append(namespaces, copied.Namespace)
+		}
+		sort.Strings(namespaces)
+		return namespaces
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-batched.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	// the second namespace of the first batch fails, the first one is recorded as done
+	c.failing = "team-a-2"
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err == nil {
+		t.Fatal("Reconcile() expected an error for the failed copy")
+	}
+	status := getStatus()
+	if status.State != cachev1alpha1.CachedCertificateStateError {
+		t.Errorf("status.state = %v after a failed copy, want Error", status.State)
+	}
+	if diff := deep.Equal(status.SyncedNamespaces, []string{"team-a-1"}); diff != nil {
+		t.Errorf("status.syncedNamespaces after a failed copy diff %v", diff)
+	}
+	if diff := deep.Equal(copiedTo(), []string{"team-a-1"}); diff != nil {
+		t.Errorf("copies after a failed copy diff %v", diff)
+	}
+
+	first := &v1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "batched", Namespace: "team-a-1"}, first); err != nil {
+		t.Fatalf("unable to get copy %v", err)
+	}
+
+	// the next reconcile resumes with the failed namespace and requeues for the rest
+	c.failing = ""
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("Reconcile() result = %+v with namespaces left, want a requeue", result)
+	}
+	status = getStatus()
+	if status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("status.state = %v, want Synced", status.State)
+	}
+	if diff := deep.Equal(status.SyncedNamespaces, []string{"team-a-1", "team-a-2", "team-a-3"}); diff != nil {
+		t.Errorf("status.syncedNamespaces diff %v", diff)
+	}
+
+	// namespaces already done aren't written again
+	resumed := &v1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "batched", Namespace: "team-a-1"}, resumed); err != nil {
+		t.Fatalf("unable to get copy %v", err)
+	}
+	if resumed.ResourceVersion != first.ResourceVersion {
+		t.Errorf("copy in team-a-1 was written again, resourceVersion %v -> %v", first.ResourceVersion, resumed.ResourceVersion)
+	}
+
+	// the last batch finishes the fan-out
+	result, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if result.RequeueAfter != 0 || result.Requeue {
+		t.Errorf("Reconcile() result = %+v once every namespace is written, want no requeue", result)
+	}
+	want := []string{"team-a-1", "team-a-2", "team-a-3", "team-a-4", "team-a-5"}
+	if diff := deep.Equal(getStatus().SyncedNamespaces, want); diff != nil {
+		t.Errorf("status.syncedNamespaces once done diff %v", diff)
+	}
+	if diff := deep.Equal(copiedTo(), want); diff != nil {
+		t.Errorf("copies once done diff %v", diff)
+	}
+
+	// a copy deleted from a synced namespace is restored
+	if err := r.Delete(ctx, resumed); err != nil {
+		t.Fatalf("unable to delete copy %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if diff := deep.Equal(copiedTo(), want); diff != nil {
+		t.Errorf("copies after deleting one diff %v", diff)
+	}
+}
+
+func Test_namespaceSelectorDependents(t *testing.T) {
+	selected := newTestCachedCertificate("selected", "selected.example.com")
+	selected.Spec.SecretNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	plain := newTestCachedCertificate("plain", "plain.example.com")
+
+	r := &CachedCertificateReconciler{Client: newFakeClient(selected, plain)}
+
+	// the namespace doesn't match, it may have just lost the label
+	got := r.namespaceSelectorDependents(newTestNamespace("team-b", nil))
+	if diff := deep.Equal(got, []ctrl.Request{{NamespacedName: types.NamespacedName{Name: "selected", Namespace: "testing"}}}); diff != nil {
+		t.Errorf("namespaceSelectorDependents() diff %v", diff)
+	}
+}
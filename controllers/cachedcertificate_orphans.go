@@ -0,0 +1,201 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// defaultOrphanCollectionInterval is how often upstream Certificates are checked when OrphanCollector.Interval is unset
+const defaultOrphanCollectionInterval = 5 * time.Minute
+
+// OrphanCollector deletes upstream Certificates, and their secrets, once no CachedCertificate has used them for GracePeriod
+// An orphan is first marked with OrphanedAtAnnotationKey, a CachedCertificate using it again within the grace period
+// clears the mark. The grace period keeps upstreams around while CachedCertificates are deleted and re-applied
+// Only upstream Certificates annotated with ReferencedByAnnotationKey are considered, anything else in the cache namespace is left alone
+type OrphanCollector struct {
+	client.Client
+
+	// CacheNamespace is the namespace holding the upstream Certificates
+	CacheNamespace string
+
+	// GracePeriod is how long an upstream Certificate stays orphaned before it is deleted
+	GracePeriod time.Duration
+
+	// Interval is how often upstream Certificates are checked, defaulting to defaultOrphanCollectionInterval
+	Interval time.Duration
+
+	// Clock is used to time the grace period, nil uses the real clock
+	Clock clock.Clock
+}
+
+// Start collects orphans until the context is done, errors are logged and retried on the next tick
+func (c *OrphanCollector) Start(ctx context.Context) error {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = defaultOrphanCollectionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.collect(ctx); err != nil {
+			log.FromContext(ctx).WithName("orphans").Error(err, "unable to collect orphaned upstream Certificates")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection only lets the leader delete upstream Certificates
+func (c *OrphanCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// now returns the current time from the Clock when set
+func (c *OrphanCollector) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// collect marks new orphans, clears the mark on upstreams in use again and deletes orphans past the grace period
+func (c *OrphanCollector) collect(ctx context.Context) error {
+	reqLog := log.FromContext(ctx).WithName("orphans")
+
+	upstreamList := &unstructured.UnstructuredList{}
+	upstreamList.SetGroupVersionKind(schema.GroupVersionKind{Group: "cert-manager.io", Kind: "CertificateList", Version: "v1"})
+	if err := c.List(ctx, upstreamList, client.InNamespace(c.CacheNamespace)); err != nil {
+		return err
+	}
+
+	for i := range upstreamList.Items {
+		upstreamCert := &upstreamList.Items[i]
+		annotations := upstreamCert.GetAnnotations()
+		if _, managed := annotations[ReferencedByAnnotationKey]; !managed {
+			continue
+		}
+
+		inUse, err := c.inUse(ctx, upstreamCert)
+		if err != nil {
+			return err
+		}
+
+		orphanedAt, marked := annotations[OrphanedAtAnnotationKey]
+		switch {
+		case inUse && marked:
+			reqLog.Info("upstream Certificate is in use again", "upstream", upstreamCert.GetName())
+			err = c.setOrphanedAt(ctx, upstreamCert, "")
+		case inUse:
+			continue
+		case !marked:
+			reqLog.Info("upstream Certificate is orphaned", "upstream", upstreamCert.GetName(), "gracePeriod", c.GracePeriod.String())
+			err = c.setOrphanedAt(ctx, upstreamCert, c.now().UTC().Format(time.RFC3339))
+		default:
+			since, parseErr := time.Parse(time.RFC3339, orphanedAt)
+			if parseErr != nil {
+				// restart the grace period rather than deleting on a mark we can't read
+				err = c.setOrphanedAt(ctx, upstreamCert, c.now().UTC().Format(time.RFC3339))
+				break
+			}
+			if c.now().Sub(since) < c.GracePeriod {
+				continue
+			}
+			reqLog.Info("deleting orphaned upstream Certificate", "upstream", upstreamCert.GetName(), "orphanedAt", orphanedAt)
+			err = c.delete(ctx, upstreamCert)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inUse reports if any CachedCertificate references the upstream Certificate
+func (c *OrphanCollector) inUse(ctx context.Context, upstreamCert *unstructured.Unstructured) (bool, error) {
+	certList := &cachev1alpha1.CachedCertificateList{}
+	if err := c.List(ctx, certList, client.MatchingFields{upstreamRefNameIndexKey: upstreamCert.GetName()}); err != nil {
+		return false, err
+	}
+
+	for _, cert := range certList.Items {
+		ref := cert.Status.UpstreamRef
+		if ref != nil && ref.Name == upstreamCert.GetName() && ref.Namespace == upstreamCert.GetNamespace() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setOrphanedAt sets the orphan mark to the given time, an empty value removes it
+func (c *OrphanCollector) setOrphanedAt(ctx context.Context, upstreamCert *unstructured.Unstructured, value string) error {
+	patch := client.MergeFrom(upstreamCert.DeepCopy())
+	annotations := upstreamCert.GetAnnotations()
+	if value == "" {
+		delete(annotations, OrphanedAtAnnotationKey)
+	} else {
+		annotations[OrphanedAtAnnotationKey] = value
+	}
+	upstreamCert.SetAnnotations(annotations)
+
+	return c.Patch(ctx, upstreamCert, patch)
+}
+
+// delete removes the upstream Certificate and its secret, the resource version precondition
+// skips the delete when a CachedCertificate reclaimed the upstream since it was listed
+func (c *OrphanCollector) delete(ctx context.Context, upstreamCert *unstructured.Unstructured) error {
+	resourceVersion := upstreamCert.GetResourceVersion()
+	err := c.Delete(ctx, upstreamCert, &client.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion}})
+	if k8serr.IsNotFound(err) || k8serr.IsConflict(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// cert-manager leaves the secret behind by default
+	secretName, _, _ := unstructured.NestedString(upstreamCert.Object, "spec", "secretName")
+	if secretName == "" {
+		return nil
+	}
+	secret := &v1.Secret{}
+	secret.SetName(secretName)
+	secret.SetNamespace(upstreamCert.GetNamespace())
+	if err = c.Delete(ctx, secret); err != nil && !k8serr.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+// newOrphanedUpstream creates an issued upstream Certificate in the cache namespace that no CachedCertificate uses
+func newOrphanedUpstream(ctx context.Context, t *testing.T, c client.Client, name string) *unstructured.Unstructured {
+	t.Helper()
+
+	upstreamCert := newUpstreamCertificate()
+	upstreamCert.SetName(name)
+	upstreamCert.SetNamespace("cache")
+	upstreamCert.SetAnnotations(map[string]string{ReferencedByAnnotationKey: ""})
+	_ = unstructured.SetNestedStringSlice(upstreamCert.Object, []string{"a.example.com"}, "spec", "dnsNames")
+	_ = unstructured.SetNestedField(upstreamCert.Object, name, "spec", "secretName")
+	_ = unstructured.SetNestedMap(upstreamCert.Object, map[string]interface{}{"name": "my-issuer", "kind": "Issuer"}, "spec", "issuerRef")
+	if err := c.Create(ctx, upstreamCert); err != nil {
+		t.Fatalf("unable to create upstream Certificate %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, c, types.NamespacedName{Name: name, Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	return upstreamCert
+}
+
+// orphanedAt returns the orphan mark of the upstream Certificate, failing when it's gone
+func orphanedAt(ctx context.Context, t *testing.T, c client.Client, name string) (string, bool) {
+	t.Helper()
+
+	upstreamCert := newUpstreamCertificate()
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: "cache"}, upstreamCert); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	value, ok := upstreamCert.GetAnnotations()[OrphanedAtAnnotationKey]
+	return value, ok
+}
+
+func Test_OrphanCollectorDeletesAfterGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFakeClock(time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC))
+	c := newFakeClient()
+	newOrphanedUpstream(ctx, t, c, "cc-a.example.com")
+
+	// not ours, never touched
+	unmanaged := newUpstreamCertificate()
+	unmanaged.SetName("unmanaged")
+	unmanaged.SetNamespace("cache")
+	if err := c.Create(ctx, unmanaged); err != nil {
+		t.Fatalf("unable to create Certificate %v", err)
+	}
+
+	collector := &OrphanCollector{Client: c, CacheNamespace: "cache", GracePeriod: time.Hour, Clock: fakeClock}
+	if err := collector.collect(ctx); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	if value, _ := orphanedAt(ctx, t, c, "cc-a.example.com"); value != "2021-11-01T12:00:00Z" {
+		t.Errorf("orphaned-at = %q, want the time it was first seen", value)
+	}
+
+	fakeClock.Step(59 * time.Minute)
+	if err := collector.collect(ctx); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	if value, _ := orphanedAt(ctx, t, c, "cc-a.example.com"); value != "2021-11-01T12:00:00Z" {
+		t.Errorf("orphaned-at = %q, want unchanged within the grace period", value)
+	}
+
+	fakeClock.Step(time.Minute)
+	if err := collector.collect(ctx); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	key := types.NamespacedName{Name: "cc-a.example.com", Namespace: "cache"}
+	if err := c.Get(ctx, key, newUpstreamCertificate()); !k8serr.IsNotFound(err) {
+		t.Errorf("upstream Certificate not deleted after the grace period, err %v", err)
+	}
+	if err := c.Get(ctx, key, &v1.Secret{}); !k8serr.IsNotFound(err) {
+		t.Errorf("upstream secret not deleted after the grace period, err %v", err)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Name: "unmanaged", Namespace: "cache"}, newUpstreamCertificate()); err != nil {
+		t.Errorf("unmanaged Certificate deleted %v", err)
+	}
+}
+
+func Test_OrphanCollectorReclaimed(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFakeClock(time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC))
+	c := newFakeClient()
+	newOrphanedUpstream(ctx, t, c, "cc-a.example.com")
+
+	collector := &OrphanCollector{Client: c, CacheNamespace: "cache", GracePeriod: time.Hour, Clock: fakeClock}
+	if err := collector.collect(ctx); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	if _, marked := orphanedAt(ctx, t, c, "cc-a.example.com"); !marked {
+		t.Fatal("collect() did not mark the orphaned upstream Certificate")
+	}
+
+	// re-applied within the grace period, picking up the existing upstream
+	cachedCert := newTestCachedCertificate("a", "a.example.com")
+	if err := c.Create(ctx, cachedCert); err != nil {
+		t.Fatalf("unable to create CachedCertificate %v", err)
+	}
+	r := &CachedCertificateReconciler{CacheNamespace: "cache", Client: c}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "a", Namespace: "testing"}}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, marked := orphanedAt(ctx, t, c, "cc-a.example.com"); marked {
+		t.Error("Reconcile() did not clear the orphan mark")
+	}
+
+	fakeClock.Step(2 * time.Hour)
+	if err := collector.collect(ctx); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	if _, marked := orphanedAt(ctx, t, c, "cc-a.example.com"); marked {
+		t.Error("collect() marked an upstream Certificate in use")
+	}
+}
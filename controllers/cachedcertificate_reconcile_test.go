@@ -0,0 +1,3032 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+// These tests call the reconciler directly against a fake client for cases
+// that are hard to reproduce against the envtest api server
+
+func newFakeClient(objs ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = cachev1alpha1.AddToScheme(s)
+
+	// the fake client needs to know about the cert-manager types, unstructured is enough
+	certGV := schema.GroupVersion{Group: "cert-manager.io", Version: "v1"}
+	s.AddKnownTypeWithName(certGV.WithKind("Certificate"), &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(certGV.WithKind("CertificateList"), &unstructured.UnstructuredList{})
+	bundleGV := schema.GroupVersion{Group: "certificates.k8s.io", Version: "v1alpha1"}
+	s.AddKnownTypeWithName(bundleGV.WithKind("ClusterTrustBundle"), &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(bundleGV.WithKind("ClusterTrustBundleList"), &unstructured.UnstructuredList{})
+	spcGV := schema.GroupVersion{Group: "secrets-store.csi.x-k8s.io", Version: "v1"}
+	s.AddKnownTypeWithName(spcGV.WithKind("SecretProviderClass"), &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(spcGV.WithKind("SecretProviderClassList"), &unstructured.UnstructuredList{})
+
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
+
+func newTestCachedCertificate(name string, dnsNames ...string) *cachev1alpha1.CachedCertificate {
+	return &cachev1alpha1.CachedCertificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "testing",
+		},
+		Spec: cachev1alpha1.CachedCertificateSpec{
+			IssuerRef: cachev1alpha1.IssuerRef{
+				Name: "my-issuer",
+				Kind: "Issuer",
+			},
+			DNSNames: dnsNames,
+		},
+	}
+}
+
+// alreadyExistsClient simulates a concurrent reconcile creating the same upstream Certificate first
+type alreadyExistsClient struct {
+	client.Client
+}
+
+func (c alreadyExistsClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		return k8serr.NewAlreadyExists(schema.GroupResource{Group: "cert-manager.io", Resource: "certificates"}, obj.GetName())
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func Test_createUpstreamCertificateAlreadyExists(t *testing.T) {
+	cachedCert := newTestCachedCertificate("concurrent", "concurrent.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         alreadyExistsClient{newFakeClient(cachedCert)},
+	}
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "concurrent", Namespace: "testing"}})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if !res.Requeue {
+		t.Error("Reconcile() should requeue to pick up the existing upstream Certificate")
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "concurrent", Namespace: "testing"}, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	want := &cachev1alpha1.ObjectReference{Name: "cc-concurrent.example.com", Namespace: "cache"}
+	if got.Status.UpstreamRef == nil || *got.Status.UpstreamRef != *want {
+		t.Errorf("Reconcile() upstreamRef = %v, want %v", got.Status.UpstreamRef, want)
+	}
+}
+
+func Test_watches(t *testing.T) {
+	selector := labels.SelectorFromSet(labels.Set{"instance": "a"})
+
+	tests := []struct {
+		name     string
+		selector labels.Selector
+		labels   map[string]string
+		want     bool
+	}{
+		{"no selector", nil, nil, true},
+		{"matching", selector, map[string]string{"instance": "a"}, true},
+		{"other instance", selector, map[string]string{"instance": "b"}, false},
+		{"unlabeled", selector, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &CachedCertificateReconciler{WatchLabelSelector: tt.selector}
+			cachedCert := newTestCachedCertificate("watched", "watched.example.com")
+			cachedCert.Labels = tt.labels
+			if got := r.watches(cachedCert); got != tt.want {
+				t.Errorf("watches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ReconcileIgnoresUnwatched(t *testing.T) {
+	cachedCert := newTestCachedCertificate("unwatched", "unwatched.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace:     "cache",
+		WatchLabelSelector: labels.SelectorFromSet(labels.Set{"instance": "a"}),
+		Client:             newFakeClient(cachedCert),
+	}
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "unwatched", Namespace: "testing"}})
+	if err != nil || res != (ctrl.Result{}) {
+		t.Fatalf("Reconcile() = %v, %v, want no requeue or err", res, err)
+	}
+
+	upstreamCerts := &unstructured.UnstructuredList{}
+	upstreamCerts.SetAPIVersion("cert-manager.io/v1")
+	upstreamCerts.SetKind("CertificateList")
+	if err := r.List(context.Background(), upstreamCerts); err != nil {
+		t.Fatal(err)
+	}
+	if len(upstreamCerts.Items) != 0 {
+		t.Errorf("Reconcile() created %v upstream Certificates for an unwatched CachedCertificate", len(upstreamCerts.Items))
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "unwatched", Namespace: "testing"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.State != "" {
+		t.Errorf("Reconcile() set state %v on an unwatched CachedCertificate", got.Status.State)
+	}
+}
+
+func Test_upsertTargetSecretSkipsOlderCertificate(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	older := newTestCertWithNotBefore(t, "leaf", root, false, time.Now().Add(-2*time.Hour))
+	newer := newTestCertWithNotBefore(t, "leaf", root, false, time.Now().Add(-time.Hour))
+
+	newSecret := func(chain []byte, upstream string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "target",
+				Namespace:   "testing",
+				Labels:      map[string]string{SyncedLabelKey: "true"},
+				Annotations: map[string]string{UpstreamAnnotationKey: upstream},
+			},
+			Data: map[string][]byte{
+				"tls.crt": chain,
+				"tls.key": []byte("key"),
+			},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		existing         []byte
+		existingUpstream string
+		incoming         []byte
+		want             []byte
+		wantInSync       bool
+	}{
+		{"older certificate is skipped", encodeChain(newer, root), "cache/cc-a", encodeChain(older, root), encodeChain(newer, root), false},
+		{"newer certificate is synced", encodeChain(older, root), "cache/cc-a", encodeChain(newer, root), encodeChain(newer, root), true},
+		{"unparsable existing certificate is replaced", []byte("garbage"), "cache/cc-a", encodeChain(older, root), encodeChain(older, root), true},
+		// e.g. dnsNames reverted to an upstream issued before the current one
+		{"older certificate from another upstream is synced", encodeChain(newer, root), "cache/cc-b", encodeChain(older, root), encodeChain(older, root), true},
+		{"older certificate without a recorded upstream is synced", encodeChain(newer, root), "", encodeChain(older, root), encodeChain(older, root), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &CachedCertificateReconciler{
+				Client: newFakeClient(newSecret(tt.existing, tt.existingUpstream)),
+			}
+
+			inSync, err := r.upsertTargetSecret(context.Background(), ctrl.Log, newSecret(tt.incoming, "cache/cc-a"), "tls.crt")
+			if err != nil {
+				t.Fatalf("upsertTargetSecret() unexpected err %v", err)
+			}
+			if inSync != tt.wantInSync {
+				t.Errorf("upsertTargetSecret() inSync = %v, want %v", inSync, tt.wantInSync)
+			}
+
+			got := &v1.Secret{}
+			if err := r.Get(context.Background(), types.NamespacedName{Name: "target", Namespace: "testing"}, got); err != nil {
+				t.Fatalf("unable to get secret %v", err)
+			}
+			if string(got.Data["tls.crt"]) != string(tt.want) {
+				t.Error("upsertTargetSecret() wrote an unexpected certificate")
+			}
+		})
+	}
+}
+
+func Test_ReconcileRevertToOlderUpstream(t *testing.T) {
+	ctx := context.Background()
+	root := newTestCert(t, "root", nil, true)
+
+	cachedCert := newTestCachedCertificate("revert", "a.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "revert", Namespace: "testing"}
+	reconcile := func(times int) {
+		t.Helper()
+		for i := 0; i < times; i++ {
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+		}
+	}
+	// issue replaces the issued tls.crt with one valid from notBefore so the upstreams are ordered by more than a second
+	issue := func(name string, notBefore time.Time) []byte {
+		t.Helper()
+		upstreamSecret, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: name, Namespace: "cache"})
+		if err != nil {
+			t.Fatalf("unable to issue upstream Certificate %v", err)
+		}
+		upstreamSecret.Data["tls.crt"] = encodeChain(newTestCertWithNotBefore(t, name, root, false, notBefore), root)
+		if err := r.Update(ctx, upstreamSecret); err != nil {
+			t.Fatalf("unable to update upstream secret %v", err)
+		}
+		return upstreamSecret.Data["tls.crt"]
+	}
+	setDNSNames := func(dnsNames ...string) {
+		t.Helper()
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		got.Spec.DNSNames = dnsNames
+		if err := r.Update(ctx, got); err != nil {
+			t.Fatalf("unable to update CachedCertificate %v", err)
+		}
+	}
+	targetCert := func() string {
+		t.Helper()
+		secret := &v1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			t.Fatalf("unable to get target secret %v", err)
+		}
+		return string(secret.Data["tls.crt"])
+	}
+
+	reconcile(1)
+	older := issue("cc-a.example.com", time.Now().Add(-2*time.Hour))
+	reconcile(1)
+	if targetCert() != string(older) {
+		t.Fatal("Reconcile() didn't sync the first upstream")
+	}
+
+	setDNSNames("b.example.com")
+	reconcile(2)
+	newer := issue("cc-b.example.com", time.Now().Add(-time.Hour))
+	reconcile(1)
+	if targetCert() != string(newer) {
+		t.Fatal("Reconcile() didn't sync the upstream for the new dnsNames")
+	}
+
+	// reverting goes back to the first upstream, its certificate is older but the one for the dnsNames asked for
+	setDNSNames("a.example.com")
+	reconcile(2)
+	if targetCert() != string(older) {
+		t.Error("Reconcile() kept the newer certificate of the previous upstream after reverting dnsNames")
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced || !got.Status.InSync {
+		t.Errorf("Reconcile() status = %v inSync %v after reverting dnsNames, want Synced and in sync", got.Status.State, got.Status.InSync)
+	}
+}
+
+func Test_upsertTargetSecretOwnership(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{"synced label", map[string]string{SyncedLabelKey: "true"}, nil, false},
+		{"lost label with our source annotation", nil, map[string]string{SourceAnnotationKey: "testing/target"}, false},
+		{"source annotation of another CachedCertificate", nil, map[string]string{SourceAnnotationKey: "testing/other"}, true},
+		{"foreign secret", map[string]string{"app": "other"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := &CachedCertificateReconciler{
+				Client: newFakeClient(&v1.Secret{ObjectMeta: metav1.ObjectMeta{
+					Name:        "target",
+					Namespace:   "testing",
+					Labels:      tt.labels,
+					Annotations: tt.annotations,
+				}}),
+			}
+
+			secret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "target",
+					Namespace:   "testing",
+					Labels:      map[string]string{SyncedLabelKey: "true"},
+					Annotations: map[string]string{SourceAnnotationKey: "testing/target"},
+				},
+				Data: map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+			}
+			_, err := r.upsertTargetSecret(ctx, ctrl.Log, secret, "tls.crt")
+			if tt.wantErr {
+				if !errors.Is(err, ErrSecretOwnershipConflict) {
+					t.Errorf("upsertTargetSecret() error = %v, want ErrSecretOwnershipConflict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("upsertTargetSecret() unexpected err %v", err)
+			}
+
+			got := &v1.Secret{}
+			if err := r.Get(ctx, types.NamespacedName{Name: "target", Namespace: "testing"}, got); err != nil {
+				t.Fatalf("unable to get secret %v", err)
+			}
+			if got.Labels[SyncedLabelKey] != "true" {
+				t.Errorf("upsertTargetSecret() labels = %v, want the synced label restored", got.Labels)
+			}
+		})
+	}
+}
+
+// staleSecretClient misses secrets on the first get, like a cache that hasn't seen a concurrent create yet
+type staleSecretClient struct {
+	client.Client
+	missed bool
+}
+
+func (c *staleSecretClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if _, ok := obj.(*v1.Secret); ok && !c.missed {
+		c.missed = true
+		return k8serr.NewNotFound(schema.GroupResource{Resource: "secrets"}, key.Name)
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func Test_upsertTargetSecretConcurrentCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{"created by a concurrent sync", map[string]string{SyncedLabelKey: "true"}, false},
+		{"created by someone else", map[string]string{"app": "other"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := &CachedCertificateReconciler{
+				Client: &staleSecretClient{Client: newFakeClient(&v1.Secret{ObjectMeta: metav1.ObjectMeta{
+					Name:      "target",
+					Namespace: "testing",
+					Labels:    tt.labels,
+				}})},
+			}
+
+			secret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "target",
+					Namespace:   "testing",
+					Labels:      map[string]string{SyncedLabelKey: "true"},
+					Annotations: map[string]string{SourceAnnotationKey: "testing/target"},
+				},
+				Data: map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+			}
+			inSync, err := r.upsertTargetSecret(ctx, ctrl.Log, secret, "tls.crt")
+			if tt.wantErr {
+				if !errors.Is(err, ErrSecretOwnershipConflict) {
+					t.Errorf("upsertTargetSecret() error = %v, want ErrSecretOwnershipConflict", err)
+				}
+				return
+			}
+			if err != nil || !inSync {
+				t.Fatalf("upsertTargetSecret() = %v, %v, want the existing secret updated", inSync, err)
+			}
+
+			got := &v1.Secret{}
+			if err := r.Get(ctx, types.NamespacedName{Name: "target", Namespace: "testing"}, got); err != nil {
+				t.Fatalf("unable to get secret %v", err)
+			}
+			if string(got.Data["tls.crt"]) != "cert" {
+				t.Errorf("upsertTargetSecret() data = %v, want the synced data", got.Data)
+			}
+		})
+	}
+}
+
+// applyRecordingClient records apply patches, which the fake client doesn't support
+type applyRecordingClient struct {
+	client.Client
+	patched []client.Object
+	options []*client.PatchOptions
+}
+
+func (c *applyRecordingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+
+	patchOptions := &client.PatchOptions{}
+	patchOptions.ApplyOptions(opts)
+	c.patched = append(c.patched, obj)
+	c.options = append(c.options, patchOptions)
+	return nil
+}
+
+func Test_upsertTargetSecretServerSideApply(t *testing.T) {
+	c := &applyRecordingClient{Client: newFakeClient()}
+	r := &CachedCertificateReconciler{
+		FieldManager: "cached-certificate-operator",
+		Client:       c,
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "target", Namespace: "testing", Labels: map[string]string{SyncedLabelKey: "true"}},
+		Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+	}
+	if _, err := r.upsertTargetSecret(context.Background(), ctrl.Log, secret, "tls.crt"); err != nil {
+		t.Fatalf("upsertTargetSecret() unexpected err %v", err)
+	}
+
+	if len(c.patched) != 1 {
+		t.Fatalf("upsertTargetSecret() applied %d objects, want 1", len(c.patched))
+	}
+	if gvk := c.patched[0].GetObjectKind().GroupVersionKind(); gvk != v1.SchemeGroupVersion.WithKind("Secret") {
+		t.Errorf("applied object kind = %v, want v1 Secret", gvk)
+	}
+	if opts := c.options[0]; opts.FieldManager != "cached-certificate-operator" || opts.Force == nil || !*opts.Force {
+		t.Errorf("apply options = %+v, want forced with the field manager", opts)
+	}
+}
+
+func Test_ReconcileIssuerFallback(t *testing.T) {
+	ctx := context.Background()
+	primary := cachev1alpha1.IssuerRef{Name: "acme", Kind: "ClusterIssuer"}
+	fallback := cachev1alpha1.IssuerRef{Name: "backup", Kind: "ClusterIssuer"}
+
+	cachedCert := newTestCachedCertificate("fallback", "fallback.example.com")
+	cachedCert.Spec.IssuerRef = primary
+	cachedCert.Spec.IssuerRefs = []cachev1alpha1.IssuerRef{fallback}
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace:        "cache",
+		IssuerFallbackTimeout: 10 * time.Minute,
+		Client:                newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "fallback", Namespace: "testing"}
+	reconcile := func() *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+
+	// simulate the upstream never becoming ready
+	expireIssuance := func(cert *cachev1alpha1.CachedCertificate) {
+		t.Helper()
+		started := metav1.NewTime(time.Now().Add(-time.Hour))
+		cert.Status.IssuanceStartTime = &started
+		if err := r.Status().Update(ctx, cert); err != nil {
+			t.Fatalf("unable to update status %v", err)
+		}
+	}
+
+	issuerOf := func(name string) string {
+		t.Helper()
+		upstream := &unstructured.Unstructured{}
+		upstream.SetGroupVersionKind(schema.GroupVersionKind{Group: "cert-manager.io", Kind: "Certificate", Version: "v1"})
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: "cache"}, upstream); err != nil {
+			t.Fatalf("unable to get upstream Certificate %v", err)
+		}
+		issuerName, _, _ := unstructured.NestedString(upstream.Object, "spec", "issuerRef", "name")
+		return issuerName
+	}
+
+	// create the primary upstream then wait on it
+	reconcile()
+	got := reconcile()
+	if got.Status.IssuanceStartTime == nil {
+		t.Fatal("Reconcile() should record when issuance started")
+	}
+	if got.Status.IssuerIndex != 0 {
+		t.Errorf("Reconcile() issuerIndex = %v before the timeout, want 0", got.Status.IssuerIndex)
+	}
+	if issuer := issuerOf(got.Status.UpstreamRef.Name); issuer != "acme" {
+		t.Errorf("primary upstream issuer = %v, want acme", issuer)
+	}
+
+	expireIssuance(got)
+	got = reconcile()
+	if got.Status.IssuerIndex != 1 {
+		t.Errorf("Reconcile() issuerIndex = %v after the timeout, want 1", got.Status.IssuerIndex)
+	}
+
+	// the fallback upstream is keyed by its issuer
+	got = reconcile()
+	wantName := getUpstreamCertificateName(SharedUpstreamStrategyDNSPlusIssuer, fallback, "fallback.example.com")
+	if got.Status.UpstreamRef == nil || got.Status.UpstreamRef.Name != wantName {
+		t.Fatalf("Reconcile() upstreamRef = %v, want %v", got.Status.UpstreamRef, wantName)
+	}
+	if issuer := issuerOf(wantName); issuer != "backup" {
+		t.Errorf("fallback upstream issuer = %v, want backup", issuer)
+	}
+
+	// there is nothing left to fall back to
+	got = reconcile()
+	expireIssuance(got)
+	got = reconcile()
+	if got.Status.IssuerIndex != 1 {
+		t.Errorf("Reconcile() issuerIndex = %v on the last issuer, want 1", got.Status.IssuerIndex)
+	}
+}
+
+func Test_activeIssuer(t *testing.T) {
+	primary := cachev1alpha1.IssuerRef{Name: "acme", Kind: "ClusterIssuer"}
+	fallback := cachev1alpha1.IssuerRef{Name: "backup", Kind: "ClusterIssuer"}
+
+	tests := []struct {
+		name      string
+		fallbacks []cachev1alpha1.IssuerRef
+		index     int
+		want      cachev1alpha1.IssuerRef
+		wantIndex int
+	}{
+		{"primary", []cachev1alpha1.IssuerRef{fallback}, 0, primary, 0},
+		{"fallback", []cachev1alpha1.IssuerRef{fallback}, 1, fallback, 1},
+		{"fallbacks removed", nil, 1, primary, 0},
+		{"past the last fallback", []cachev1alpha1.IssuerRef{fallback}, 3, fallback, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cachedCert := newTestCachedCertificate("issuer", "example.com")
+			cachedCert.Spec.IssuerRef = primary
+			cachedCert.Spec.IssuerRefs = tt.fallbacks
+			cachedCert.Status.IssuerIndex = tt.index
+
+			got, gotIndex := activeIssuer(cachedCert)
+			if got != tt.want || gotIndex != tt.wantIndex {
+				t.Errorf("activeIssuer() = %v, %v, want %v, %v", got, gotIndex, tt.want, tt.wantIndex)
+			}
+		})
+	}
+}
+
+func Test_ReconcileCacheNamespaceChange(t *testing.T) {
+	ctx := context.Background()
+
+	// synced against an upstream in the previous cache namespace
+	cachedCert := newTestCachedCertificate("moved", "moved.example.com")
+	cachedCert.Status = cachev1alpha1.CachedCertificateStatus{
+		UpstreamReady: true,
+		UpstreamRef:   &cachev1alpha1.ObjectReference{Name: "cc-moved.example.com", Namespace: "old-cache"},
+		State:         cachev1alpha1.CachedCertificateStateSynced,
+	}
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "new-cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "moved", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+
+	want := &cachev1alpha1.ObjectReference{Name: "cc-moved.example.com", Namespace: "new-cache"}
+	if got.Status.UpstreamRef == nil || *got.Status.UpstreamRef != *want {
+		t.Errorf("Reconcile() upstreamRef = %v, want %v", got.Status.UpstreamRef, want)
+	}
+	if got.Status.UpstreamReady || got.Status.State != cachev1alpha1.CachedCertificateStatePending {
+		t.Errorf("Reconcile() status = %v, want pending until the new upstream is ready", got.Status)
+	}
+
+	upstream := &unstructured.Unstructured{}
+	upstream.SetGroupVersionKind(schema.GroupVersionKind{Group: "cert-manager.io", Kind: "Certificate", Version: "v1"})
+	if err := r.Get(ctx, types.NamespacedName{Name: want.Name, Namespace: want.Namespace}, upstream); err != nil {
+		t.Errorf("upstream Certificate not created in the new cache namespace %v", err)
+	}
+}
+
+func Test_ReconcileInSync(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("in-sync", "in-sync.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "in-sync", Namespace: "testing"}
+	reconcile := func() *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+
+	// create the upstream and issue it
+	got := reconcile()
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: got.Status.UpstreamRef.Name, Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	got = reconcile()
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced || !got.Status.InSync {
+		t.Fatalf("Reconcile() status = %v, want synced and in sync", got.Status)
+	}
+
+	// pause the sync so the external edit isn't corrected straight away
+	got.Spec.SyncPaused = true
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to pause sync %v", err)
+	}
+
+	downstream := &v1.Secret{}
+	if err := r.Get(ctx, key, downstream); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	downstream.Data["tls.crt"] = []byte("edited")
+	if err := r.Update(ctx, downstream); err != nil {
+		t.Fatalf("unable to edit target secret %v", err)
+	}
+
+	if got = reconcile(); got.Status.InSync {
+		t.Error("Reconcile() inSync = true after an external edit")
+	}
+
+	got.Spec.SyncPaused = false
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to unpause sync %v", err)
+	}
+
+	if got = reconcile(); !got.Status.InSync {
+		t.Error("Reconcile() inSync = false after correcting the target secret")
+	}
+
+	if err := r.Get(ctx, key, downstream); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	if string(downstream.Data["tls.crt"]) == "edited" {
+		t.Error("Reconcile() did not correct the target secret")
+	}
+}
+
+func Test_ReconcileUpToDate(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("fresh", "fresh.example.com")
+	// the fake client doesn't track generations, the API server starts at 1 and bumps it on spec changes
+	cachedCert.Generation = 1
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "fresh", Namespace: "testing"}
+	reconcile := func() *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+	targetCA := func() string {
+		t.Helper()
+		secret := &v1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			t.Fatalf("unable to get target secret %v", err)
+		}
+		return string(secret.Data["ca.crt"])
+	}
+
+	reconcile()
+	upstreamSecret, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-fresh.example.com", Namespace: "cache"})
+	if err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	got := reconcile()
+	if got.Status.ObservedGeneration != 1 || got.Status.SecretHash == "" {
+		t.Fatalf("Reconcile() observedGeneration = %v secretHash = %q, want 1 and the synced hash", got.Status.ObservedGeneration, got.Status.SecretHash)
+	}
+
+	// change the upstream without going through the upstream secret watch, a fresh CachedCertificate doesn't look
+	upstreamSecret.Data["ca.crt"] = []byte("rotated")
+	if err := r.Update(ctx, upstreamSecret); err != nil {
+		t.Fatalf("unable to update upstream secret %v", err)
+	}
+	reconcile()
+	if targetCA() == "rotated" {
+		t.Fatal("Reconcile() synced while the spec and target secret were unchanged")
+	}
+
+	// the upstream secret watch moves dependents to Pending which must not be skipped
+	watch := &UpstreamSecretReconciler{CacheNamespace: "cache", CertNameIndexKey: upstreamRefNameIndexKey, Client: r.Client}
+	if _, err := watch.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(upstreamSecret)}); err != nil {
+		t.Fatalf("upstream secret Reconcile() unexpected err %v", err)
+	}
+	reconcile()
+	if targetCA() != "rotated" {
+		t.Error("Reconcile() skipped the sync triggered by the upstream secret watch")
+	}
+
+	// an edit of the target secret no longer matches the recorded hash
+	secret := &v1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	secret.Data["ca.crt"] = []byte("edited")
+	if err := r.Update(ctx, secret); err != nil {
+		t.Fatalf("unable to edit target secret %v", err)
+	}
+	reconcile()
+	if targetCA() != "rotated" {
+		t.Error("Reconcile() did not correct an edited target secret")
+	}
+
+	// a spec change bumps the generation
+	got = reconcile()
+	got.Generation = 2
+	got.Spec.OmitCA = true
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+	if got = reconcile(); got.Status.ObservedGeneration != 2 {
+		t.Errorf("Reconcile() observedGeneration = %v after a spec change, want 2", got.Status.ObservedGeneration)
+	}
+	if ca := targetCA(); ca != "" {
+		t.Errorf("Reconcile() target ca.crt = %q after setting omitCA, want it removed", ca)
+	}
+}
+
+func Test_ReconcileUpToDateMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("labeled", "labeled.example.com")
+	cachedCert.Generation = 1
+	cachedCert.Spec.PropagateLabels = true
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "labeled", Namespace: "testing"}
+	reconcile := func() {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+	}
+	target := func() *v1.Secret {
+		t.Helper()
+		secret := &v1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			t.Fatalf("unable to get target secret %v", err)
+		}
+		return secret
+	}
+	relabel := func(labels map[string]string) {
+		t.Helper()
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		// metadata edits don't bump the generation
+		got.Labels = labels
+		if err := r.Update(ctx, got); err != nil {
+			t.Fatalf("unable to update CachedCertificate %v", err)
+		}
+	}
+
+	reconcile()
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-labeled.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	reconcile()
+
+	// a label added to the CachedCertificate reaches the target secret
+	relabel(map[string]string{"team": "a"})
+	reconcile()
+	if got := target().Labels["team"]; got != "a" {
+		t.Errorf("Reconcile() target label team = %q after a label-only edit, want a", got)
+	}
+
+	// and a removed label is removed from it
+	relabel(nil)
+	reconcile()
+	if got, ok := target().Labels["team"]; ok {
+		t.Errorf("Reconcile() target label team = %q after removing it, want it removed", got)
+	}
+
+	// a new renewal time on the upstream Certificate changes only the annotations
+	upstreamCert := newUpstreamCertificate()
+	if err := r.Get(ctx, types.NamespacedName{Name: "cc-labeled.example.com", Namespace: "cache"}, upstreamCert); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	if err := unstructured.SetNestedField(upstreamCert.Object, "2021-11-01T12:00:00Z", "status", "renewalTime"); err != nil {
+		t.Fatalf("unable to set renewalTime %v", err)
+	}
+	if err := r.Update(ctx, upstreamCert); err != nil {
+		t.Fatalf("unable to update upstream Certificate %v", err)
+	}
+	reconcile()
+	secret := target()
+	if got := secret.Annotations[RenewalTimeAnnotationKey]; got != "2021-11-01T12:00:00Z" {
+		t.Errorf("Reconcile() target renewal time = %q after an annotation-only change, want 2021-11-01T12:00:00Z", got)
+	}
+
+	// once the metadata matches the sync is skipped again
+	resourceVersion := secret.ResourceVersion
+	reconcile()
+	if got := target().ResourceVersion; got != resourceVersion {
+		t.Errorf("Reconcile() wrote the target secret again with nothing changed, resourceVersion %v -> %v", resourceVersion, got)
+	}
+}
+
+func Benchmark_ReconcileSynced(b *testing.B) {
+	ctx := context.Background()
+
+	benchmarks := []struct {
+		name       string
+		generation int64
+	}{
+		// without a generation every reconcile goes through the full sync
+		{"full sync", 0},
+		{"up to date", 1},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			cachedCert := newTestCachedCertificate("bench", "bench.example.com")
+			cachedCert.Generation = bm.generation
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Client:         newFakeClient(cachedCert),
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "bench", Namespace: "testing"}}
+			_, _ = r.Reconcile(ctx, req)
+			if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-bench.example.com", Namespace: "cache"}); err != nil {
+				b.Fatalf("unable to issue upstream Certificate %v", err)
+			}
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				b.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.Reconcile(ctx, req); err != nil {
+					b.Fatalf("Reconcile() unexpected err %v", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_ReconcileAddedDNSName(t *testing.T) {
+	ctx := context.Background()
+
+	// both share the upstream for a single name until one of them adds a name
+	growing := newTestCachedCertificate("growing", "shared.example.com")
+	other := newTestCachedCertificate("other", "shared.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(growing, other),
+	}
+
+	growingKey := types.NamespacedName{Name: "growing", Namespace: "testing"}
+	otherKey := types.NamespacedName{Name: "other", Namespace: "testing"}
+	reconcile := func(key types.NamespacedName) *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+
+	reconcile(growingKey)
+	reconcile(otherKey)
+	oldKey := types.NamespacedName{Name: "cc-shared.example.com", Namespace: "cache"}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, oldKey); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	got := reconcile(growingKey)
+	reconcile(otherKey)
+
+	got.Spec.DNSNames = append(got.Spec.DNSNames, "added.example.com")
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+
+	// moves off the old upstream, then creates the new one
+	if got = reconcile(growingKey); got.Status.UpstreamRef != nil || got.Status.State != cachev1alpha1.CachedCertificateStatePending {
+		t.Fatalf("Reconcile() status = %v, want pending without an upstream", got.Status)
+	}
+	got = reconcile(growingKey)
+	newKey := types.NamespacedName{Name: "cc-added.example.com-shared.example.com", Namespace: "cache"}
+	if got.Status.UpstreamRef == nil || got.Status.UpstreamRef.Name != newKey.Name {
+		t.Fatalf("Reconcile() upstreamRef = %v, want %v", got.Status.UpstreamRef, newKey.Name)
+	}
+
+	if _, err := testutil.IssueCertificate(ctx, r.Client, newKey); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if got = reconcile(growingKey); got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("Reconcile() status = %v, want synced from the new upstream", got.Status)
+	}
+
+	// the old upstream is left to the CachedCertificate still using it
+	oldUpstream := newUpstreamCertificate()
+	if err := r.Get(ctx, oldKey, oldUpstream); err != nil {
+		t.Fatalf("old upstream Certificate removed %v", err)
+	}
+	dnsNames, _, _ := unstructured.NestedStringSlice(oldUpstream.Object, "spec", "dnsNames")
+	if diff := deep.Equal(dnsNames, []string{"shared.example.com"}); diff != nil {
+		t.Errorf("old upstream dnsNames diff %v", diff)
+	}
+	if refs := oldUpstream.GetAnnotations()[ReferencedByAnnotationKey]; refs != "testing/other" {
+		t.Errorf("old upstream referenced by %q, want testing/other", refs)
+	}
+
+	newUpstream := newUpstreamCertificate()
+	if err := r.Get(ctx, newKey, newUpstream); err != nil {
+		t.Fatalf("unable to get new upstream Certificate %v", err)
+	}
+	if refs := newUpstream.GetAnnotations()[ReferencedByAnnotationKey]; refs != "testing/growing" {
+		t.Errorf("new upstream referenced by %q, want testing/growing", refs)
+	}
+
+	if got = reconcile(otherKey); got.Status.State != cachev1alpha1.CachedCertificateStateSynced || got.Status.UpstreamRef.Name != oldKey.Name {
+		t.Errorf("Reconcile() other status = %v, want still synced from the old upstream", got.Status)
+	}
+}
+
+func Test_ReconcileUpstreamNameLabel(t *testing.T) {
+	ctx := context.Background()
+
+	labeled := newTestCachedCertificate("labeled", "label.example.com")
+	other := newTestCachedCertificate("other", "other.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(labeled, other),
+	}
+
+	key := types.NamespacedName{Name: "labeled", Namespace: "testing"}
+	reconcile := func(key types.NamespacedName) *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+	selected := func(upstreamName string) []string {
+		t.Helper()
+		list := &cachev1alpha1.CachedCertificateList{}
+		if err := r.List(ctx, list, client.MatchingLabels{UpstreamNameLabelKey: upstreamName}); err != nil {
+			t.Fatalf("unable to list CachedCertificates %v", err)
+		}
+		var names []string
+		for _, item := range list.Items {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	got := reconcile(key)
+	reconcile(types.NamespacedName{Name: "other", Namespace: "testing"})
+	if label := got.Labels[UpstreamNameLabelKey]; label != "cc-label.example.com" {
+		t.Errorf("Reconcile() label = %q, want cc-label.example.com", label)
+	}
+	if diff := deep.Equal(selected("cc-label.example.com"), []string{"labeled"}); diff != nil {
+		t.Errorf("selected CachedCertificates diff %v", diff)
+	}
+
+	// the label follows dnsNames changes
+	got.Spec.DNSNames = append(got.Spec.DNSNames, "added.example.com")
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+	if got = reconcile(key); got.Labels[UpstreamNameLabelKey] != "cc-added.example.com-label.example.com" {
+		t.Errorf("Reconcile() label = %q after adding a name, want cc-added.example.com-label.example.com", got.Labels[UpstreamNameLabelKey])
+	}
+	if names := selected("cc-label.example.com"); len(names) != 0 {
+		t.Errorf("selected CachedCertificates = %v for the previous upstream, want none", names)
+	}
+
+	// names too long for a label value drop the label
+	got.Spec.DNSNames = []string{strings.Repeat("a", 63) + ".example.com"}
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+	if got = reconcile(key); got.Labels[UpstreamNameLabelKey] != "" {
+		t.Errorf("Reconcile() label = %q for a long name, want none", got.Labels[UpstreamNameLabelKey])
+	}
+}
+
+func Test_ReconcileRenewBefore(t *testing.T) {
+	percentage := int32(33)
+	tests := []struct {
+		name                      string
+		renewBefore               *metav1.Duration
+		renewBeforePercentage     *int32
+		wantRenewBefore           interface{}
+		wantRenewBeforePercentage interface{}
+	}{
+		{"unset", nil, nil, nil, nil},
+		{"renew before", &metav1.Duration{Duration: 720 * time.Hour}, nil, "720h0m0s", nil},
+		{"renew before percentage", nil, &percentage, nil, int64(33)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("renew", "renew.example.com")
+			cachedCert.Spec.RenewBefore = tt.renewBefore
+			cachedCert.Spec.RenewBeforePercentage = tt.renewBeforePercentage
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Client:         newFakeClient(cachedCert),
+			}
+
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "renew", Namespace: "testing"}}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			upstreamCert := newUpstreamCertificate()
+			if err := r.Get(ctx, types.NamespacedName{Name: "cc-renew.example.com", Namespace: "cache"}, upstreamCert); err != nil {
+				t.Fatalf("unable to get upstream Certificate %v", err)
+			}
+			spec, _, _ := unstructured.NestedMap(upstreamCert.Object, "spec")
+			if spec["renewBefore"] != tt.wantRenewBefore || spec["renewBeforePercentage"] != tt.wantRenewBeforePercentage {
+				t.Errorf("Reconcile() upstream renewBefore = %v renewBeforePercentage = %v, want %v and %v",
+					spec["renewBefore"], spec["renewBeforePercentage"], tt.wantRenewBefore, tt.wantRenewBeforePercentage)
+			}
+		})
+	}
+}
+
+func Test_ReconcileCommonName(t *testing.T) {
+	ctx := context.Background()
+
+	plain := newTestCachedCertificate("plain", "cn.example.com")
+	named := newTestCachedCertificate("named", "cn.example.com")
+	named.Spec.CommonName = "cn.example.com"
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(plain, named),
+	}
+
+	reconcile := func(name string) *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		key := types.NamespacedName{Name: name, Namespace: "testing"}
+		_, _ = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+	upstreamCommonName := func(name string) string {
+		t.Helper()
+		upstreamCert := newUpstreamCertificate()
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: "cache"}, upstreamCert); err != nil {
+			t.Fatalf("unable to get upstream Certificate %v", err)
+		}
+		commonName, _, _ := unstructured.NestedString(upstreamCert.Object, "spec", "commonName")
+		return commonName
+	}
+
+	plainUpstream := reconcile("plain").Status.UpstreamRef.Name
+	namedUpstream := reconcile("named").Status.UpstreamRef.Name
+	if plainUpstream == namedUpstream {
+		t.Fatalf("Reconcile() shared upstream %v between CachedCertificates with and without a commonName", plainUpstream)
+	}
+	if got := upstreamCommonName(plainUpstream); got != "" {
+		t.Errorf("upstream commonName = %q without a commonName set, want none", got)
+	}
+	if got := upstreamCommonName(namedUpstream); got != "cn.example.com" {
+		t.Errorf("upstream commonName = %q, want cn.example.com", got)
+	}
+
+	// a changed commonName moves to a new upstream
+	got := reconcile("named")
+	got.Spec.CommonName = "other.example.com"
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+	if got = reconcile("named"); got.Status.UpstreamRef != nil {
+		t.Fatalf("Reconcile() upstreamRef = %v after a commonName change, want it cleared", got.Status.UpstreamRef)
+	}
+	movedUpstream := reconcile("named").Status.UpstreamRef.Name
+	if movedUpstream == namedUpstream || movedUpstream == plainUpstream {
+		t.Errorf("Reconcile() upstream = %v after a commonName change, want a new upstream", movedUpstream)
+	}
+	if got := upstreamCommonName(movedUpstream); got != "other.example.com" {
+		t.Errorf("upstream commonName = %q, want other.example.com", got)
+	}
+}
+
+func Test_ReconcileSecretOwnerRef(t *testing.T) {
+	ctx := context.Background()
+
+	app := &unstructured.Unstructured{}
+	app.SetAPIVersion("argoproj.io/v1alpha1")
+	app.SetKind("Application")
+	app.SetName("app")
+	app.SetNamespace("testing")
+	app.SetUID("app-uid")
+
+	cachedCert := newTestCachedCertificate("owned", "owned.example.com")
+	cachedCert.Spec.SecretOwnerRef = &cachev1alpha1.SecretOwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Application", Name: "app"}
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "owned", Namespace: "testing"}
+	reconcile := func() *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		_, _ = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+
+	reconcile()
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-owned.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	// the owner doesn't exist yet
+	if got := reconcile(); got.Status.State != cachev1alpha1.CachedCertificateStateError {
+		t.Errorf("Reconcile() without the owner state = %v, want error", got.Status.State)
+	}
+
+	if err := r.Create(ctx, app); err != nil {
+		t.Fatalf("unable to create owner %v", err)
+	}
+	if got := reconcile(); got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Fatalf("Reconcile() state = %v, want synced", got.Status.State)
+	}
+
+	secret := &v1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "owned", Namespace: "testing"}, secret); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	want := []metav1.OwnerReference{{APIVersion: "argoproj.io/v1alpha1", Kind: "Application", Name: "app", UID: "app-uid"}}
+	if diff := deep.Equal(secret.OwnerReferences, want); diff != nil {
+		t.Errorf("Reconcile() secret ownerReferences diff %v", diff)
+	}
+}
+
+func Test_ReconcileSecretType(t *testing.T) {
+	ctx := context.Background()
+
+	// two consumers of the same upstream wanting different secret types
+	tlsCert := newTestCachedCertificate("tls", "shared-type.example.com")
+	opaqueCert := newTestCachedCertificate("opaque", "shared-type.example.com")
+	opaqueCert.Spec.SecretType = v1.SecretTypeOpaque
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(tlsCert, opaqueCert),
+	}
+
+	reconcile := func(name string) {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "testing"}}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+	}
+	secretType := func(name string) v1.SecretType {
+		t.Helper()
+		secret := &v1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: "testing"}, secret); err != nil {
+			t.Fatalf("unable to get target secret %v", err)
+		}
+		return secret.Type
+	}
+
+	reconcile("tls")
+	reconcile("opaque")
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-shared-type.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	reconcile("tls")
+	reconcile("opaque")
+
+	if got := secretType("tls"); got != v1.SecretTypeTLS {
+		t.Errorf("target secret type = %v, want the upstream type %v", got, v1.SecretTypeTLS)
+	}
+	if got := secretType("opaque"); got != v1.SecretTypeOpaque {
+		t.Errorf("target secret type = %v, want %v", got, v1.SecretTypeOpaque)
+	}
+
+	// changing the type replaces the secret
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "tls", Namespace: "testing"}, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	got.Spec.SecretType = v1.SecretTypeOpaque
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+	reconcile("tls")
+	if got := secretType("tls"); got != v1.SecretTypeOpaque {
+		t.Errorf("target secret type = %v after changing secretType, want %v", got, v1.SecretTypeOpaque)
+	}
+}
+
+func Test_ReconcileKeys(t *testing.T) {
+	ctx := context.Background()
+
+	// consumers of the same upstream each wanting a different part of it
+	fullCert := newTestCachedCertificate("full", "shared-keys.example.com")
+	keyCert := newTestCachedCertificate("key-only", "shared-keys.example.com")
+	keyCert.Spec.Keys = []cachev1alpha1.SecretKey{cachev1alpha1.SecretKeyKey}
+	chainCert := newTestCachedCertificate("chain-only", "shared-keys.example.com")
+	chainCert.Spec.Keys = []cachev1alpha1.SecretKey{cachev1alpha1.SecretKeyCert, cachev1alpha1.SecretKeyCA}
+	chainCert.Spec.KeyMapping = map[string]string{"ca.crt": "ca.pem"}
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(fullCert, keyCert, chainCert),
+	}
+
+	names := []string{"full", "key-only", "chain-only"}
+	reconcileAll := func() {
+		t.Helper()
+		for _, name := range names {
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "testing"}}); err != nil {
+				t.Fatalf("Reconcile(%s) unexpected err %v", name, err)
+			}
+		}
+	}
+
+	reconcileAll()
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-shared-keys.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	reconcileAll()
+
+	want := map[string][]string{
+		"full":       {"ca.crt", "tls.crt", "tls.key"},
+		"key-only":   {"tls.key"},
+		"chain-only": {"ca.pem", "tls.crt"},
+	}
+	for _, name := range names {
+		secret := &v1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: "testing"}, secret); err != nil {
+			t.Fatalf("unable to get target secret %s %v", name, err)
+		}
+		var keys []string
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if diff := deep.Equal(keys, want[name]); diff != nil {
+			t.Errorf("target secret %s keys diff %v", name, diff)
+		}
+	}
+}
+
+func Test_ReconcileSecretSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		keystoreSize int
+		wantState    cachev1alpha1.CachedCertificateState
+		wantReason   string
+	}{
+		{"keystore under the limit", 512 * 1024, cachev1alpha1.CachedCertificateStateSynced, string(cachev1alpha1.CachedCertificateStateSynced)},
+		{"keystore over the limit", v1.MaxSecretSize, cachev1alpha1.CachedCertificateStateError, cachev1alpha1.ReasonSecretTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("keystore", "keystore.example.com")
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Client:         newFakeClient(cachedCert),
+			}
+
+			key := types.NamespacedName{Name: "keystore", Namespace: "testing"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+			upstreamSecret, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-keystore.example.com", Namespace: "cache"})
+			if err != nil {
+				t.Fatalf("unable to issue upstream Certificate %v", err)
+			}
+
+			// every byte value, including invalid utf-8, must survive the copy untouched
+			keystore := make([]byte, tt.keystoreSize)
+			for i := range keystore {
+				keystore[i] = byte(i)
+			}
+			upstreamSecret.Data["keystore.p12"] = keystore
+			if err = r.Update(ctx, upstreamSecret); err != nil {
+				t.Fatalf("unable to update upstream secret %v", err)
+			}
+
+			if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			got := &cachev1alpha1.CachedCertificate{}
+			if err = r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if got.Status.State != tt.wantState || readyReason(&got.Status) != tt.wantReason {
+				t.Errorf("Reconcile() status = %v, want %v with reason %v", got.Status, tt.wantState, tt.wantReason)
+			}
+
+			secret := &v1.Secret{}
+			err = r.Get(ctx, key, secret)
+			if tt.wantState != cachev1alpha1.CachedCertificateStateSynced {
+				if !k8serr.IsNotFound(err) {
+					t.Errorf("target secret get err = %v, want not found for an oversized secret", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to get target secret %v", err)
+			}
+			if !bytes.Equal(secret.Data["keystore.p12"], keystore) {
+				t.Error("Reconcile() changed the keystore bytes while syncing")
+			}
+		})
+	}
+}
+
+func Test_ReconcileIssuerGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		group     string
+		wantGroup interface{}
+	}{
+		{"cert-manager issuer", "", nil},
+		{"external issuer", "awspca.cert-manager.io", "awspca.cert-manager.io"},
+		{"another external issuer", "origin-ca-issuer.k8s.cloudflare.com", "origin-ca-issuer.k8s.cloudflare.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("grouped", "grouped.example.com")
+			cachedCert.Spec.IssuerRef = cachev1alpha1.IssuerRef{Name: "ca", Kind: "AWSPCAClusterIssuer", Group: tt.group}
+			r := &CachedCertificateReconciler{
+				CacheNamespace:         "cache",
+				SharedUpstreamStrategy: SharedUpstreamStrategyDNSPlusIssuer,
+				Client:                 newFakeClient(cachedCert),
+			}
+
+			key := types.NamespacedName{Name: "grouped", Namespace: "testing"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+			if err := r.Get(ctx, key, cachedCert); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if want := getUpstreamCertificateName(SharedUpstreamStrategyDNSPlusIssuer, cachedCert.Spec.IssuerRef, "grouped.example.com"); cachedCert.Status.UpstreamRef.Name != want {
+				t.Errorf("upstream = %v, want %v", cachedCert.Status.UpstreamRef.Name, want)
+			}
+
+			upstream := newUpstreamCertificate()
+			if err := r.Get(ctx, types.NamespacedName{Name: cachedCert.Status.UpstreamRef.Name, Namespace: "cache"}, upstream); err != nil {
+				t.Fatalf("unable to get upstream Certificate %v", err)
+			}
+			issuerRef, _, _ := unstructured.NestedMap(upstream.Object, "spec", "issuerRef")
+			if diff := deep.Equal(issuerRef["group"], tt.wantGroup); diff != nil {
+				t.Errorf("upstream spec.issuerRef.group diff %v", diff)
+			}
+			if issuerRef["kind"] != "AWSPCAClusterIssuer" || issuerRef["name"] != "ca" {
+				t.Errorf("upstream spec.issuerRef = %v, want kind AWSPCAClusterIssuer and name ca", issuerRef)
+			}
+		})
+	}
+}
+
+func Test_ReconcileAllowedIssuers(t *testing.T) {
+	tests := []struct {
+		name         string
+		issuer       cachev1alpha1.IssuerRef
+		wantState    cachev1alpha1.CachedCertificateState
+		wantUpstream bool
+	}{
+		{"allowed issuer", cachev1alpha1.IssuerRef{Name: "letsencrypt", Kind: "ClusterIssuer"}, "", true},
+		{"disallowed issuer", cachev1alpha1.IssuerRef{Name: "internal-ca", Kind: "ClusterIssuer"}, cachev1alpha1.CachedCertificateStateError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("issuer", "issuer.example.com")
+			cachedCert.Spec.IssuerRef = tt.issuer
+
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Validator: &cachev1alpha1.CachedCertificateValidator{
+					AllowedIssuers: []cachev1alpha1.IssuerRef{{Name: "letsencrypt", Kind: "ClusterIssuer"}},
+				},
+				Client: newFakeClient(cachedCert),
+			}
+
+			key := types.NamespacedName{Name: "issuer", Namespace: "testing"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			got := &cachev1alpha1.CachedCertificate{}
+			if err := r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if got.Status.State != tt.wantState {
+				t.Errorf("Reconcile() state = %v, want %v", got.Status.State, tt.wantState)
+			}
+
+			upstreams := &unstructured.UnstructuredList{}
+			upstreams.SetGroupVersionKind(schema.GroupVersionKind{Group: "cert-manager.io", Kind: "CertificateList", Version: "v1"})
+			if err := r.List(ctx, upstreams); err != nil {
+				t.Fatalf("unable to list upstream Certificates %v", err)
+			}
+			if gotUpstream := len(upstreams.Items) > 0; gotUpstream != tt.wantUpstream {
+				t.Errorf("Reconcile() created upstream = %v, want %v", gotUpstream, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+// Test_ReconcileUpstreamSecretChangedMidSync has the upstream secret renewed and its dependents marked Pending between
+// reading the old upstream secret and writing the Synced status, the renewal must not be lost
+func Test_ReconcileUpstreamSecretChangedMidSync(t *testing.T) {
+	ctx := context.Background()
+	cachedCert := newTestCachedCertificate("race", "race.example.com")
+	cachedCert.Generation = 1
+	fakeClient := newFakeClient(cachedCert)
+	r := &CachedCertificateReconciler{CacheNamespace: "cache", Client: fakeClient}
+	watch := &UpstreamSecretReconciler{CacheNamespace: "cache", CertNameIndexKey: upstreamRefNameIndexKey, Client: fakeClient}
+
+	key := types.NamespacedName{Name: "race", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	upstreamSecret, err := testutil.IssueCertificate(ctx, fakeClient, types.NamespacedName{Name: "cc-race.example.com", Namespace: "cache"})
+	if err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	renewed := false
+	r.Client = hookedStatusClient{Client: fakeClient, beforeUpdate: func(cert *cachev1alpha1.CachedCertificate) {
+		if renewed || cert.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+			return
+		}
+		renewed = true
+
+		upstreamSecret.Data["ca.crt"] = []byte("renewed")
+		if err := fakeClient.Update(ctx, upstreamSecret); err != nil {
+			t.Fatalf("unable to update upstream secret %v", err)
+		}
+		if _, err := watch.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(upstreamSecret)}); err != nil {
+			t.Fatalf("upstream secret Reconcile() unexpected err %v", err)
+		}
+	}}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if !renewed {
+		t.Fatal("the upstream secret wasn't renewed during the sync")
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := fakeClient.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStatePending || got.Status.InSync {
+		t.Fatalf("Reconcile() status = %v, want the Pending from the upstream secret watch kept", got.Status)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	secret := &v1.Secret{}
+	if err := fakeClient.Get(ctx, key, secret); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	if string(secret.Data["ca.crt"]) != "renewed" {
+		t.Errorf("target ca.crt = %q, want the renewed upstream secret synced", secret.Data["ca.crt"])
+	}
+}
+
+// hookedStatusClient calls beforeUpdate ahead of every CachedCertificate status update
+type hookedStatusClient struct {
+	client.Client
+	beforeUpdate func(cert *cachev1alpha1.CachedCertificate)
+}
+
+func (c hookedStatusClient) Status() client.StatusWriter {
+	return hookedStatusWriter{StatusWriter: c.Client.Status(), beforeUpdate: c.beforeUpdate}
+}
+
+type hookedStatusWriter struct {
+	client.StatusWriter
+	beforeUpdate func(cert *cachev1alpha1.CachedCertificate)
+}
+
+func (w hookedStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if cert, ok := obj.(*cachev1alpha1.CachedCertificate); ok {
+		w.beforeUpdate(cert)
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func Test_ReconcileQuotaExceeded(t *testing.T) {
+	ctx := context.Background()
+	cachedCert := newTestCachedCertificate("quota", "quota.example.com")
+	quota := &quotaClient{Client: newFakeClient(cachedCert), full: true}
+	r := &CachedCertificateReconciler{
+		CacheNamespace:       "cache",
+		QuotaExceededBackoff: time.Minute,
+		Client:               quota,
+	}
+
+	key := types.NamespacedName{Name: "quota", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, quota.Client, types.NamespacedName{Name: "cc-quota.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v, want the quota retried through RequeueAfter", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("Reconcile() RequeueAfter = %v, want the quota backoff", result.RequeueAfter)
+	}
+	got := &cachev1alpha1.CachedCertificate{}
+	if err = r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&got.Status) != cachev1alpha1.ReasonQuotaExceeded {
+		t.Errorf("Reconcile() status = %v, want a QuotaExceeded error", got.Status)
+	}
+
+	// syncs once there's room again
+	quota.full = false
+	if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	got = &cachev1alpha1.CachedCertificate{}
+	if err = r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("Reconcile() state = %v once the quota has room, want Synced", got.Status.State)
+	}
+}
+
+// quotaClient refuses secret creates in the testing namespace like the quota admission plugin while full is set
+type quotaClient struct {
+	client.Client
+	full bool
+}
+
+func (c *quotaClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*v1.Secret); ok && c.full && obj.GetNamespace() == "testing" {
+		return k8serr.NewForbidden(schema.GroupResource{Resource: "secrets"}, obj.GetName(),
+			errors.New("exceeded quota: secrets, requested: secrets=1, used: secrets=10, limited: secrets=10"))
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+// conflictClient fails status updates with a conflict until conflicts runs out
+type conflictClient struct {
+	client.Client
+	conflicts *int
+}
+
+func (c conflictClient) Status() client.StatusWriter {
+	return conflictStatusWriter{StatusWriter: c.Client.Status(), conflicts: c.conflicts}
+}
+
+type conflictStatusWriter struct {
+	client.StatusWriter
+	conflicts *int
+}
+
+func (w conflictStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if *w.conflicts > 0 {
+		*w.conflicts--
+		return k8serr.NewConflict(schema.GroupResource{Group: "cache.weavelab.xyz", Resource: "cachedcertificates"}, obj.GetName(), errors.New("object was modified"))
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+// statusSubresourceClient leaves the spec alone on CachedCertificate status updates like the api server does,
+// the fake client otherwise persists in memory spec changes such as merged dns names
+type statusSubresourceClient struct {
+	client.Client
+}
+
+func (c statusSubresourceClient) Status() client.StatusWriter {
+	return statusSubresourceWriter{StatusWriter: c.Client.Status(), reader: c.Client}
+}
+
+type statusSubresourceWriter struct {
+	client.StatusWriter
+	reader client.Reader
+}
+
+func (w statusSubresourceWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	cert, ok := obj.(*cachev1alpha1.CachedCertificate)
+	if !ok {
+		return w.StatusWriter.Update(ctx, obj, opts...)
+	}
+
+	stored := &cachev1alpha1.CachedCertificate{}
+	if err := w.reader.Get(ctx, client.ObjectKeyFromObject(cert), stored); err != nil {
+		return err
+	}
+	stored.Status = cert.Status
+	stored.ResourceVersion = cert.ResourceVersion
+
+	err := w.StatusWriter.Update(ctx, stored, opts...)
+	cert.ResourceVersion = stored.ResourceVersion
+	return err
+}
+
+func Test_ReconcileMaxDNSNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		dnsNames  []string
+		wantState cachev1alpha1.CachedCertificateState
+	}{
+		{"at the limit", []string{"a.example.com", "b.example.com"}, ""},
+		{"over the limit", []string{"a.example.com", "b.example.com", "c.example.com"}, cachev1alpha1.CachedCertificateStateError},
+		{"duplicates aren't counted", []string{"a.example.com", "b.example.com", "a.example.com"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("max", tt.dnsNames...)
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Validator:      &cachev1alpha1.CachedCertificateValidator{MaxDNSNames: 2},
+				Client:         newFakeClient(cachedCert),
+			}
+
+			key := types.NamespacedName{Name: "max", Namespace: "testing"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			got := &cachev1alpha1.CachedCertificate{}
+			if err := r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if got.Status.State != tt.wantState {
+				t.Errorf("Reconcile() state = %v, want %v", got.Status.State, tt.wantState)
+			}
+			if tt.wantState == cachev1alpha1.CachedCertificateStateError {
+				// the message has to tell the owner what the limit is
+				condition := meta.FindStatusCondition(got.Status.Conditions, cachev1alpha1.ConditionReady)
+				if condition == nil || condition.Reason != cachev1alpha1.ReasonInvalidSpec || !strings.Contains(condition.Message, "at most 2") {
+					t.Errorf("Reconcile() Ready condition = %v, want InvalidSpec stating the limit", condition)
+				}
+			}
+		})
+	}
+}
+
+func Test_ReconcileFailTerminalMessage(t *testing.T) {
+	ctx := context.Background()
+	cachedCert := newTestCachedCertificate("invalid", "a.example.com", "b.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Validator:      &cachev1alpha1.CachedCertificateValidator{MaxDNSNames: 1},
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "invalid", Namespace: "testing"}
+	reconcile := func() *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+
+	got := reconcile()
+	if condition := meta.FindStatusCondition(got.Status.Conditions, cachev1alpha1.ConditionReady); condition == nil || !strings.Contains(condition.Message, "at most 1") {
+		t.Fatalf("Reconcile() Ready condition = %v, want InvalidSpec stating the limit", condition)
+	}
+
+	// the same failure again doesn't write the status
+	resourceVersion := got.ResourceVersion
+	if got = reconcile(); got.ResourceVersion != resourceVersion {
+		t.Errorf("Reconcile() wrote an unchanged status, resourceVersion %v -> %v", resourceVersion, got.ResourceVersion)
+	}
+
+	// another invalid field keeps the reason but has to show its own message
+	got.Spec.DNSNames = []string{strings.Repeat("a", 64) + ".example.com"}
+	if err := r.Update(ctx, got); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+	got = reconcile()
+	condition := meta.FindStatusCondition(got.Status.Conditions, cachev1alpha1.ConditionReady)
+	if condition == nil || condition.Reason != cachev1alpha1.ReasonInvalidSpec || !strings.Contains(condition.Message, "63 characters") {
+		t.Errorf("Reconcile() Ready condition = %v, want InvalidSpec for the new field", condition)
+	}
+}
+
+func Test_updateStatusRetriesConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		conflicts int
+		wantErr   bool
+	}{
+		{"no conflict", 0, false},
+		{"conflict then success", 1, false},
+		{"persistent conflict", 100, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("conflict", "conflict.example.com")
+			conflicts := tt.conflicts
+			r := &CachedCertificateReconciler{
+				Client: conflictClient{Client: newFakeClient(cachedCert), conflicts: &conflicts},
+			}
+
+			key := types.NamespacedName{Name: "conflict", Namespace: "testing"}
+			if err := r.Get(ctx, key, cachedCert); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+
+			setState(&cachedCert.Status, cachev1alpha1.CachedCertificateStateSynced)
+			cachedCert.Status.UpstreamReady = true
+
+			err := r.updateStatus(ctx, cachedCert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("updateStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !k8serr.IsConflict(err) {
+					t.Errorf("updateStatus() error = %v, want a conflict", err)
+				}
+				return
+			}
+
+			got := &cachev1alpha1.CachedCertificate{}
+			if err := r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if got.Status.State != cachev1alpha1.CachedCertificateStateSynced || !got.Status.UpstreamReady {
+				t.Errorf("updateStatus() persisted status = %v", got.Status)
+			}
+
+			// a follow up write must not conflict on a stale resource version
+			cachedCert.Status.InSync = true
+			if err := r.updateStatus(ctx, cachedCert); err != nil {
+				t.Errorf("updateStatus() follow up write error = %v", err)
+			}
+		})
+	}
+}
+
+func Test_ReconcilePublishCAConfigMap(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("published", "published.example.com")
+	cachedCert.Spec.PublishCAConfigMap = "published-ca"
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "published", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if err := r.Get(ctx, key, cachedCert); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: cachedCert.Status.UpstreamRef.Name, Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	secret := &v1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+
+	configMap := &v1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "published-ca", Namespace: "testing"}, configMap); err != nil {
+		t.Fatalf("ConfigMap not created %v", err)
+	}
+
+	if diff := deep.Equal(configMap.Data, map[string]string{
+		"tls.crt": string(secret.Data["tls.crt"]),
+		"ca.crt":  string(secret.Data["ca.crt"]),
+	}); diff != nil {
+		t.Errorf("ConfigMap data diff %v", diff)
+	}
+
+	if len(configMap.OwnerReferences) != 1 || configMap.OwnerReferences[0].Name != "published" {
+		t.Errorf("ConfigMap ownerReferences = %v, want the CachedCertificate", configMap.OwnerReferences)
+	}
+}
+
+func Test_ReconcilePublishMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("paired", "paired.example.com")
+	cachedCert.Spec.SecretName = "paired-tls"
+	cachedCert.Spec.PublishCAConfigMap = "paired-ca"
+	cachedCert.Spec.PublishMetadata = true
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "paired", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-paired.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	secret := &v1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "paired-tls", Namespace: "testing"}, secret); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	configMap := &v1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "paired-ca", Namespace: "testing"}, configMap); err != nil {
+		t.Fatalf("ConfigMap not created %v", err)
+	}
+
+	// the ConfigMap points at its secret and describes it without holding the key
+	got := publishedMetadata{}
+	if err := json.Unmarshal([]byte(configMap.Data[PublishedMetadataKey]), &got); err != nil {
+		t.Fatalf("unable to decode %s %v", PublishedMetadataKey, err)
+	}
+	want := publishedMetadata{
+		SecretName:      "paired-tls",
+		SecretNamespace: "testing",
+		Keys:            []string{"ca.crt", "tls.crt", "tls.key"},
+		NotBefore:       secret.Annotations[NotBeforeAnnotationKey],
+		NotAfter:        secret.Annotations[NotAfterAnnotationKey],
+	}
+	if want.NotAfter == "" {
+		t.Fatal("target secret has no validity annotations to mirror")
+	}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Errorf("%s diff %v", PublishedMetadataKey, diff)
+	}
+	if _, ok := configMap.Data["tls.key"]; ok {
+		t.Error("ConfigMap holds the private key")
+	}
+	if configMap.Data["tls.crt"] != string(secret.Data["tls.crt"]) {
+		t.Error("ConfigMap tls.crt differs from the paired secret")
+	}
+	for _, annotation := range []string{NotBeforeAnnotationKey, NotAfterAnnotationKey} {
+		if configMap.Annotations[annotation] != secret.Annotations[annotation] {
+			t.Errorf("ConfigMap annotation %s = %q, want the secret's %q", annotation, configMap.Annotations[annotation], secret.Annotations[annotation])
+		}
+	}
+}
+
+func Test_ReconcileCancelledContext(t *testing.T) {
+	cachedCert := newTestCachedCertificate("cancelled", "cancelled.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	key := types.NamespacedName{Name: "cancelled", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Reconcile() err = %v, want %v", err, context.Canceled)
+	}
+
+	upstreams := &unstructured.UnstructuredList{}
+	upstreams.SetGroupVersionKind(schema.GroupVersionKind{Group: "cert-manager.io", Kind: "CertificateList", Version: "v1"})
+	if err := r.List(context.Background(), upstreams); err != nil {
+		t.Fatalf("unable to list upstream Certificates %v", err)
+	}
+	if len(upstreams.Items) > 0 {
+		t.Error("Reconcile() created an upstream Certificate after cancellation")
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(context.Background(), key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.UpstreamRef != nil {
+		t.Error("Reconcile() wrote status after cancellation")
+	}
+
+	if err := r.updateStatus(ctx, got); !errors.Is(err, context.Canceled) {
+		t.Errorf("updateStatus() err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func Test_ReconcileInvalidSecretName(t *testing.T) {
+	ctx := context.Background()
+	cachedCert := newTestCachedCertificate("invalid-secret", "invalid-secret.example.com")
+	cachedCert.Spec.SecretName = "Invalid_Secret"
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Validator:      &cachev1alpha1.CachedCertificateValidator{},
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "invalid-secret", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError {
+		t.Errorf("Reconcile() state = %v, want %v", got.Status.State, cachev1alpha1.CachedCertificateStateError)
+	}
+	if got.Status.UpstreamRef != nil {
+		t.Error("Reconcile() should not pick an upstream for an invalid CachedCertificate")
+	}
+	if reason := readyReason(&got.Status); reason != cachev1alpha1.ReasonInvalidSpec {
+		t.Errorf("Reconcile() Ready reason = %v, want %v", reason, cachev1alpha1.ReasonInvalidSpec)
+	}
+}
+
+func Test_ReconcileUpstreamCertificateDeleted(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("deleted", "deleted.example.com")
+	other := newTestCachedCertificate("other", "other.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert, other),
+	}
+
+	key := types.NamespacedName{Name: "deleted", Namespace: "testing"}
+	for _, name := range []string{"deleted", "other"} {
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "testing"}}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	upstreamKey := types.NamespacedName{Name: got.Status.UpstreamRef.Name, Namespace: "cache"}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, upstreamKey); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	upstream := newUpstreamCertificate()
+	if err := r.Get(ctx, upstreamKey, upstream); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	if err := r.Delete(ctx, upstream); err != nil {
+		t.Fatalf("unable to delete upstream Certificate %v", err)
+	}
+
+	if !r.upstreamCertificateChanged().Delete(event.DeleteEvent{Object: upstream}) {
+		t.Error("upstreamCertificateChanged() filtered a delete in the cache namespace")
+	}
+
+	requests := r.upstreamCertificateDependents(upstream)
+	if diff := deep.Equal(requests, []reconcile.Request{{NamespacedName: key}}); diff != nil {
+		t.Fatalf("upstreamCertificateDependents() diff %v", diff)
+	}
+
+	if _, err := r.Reconcile(ctx, requests[0]); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	if err := r.Get(ctx, upstreamKey, newUpstreamCertificate()); err != nil {
+		t.Errorf("upstream Certificate not re-created %v", err)
+	}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced || !got.Status.InSync {
+		t.Errorf("Reconcile() status = %v, want synced from the existing upstream secret", got.Status)
+	}
+}
+
+func Test_ReconcileUpstreamDNSNamesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(upstream *unstructured.Unstructured)
+	}{
+		{"missing", func(upstream *unstructured.Unstructured) {
+			unstructured.RemoveNestedField(upstream.Object, "spec", "dnsNames")
+		}},
+		{"wrong type", func(upstream *unstructured.Unstructured) {
+			_ = unstructured.SetNestedField(upstream.Object, "bad-names.example.com", "spec", "dnsNames")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("bad-names", "bad-names.example.com")
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Client:         newFakeClient(cachedCert),
+			}
+
+			key := types.NamespacedName{Name: "bad-names", Namespace: "testing"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			upstreamKey := types.NamespacedName{Name: "cc-bad-names.example.com", Namespace: "cache"}
+			upstream := newUpstreamCertificate()
+			if err := r.Get(ctx, upstreamKey, upstream); err != nil {
+				t.Fatalf("unable to get upstream Certificate %v", err)
+			}
+			tt.corrupt(upstream)
+			if err := r.Update(ctx, upstream); err != nil {
+				t.Fatalf("unable to update upstream Certificate %v", err)
+			}
+
+			// returned as an error so the fix is picked up by the retry
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); !errors.Is(err, errUpstreamInvalid) {
+				t.Errorf("Reconcile() error = %v, want errUpstreamInvalid", err)
+			}
+
+			got := &cachev1alpha1.CachedCertificate{}
+			if err := r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if got.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&got.Status) != cachev1alpha1.ReasonUpstreamInvalid {
+				t.Errorf("Reconcile() status = %v, want an UpstreamInvalid error", got.Status)
+			}
+		})
+	}
+}
+
+func Test_ReconcileUpstreamIssuerRefInvalid(t *testing.T) {
+	ctx := context.Background()
+	cachedCert := newTestCachedCertificate("no-issuer", "no-issuer.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "no-issuer", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	// an upstream left behind by an older version, already issued but without an issuerRef
+	upstreamKey := types.NamespacedName{Name: "cc-no-issuer.example.com", Namespace: "cache"}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, upstreamKey); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	upstream := newUpstreamCertificate()
+	if err := r.Get(ctx, upstreamKey, upstream); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	issuerRef, _, _ := unstructured.NestedMap(upstream.Object, "spec", "issuerRef")
+	unstructured.RemoveNestedField(upstream.Object, "spec", "issuerRef")
+	if err := r.Update(ctx, upstream); err != nil {
+		t.Fatalf("unable to update upstream Certificate %v", err)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); !errors.Is(err, errUpstreamInvalid) {
+		t.Errorf("Reconcile() error = %v, want errUpstreamInvalid", err)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&got.Status) != cachev1alpha1.ReasonUpstreamInvalid {
+		t.Errorf("Reconcile() status = %v, want an UpstreamInvalid error", got.Status)
+	}
+	if err := r.Get(ctx, key, &v1.Secret{}); !k8serr.IsNotFound(err) {
+		t.Errorf("target secret get err = %v, want not found while the upstream is invalid", err)
+	}
+
+	fixed := upstream.DeepCopy()
+	if err := unstructured.SetNestedMap(fixed.Object, issuerRef, "spec", "issuerRef"); err != nil {
+		t.Fatal(err)
+	}
+	if !r.upstreamCertificateChanged().Update(event.UpdateEvent{ObjectOld: upstream, ObjectNew: fixed}) {
+		t.Error("upstreamCertificateChanged() filtered an issuerRef fix")
+	}
+	if err := r.Update(ctx, fixed); err != nil {
+		t.Fatalf("unable to update upstream Certificate %v", err)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	got = &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("Reconcile() state = %v after the issuerRef was fixed, want Synced", got.Status.State)
+	}
+}
+
+func Test_ReconcileUpstreamReader(t *testing.T) {
+	ctx := context.Background()
+	cachedCert := newTestCachedCertificate("hub", "hub.example.com")
+	local := newFakeClient(cachedCert)
+	upstream := newFakeClient()
+	r := &CachedCertificateReconciler{
+		CacheNamespace:       "cache",
+		UpstreamReader:       upstream,
+		UpstreamPollInterval: time.Minute,
+		Client:               local,
+	}
+
+	// nothing is created while the upstream is missing from the upstream cluster
+	key := types.NamespacedName{Name: "hub", Namespace: "testing"}
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if result.RequeueAfter <= 0 {
+		t.Error("Reconcile() didn't requeue to check for the missing upstream again")
+	}
+	got := &cachev1alpha1.CachedCertificate{}
+	if err = local.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStatePending || readyReason(&got.Status) != cachev1alpha1.ReasonUpstreamNotFound {
+		t.Errorf("Reconcile() status = %v, want Pending with reason UpstreamNotFound", got.Status)
+	}
+	upstreamKey := types.NamespacedName{Name: "cc-hub.example.com", Namespace: "cache"}
+	for _, c := range []client.Client{local, upstream} {
+		if err = c.Get(ctx, upstreamKey, newUpstreamCertificate()); !k8serr.IsNotFound(err) {
+			t.Errorf("upstream Certificate get err = %v, want not found in either cluster", err)
+		}
+	}
+
+	// issued in the upstream cluster by whoever manages it
+	upstreamCert := newUpstreamCertificate()
+	upstreamCert.SetName(upstreamKey.Name)
+	upstreamCert.SetNamespace(upstreamKey.Namespace)
+	_ = unstructured.SetNestedStringSlice(upstreamCert.Object, []string{"hub.example.com"}, "spec", "dnsNames")
+	_ = unstructured.SetNestedField(upstreamCert.Object, upstreamKey.Name, "spec", "secretName")
+	_ = unstructured.SetNestedMap(upstreamCert.Object, issuerRefToUnstructured(cachedCert.Spec.IssuerRef), "spec", "issuerRef")
+	if err = upstream.Create(ctx, upstreamCert); err != nil {
+		t.Fatalf("unable to create upstream Certificate %v", err)
+	}
+	upstreamSecret, err := testutil.IssueCertificate(ctx, upstream, upstreamKey)
+	if err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	result, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("Reconcile() requeue after = %v, want the poll interval", result.RequeueAfter)
+	}
+
+	secret := &v1.Secret{}
+	if err = local.Get(ctx, key, secret); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	if !bytes.Equal(secret.Data["tls.crt"], upstreamSecret.Data["tls.crt"]) {
+		t.Error("Reconcile() didn't sync the upstream cluster's secret")
+	}
+	got = &cachev1alpha1.CachedCertificate{}
+	if err = local.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("Reconcile() state = %v, want Synced", got.Status.State)
+	}
+
+	// the upstream cluster is only read
+	if err = upstream.Get(ctx, upstreamKey, upstreamCert); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	if _, ok := upstreamCert.GetAnnotations()[ReferencedByAnnotationKey]; ok {
+		t.Error("Reconcile() recorded references on an upstream in the upstream cluster")
+	}
+	if err = local.Get(ctx, upstreamKey, newUpstreamCertificate()); !k8serr.IsNotFound(err) {
+		t.Errorf("upstream Certificate get err = %v, want not found in the local cluster", err)
+	}
+}
+
+func Test_ReconcileUpstreamSecretNameRemoved(t *testing.T) {
+	ctx := context.Background()
+	cachedCert := newTestCachedCertificate("no-secret-name", "no-secret-name.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "no-secret-name", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	upstreamKey := types.NamespacedName{Name: "cc-no-secret-name.example.com", Namespace: "cache"}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, upstreamKey); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	old := newUpstreamCertificate()
+	if err := r.Get(ctx, upstreamKey, old); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	broken := old.DeepCopy()
+	unstructured.RemoveNestedField(broken.Object, "spec", "secretName")
+	if err := r.Update(ctx, broken); err != nil {
+		t.Fatalf("unable to update upstream Certificate %v", err)
+	}
+
+	if !r.upstreamCertificateChanged().Update(event.UpdateEvent{ObjectOld: old, ObjectNew: broken}) {
+		t.Error("upstreamCertificateChanged() filtered a secretName change")
+	}
+	if r.upstreamCertificateChanged().Update(event.UpdateEvent{ObjectOld: old, ObjectNew: old}) {
+		t.Error("upstreamCertificateChanged() passed an update without a secretName change")
+	}
+
+	// the broken upstream is reported straight away, without an error to retry
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if res.Requeue || res.RequeueAfter != 0 {
+		t.Errorf("Reconcile() = %v, want no requeue until the upstream is fixed", res)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&got.Status) != cachev1alpha1.ReasonUpstreamInvalid {
+		t.Errorf("Reconcile() status = %v, want an UpstreamInvalid error", got.Status)
+	}
+
+	// fixing the upstream syncs again
+	if err := r.Get(ctx, upstreamKey, broken); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	fixed := broken.DeepCopy()
+	_ = unstructured.SetNestedField(fixed.Object, "cc-no-secret-name.example.com", "spec", "secretName")
+	if err := r.Update(ctx, fixed); err != nil {
+		t.Fatalf("unable to update upstream Certificate %v", err)
+	}
+	if !r.upstreamCertificateChanged().Update(event.UpdateEvent{ObjectOld: broken, ObjectNew: fixed}) {
+		t.Error("upstreamCertificateChanged() filtered a secretName fix")
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("Reconcile() status = %v, want synced after the upstream is fixed", got.Status)
+	}
+}
+
+func Test_ReconcileUpstreamRenewalTime(t *testing.T) {
+	ctx := context.Background()
+	cachedCert := newTestCachedCertificate("renewal", "renewal.example.com")
+	// a generation so reconciles can be skipped as up to date
+	cachedCert.Generation = 1
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "renewal", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	upstreamKey := types.NamespacedName{Name: "cc-renewal.example.com", Namespace: "cache"}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, upstreamKey); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	// cert-manager sets the renewal time once the secret is written, nothing else changes
+	old := newUpstreamCertificate()
+	if err := r.Get(ctx, upstreamKey, old); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	renewed := old.DeepCopy()
+	_ = unstructured.SetNestedField(renewed.Object, "2021-11-01T12:00:00Z", "status", "renewalTime")
+	if err := r.Update(ctx, renewed); err != nil {
+		t.Fatalf("unable to update upstream Certificate %v", err)
+	}
+
+	if !r.upstreamCertificateChanged().Update(event.UpdateEvent{ObjectOld: old, ObjectNew: renewed}) {
+		t.Error("upstreamCertificateChanged() filtered a renewalTime change")
+	}
+	if r.upstreamCertificateChanged().Update(event.UpdateEvent{ObjectOld: renewed, ObjectNew: renewed}) {
+		t.Error("upstreamCertificateChanged() passed an update without a renewalTime change")
+	}
+
+	requests := r.upstreamCertificateDependents(renewed)
+	if diff := deep.Equal(requests, []reconcile.Request{{NamespacedName: key}}); diff != nil {
+		t.Fatalf("upstreamCertificateDependents() diff %v", diff)
+	}
+	if _, err := r.Reconcile(ctx, requests[0]); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	secret := &v1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		t.Fatalf("unable to get target secret %v", err)
+	}
+	if got := secret.Annotations[RenewalTimeAnnotationKey]; got != "2021-11-01T12:00:00Z" {
+		t.Errorf("Reconcile() target renewal time = %q, want the upstream's 2021-11-01T12:00:00Z", got)
+	}
+}
+
+func Test_ReconcileMaxBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackoff string
+		elapsed    time.Duration
+		want       time.Duration
+	}{
+		{"first check", "", 0, minWaitBackoff},
+		{"backs off", "", 20 * time.Second, 16 * time.Second},
+		{"default ceiling", "", 30 * time.Minute, defaultMaxWaitBackoff},
+		{"longer ceiling", "5m", 30 * time.Minute, 5 * time.Minute},
+		{"shorter ceiling", "10s", 30 * time.Minute, 10 * time.Second},
+		{"ceiling below the first check", "1s", 0, time.Second},
+		{"invalid ceiling uses the default", "soon", 30 * time.Minute, defaultMaxWaitBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fakeClock := clock.NewFakeClock(time.Now())
+			cachedCert := newTestCachedCertificate("backoff", "backoff.example.com")
+			if tt.maxBackoff != "" {
+				cachedCert.Annotations = map[string]string{cachev1alpha1.MaxBackoffAnnotationKey: tt.maxBackoff}
+			}
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Clock:          fakeClock,
+				Client:         newFakeClient(cachedCert),
+			}
+
+			// create the upstream then start waiting on it
+			key := types.NamespacedName{Name: "backoff", Namespace: "testing"}
+			for i := 0; i < 2; i++ {
+				if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+					t.Fatalf("Reconcile() unexpected err %v", err)
+				}
+			}
+
+			fakeClock.Step(tt.elapsed)
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+			if result.RequeueAfter != tt.want {
+				t.Errorf("Reconcile() requeueAfter = %v, want %v", result.RequeueAfter, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ReconcileWaitForIssuance(t *testing.T) {
+	ctx := context.Background()
+	r := &CachedCertificateReconciler{
+		CacheNamespace:  "cache",
+		WaitForIssuance: 10 * time.Second,
+		Client:          newFakeClient(newTestCachedCertificate("ci", "ci.example.com")),
+	}
+
+	// create the upstream
+	key := types.NamespacedName{Name: "ci", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	// issue while the next reconcile is waiting
+	issued := make(chan error, 1)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		_, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-ci.example.com", Namespace: "cache"})
+		issued <- err
+	}()
+
+	start := time.Now()
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if err := <-issued; err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= r.WaitForIssuance {
+		t.Errorf("Reconcile() took %v, want to return once issued", elapsed)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("Reconcile() state = %v, want synced within a single reconcile", got.Status.State)
+	}
+}
+
+func Test_ReconcileWaitForIssuanceDeadline(t *testing.T) {
+	ctx := context.Background()
+	r := &CachedCertificateReconciler{
+		CacheNamespace:  "cache",
+		WaitForIssuance: 500 * time.Millisecond,
+		Client:          newFakeClient(newTestCachedCertificate("ci", "ci.example.com")),
+	}
+
+	key := types.NamespacedName{Name: "ci", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	start := time.Now()
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < r.WaitForIssuance {
+		t.Errorf("Reconcile() took %v, want to wait %v", elapsed, r.WaitForIssuance)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("Reconcile() result = %v, want requeued after the deadline", result)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStatePending {
+		t.Errorf("Reconcile() state = %v, want pending", got.Status.State)
+	}
+}
+
+func Test_ReconcileIssuanceTimeout(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFakeClock(time.Now())
+
+	cachedCert := newTestCachedCertificate("timeout", "timeout.example.com")
+	cachedCert.Spec.IssuanceTimeout = &metav1.Duration{Duration: 5 * time.Minute}
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Clock:          fakeClock,
+		Client:         newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "timeout", Namespace: "testing"}
+	reconcile := func() (ctrl.Result, *cachev1alpha1.CachedCertificate) {
+		t.Helper()
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		if err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return result, got
+	}
+
+	// create the upstream then start waiting on it
+	reconcile()
+	_, got := reconcile()
+	if got.Status.IssuanceStartTime == nil || !got.Status.IssuanceStartTime.Time.Equal(fakeClock.Now().Truncate(time.Second)) {
+		t.Fatalf("Reconcile() issuanceStartTime = %v, want the clock time", got.Status.IssuanceStartTime)
+	}
+
+	fakeClock.Step(4 * time.Minute)
+	result, got := reconcile()
+	if got.Status.State != cachev1alpha1.CachedCertificateStatePending || result.RequeueAfter == 0 {
+		t.Errorf("Reconcile() within the timeout state = %v result = %v, want pending and requeued", got.Status.State, result)
+	}
+
+	fakeClock.Step(2 * time.Minute)
+	result, got = reconcile()
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError || got.Status.InSync {
+		t.Errorf("Reconcile() past the timeout status = %v, want error", got.Status)
+	}
+	if result.Requeue || result.RequeueAfter != 0 {
+		t.Errorf("Reconcile() past the timeout result = %v, want no requeue", result)
+	}
+
+	// a late upstream secret still syncs
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: got.Status.UpstreamRef.Name, Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, got = reconcile(); got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("Reconcile() after issuance state = %v, want synced", got.Status.State)
+	}
+}
+
+func Test_ReconcileAuditLog(t *testing.T) {
+	ctx := context.Background()
+	var audit []recordedLog
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		AuditLog:       recordingLogger{logs: &audit},
+		Client:         newFakeClient(newTestCachedCertificate("audited", "audited.example.com")),
+	}
+
+	key := types.NamespacedName{Name: "audited", Namespace: "testing"}
+	reconcile := func() {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+	}
+	assertAudit := func(wantAction string, wantHash string) {
+		t.Helper()
+		if wantAction == "" {
+			if len(audit) != 0 {
+				t.Errorf("audit log = %v, want no records", audit)
+			}
+			return
+		}
+		if len(audit) != 1 {
+			t.Fatalf("audit log = %v, want a single record", audit)
+		}
+
+		fields := map[interface{}]interface{}{}
+		for i := 0; i+1 < len(audit[0].keysAndValues); i += 2 {
+			fields[audit[0].keysAndValues[i]] = audit[0].keysAndValues[i+1]
+		}
+		want := map[interface{}]interface{}{
+			"action":            wantAction,
+			"cachedCertificate": "testing/audited",
+			"secret":            "testing/audited",
+			"hash":              wantHash,
+		}
+		for k, v := range want {
+			if fields[k] != v {
+				t.Errorf("audit record %v = %v, want %v", k, fields[k], v)
+			}
+		}
+		ts, _ := fields["time"].(string)
+		if _, err := time.Parse(time.RFC3339, ts); err != nil {
+			t.Errorf("audit record time = %v, want RFC3339", fields["time"])
+		}
+	}
+
+	reconcile()
+	upstreamKey := types.NamespacedName{Name: "cc-audited.example.com", Namespace: "cache"}
+	upstreamSecret, err := testutil.IssueCertificate(ctx, r.Client, upstreamKey)
+	if err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	reconcile()
+	assertAudit("create", secretDataHash(upstreamSecret.Data))
+
+	// nothing changed, nothing to record
+	audit = nil
+	reconcile()
+	assertAudit("", "")
+
+	// a renewal changes the data
+	upstreamCert := newUpstreamCertificate()
+	if err := r.Get(ctx, upstreamKey, upstreamCert); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	renewed, err := testutil.NewCertificateSecret(upstreamCert)
+	if err != nil {
+		t.Fatalf("unable to renew upstream Certificate %v", err)
+	}
+	upstreamSecret.Data = renewed.Data
+	if err := r.Update(ctx, upstreamSecret); err != nil {
+		t.Fatalf("unable to update upstream secret %v", err)
+	}
+
+	audit = nil
+	reconcile()
+	assertAudit("update", secretDataHash(renewed.Data))
+}
+
+func Test_ReconcileNamespaceTerminating(t *testing.T) {
+	ctx := context.Background()
+	namespace := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "testing"},
+		Status:     v1.NamespaceStatus{Phase: v1.NamespaceTerminating},
+	}
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(newTestCachedCertificate("terminating", "terminating.example.com"), namespace),
+	}
+
+	key := types.NamespacedName{Name: "terminating", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-terminating.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		if err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+		if result.Requeue || result.RequeueAfter != 0 {
+			t.Errorf("Reconcile() result = %v, want no requeue", result)
+		}
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStatePending || readyReason(&got.Status) != cachev1alpha1.ReasonNamespaceTerminating {
+		t.Errorf("Reconcile() status = %v, want pending with reason %v", got.Status, cachev1alpha1.ReasonNamespaceTerminating)
+	}
+
+	err := r.Get(ctx, types.NamespacedName{Name: "terminating", Namespace: "testing"}, &v1.Secret{})
+	if !k8serr.IsNotFound(err) {
+		t.Errorf("Reconcile() wrote the target secret in a terminating namespace, get err %v", err)
+	}
+}
+
+func Test_ReconcileRecoveredEvent(t *testing.T) {
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(10)
+
+	// a foreign secret in the way of the target secret forces an error
+	foreign := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "recovers", Namespace: "testing"}}
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Recorder:       recorder,
+		Client:         newFakeClient(newTestCachedCertificate("recovers", "recovers.example.com"), foreign),
+	}
+
+	key := types.NamespacedName{Name: "recovers", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-recovers.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	_, _ = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError {
+		t.Fatalf("Reconcile() state = %v, want Error", got.Status.State)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("Reconcile() emitted %v before recovering", <-recorder.Events)
+	}
+
+	if err := r.Delete(ctx, foreign); err != nil {
+		t.Fatalf("unable to delete foreign secret %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if want := "Normal " + EventReasonRecovered + " Synced again after an error"; event != want {
+			t.Errorf("Reconcile() event = %q, want %q", event, want)
+		}
+	default:
+		t.Error("Reconcile() did not emit a Recovered event")
+	}
+
+	// staying synced isn't a recovery
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("Reconcile() emitted %v while already synced", <-recorder.Events)
+	}
+}
+
+func Test_ReconcileErrorReasons(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup runs after the upstream Certificate is created and issued
+		setup      func(ctx context.Context, t *testing.T, c client.Client, upstream *unstructured.Unstructured)
+		wantReason string
+	}{
+		{
+			"upstream without a secretName",
+			func(ctx context.Context, t *testing.T, c client.Client, upstream *unstructured.Unstructured) {
+				unstructured.RemoveNestedField(upstream.Object, "spec", "secretName")
+				if err := c.Update(ctx, upstream); err != nil {
+					t.Fatalf("unable to update upstream Certificate %v", err)
+				}
+			},
+			cachev1alpha1.ReasonUpstreamInvalid,
+		},
+		{
+			"target secret owned by someone else",
+			func(ctx context.Context, t *testing.T, c client.Client, upstream *unstructured.Unstructured) {
+				if err := c.Create(ctx, &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "reasons", Namespace: "testing"}}); err != nil {
+					t.Fatalf("unable to create conflicting secret %v", err)
+				}
+			},
+			cachev1alpha1.ReasonSecretConflict,
+		},
+		{
+			"synced",
+			func(ctx context.Context, t *testing.T, c client.Client, upstream *unstructured.Unstructured) {},
+			string(cachev1alpha1.CachedCertificateStateSynced),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Client:         newFakeClient(newTestCachedCertificate("reasons", "reasons.example.com")),
+			}
+
+			key := types.NamespacedName{Name: "reasons", Namespace: "testing"}
+			got := &cachev1alpha1.CachedCertificate{}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+			if err := r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+
+			upstreamKey := types.NamespacedName{Name: got.Status.UpstreamRef.Name, Namespace: "cache"}
+			if _, err := testutil.IssueCertificate(ctx, r.Client, upstreamKey); err != nil {
+				t.Fatalf("unable to issue upstream Certificate %v", err)
+			}
+			upstream := newUpstreamCertificate()
+			if err := r.Get(ctx, upstreamKey, upstream); err != nil {
+				t.Fatalf("unable to get upstream Certificate %v", err)
+			}
+
+			tt.setup(ctx, t, r.Client, upstream)
+
+			// errors are returned for a retry, the status is what matters here
+			_, _ = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err := r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+
+			if reason := readyReason(&got.Status); reason != tt.wantReason {
+				t.Errorf("Reconcile() Ready reason = %v, want %v", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_typedErrors(t *testing.T) {
+	ctx := context.Background()
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "taken", Namespace: "testing"}}),
+	}
+
+	upstream := newUpstreamCertificate()
+	upstream.SetName("cc-a.example.com")
+	_ = unstructured.SetNestedStringSlice(upstream.Object, []string{"a.example.com"}, "spec", "dnsNames")
+
+	_, err := r.upsertTargetSecret(ctx, ctrl.Log, &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "taken", Namespace: "testing"}}, "tls.crt")
+	if !errors.Is(err, ErrSecretOwnershipConflict) {
+		t.Errorf("upsertTargetSecret() error = %v, want ErrSecretOwnershipConflict", err)
+	}
+
+	_, err = r.getUpstreamSecret(ctx, ctrl.Log, upstream)
+	if !errors.Is(err, ErrUpstreamNoSecretName) || !errors.Is(err, errUpstreamInvalid) {
+		t.Errorf("getUpstreamSecret() error = %v, want ErrUpstreamNoSecretName", err)
+	}
+
+	if _, err = checkUpstreamDNSNames(upstream, []string{"a.example.com", "b.example.com"}); !errors.Is(err, ErrUpstreamDNSMismatch) {
+		t.Errorf("checkUpstreamDNSNames() error = %v, want ErrUpstreamDNSMismatch", err)
+	}
+	if _, err = checkUpstreamDNSNames(upstream, []string{"a.example.com"}); err != nil {
+		t.Errorf("checkUpstreamDNSNames() unexpected error %v", err)
+	}
+}
+
+func Test_UpstreamSecretReconcilerCustomAnnotationKey(t *testing.T) {
+	ctx := context.Background()
+	const annotationKey = "certs.example.com/certificate-name"
+
+	cachedCert := newTestCachedCertificate("custom", "custom.example.com")
+	cachedCert.Status = cachev1alpha1.CachedCertificateStatus{
+		UpstreamReady: true,
+		UpstreamRef:   &cachev1alpha1.ObjectReference{Name: "cc-custom.example.com", Namespace: "cache"},
+		State:         cachev1alpha1.CachedCertificateStateSynced,
+		InSync:        true,
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cc-custom.example.com",
+			Namespace:   "cache",
+			Annotations: map[string]string{annotationKey: "cc-custom.example.com"},
+		},
+	}
+
+	r := &UpstreamSecretReconciler{
+		CacheNamespace:        "cache",
+		CertNameIndexKey:      upstreamRefNameIndexKey,
+		CertNameAnnotationKey: annotationKey,
+		Client:                newFakeClient(cachedCert, secret),
+	}
+
+	if !r.isUpstreamSecret(secret) {
+		t.Error("isUpstreamSecret() = false for a secret with the custom annotation")
+	}
+	defaultSecret := secret.DeepCopy()
+	defaultSecret.Annotations = map[string]string{CertificateNameAnnotationKey: "cc-custom.example.com"}
+	if r.isUpstreamSecret(defaultSecret) {
+		t.Error("isUpstreamSecret() = true for a secret with only the default annotation")
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "custom", Namespace: "testing"}, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStatePending {
+		t.Errorf("Reconcile() dependent state = %v, want %v to trigger a resync", got.Status.State, cachev1alpha1.CachedCertificateStatePending)
+	}
+}
+
+func Test_UpstreamSecretReconcilerSkipsPolling(t *testing.T) {
+	ctx := context.Background()
+
+	synced := cachev1alpha1.CachedCertificateStatus{
+		UpstreamReady: true,
+		UpstreamRef:   &cachev1alpha1.ObjectReference{Name: "cc-shared.example.com", Namespace: "cache"},
+		State:         cachev1alpha1.CachedCertificateStateSynced,
+		InSync:        true,
+	}
+	fast := newTestCachedCertificate("fast", "shared.example.com")
+	fast.Status = synced
+	slow := newTestCachedCertificate("slow", "shared.example.com")
+	slow.Spec.UpstreamSecretSync = cachev1alpha1.UpstreamSecretSyncPoll
+	slow.Status = *synced.DeepCopy()
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cc-shared.example.com",
+			Namespace:   "cache",
+			Annotations: map[string]string{CertificateNameAnnotationKey: "cc-shared.example.com"},
+		},
+	}
+
+	r := &UpstreamSecretReconciler{
+		CacheNamespace:   "cache",
+		CertNameIndexKey: upstreamRefNameIndexKey,
+		Client:           newFakeClient(fast, slow, secret),
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	for name, want := range map[string]cachev1alpha1.CachedCertificateState{
+		"fast": cachev1alpha1.CachedCertificateStatePending,
+		"slow": cachev1alpha1.CachedCertificateStateSynced,
+	} {
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: "testing"}, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		if got.Status.State != want {
+			t.Errorf("Reconcile() %v state = %v, want %v", name, got.Status.State, want)
+		}
+	}
+}
+
+func Test_ReconcilePollRequeues(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("poll", "poll.example.com")
+	cachedCert.Spec.UpstreamSecretSync = cachev1alpha1.UpstreamSecretSyncPoll
+	r := &CachedCertificateReconciler{
+		CacheNamespace:       "cache",
+		UpstreamPollInterval: 15 * time.Minute,
+		Client:               newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "poll", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: got.Status.UpstreamRef.Name, Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if result.RequeueAfter != 15*time.Minute {
+		t.Errorf("Reconcile() requeueAfter = %v, want the poll interval", result.RequeueAfter)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// ResyncPath is the path the ResyncHandler is served on
+const ResyncPath = "/resync"
+
+// ResyncHandler enqueues every CachedCertificate for reconcile, e.g. after a manual fix to upstream secrets
+// Events are sent to the channel given to CachedCertificateReconciler.ResyncEvents
+type ResyncHandler struct {
+	client.Reader
+	Events chan<- event.GenericEvent
+}
+
+// ServeHTTP lists all CachedCertificates and enqueues them, only POST is accepted since this triggers writes
+func (h *ResyncHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reqLog := log.FromContext(req.Context()).WithName("resync")
+
+	certList := &cachev1alpha1.CachedCertificateList{}
+	if err := h.List(req.Context(), certList); err != nil {
+		reqLog.Error(err, "unable to list CachedCertificates for resync")
+		http.Error(w, "unable to list CachedCertificates", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range certList.Items {
+		select {
+		case h.Events <- event.GenericEvent{Object: &certList.Items[i]}:
+		case <-req.Context().Done():
+			http.Error(w, "resync cancelled", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	reqLog.Info("enqueued CachedCertificates for resync", "count", len(certList.Items))
+	_, _ = w.Write([]byte("enqueued " + strconv.Itoa(len(certList.Items)) + " CachedCertificates\n"))
+}
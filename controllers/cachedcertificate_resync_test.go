@@ -0,0 +1,178 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func Test_ResyncHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+		wantQueued []reconcile.Request
+	}{
+		{
+			"post enqueues everything",
+			http.MethodPost,
+			http.StatusOK,
+			[]reconcile.Request{
+				{NamespacedName: types.NamespacedName{Name: "a", Namespace: "testing"}},
+				{NamespacedName: types.NamespacedName{Name: "b", Namespace: "testing"}},
+			},
+		},
+		{"get is rejected", http.MethodGet, http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan event.GenericEvent, 10)
+			h := &ResyncHandler{
+				Reader: newFakeClient(newTestCachedCertificate("a", "a.example.com"), newTestCachedCertificate("b", "b.example.com")),
+				Events: events,
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, ResyncPath, nil))
+			close(events)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+
+			// the reconciler watches the channel with EnqueueRequestForObject, so each event becomes a reconcile
+			queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer queue.ShutDown()
+			for evt := range events {
+				(&handler.EnqueueRequestForObject{}).Generic(evt, queue)
+			}
+
+			var queued []reconcile.Request
+			for queue.Len() > 0 {
+				item, _ := queue.Get()
+				queued = append(queued, item.(reconcile.Request))
+				queue.Done(item)
+			}
+
+			if diff := deep.Equal(queued, tt.wantQueued); diff != nil {
+				t.Errorf("ServeHTTP() queued diff %v", diff)
+			}
+		})
+	}
+}
+
+func Test_ReconcileResyncAnnotation(t *testing.T) {
+	ctx := context.Background()
+
+	cachedCert := newTestCachedCertificate("nonce", "nonce.example.com")
+	cachedCert.Generation = 1
+	r := &CachedCertificateReconciler{
+		CacheNamespace:      "cache",
+		UpstreamSecretCache: NewUpstreamSecretCache(time.Hour),
+		Client:              newFakeClient(cachedCert),
+	}
+
+	key := types.NamespacedName{Name: "nonce", Namespace: "testing"}
+	reconcile := func() *cachev1alpha1.CachedCertificate {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		return got
+	}
+	target := func() *v1.Secret {
+		t.Helper()
+		secret := &v1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			t.Fatalf("unable to get target secret %v", err)
+		}
+		return secret
+	}
+	setNonce := func(nonce string) {
+		t.Helper()
+		got := &cachev1alpha1.CachedCertificate{}
+		if err := r.Get(ctx, key, got); err != nil {
+			t.Fatalf("unable to get CachedCertificate %v", err)
+		}
+		got.Annotations = map[string]string{ResyncAnnotationKey: nonce}
+		if err := r.Update(ctx, got); err != nil {
+			t.Fatalf("unable to update CachedCertificate %v", err)
+		}
+	}
+
+	reconcile()
+	upstreamSecret, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-nonce.example.com", Namespace: "cache"})
+	if err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	reconcile()
+
+	// a change the upstream secret watch and the secret cache haven't seen
+	upstreamSecret.Data["ca.crt"] = []byte("rotated")
+	if err = r.Update(ctx, upstreamSecret); err != nil {
+		t.Fatalf("unable to update upstream secret %v", err)
+	}
+	reconcile()
+	if string(target().Data["ca.crt"]) == "rotated" {
+		t.Fatal("Reconcile() synced without a resync request")
+	}
+
+	setNonce("1")
+	if got := reconcile(); got.Status.ResyncNonce != "1" {
+		t.Errorf("Reconcile() status.resyncNonce = %q, want 1", got.Status.ResyncNonce)
+	}
+	if string(target().Data["ca.crt"]) != "rotated" {
+		t.Error("Reconcile() didn't re-read the upstream secret for the resync request")
+	}
+
+	// the same nonce is only handled once
+	resourceVersion := target().ResourceVersion
+	reconcile()
+	if got := target().ResourceVersion; got != resourceVersion {
+		t.Errorf("Reconcile() wrote the target secret again for a handled nonce, resourceVersion %v -> %v", resourceVersion, got)
+	}
+
+	// a new nonce writes the target secret even though nothing changed
+	setNonce("2")
+	if got := reconcile(); got.Status.ResyncNonce != "2" {
+		t.Errorf("Reconcile() status.resyncNonce = %q, want 2", got.Status.ResyncNonce)
+	}
+	if got := target().ResourceVersion; got == resourceVersion {
+		t.Error("Reconcile() didn't write the target secret for a new nonce")
+	}
+}
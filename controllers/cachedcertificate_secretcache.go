@@ -0,0 +1,136 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// UpstreamSecretCache reuses upstream secret reads for a short TTL, so CachedCertificates sharing an upstream don't each
+// read the same secret during a renewal. The upstream secret watch hands it every new resourceVersion it sees, replacing
+// the cached copy, and drops deleted secrets. It is safe for concurrent use
+type UpstreamSecretCache struct {
+	// TTL is how long a read is reused
+	TTL time.Duration
+
+	// Clock is used to expire reads, nil uses the real clock
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[types.NamespacedName]upstreamSecretEntry
+}
+
+// upstreamSecretEntry is a cached upstream secret and when it stops being used
+type upstreamSecretEntry struct {
+	secret  *v1.Secret
+	expires time.Time
+}
+
+// NewUpstreamSecretCache returns an empty cache reusing reads for ttl
+func NewUpstreamSecretCache(ttl time.Duration) *UpstreamSecretCache {
+	return &UpstreamSecretCache{TTL: ttl}
+}
+
+// Get returns a copy of the cached secret, reading it with the reader when it isn't cached or has expired
+// Errors, including not found, aren't cached
+func (c *UpstreamSecretCache) Get(ctx context.Context, reader client.Reader, key types.NamespacedName) (*v1.Secret, error) {
+	if secret, ok := c.lookup(key); ok {
+		return secret, nil
+	}
+
+	secret := &v1.Secret{}
+	if err := reader.Get(ctx, key, secret); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// an observed or concurrently read secret stored since the lookup is at least as new, keep it
+	if _, ok := c.fresh(key); !ok {
+		c.set(key, secret)
+	}
+
+	return secret, nil
+}
+
+// Observe replaces the cached copy with a secret seen by the upstream secret watch when its resourceVersion differs
+func (c *UpstreamSecretCache) Observe(secret *v1.Secret) {
+	key := types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok && entry.secret.ResourceVersion == secret.ResourceVersion {
+		return
+	}
+	c.set(key, secret)
+}
+
+// Forget drops the cached copy, e.g. once the secret is deleted
+func (c *UpstreamSecretCache) Forget(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// lookup returns a copy of the unexpired cached secret
+func (c *UpstreamSecretCache) lookup(key types.NamespacedName) (*v1.Secret, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.fresh(key)
+	if !ok {
+		return nil, false
+	}
+	// callers change the secret they get back, e.g. its annotations while generating the target secret
+	return entry.secret.DeepCopy(), true
+}
+
+// fresh returns the entry when it hasn't expired, expired entries are removed. c.mu must be held
+func (c *UpstreamSecretCache) fresh(key types.NamespacedName) (upstreamSecretEntry, bool) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return upstreamSecretEntry{}, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return upstreamSecretEntry{}, false
+	}
+	return entry, true
+}
+
+// set stores a copy of the secret. c.mu must be held
+func (c *UpstreamSecretCache) set(key types.NamespacedName, secret *v1.Secret) {
+	if c.entries == nil {
+		c.entries = map[types.NamespacedName]upstreamSecretEntry{}
+	}
+	c.entries[key] = upstreamSecretEntry{secret: secret.DeepCopy(), expires: c.now().Add(c.TTL)}
+}
+
+// now returns the current time from the Clock when set
+func (c *UpstreamSecretCache) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
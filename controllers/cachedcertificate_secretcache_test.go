@@ -0,0 +1,198 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// countingClient counts the secrets read through it
+type countingClient struct {
+	client.Client
+	secretGets int
+}
+
+func (c *countingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if _, ok := obj.(*v1.Secret); ok {
+		c.secretGets++
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func Test_UpstreamSecretCache(t *testing.T) {
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "cc-a.example.com", Namespace: "cache"}
+	reader := &countingClient{Client: newFakeClient(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Data:       map[string][]byte{"tls.crt": []byte("first")},
+	})}
+	fakeClock := clock.NewFakeClock(time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC))
+	c := &UpstreamSecretCache{TTL: time.Minute, Clock: fakeClock}
+
+	get := func(wantData string, wantGets int) *v1.Secret {
+		t.Helper()
+		secret, err := c.Get(ctx, reader, key)
+		if err != nil {
+			t.Fatalf("Get() unexpected err %v", err)
+		}
+		if got := string(secret.Data["tls.crt"]); got != wantData {
+			t.Errorf("Get() tls.crt = %q, want %q", got, wantData)
+		}
+		if reader.secretGets != wantGets {
+			t.Errorf("Get() read the secret %d times, want %d", reader.secretGets, wantGets)
+		}
+		return secret
+	}
+
+	// callers may change what they get back without changing the cache
+	get("first", 1).Data["tls.crt"] = []byte("changed by caller")
+	get("first", 1)
+
+	// a renewal the watch hasn't seen yet is only picked up after the TTL
+	renewed := &v1.Secret{}
+	if err := reader.Client.Get(ctx, key, renewed); err != nil {
+		t.Fatalf("unable to get secret %v", err)
+	}
+	renewed.Data["tls.crt"] = []byte("second")
+	if err := reader.Client.Update(ctx, renewed); err != nil {
+		t.Fatalf("unable to update secret %v", err)
+	}
+	get("first", 1)
+
+	// the watch seeing the new resourceVersion replaces the cached copy
+	c.Observe(renewed)
+	get("second", 1)
+
+	// the same resourceVersion again keeps the entry
+	c.Observe(renewed)
+	get("second", 1)
+
+	fakeClock.Step(time.Minute)
+	get("second", 2)
+
+	c.Forget(key)
+	get("second", 3)
+
+	// not found isn't cached
+	if err := reader.Client.Delete(ctx, renewed); err != nil {
+		t.Fatalf("unable to delete secret %v", err)
+	}
+	c.Forget(key)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, reader, key); !k8serr.IsNotFound(err) {
+			t.Errorf("Get() error = %v, want not found", err)
+		}
+	}
+	if reader.secretGets != 5 {
+		t.Errorf("Get() read the secret %d times, want every missing read to go to the reader", reader.secretGets)
+	}
+}
+
+func Test_UpstreamSecretReconcilerUpdatesSecretCache(t *testing.T) {
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "cc-a.example.com", Namespace: "cache"}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        key.Name,
+			Namespace:   key.Namespace,
+			Annotations: map[string]string{CertificateNameAnnotationKey: key.Name},
+		},
+		Data: map[string][]byte{"tls.crt": []byte("first")},
+	}
+	cl := newFakeClient(secret)
+	cache := NewUpstreamSecretCache(time.Hour)
+	if _, err := cache.Get(ctx, cl, key); err != nil {
+		t.Fatalf("Get() unexpected err %v", err)
+	}
+
+	if err := cl.Get(ctx, key, secret); err != nil {
+		t.Fatalf("unable to get secret %v", err)
+	}
+	secret.Data["tls.crt"] = []byte("second")
+	if err := cl.Update(ctx, secret); err != nil {
+		t.Fatalf("unable to update secret %v", err)
+	}
+
+	r := &UpstreamSecretReconciler{CacheNamespace: "cache", CertNameIndexKey: upstreamRefNameIndexKey, SecretCache: cache, Client: cl}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	got, err := cache.Get(ctx, cl, key)
+	if err != nil {
+		t.Fatalf("Get() unexpected err %v", err)
+	}
+	if string(got.Data["tls.crt"]) != "second" {
+		t.Errorf("Get() tls.crt = %q after the watch saw a new version, want second", got.Data["tls.crt"])
+	}
+
+	// a deleted secret is dropped
+	if err := cl.Delete(ctx, secret); err != nil {
+		t.Fatalf("unable to delete secret %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err := cache.Get(ctx, cl, key); !k8serr.IsNotFound(err) {
+		t.Errorf("Get() error = %v after the secret was deleted, want not found", err)
+	}
+}
+
+func Benchmark_getUpstreamSecret(b *testing.B) {
+	ctx := context.Background()
+
+	upstreamCert := newUpstreamCertificate()
+	upstreamCert.SetName("cc-bench.example.com")
+	upstreamCert.SetNamespace("cache")
+	_ = unstructured.SetNestedField(upstreamCert.Object, "cc-bench.example.com", "spec", "secretName")
+
+	benchmarks := []struct {
+		name  string
+		cache *UpstreamSecretCache
+	}{
+		{"uncached", nil},
+		{"cached", NewUpstreamSecretCache(time.Minute)},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			reader := &countingClient{Client: newFakeClient(&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cc-bench.example.com", Namespace: "cache"},
+				Data:       testTLSData,
+			})}
+			r := &CachedCertificateReconciler{UpstreamSecretCache: bm.cache, Client: reader}
+
+			// every iteration stands for another CachedCertificate sharing the upstream
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.getUpstreamSecret(ctx, ctrl.Log, upstreamCert); err != nil {
+					b.Fatalf("getUpstreamSecret() unexpected err %v", err)
+				}
+			}
+			b.ReportMetric(float64(reader.secretGets)/float64(b.N), "gets/op")
+		})
+	}
+}
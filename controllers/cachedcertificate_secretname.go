@@ -0,0 +1,106 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// secretNameTemplateData is what a default secretName template is rendered with
+type secretNameTemplateData struct {
+	// Name is the name of the CachedCertificate
+	Name string
+}
+
+// ParseSecretNameTemplate parses a template for the secretName of CachedCertificates that don't set one, e.g. "{{ .Name }}-tls"
+// The template is rendered once with a sample name so unknown fields and templates never giving a valid name fail here
+func ParseSecretNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("secretName").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse secretName template: %w", err)
+	}
+
+	if _, err = renderSecretName(tmpl, "example"); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// ParseUpstreamSecretNameTemplate parses a template for the secretName of upstream Certificates, rendered with the upstream
+// name as .Name e.g. "{{ .Name }}-tls". The secret of every upstream has to be unique, so templates that don't use the name fail
+func ParseUpstreamSecretNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := ParseSecretNameTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := renderSecretName(tmpl, "example-a")
+	if err != nil {
+		return nil, err
+	}
+	b, err := renderSecretName(tmpl, "example-b")
+	if err != nil {
+		return nil, err
+	}
+	if a == b {
+		return nil, fmt.Errorf("upstream secretName template renders %q for every upstream, it has to use .Name", a)
+	}
+
+	return tmpl, nil
+}
+
+// renderSecretName renders the template for a CachedCertificate name, the result has to be a valid secret name
+func renderSecretName(tmpl *template.Template, name string) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, secretNameTemplateData{Name: name}); err != nil {
+		return "", fmt.Errorf("unable to render secretName template: %w", err)
+	}
+
+	secretName := b.String()
+	if msgs := validation.IsDNS1123Subdomain(secretName); len(msgs) > 0 {
+		return "", fmt.Errorf("secretName template rendered invalid name %q: %s", secretName, strings.Join(msgs, ", "))
+	}
+
+	return secretName, nil
+}
+
+// upstreamSecretNameFor returns the secretName for a new upstream Certificate, the upstream name when there's no template
+func upstreamSecretNameFor(tmpl *template.Template, upstreamName string) (string, error) {
+	if tmpl == nil {
+		return upstreamName, nil
+	}
+	return renderSecretName(tmpl, upstreamName)
+}
+
+// targetSecretName returns the secretName of the CachedCertificate, defaulting to the rendered template or its name when
+// no template is set
+func targetSecretName(tmpl *template.Template, cachedCert *cachev1alpha1.CachedCertificate) (string, error) {
+	if cachedCert.Spec.SecretName != "" {
+		return cachedCert.Spec.SecretName, nil
+	}
+	if tmpl == nil {
+		return cachedCert.GetName(), nil
+	}
+	return renderSecretName(tmpl, cachedCert.GetName())
+}
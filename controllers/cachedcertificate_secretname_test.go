@@ -0,0 +1,267 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func Test_ParseSecretNameTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"suffix", "{{ .Name }}-tls", "web-tls", false},
+		{"prefix", "tls-{{ .Name }}", "tls-web", false},
+		{"constant", "shared-tls", "shared-tls", false},
+		{"undefined function", "{{ .Name | lower }}", "", true},
+		{"unclosed action", "{{ .Name -tls", "", true},
+		{"unknown field", "{{ .Namespace }}-tls", "", true},
+		{"underscore", "{{ .Name }}_tls", "", true},
+		{"uppercase", "{{ .Name }}-TLS", "", true},
+		{"empty", "{{ if false }}x{{ end }}", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseSecretNameTemplate(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSecretNameTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got, err := renderSecretName(tmpl, "web")
+			if err != nil {
+				t.Fatalf("renderSecretName() unexpected err %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renderSecretName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_targetSecretName(t *testing.T) {
+	tmpl, err := ParseSecretNameTemplate("{{ .Name }}-tls")
+	if err != nil {
+		t.Fatalf("ParseSecretNameTemplate() unexpected err %v", err)
+	}
+
+	explicit := newTestCachedCertificate("explicit", "explicit.example.com")
+	explicit.Spec.SecretName = "explicit-secret"
+	// valid on its own but too long once the suffix is added
+	long := newTestCachedCertificate(strings.Repeat("a", 250), "long.example.com")
+
+	tests := []struct {
+		name       string
+		tmpl       bool
+		cachedCert *cachev1alpha1.CachedCertificate
+		want       string
+		wantErr    bool
+	}{
+		{"no template", false, newTestCachedCertificate("web", "web.example.com"), "web", false},
+		{"template", true, newTestCachedCertificate("web", "web.example.com"), "web-tls", false},
+		{"secretName wins over template", true, explicit, "explicit-secret", false},
+		{"rendered name too long", true, long, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var useTmpl *template.Template
+			if tt.tmpl {
+				useTmpl = tmpl
+			}
+
+			got, err := targetSecretName(useTmpl, tt.cachedCert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("targetSecretName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("targetSecretName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ReconcileDefaultSecretNameTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	tmpl, err := ParseSecretNameTemplate("{{ .Name }}-tls")
+	if err != nil {
+		t.Fatalf("ParseSecretNameTemplate() unexpected err %v", err)
+	}
+
+	long := newTestCachedCertificate(strings.Repeat("a", 250), "long.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace:            "cache",
+		DefaultSecretNameTemplate: tmpl,
+		Client:                    newFakeClient(newTestCachedCertificate("web", "web.example.com"), long),
+	}
+
+	key := types.NamespacedName{Name: "web", Namespace: "testing"}
+	if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if _, err = testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-web.example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	if err = r.Get(ctx, types.NamespacedName{Name: "web-tls", Namespace: "testing"}, &v1.Secret{}); err != nil {
+		t.Errorf("unable to get target secret named from the template %v", err)
+	}
+
+	// a name the template can't turn into a valid secret name is reported rather than synced
+	longKey := types.NamespacedName{Name: long.Name, Namespace: "testing"}
+	if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: longKey}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	if err = r.Get(ctx, longKey, long); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if long.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&long.Status) != cachev1alpha1.ReasonInvalidSpec {
+		t.Errorf("status = %v/%v, want Error/%v", long.Status.State, readyReason(&long.Status), cachev1alpha1.ReasonInvalidSpec)
+	}
+}
+
+func Test_ParseUpstreamSecretNameTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{"suffix", "{{ .Name }}-tls", false},
+		{"prefix", "team-a-{{ .Name }}", false},
+		{"constant", "shared-tls", true},
+		{"invalid", "{{ .Name }}_tls", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseUpstreamSecretNameTemplate(tt.text); (err != nil) != tt.wantErr {
+				t.Errorf("ParseUpstreamSecretNameTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ReconcileUpstreamSecretNameTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	tmpl, err := ParseUpstreamSecretNameTemplate("{{ .Name }}-tls")
+	if err != nil {
+		t.Fatalf("ParseUpstreamSecretNameTemplate() unexpected err %v", err)
+	}
+
+	// made by hand before the template was set, holding the name the template gives the taken upstream
+	handMade := newUpstreamCertificate()
+	handMade.SetName("hand-made")
+	handMade.SetNamespace("cache")
+	_ = unstructured.SetNestedField(handMade.Object, "cc-taken.example.com-tls", "spec", "secretName")
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace:             "cache",
+		UpstreamSecretNameTemplate: tmpl,
+		Client: newFakeClient(
+			newTestCachedCertificate("web", "web.example.com"),
+			newTestCachedCertificate("taken", "taken.example.com"),
+			handMade,
+		),
+	}
+
+	key := types.NamespacedName{Name: "web", Namespace: "testing"}
+	if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	// the Certificate keeps its derived name, only the secret follows the template
+	upstreamKey := types.NamespacedName{Name: "cc-web.example.com", Namespace: "cache"}
+	upstreamCert := newUpstreamCertificate()
+	if err = r.Get(ctx, upstreamKey, upstreamCert); err != nil {
+		t.Fatalf("unable to get upstream Certificate %v", err)
+	}
+	if got := upstreamSecretName(upstreamCert); got != "cc-web.example.com-tls" {
+		t.Errorf("upstream secretName = %q, want cc-web.example.com-tls", got)
+	}
+
+	upstreamSecret, err := testutil.IssueCertificate(ctx, r.Client, upstreamKey)
+	if err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	got := &cachev1alpha1.CachedCertificate{}
+	if err = r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateSynced {
+		t.Errorf("Reconcile() state = %v, want Synced from the templated upstream secret", got.Status.State)
+	}
+
+	// a deleted upstream secret is traced back to its Certificate through the secretName
+	if err = r.Delete(ctx, upstreamSecret); err != nil {
+		t.Fatalf("unable to delete upstream secret %v", err)
+	}
+	watch := &UpstreamSecretReconciler{CacheNamespace: "cache", CertNameIndexKey: upstreamRefNameIndexKey, Client: r.Client}
+	if name := watch.certificateForSecret(ctx, client.ObjectKeyFromObject(upstreamSecret)); name != upstreamKey.Name {
+		t.Errorf("certificateForSecret() = %v, want %v", name, upstreamKey.Name)
+	}
+	if _, err = watch.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(upstreamSecret)}); err != nil {
+		t.Fatalf("upstream secret Reconcile() unexpected err %v", err)
+	}
+	got = &cachev1alpha1.CachedCertificate{}
+	if err = r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStatePending || got.Status.UpstreamReady {
+		t.Errorf("status = %v after the upstream secret was deleted, want Pending without a ready upstream", got.Status)
+	}
+
+	// a secretName already used in the cache namespace isn't given to a second Certificate
+	takenKey := types.NamespacedName{Name: "taken", Namespace: "testing"}
+	if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: takenKey}); !errors.Is(err, ErrUpstreamSecretNameTaken) {
+		t.Errorf("Reconcile() error = %v, want ErrUpstreamSecretNameTaken", err)
+	}
+	got = &cachev1alpha1.CachedCertificate{}
+	if err = r.Get(ctx, takenKey, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if got.Status.State != cachev1alpha1.CachedCertificateStateError || readyReason(&got.Status) != cachev1alpha1.ReasonUpstreamInvalid {
+		t.Errorf("status = %v/%v, want Error/%v", got.Status.State, readyReason(&got.Status), cachev1alpha1.ReasonUpstreamInvalid)
+	}
+	if err = r.Get(ctx, types.NamespacedName{Name: "cc-taken.example.com", Namespace: "cache"}, newUpstreamCertificate()); !k8serr.IsNotFound(err) {
+		t.Errorf("upstream Certificate get err = %v, want it not created", err)
+	}
+}
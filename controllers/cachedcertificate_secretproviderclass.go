@@ -0,0 +1,103 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// newSecretProviderClass returns an empty secrets-store CSI driver SecretProviderClass
+func newSecretProviderClass() *unstructured.Unstructured {
+	spc := &unstructured.Unstructured{}
+	spc.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "secrets-store.csi.x-k8s.io",
+		Kind:    "SecretProviderClass",
+		Version: "v1",
+	})
+	return spc
+}
+
+// secretProviderClassName returns the name of the SecretProviderClass requested with SecretProviderClassAnnotationKey
+// defaulting to the target secret name, ok is false when none is requested
+func secretProviderClassName(cachedCert *cachev1alpha1.CachedCertificate) (name string, ok bool) {
+	name, ok = cachedCert.GetAnnotations()[SecretProviderClassAnnotationKey]
+	if !ok {
+		return "", false
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = cachedCert.Spec.SecretName
+	}
+	return name, true
+}
+
+// genSecretProviderClassForSync builds the SecretProviderClass for the synced secret. The provider gets the secret's
+// namespace and name and its keys, sorted and newline separated, as parameters so each key can be mounted as a file
+func genSecretProviderClassForSync(cachedCert *cachev1alpha1.CachedCertificate, secret *v1.Secret, name, provider string, blockOwnerDeletion bool) *unstructured.Unstructured {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	spc := newSecretProviderClass()
+	spc.SetName(name)
+	spc.SetNamespace(cachedCert.GetNamespace())
+	spc.SetLabels(map[string]string{SyncedLabelKey: "true"})
+	spc.SetAnnotations(map[string]string{SourceAnnotationKey: cachedCert.Namespace + "/" + cachedCert.Name})
+	spc.SetOwnerReferences([]metav1.OwnerReference{ownerReference(cachedCert, blockOwnerDeletion)})
+	spc.Object["spec"] = map[string]interface{}{
+		"provider": provider,
+		"parameters": map[string]interface{}{
+			"secretNamespace": secret.GetNamespace(),
+			"secretName":      secret.GetName(),
+			"objects":         strings.Join(keys, "\n"),
+		},
+	}
+	return spc
+}
+
+// upsertSecretProviderClass creates or updates the SecretProviderClass, refusing to update one the controller didn't create
+func (r *CachedCertificateReconciler) upsertSecretProviderClass(ctx context.Context, reqLog logr.Logger, spc *unstructured.Unstructured) error {
+	existing := newSecretProviderClass()
+	err := r.Get(ctx, types.NamespacedName{Name: spc.GetName(), Namespace: spc.GetNamespace()}, existing)
+	if k8serr.IsNotFound(err) {
+		return r.Create(ctx, spc)
+	} else if err != nil {
+		reqLog.Error(err, "unexpected error getting SecretProviderClass for sync")
+		return err
+	}
+
+	if !syncedFrom(existing, spc) {
+		return fmt.Errorf("refusing to update SecretProviderClass %s: %w", spc.GetName(), ErrSecretOwnershipConflict)
+	}
+
+	spc.SetResourceVersion(existing.GetResourceVersion())
+	return r.Update(ctx, spc)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func Test_genSecretProviderClassForSync(t *testing.T) {
+	cachedCert := newTestCachedCertificate("csi", "csi.example.com")
+	cachedCert.UID = "csi-uid"
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "csi-tls", Namespace: "testing"},
+		Data:       map[string][]byte{"tls.key": nil, "tls.crt": nil, "ca.crt": nil},
+	}
+
+	got := genSecretProviderClassForSync(cachedCert, secret, "csi", "kubernetes", true)
+
+	want := newSecretProviderClass()
+	want.SetName("csi")
+	want.SetNamespace("testing")
+	want.SetLabels(map[string]string{SyncedLabelKey: "true"})
+	want.SetAnnotations(map[string]string{SourceAnnotationKey: "testing/csi"})
+	want.SetOwnerReferences([]metav1.OwnerReference{ownerReference(cachedCert, true)})
+	want.Object["spec"] = map[string]interface{}{
+		"provider": "kubernetes",
+		"parameters": map[string]interface{}{
+			"secretNamespace": "testing",
+			"secretName":      "csi-tls",
+			"objects":         "ca.crt\ntls.crt\ntls.key",
+		},
+	}
+	if diff := deep.Equal(got.Object, want.Object); diff != nil {
+		t.Errorf("genSecretProviderClassForSync() diff %v", diff)
+	}
+}
+
+func Test_ReconcileSecretProviderClass(t *testing.T) {
+	ctx := context.Background()
+
+	named := newTestCachedCertificate("named", "named.example.com")
+	named.Annotations = map[string]string{SecretProviderClassAnnotationKey: "named-csi"}
+	defaulted := newTestCachedCertificate("defaulted", "defaulted.example.com")
+	defaulted.Spec.SecretName = "defaulted-tls"
+	defaulted.Annotations = map[string]string{SecretProviderClassAnnotationKey: ""}
+	plain := newTestCachedCertificate("plain", "plain.example.com")
+	r := &CachedCertificateReconciler{
+		CacheNamespace:              "cache",
+		SecretProviderClassProvider: "kubernetes",
+		Client:                      newFakeClient(named, defaulted, plain),
+	}
+
+	for _, name := range []string{"named", "defaulted", "plain"} {
+		key := types.NamespacedName{Name: name, Namespace: "testing"}
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+		if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-" + name + ".example.com", Namespace: "cache"}); err != nil {
+			t.Fatalf("unable to issue upstream Certificate %v", err)
+		}
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+	}
+
+	for spcName, secretName := range map[string]string{"named-csi": "named", "defaulted-tls": "defaulted-tls"} {
+		spc := newSecretProviderClass()
+		if err := r.Get(ctx, types.NamespacedName{Name: spcName, Namespace: "testing"}, spc); err != nil {
+			t.Errorf("unable to get SecretProviderClass %s %v", spcName, err)
+			continue
+		}
+		parameters, _ := spc.Object["spec"].(map[string]interface{})["parameters"].(map[string]interface{})
+		if parameters["secretName"] != secretName || parameters["secretNamespace"] != "testing" {
+			t.Errorf("SecretProviderClass %s parameters = %v, want secret testing/%s", spcName, parameters, secretName)
+		}
+	}
+
+	// not annotated, nothing generated
+	if err := r.Get(ctx, types.NamespacedName{Name: "plain", Namespace: "testing"}, newSecretProviderClass()); !k8serr.IsNotFound(err) {
+		t.Errorf("SecretProviderClass get err = %v, want not found without the annotation", err)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"text/template"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// defaultStaleSecretCollectionInterval is how often target secrets are checked when StaleSecretCollector.Interval is unset
+const defaultStaleSecretCollectionInterval = 10 * time.Minute
+
+// StaleSecretCollector deletes target secrets left behind by their CachedCertificate, either because it no longer exists
+// or because its secretName changed, e.g. when the operator stopped mid-rename or the secret has another owner
+// Only secrets labeled with SyncedLabelKey and annotated with SourceAnnotationKey are considered. Copies in other namespaces
+// made for a SecretNamespaceSelector are deleted once their CachedCertificate is gone, as they have no owner reference
+type StaleSecretCollector struct {
+	client.Client
+
+	// Interval is how often target secrets are checked, defaulting to defaultStaleSecretCollectionInterval
+	Interval time.Duration
+
+	// DefaultSecretNameTemplate has to match the reconciler's so defaulted secret names aren't taken as renames
+	DefaultSecretNameTemplate *template.Template
+}
+
+// Start collects stale secrets until the context is done, errors are logged and retried on the next tick
+func (c *StaleSecretCollector) Start(ctx context.Context) error {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = defaultStaleSecretCollectionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.collect(ctx); err != nil {
+			log.FromContext(ctx).WithName("stale-secrets").Error(err, "unable to collect stale target secrets")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection only lets the leader delete target secrets
+func (c *StaleSecretCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// collect deletes every synced secret whose source CachedCertificate is gone or now writes a different secret
+func (c *StaleSecretCollector) collect(ctx context.Context) error {
+	reqLog := log.FromContext(ctx).WithName("stale-secrets")
+
+	secretList := &v1.SecretList{}
+	if err := c.List(ctx, secretList, client.MatchingLabels{SyncedLabelKey: "true"}); err != nil {
+		return err
+	}
+
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		stale, err := c.stale(ctx, secret)
+		if err != nil {
+			return err
+		}
+		if !stale {
+			continue
+		}
+
+		reqLog.Info("deleting stale target secret", "secret", secret.Namespace+"/"+secret.Name, "source", secret.Annotations[SourceAnnotationKey])
+		if err = c.delete(ctx, secret); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stale reports if the secret's source CachedCertificate no longer exists or no longer uses the secret's name
+// secrets with a missing or malformed source, or one in another namespace that isn't a copy, are left alone
+func (c *StaleSecretCollector) stale(ctx context.Context, secret *v1.Secret) (bool, error) {
+	parts := strings.Split(secret.Annotations[SourceAnnotationKey], "/")
+	copyOf, isCopy := secret.Labels[CopyOfLabelKey]
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || (parts[0] != secret.Namespace && !isCopy) {
+		return false, nil
+	}
+
+	cachedCert := &cachev1alpha1.CachedCertificate{}
+	err := c.Get(ctx, types.NamespacedName{Name: parts[1], Namespace: parts[0]}, cachedCert)
+	if k8serr.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if isCopy {
+		// a CachedCertificate re-created under the same name has a new uid, its own reconcile handles selector changes
+		return string(cachedCert.GetUID()) != copyOf, nil
+	}
+
+	secretName, err := targetSecretName(c.DefaultSecretNameTemplate, cachedCert)
+	if err != nil {
+		// the CachedCertificate is in the Error state until its name renders, keep its secret meanwhile
+		return false, nil
+	}
+	return secretName != secret.Name, nil
+}
+
+// delete removes the secret, the resource version precondition skips the delete when it was synced again since it was listed
+func (c *StaleSecretCollector) delete(ctx context.Context, secret *v1.Secret) error {
+	resourceVersion := secret.GetResourceVersion()
+	err := c.Delete(ctx, secret, &client.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion}})
+	if k8serr.IsNotFound(err) || k8serr.IsConflict(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// newSyncedSecret returns a target secret as written for the source CachedCertificate
+func newSyncedSecret(name, source string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "testing",
+			Labels:      map[string]string{SyncedLabelKey: "true"},
+			Annotations: map[string]string{SourceAnnotationKey: source},
+		},
+	}
+}
+
+func Test_StaleSecretCollector(t *testing.T) {
+	renamed := newTestCachedCertificate("renamed", "renamed.example.com")
+	renamed.Spec.SecretName = "renamed-new"
+	valid := newTestCachedCertificate("valid", "valid.example.com")
+	explicit := newTestCachedCertificate("explicit", "explicit.example.com")
+	explicit.Spec.SecretName = "explicit-tls"
+
+	valid.UID = "valid-uid"
+
+	unlabeled := newSyncedSecret("unlabeled", "testing/gone")
+	unlabeled.Labels = nil
+
+	// copies made for a SecretNamespaceSelector live in another namespace
+	namespaceCopy := func(name, source, uid string) *v1.Secret {
+		secret := newSyncedSecret(name, source)
+		secret.Namespace = "team-a"
+		secret.Labels[CopyOfLabelKey] = uid
+		return secret
+	}
+
+	tests := []struct {
+		name       string
+		secret     *v1.Secret
+		wantDelete bool
+	}{
+		{"owner gone", newSyncedSecret("gone", "testing/gone"), true},
+		{"owner renamed", newSyncedSecret("renamed", "testing/renamed"), true},
+		{"owner renamed, current secret", newSyncedSecret("renamed-new", "testing/renamed"), false},
+		{"owner valid with defaulted secretName", newSyncedSecret("valid", "testing/valid"), false},
+		{"owner valid with secretName", newSyncedSecret("explicit-tls", "testing/explicit"), false},
+		{"not synced", unlabeled, false},
+		{"malformed source", newSyncedSecret("malformed", "gone"), false},
+		{"source in another namespace", newSyncedSecret("elsewhere", "other/gone"), false},
+		{"copy with owner gone", namespaceCopy("gone", "testing/gone", "gone-uid"), true},
+		{"copy of a re-created owner", namespaceCopy("valid", "testing/valid", "old-uid"), true},
+		{"copy with owner valid", namespaceCopy("valid", "testing/valid", "valid-uid"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := newFakeClient(renamed, valid, explicit, tt.secret)
+
+			collector := &StaleSecretCollector{Client: c}
+			if err := collector.collect(ctx); err != nil {
+				t.Fatalf("collect() error = %v", err)
+			}
+
+			err := c.Get(ctx, client.ObjectKeyFromObject(tt.secret), &v1.Secret{})
+			if deleted := k8serr.IsNotFound(err); deleted != tt.wantDelete {
+				t.Errorf("collect() deleted = %v, want %v (get error %v)", deleted, tt.wantDelete, err)
+			}
+		})
+	}
+}
+
+func Test_StaleSecretCollectorSecretNameTemplate(t *testing.T) {
+	ctx := context.Background()
+	tmpl, err := ParseSecretNameTemplate("{{ .Name }}-tls")
+	if err != nil {
+		t.Fatalf("ParseSecretNameTemplate() unexpected err %v", err)
+	}
+
+	current := newSyncedSecret("valid-tls", "testing/valid")
+	// synced before the template was configured
+	previous := newSyncedSecret("valid", "testing/valid")
+	c := newFakeClient(newTestCachedCertificate("valid", "valid.example.com"), current, previous)
+
+	collector := &StaleSecretCollector{Client: c, DefaultSecretNameTemplate: tmpl}
+	if err = collector.collect(ctx); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+
+	if err = c.Get(ctx, client.ObjectKeyFromObject(current), &v1.Secret{}); err != nil {
+		t.Errorf("collect() deleted the secret named from the template, get error %v", err)
+	}
+	if err = c.Get(ctx, client.ObjectKeyFromObject(previous), &v1.Secret{}); !k8serr.IsNotFound(err) {
+		t.Errorf("collect() kept the secret named before the template, get error %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// defaultSummaryInterval is how often the summary ConfigMap is refreshed when SummaryWriter.Interval is unset
+const defaultSummaryInterval = time.Minute
+
+// SummaryTotalKey is the summary ConfigMap key holding the number of CachedCertificates with a state
+const SummaryTotalKey = "Total"
+
+// SummaryWriter keeps a ConfigMap up to date with the number of CachedCertificates in each state
+// It is meant for dashboards that can read a ConfigMap but not the metrics endpoint
+type SummaryWriter struct {
+	client.Client
+
+	// Key is the namespace and name of the summary ConfigMap, it is created when missing
+	Key types.NamespacedName
+
+	// Interval is how often the summary is refreshed, defaulting to defaultSummaryInterval
+	Interval time.Duration
+}
+
+// Start refreshes the summary until the context is done, errors are logged and retried on the next tick
+func (w *SummaryWriter) Start(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultSummaryInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.write(ctx); err != nil {
+			log.FromContext(ctx).WithName("summary").Error(err, "unable to write CachedCertificate summary", "configMap", w.Key)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection only lets the leader write the summary
+func (w *SummaryWriter) NeedLeaderElection() bool {
+	return true
+}
+
+// write lists all CachedCertificates and creates or updates the summary ConfigMap with their counts
+func (w *SummaryWriter) write(ctx context.Context) error {
+	certList := &cachev1alpha1.CachedCertificateList{}
+	if err := w.List(ctx, certList); err != nil {
+		return err
+	}
+
+	data := map[string]string{}
+	total := 0
+	for state, count := range countStates(certList.Items) {
+		data[string(state)] = strconv.Itoa(count)
+		total += count
+	}
+	data[SummaryTotalKey] = strconv.Itoa(total)
+
+	configMap := &v1.ConfigMap{}
+	err := w.Get(ctx, w.Key, configMap)
+	if k8serr.IsNotFound(err) {
+		return w.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      w.Key.Name,
+				Namespace: w.Key.Namespace,
+			},
+			Data: data,
+		})
+	} else if err != nil {
+		return err
+	}
+
+	// skip no-op writes, the summary rarely changes between ticks
+	if reflect.DeepEqual(configMap.Data, data) {
+		return nil
+	}
+
+	configMap.Data = data
+	return w.Update(ctx, configMap)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+func Test_SummaryWriter(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeClient(
+		newTestCachedCertificateInState("a", cachev1alpha1.CachedCertificateStateSynced),
+		newTestCachedCertificateInState("b", cachev1alpha1.CachedCertificateStateSynced),
+		newTestCachedCertificateInState("c", cachev1alpha1.CachedCertificateStatePending),
+		newTestCachedCertificateInState("d", cachev1alpha1.CachedCertificateStateError),
+		newTestCachedCertificateInState("e", ""),
+	)
+	w := &SummaryWriter{Client: c, Key: types.NamespacedName{Name: "summary", Namespace: "cache"}}
+
+	want := map[string]string{"Synced": "2", "Pending": "1", "Error": "1", "SyncPaused": "0", SummaryTotalKey: "4"}
+	if err := w.write(ctx); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	got := &v1.ConfigMap{}
+	if err := c.Get(ctx, w.Key, got); err != nil {
+		t.Fatalf("summary ConfigMap not created %v", err)
+	}
+	if diff := deep.Equal(got.Data, want); diff != nil {
+		t.Errorf("summary diff %v", diff)
+	}
+
+	// counts follow state changes on the next write
+	cert := &cachev1alpha1.CachedCertificate{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "c", Namespace: "testing"}, cert); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	cert.Status.State = cachev1alpha1.CachedCertificateStateSynced
+	if err := c.Status().Update(ctx, cert); err != nil {
+		t.Fatalf("unable to update CachedCertificate %v", err)
+	}
+
+	want["Synced"], want["Pending"] = "3", "0"
+	if err := w.write(ctx); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	if err := c.Get(ctx, w.Key, got); err != nil {
+		t.Fatalf("unable to get summary ConfigMap %v", err)
+	}
+	if diff := deep.Equal(got.Data, want); diff != nil {
+		t.Errorf("summary diff %v", diff)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// tracerName identifies the spans created by this package
+	tracerName = "weavelab.xyz/cached-certificate-operator/controllers"
+
+	// cachedCertificateNameKey and cachedCertificateNamespaceKey are the span attributes identifying the CachedCertificate
+	cachedCertificateNameKey      = attribute.Key("cachedcertificate.name")
+	cachedCertificateNamespaceKey = attribute.Key("cachedcertificate.namespace")
+
+	// upstreamNameKey is the span attribute holding the upstream Certificate name
+	upstreamNameKey = attribute.Key("upstream.name")
+)
+
+// spanKeyContextKey holds the CachedCertificate being reconciled so every span can be tagged with it
+type spanKeyContextKey struct{}
+
+// startSpan starts a span for a step of the reconcile, the otel global provider is used when TracerProvider is nil
+// which does nothing unless tracing is set up in main
+func (r *CachedCertificateReconciler) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	provider := r.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	if key, ok := ctx.Value(spanKeyContextKey{}).(types.NamespacedName); ok {
+		attrs = append(attrs, cachedCertificateNameKey.String(key.Name), cachedCertificateNamespaceKey.String(key.Namespace))
+	}
+	return provider.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
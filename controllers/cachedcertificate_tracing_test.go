@@ -0,0 +1,79 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func Test_ReconcileTracing(t *testing.T) {
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+		Client:         newFakeClient(newTestCachedCertificate("traced", "traced.example.com")),
+	}
+
+	key := types.NamespacedName{Name: "traced", Namespace: "testing"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+	got := &cachev1alpha1.CachedCertificate{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("unable to get CachedCertificate %v", err)
+	}
+	if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: got.Status.UpstreamRef.Name, Namespace: "cache"}); err != nil {
+		t.Fatalf("unable to issue upstream Certificate %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() unexpected err %v", err)
+	}
+
+	spans := map[string]int{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()]++
+
+		attrs := map[string]string{}
+		for _, attr := range span.Attributes() {
+			attrs[string(attr.Key)] = attr.Value.Emit()
+		}
+		if attrs[string(cachedCertificateNameKey)] != "traced" || attrs[string(cachedCertificateNamespaceKey)] != "testing" {
+			t.Errorf("span %v attributes = %v, want the CachedCertificate name and namespace", span.Name(), attrs)
+		}
+
+		if span.Name() != "Reconcile" && !span.Parent().IsValid() {
+			t.Errorf("span %v has no parent, want it under Reconcile", span.Name())
+		}
+	}
+
+	for _, name := range []string{"Reconcile", "createUpstreamCertificate", "getUpstreamSecret", "upsertTargetSecret"} {
+		if spans[name] == 0 {
+			t.Errorf("no %v span recorded, got %v", name, spans)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+const (
+	// TrustBundleKey is the target secret key holding ca.crt and the extra CAs from TrustBundleFrom
+	TrustBundleKey = "trust-bundle.pem"
+
+	// trustBundleFromIndexKey is used to index CachedCertificates by the ConfigMap they read extra CAs from
+	trustBundleFromIndexKey = "spec.trustBundleFrom.name"
+)
+
+// resolveTrustBundle reads the extra CAs for the trust bundle, a missing ConfigMap or key gives no extra CAs so the
+// bundle still has ca.crt. Only other read errors are returned
+func (r *CachedCertificateReconciler) resolveTrustBundle(ctx context.Context, reqLog logr.Logger, cachedCert *cachev1alpha1.CachedCertificate) ([]byte, error) {
+	ref := cachedCert.Spec.TrustBundleFrom
+	if ref == nil {
+		return nil, nil
+	}
+
+	configMap := &v1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cachedCert.GetNamespace()}, configMap)
+	if k8serr.IsNotFound(err) {
+		reqLog.Info("trust bundle ConfigMap not found, bundling ca.crt only", "configMap", ref.Name)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	value, ok := configMap.Data[ref.Key]
+	if !ok {
+		reqLog.Info("trust bundle key not found in ConfigMap, bundling ca.crt only", "configMap", ref.Name, "key", ref.Key)
+		return nil, nil
+	}
+
+	return []byte(value), nil
+}
+
+// addTrustBundle sets the TrustBundleKey of the target secret to the upstream ca.crt followed by the extra CAs
+// Either may be missing, the key is left out when both are
+func addTrustBundle(secret *v1.Secret, caPEM, extraPEM []byte) {
+	var bundle []byte
+	for _, part := range [][]byte{caPEM, extraPEM} {
+		part = bytes.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		bundle = append(append(bundle, part...), '\n')
+	}
+
+	// the data may still be the upstream secret's own map, copy it before adding the key
+	data := make(map[string][]byte, len(secret.Data)+1)
+	for k, v := range secret.Data {
+		data[k] = v
+	}
+	if len(bundle) > 0 {
+		data[TrustBundleKey] = bundle
+	}
+	secret.Data = data
+}
+
+// trustBundleConfigMapDependents maps a ConfigMap to the CachedCertificates reading extra CAs from it
+func (r *CachedCertificateReconciler) trustBundleConfigMapDependents(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+
+	certList := &cachev1alpha1.CachedCertificateList{}
+	err := r.List(ctx, certList, client.InNamespace(obj.GetNamespace()), client.MatchingFields{trustBundleFromIndexKey: obj.GetName()})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to list CachedCertificates reading a trust bundle from ConfigMap", "name", obj.GetName(), "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cert := range certList.Items {
+		ref := cert.Spec.TrustBundleFrom
+		if ref == nil || ref.Name != obj.GetName() || !r.watches(&cert) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: cert.Name, Namespace: cert.Namespace}})
+	}
+
+	return requests
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func Test_addTrustBundle(t *testing.T) {
+	tests := []struct {
+		name  string
+		ca    string
+		extra string
+		want  string
+	}{
+		{"both", "ca\n", "extra\n", "ca\nextra\n"},
+		{"missing trailing newlines", "ca", "extra", "ca\nextra\n"},
+		{"no extra CAs", "ca\n", "", "ca\n"},
+		{"no ca.crt", "", "extra\n", "extra\n"},
+		{"neither", "", " \n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamData := map[string][]byte{"tls.crt": []byte("crt")}
+			secret := &v1.Secret{Data: upstreamData}
+
+			addTrustBundle(secret, []byte(tt.ca), []byte(tt.extra))
+
+			got, ok := secret.Data[TrustBundleKey]
+			if string(got) != tt.want || ok != (tt.want != "") {
+				t.Errorf("addTrustBundle() bundle = %q (set %v), want %q", got, ok, tt.want)
+			}
+			if _, ok := upstreamData[TrustBundleKey]; ok {
+				t.Error("addTrustBundle() changed the map it was given")
+			}
+		})
+	}
+}
+
+func Test_ReconcileTrustBundle(t *testing.T) {
+	ctx := context.Background()
+
+	root := newTestCert(t, "extra root", nil, true)
+	extraCA := encodeChain(root)
+
+	bundled := newTestCachedCertificate("bundled", "bundled.example.com")
+	bundled.Spec.TrustBundleFrom = &cachev1alpha1.ConfigMapKeyRef{Name: "extra-cas", Key: "ca.pem"}
+	bundled.Spec.OmitCA = true
+	missing := newTestCachedCertificate("missing", "missing.example.com")
+	missing.Spec.TrustBundleFrom = &cachev1alpha1.ConfigMapKeyRef{Name: "not-there", Key: "ca.pem"}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "extra-cas", Namespace: "testing"},
+		Data:       map[string]string{"ca.pem": string(extraCA)},
+	}
+
+	r := &CachedCertificateReconciler{
+		CacheNamespace: "cache",
+		Client:         newFakeClient(bundled, missing, configMap),
+	}
+
+	sync := func(name string) (upstreamCA, bundle []byte) {
+		t.Helper()
+		key := types.NamespacedName{Name: name, Namespace: "testing"}
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+		upstreamSecret, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-" + name + ".example.com", Namespace: "cache"})
+		if err != nil {
+			t.Fatalf("unable to issue upstream Certificate %v", err)
+		}
+		if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() unexpected err %v", err)
+		}
+
+		secret := &v1.Secret{}
+		if err = r.Get(ctx, key, secret); err != nil {
+			t.Fatalf("unable to get target secret %v", err)
+		}
+		if _, ok := secret.Data["ca.crt"]; ok && name == "bundled" {
+			t.Error("Reconcile() synced ca.crt despite omitCA")
+		}
+		return upstreamSecret.Data["ca.crt"], secret.Data[TrustBundleKey]
+	}
+
+	// omitCA only drops the ca.crt key, the bundle still has it
+	upstreamCA, bundle := sync("bundled")
+	if !bytes.Contains(bundle, bytes.TrimSpace(upstreamCA)) || !bytes.Contains(bundle, bytes.TrimSpace(extraCA)) {
+		t.Errorf("trust bundle = %s, want both the upstream ca.crt and the extra CA", bundle)
+	}
+	if bytes.Index(bundle, bytes.TrimSpace(upstreamCA)) > bytes.Index(bundle, bytes.TrimSpace(extraCA)) {
+		t.Error("trust bundle lists the extra CA before ca.crt")
+	}
+
+	// a missing ConfigMap still bundles ca.crt rather than failing the sync
+	upstreamCA, bundle = sync("missing")
+	if !bytes.Equal(bytes.TrimSpace(bundle), bytes.TrimSpace(upstreamCA)) {
+		t.Errorf("trust bundle = %s without the ConfigMap, want just ca.crt", bundle)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+// newUpstreamCertificate returns an empty upstream Certificate for use with watches and gets
+func newUpstreamCertificate() *unstructured.Unstructured {
+	upstreamCert := &unstructured.Unstructured{}
+	upstreamCert.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "cert-manager.io",
+		Kind:    "Certificate",
+		Version: "v1",
+	})
+	return upstreamCert
+}
+
+// checkUpstreamDNSNames returns the dnsNames of the upstream Certificate, with ErrUpstreamDNSMismatch wrapped in the error
+// when they aren't the same set as dnsNames
+func checkUpstreamDNSNames(upstreamCert *unstructured.Unstructured, dnsNames []string) ([]string, error) {
+	upstreamDNSNames, found, err := unstructured.NestedStringSlice(upstreamCert.Object, "spec", "dnsNames")
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, errUpstreamInvalid)
+	}
+	if !found {
+		return nil, fmt.Errorf("dnsNames not set in upstream Certificate %s: %w", upstreamCert.GetName(), errUpstreamInvalid)
+	}
+
+	if !slicesEqualAfterSort(upstreamDNSNames, dnsNames) {
+		return upstreamDNSNames, fmt.Errorf("upstream Certificate %s: %w", upstreamCert.GetName(), ErrUpstreamDNSMismatch)
+	}
+
+	return upstreamDNSNames, nil
+}
+
+// checkUpstreamCommonName returns ErrUpstreamCommonNameMismatch wrapped in the error when the upstream Certificate's commonName
+// isn't commonName. Without a commonName any upstream matches, so upstreams made or imported with one can still be shared
+func checkUpstreamCommonName(upstreamCert *unstructured.Unstructured, commonName string) error {
+	if commonName == "" {
+		return nil
+	}
+
+	upstreamCommonName, _, err := unstructured.NestedString(upstreamCert.Object, "spec", "commonName")
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, errUpstreamInvalid)
+	}
+	if upstreamCommonName != commonName {
+		return fmt.Errorf("upstream Certificate %s: %w", upstreamCert.GetName(), ErrUpstreamCommonNameMismatch)
+	}
+
+	return nil
+}
+
+// checkUpstreamIssuerRef returns errUpstreamInvalid wrapped in the error when the upstream Certificate has no issuerRef name,
+// e.g. one made by hand or by an older version. cert-manager can't issue it so its secret would never be renewed
+func checkUpstreamIssuerRef(upstreamCert *unstructured.Unstructured) error {
+	if upstreamIssuerName(upstreamCert) == "" {
+		return fmt.Errorf("issuerRef not set in upstream Certificate %s: %w", upstreamCert.GetName(), errUpstreamInvalid)
+	}
+	return nil
+}
+
+// upstreamCertificateChanged only passes deletes of Certificates in the cache namespace and updates changing their secretName,
+// issuer or renewal time. Other creates and updates are already covered by the upstream secret watch, but a missing secretName
+// or issuer means there's no secret to watch, so CachedCertificates report the broken upstream right away and recover once it
+// is fixed. cert-manager sets status.renewalTime after writing the secret, so the renewal time annotation needs its own update
+func (r *CachedCertificateReconciler) upstreamCertificateChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectNew.GetNamespace() != r.CacheNamespace {
+				return false
+			}
+			return upstreamSecretName(e.ObjectOld) != upstreamSecretName(e.ObjectNew) ||
+				upstreamIssuerName(e.ObjectOld) != upstreamIssuerName(e.ObjectNew) ||
+				upstreamRenewalTime(e.ObjectOld) != upstreamRenewalTime(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return e.Object.GetNamespace() == r.CacheNamespace
+		},
+	}
+}
+
+// upstreamSecretName returns spec.secretName of an upstream Certificate, empty when missing or not unstructured
+func upstreamSecretName(obj client.Object) string {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return ""
+	}
+	secretName, _, _ := unstructured.NestedString(u.Object, "spec", "secretName")
+	return secretName
+}
+
+// upstreamIssuerName returns spec.issuerRef.name of an upstream Certificate, empty when missing or not unstructured
+func upstreamIssuerName(obj client.Object) string {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return ""
+	}
+	name, _, _ := unstructured.NestedString(u.Object, "spec", "issuerRef", "name")
+	return name
+}
+
+// upstreamRenewalTime returns status.renewalTime of an upstream Certificate, empty when missing or not unstructured
+func upstreamRenewalTime(obj client.Object) string {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return ""
+	}
+	renewalTime, _, _ := unstructured.NestedString(u.Object, "status", "renewalTime")
+	return renewalTime
+}
+
+// upstreamCertificateDependents maps an upstream Certificate to the CachedCertificates using it
+// so they re-create it after a manual delete or re-check its secretName
+func (r *CachedCertificateReconciler) upstreamCertificateDependents(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+
+	certList := &cachev1alpha1.CachedCertificateList{}
+	err := r.List(ctx, certList, client.MatchingFields{upstreamRefNameIndexKey: obj.GetName()})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to list dependents of upstream Certificate", "name", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cert := range certList.Items {
+		ref := cert.Status.UpstreamRef
+		if ref == nil || ref.Name != obj.GetName() || ref.Namespace != obj.GetNamespace() || !r.watches(&cert) {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: cert.Name, Namespace: cert.Namespace}})
+	}
+
+	return requests
+}
@@ -22,7 +22,9 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -42,6 +44,18 @@ type UpstreamSecretReconciler struct {
 	CacheNamespace   string
 	CertNameIndexKey string
 
+	// CertNameAnnotationKey is the annotation pointing from a secret to its Certificate, empty uses CertificateNameAnnotationKey
+	CertNameAnnotationKey string
+
+	// AllEvents disables the event filtering on upstream secrets, this is noisy and intended for debugging
+	AllEvents bool
+
+	// Watches filters the CachedCertificates this instance is responsible for, nil includes all of them
+	Watches func(client.Object) bool
+
+	// SecretCache is kept up to date with the upstream secrets seen, nil when upstream secret reads aren't cached
+	SecretCache *UpstreamSecretCache
+
 	client.Client
 	Scheme *runtime.Scheme
 }
@@ -49,35 +63,63 @@ type UpstreamSecretReconciler struct {
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *UpstreamSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	reqLog := log.FromContext(ctx)
-
 	secret := &corev1.Secret{}
 	err := r.Get(ctx, req.NamespacedName, secret)
 	switch {
 	case k8serr.IsNotFound(err):
-		// nothing to do so exit with requeue and no err
-		return ctrl.Result{}, nil
+		// the secret was deleted, dependents are still found through the Certificate it was issued for
+		// and sent back to wait for re-issuance
+		if r.SecretCache != nil {
+			r.SecretCache.Forget(req.NamespacedName)
+		}
+		return r.markDependentsPending(ctx, r.certificateForSecret(ctx, req.NamespacedName), true)
 	case err != nil:
 		return ctrl.Result{}, err
 	}
 
-	certName := secret.Annotations[CertificateNameAnnotationKey]
+	// replace the cached copy before dependents are sent to re-sync from it
+	if r.SecretCache != nil {
+		r.SecretCache.Observe(secret)
+	}
+
+	certName := secret.Annotations[r.certNameAnnotationKey()]
 	if certName == "" {
 		// nothing to do so exit with requeue and no err
 		return ctrl.Result{}, nil
 	}
 
+	return r.markDependentsPending(ctx, certName, false)
+}
+
+// markDependentsPending sets all CachedCertificates using the given upstream Certificate to pending, triggering their reconcile.
+// When the upstream secret is gone the dependents are also marked as no longer having a ready upstream.
+func (r *UpstreamSecretReconciler) markDependentsPending(ctx context.Context, certName string, secretDeleted bool) (ctrl.Result, error) {
+	reqLog := log.FromContext(ctx)
+
 	// get a list of all certs using the updated secret, using the indexed attribute for fast listings
 	certList := &cachev1alpha1.CachedCertificateList{}
-	err = r.List(ctx, certList, client.MatchingFields{r.CertNameIndexKey: certName})
+	err := r.List(ctx, certList, client.MatchingFields{r.CertNameIndexKey: certName})
 	if err != nil {
 		return ctrl.Result{Requeue: true}, err
 	}
 
 	for _, cert := range certList.Items {
+		if r.Watches != nil && !r.Watches(&cert) {
+			continue
+		}
+
+		if cert.Spec.UpstreamSecretSync == cachev1alpha1.UpstreamSecretSyncPoll {
+			// picked up on its next poll instead
+			continue
+		}
+
 		reqLog.Info("Updating upstream cert to pending status to trigger reconcile", "cert_name", cert.GetName(), "cert_namespace", cert.GetNamespace())
 		patch := client.MergeFrom(cert.DeepCopy())
-		cert.Status.State = cachev1alpha1.CachedCertificateStatePending
+		setState(&cert.Status, cachev1alpha1.CachedCertificateStatePending)
+		cert.Status.InSync = false
+		if secretDeleted {
+			cert.Status.UpstreamReady = false
+		}
 		err := r.Client.Status().Patch(ctx, &cert, patch)
 		if err != nil {
 			return reconcile.Result{RequeueAfter: time.Second * 3}, err
@@ -87,21 +129,55 @@ func (r *UpstreamSecretReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	return reconcile.Result{}, nil
 }
 
+// certificateForSecret returns the name of the Certificate in the cache namespace with the given secretName. Upstream secrets
+// share the name of their Certificate unless an upstream secretName template is used, so that is the fallback
+func (r *UpstreamSecretReconciler) certificateForSecret(ctx context.Context, key types.NamespacedName) string {
+	certList := &unstructured.UnstructuredList{}
+	certList.SetGroupVersionKind(newUpstreamCertificate().GroupVersionKind().GroupVersion().WithKind("CertificateList"))
+	if err := r.List(ctx, certList, client.InNamespace(key.Namespace)); err != nil {
+		log.FromContext(ctx).Error(err, "unable to list Certificates for deleted upstream secret", "secret", key.Name)
+		return key.Name
+	}
+
+	for i := range certList.Items {
+		if upstreamSecretName(&certList.Items[i]) == key.Name {
+			return certList.Items[i].GetName()
+		}
+	}
+	return key.Name
+}
+
+// certNameAnnotationKey returns the configured annotation key or the cert-manager default
+func (r *UpstreamSecretReconciler) certNameAnnotationKey() string {
+	if r.CertNameAnnotationKey == "" {
+		return CertificateNameAnnotationKey
+	}
+	return r.CertNameAnnotationKey
+}
+
+// isUpstreamSecret checks the object is a secret issued for an upstream Certificate
+func (r *UpstreamSecretReconciler) isUpstreamSecret(object client.Object) bool {
+	return object.GetNamespace() == r.CacheNamespace && // in the cache namespace
+		object.GetAnnotations()[r.certNameAnnotationKey()] != "" && // owned by cert-manager
+		object.GetLabels()[SyncedLabelKey] != "true" // not made by us (usually only happens in local dev)
+}
+
 // SetupWithManager sets up the controller with the Manager. It will force reconciles only for secrets in the given namespace
 func (r *UpstreamSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	namespaceAndLabelsPredicate := predicate.NewPredicateFuncs(
-		func(object client.Object) bool {
-			return object.GetNamespace() == r.CacheNamespace && // in the cache namespace
-				object.GetAnnotations()[CertificateNameAnnotationKey] != "" && // owned by cert-manager
-				object.GetLabels()[SyncedLabelKey] != "true" // not made by us (usually only happens in local dev)
-		},
-	)
+	namespaceAndLabelsPredicate := predicate.NewPredicateFuncs(r.isUpstreamSecret)
+
+	// only reconcile on actual resource version changes and deletes, meaning we skip all initial add reconciles
+	var eventsPredicate predicate.Predicate = ResourceVersionChangesOnly{}
+	if r.AllEvents {
+		// pass through every event, useful when debugging
+		eventsPredicate = predicate.Funcs{}
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Secret{}, builder.WithPredicates(
 			predicate.And(
-				ResourceVersionChangesOnly{}, // only reconcile on actual resource version changes, meaning we skip all initial add reconciles
-				namespaceAndLabelsPredicate,  // only watch the cached namespace for secrets not owned by us
+				eventsPredicate,
+				namespaceAndLabelsPredicate, // only watch the cached namespace for secrets not owned by us
 			),
 		)).
 		Complete(r)
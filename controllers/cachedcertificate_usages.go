@@ -0,0 +1,85 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/x509"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+)
+
+var (
+	// keyUsages maps the cert-manager key usage names to x509 key usages
+	keyUsages = map[cachev1alpha1.KeyUsage]x509.KeyUsage{
+		cachev1alpha1.KeyUsageDigitalSignature:  x509.KeyUsageDigitalSignature,
+		cachev1alpha1.KeyUsageContentCommitment: x509.KeyUsageContentCommitment,
+		cachev1alpha1.KeyUsageKeyEncipherment:   x509.KeyUsageKeyEncipherment,
+		cachev1alpha1.KeyUsageDataEncipherment:  x509.KeyUsageDataEncipherment,
+		cachev1alpha1.KeyUsageKeyAgreement:      x509.KeyUsageKeyAgreement,
+		cachev1alpha1.KeyUsageCertSign:          x509.KeyUsageCertSign,
+		cachev1alpha1.KeyUsageCRLSign:           x509.KeyUsageCRLSign,
+		cachev1alpha1.KeyUsageEncipherOnly:      x509.KeyUsageEncipherOnly,
+		cachev1alpha1.KeyUsageDecipherOnly:      x509.KeyUsageDecipherOnly,
+	}
+
+	// extKeyUsages maps the cert-manager extended key usage names to x509 extended key usages
+	extKeyUsages = map[cachev1alpha1.KeyUsage]x509.ExtKeyUsage{
+		cachev1alpha1.KeyUsageServerAuth:      x509.ExtKeyUsageServerAuth,
+		cachev1alpha1.KeyUsageClientAuth:      x509.ExtKeyUsageClientAuth,
+		cachev1alpha1.KeyUsageCodeSigning:     x509.ExtKeyUsageCodeSigning,
+		cachev1alpha1.KeyUsageEmailProtection: x509.ExtKeyUsageEmailProtection,
+		cachev1alpha1.KeyUsageTimestamping:    x509.ExtKeyUsageTimeStamping,
+		cachev1alpha1.KeyUsageOCSPSigning:     x509.ExtKeyUsageOCSPSigning,
+	}
+)
+
+// missingUsages returns the usages the leaf certificate of the PEM chain doesn't have
+// Unknown usage names are reported as missing since they can't be verified
+func missingUsages(chains *ParsedChainCache, chain []byte, usages []cachev1alpha1.KeyUsage) ([]cachev1alpha1.KeyUsage, error) {
+	certs, err := chains.parse(chain)
+	if err != nil {
+		return nil, err
+	}
+	leaf := sortLeafFirst(certs)[0]
+
+	var missing []cachev1alpha1.KeyUsage
+	for _, usage := range usages {
+		if keyUsage, ok := keyUsages[usage]; ok {
+			if leaf.KeyUsage&keyUsage == 0 {
+				missing = append(missing, usage)
+			}
+			continue
+		}
+
+		extKeyUsage, ok := extKeyUsages[usage]
+		if !ok || !hasExtKeyUsage(leaf, extKeyUsage) {
+			missing = append(missing, usage)
+		}
+	}
+
+	return missing, nil
+}
+
+// hasExtKeyUsage reports if the certificate has the extended key usage, any counts as every usage
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/testutil"
+)
+
+func Test_missingUsages(t *testing.T) {
+	root := newTestCert(t, "root", nil, true)
+	leaf := newTestCert(t, "leaf", root, false)
+
+	// the leaf is found no matter the chain order, the root's usages don't count
+	missing, err := missingUsages(nil, encodeChain(root, leaf), []cachev1alpha1.KeyUsage{cachev1alpha1.KeyUsageServerAuth, "made up"})
+	if err != nil {
+		t.Fatalf("missingUsages() error = %v", err)
+	}
+	if diff := deep.Equal(missing, []cachev1alpha1.KeyUsage{cachev1alpha1.KeyUsageServerAuth, "made up"}); diff != nil {
+		t.Errorf("missingUsages() diff %v", diff)
+	}
+
+	if _, err := missingUsages(nil, []byte("not a certificate"), []cachev1alpha1.KeyUsage{cachev1alpha1.KeyUsageServerAuth}); err == nil {
+		t.Error("missingUsages() expected an error for invalid PEM")
+	}
+}
+
+func Test_ReconcileRequiredUsages(t *testing.T) {
+	// testutil issues certificates with digital signature, key encipherment and server auth
+	tests := []struct {
+		name       string
+		usages     []cachev1alpha1.KeyUsage
+		wantState  cachev1alpha1.CachedCertificateState
+		wantReason string
+	}{
+		{
+			"all usages present",
+			[]cachev1alpha1.KeyUsage{cachev1alpha1.KeyUsageDigitalSignature, cachev1alpha1.KeyUsageServerAuth},
+			cachev1alpha1.CachedCertificateStateSynced,
+			string(cachev1alpha1.CachedCertificateStateSynced),
+		},
+		{
+			"issuer dropped client auth",
+			[]cachev1alpha1.KeyUsage{cachev1alpha1.KeyUsageServerAuth, cachev1alpha1.KeyUsageClientAuth},
+			cachev1alpha1.CachedCertificateStateError,
+			cachev1alpha1.ReasonUsagesMissing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("usages", "usages.example.com")
+			cachedCert.Spec.RequiredUsages = tt.usages
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				Client:         newFakeClient(cachedCert),
+			}
+
+			key := types.NamespacedName{Name: "usages", Namespace: "testing"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+			if _, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-usages.example.com", Namespace: "cache"}); err != nil {
+				t.Fatalf("unable to issue upstream Certificate %v", err)
+			}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			got := &cachev1alpha1.CachedCertificate{}
+			if err := r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if got.Status.State != tt.wantState || readyReason(&got.Status) != tt.wantReason {
+				t.Errorf("Reconcile() status = %v, want %v with reason %v", got.Status, tt.wantState, tt.wantReason)
+			}
+
+			// nothing is synced while usages are missing
+			err := r.Get(ctx, types.NamespacedName{Name: "usages", Namespace: "testing"}, &v1.Secret{})
+			if synced := err == nil; synced != (tt.wantState == cachev1alpha1.CachedCertificateStateSynced) {
+				t.Errorf("target secret synced = %v, want %v", synced, !synced)
+			}
+		})
+	}
+}
+
+func Test_ReconcileVerifyKeyPair(t *testing.T) {
+	tests := []struct {
+		name       string
+		mismatch   bool
+		wantState  cachev1alpha1.CachedCertificateState
+		wantReason string
+	}{
+		{"matching key", false, cachev1alpha1.CachedCertificateStateSynced, string(cachev1alpha1.CachedCertificateStateSynced)},
+		{"mismatched key", true, cachev1alpha1.CachedCertificateStateError, cachev1alpha1.ReasonKeyPairMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("keypair", "keypair.example.com")
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				VerifyKeyPair:  true,
+				Client:         newFakeClient(cachedCert),
+			}
+
+			key := types.NamespacedName{Name: "keypair", Namespace: "testing"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+			upstreamSecret, err := testutil.IssueCertificate(ctx, r.Client, types.NamespacedName{Name: "cc-keypair.example.com", Namespace: "cache"})
+			if err != nil {
+				t.Fatalf("unable to issue upstream Certificate %v", err)
+			}
+			if tt.mismatch {
+				upstreamSecret.Data["tls.key"] = encodeKey(t, newTestCert(t, "other", nil, false))
+				if err = r.Update(ctx, upstreamSecret); err != nil {
+					t.Fatalf("unable to update upstream secret %v", err)
+				}
+			}
+			if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			got := &cachev1alpha1.CachedCertificate{}
+			if err = r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if got.Status.State != tt.wantState || readyReason(&got.Status) != tt.wantReason {
+				t.Errorf("Reconcile() status = %v, want %v with reason %v", got.Status, tt.wantState, tt.wantReason)
+			}
+
+			// the mismatched pair never reaches the target secret
+			err = r.Get(ctx, key, &v1.Secret{})
+			if synced := err == nil; synced != !tt.mismatch {
+				t.Errorf("target secret synced = %v, want %v", synced, !tt.mismatch)
+			}
+		})
+	}
+}
+
+func Test_ReconcileVerifyDNSNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		issued     []interface{}
+		wantState  cachev1alpha1.CachedCertificateState
+		wantReason string
+	}{
+		{"all names", []interface{}{"a.example.com", "b.example.com"}, cachev1alpha1.CachedCertificateStateSynced, string(cachev1alpha1.CachedCertificateStateSynced)},
+		{"missing a name", []interface{}{"a.example.com"}, cachev1alpha1.CachedCertificateStateError, cachev1alpha1.ReasonDNSNamesMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cachedCert := newTestCachedCertificate("sans", "a.example.com", "b.example.com")
+			r := &CachedCertificateReconciler{
+				CacheNamespace: "cache",
+				VerifyDNSNames: true,
+				Client:         newFakeClient(cachedCert),
+			}
+
+			key := types.NamespacedName{Name: "sans", Namespace: "testing"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			// the upstream Certificate asks for both names, the issuer only puts tt.issued in the certificate
+			upstreamCert := newUpstreamCertificate()
+			if err := r.Get(ctx, types.NamespacedName{Name: "cc-a.example.com-b.example.com", Namespace: "cache"}, upstreamCert); err != nil {
+				t.Fatalf("unable to get upstream Certificate %v", err)
+			}
+			issuedCert := upstreamCert.DeepCopy()
+			if err := unstructured.SetNestedSlice(issuedCert.Object, tt.issued, "spec", "dnsNames"); err != nil {
+				t.Fatal(err)
+			}
+			upstreamSecret, err := testutil.NewCertificateSecret(issuedCert)
+			if err != nil {
+				t.Fatalf("unable to issue upstream Certificate %v", err)
+			}
+			if err = r.Create(ctx, upstreamSecret); err != nil {
+				t.Fatalf("unable to create upstream secret %v", err)
+			}
+			if _, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() unexpected err %v", err)
+			}
+
+			got := &cachev1alpha1.CachedCertificate{}
+			if err = r.Get(ctx, key, got); err != nil {
+				t.Fatalf("unable to get CachedCertificate %v", err)
+			}
+			if got.Status.State != tt.wantState || readyReason(&got.Status) != tt.wantReason {
+				t.Errorf("Reconcile() status = %v, want %v with reason %v", got.Status, tt.wantState, tt.wantReason)
+			}
+
+			// a certificate missing names never reaches the target secret
+			err = r.Get(ctx, key, &v1.Secret{})
+			if synced := err == nil; synced != (tt.wantState == cachev1alpha1.CachedCertificateStateSynced) {
+				t.Errorf("target secret synced = %v, want %v", synced, !synced)
+			}
+		})
+	}
+}
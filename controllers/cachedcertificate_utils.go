@@ -17,16 +17,25 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"hash/fnv"
 	"sort"
 	"strconv"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
 )
 
@@ -37,6 +46,38 @@ const (
 	// hashPrefixLength defines the number of chars to keep before each hash
 	// hashPrefixLength + len(hash) should not exceed maxSecretNameLength
 	hashPrefixLength = 128
+
+	// PublishedMetadataKey is the ConfigMap key holding the metadata of the paired target secret with PublishMetadata
+	PublishedMetadataKey = "metadata.json"
+
+	// maxReferencesListed caps the references written to an annotation, keeping well clear of the annotation size limit
+	maxReferencesListed = 50
+)
+
+var (
+	// errUpstreamInvalid is wrapped by errors caused by the upstream Certificate rather than the CachedCertificate
+	errUpstreamInvalid = errors.New("upstream Certificate is invalid")
+
+	// ErrSecretOwnershipConflict is wrapped by errors caused by a target secret or ConfigMap the controller didn't create
+	ErrSecretOwnershipConflict = errors.New("target object was not created by the controller")
+
+	// ErrUpstreamNoSecretName is wrapped by errors caused by an upstream Certificate without a secretName
+	// It also matches errUpstreamInvalid
+	ErrUpstreamNoSecretName = fmt.Errorf("upstream Certificate has no secretName: %w", errUpstreamInvalid)
+
+	// ErrUpstreamSecretNameTaken is wrapped by errors caused by a new upstream Certificate's secretName already being used by
+	// another Certificate in the cache namespace. It also matches errUpstreamInvalid
+	ErrUpstreamSecretNameTaken = fmt.Errorf("upstream secretName is used by another Certificate: %w", errUpstreamInvalid)
+
+	// ErrUpstreamDNSMismatch is wrapped by errors caused by an upstream Certificate with different dnsNames than the CachedCertificate
+	ErrUpstreamDNSMismatch = errors.New("upstream Certificate dnsNames don't match")
+
+	// ErrUpstreamCommonNameMismatch is wrapped by errors caused by an upstream Certificate with a different commonName than
+	// the CachedCertificate
+	ErrUpstreamCommonNameMismatch = errors.New("upstream Certificate commonName doesn't match")
+
+	// ErrSecretTooLarge is wrapped by errors caused by a target secret over the api server's secret size limit
+	ErrSecretTooLarge = errors.New("target secret is too large")
 )
 
 // ResourceVersionChangesOnly will filter out events that don't change the resource version
@@ -45,8 +86,8 @@ type ResourceVersionChangesOnly struct{}
 // Create skips all events
 func (ResourceVersionChangesOnly) Create(e event.CreateEvent) bool { return false }
 
-// Delete skips all events
-func (ResourceVersionChangesOnly) Delete(e event.DeleteEvent) bool { return false }
+// Delete passes all events, a removed object is always a change worth acting on
+func (ResourceVersionChangesOnly) Delete(e event.DeleteEvent) bool { return true }
 
 // Generic skips all events
 func (ResourceVersionChangesOnly) Generic(e event.GenericEvent) bool { return false }
@@ -63,27 +104,166 @@ func (ResourceVersionChangesOnly) Update(e event.UpdateEvent) bool {
 	return e.ObjectNew.GetResourceVersion() != e.ObjectOld.GetResourceVersion()
 }
 
-func validateSecret(secret *v1.Secret) error {
+// setState updates the state and the Ready condition with the state as its reason
+func setState(status *cachev1alpha1.CachedCertificateStatus, state cachev1alpha1.CachedCertificateState) {
+	setStateWithReason(status, state, string(state), "")
+}
+
+// failTerminal sets the Error state with the reason for failures retrying can't fix, which wait on the next event instead
+// The status is only written when it isn't already reporting the reason and message, so repeated reconciles don't keep
+// updating it while a new message for the same reason, e.g. another invalid field, is still shown
+func (r *CachedCertificateReconciler) failTerminal(ctx context.Context, cachedCert *cachev1alpha1.CachedCertificate, reason, msg string) (ctrl.Result, error) {
+	condition := meta.FindStatusCondition(cachedCert.Status.Conditions, cachev1alpha1.ConditionReady)
+	if cachedCert.Status.State == cachev1alpha1.CachedCertificateStateError && !cachedCert.Status.InSync &&
+		condition != nil && condition.Reason == reason && condition.Message == msg {
+		return ctrl.Result{}, nil
+	}
+
+	log.FromContext(ctx).Info("unable to sync CachedCertificate", "reason", reason, "message", msg)
+	setStateWithReason(&cachedCert.Status, cachev1alpha1.CachedCertificateStateError, reason, msg)
+	cachedCert.Status.InSync = false
+	return ctrl.Result{}, r.updateStatus(ctx, cachedCert)
+}
+
+// setStateWithReason updates the state and the Ready condition, LastTransitionTime is only moved when the state actually changes
+func setStateWithReason(status *cachev1alpha1.CachedCertificateStatus, state cachev1alpha1.CachedCertificateState, reason, message string) {
+	ready := metav1.ConditionFalse
+	if state == cachev1alpha1.CachedCertificateStateSynced {
+		ready = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    cachev1alpha1.ConditionReady,
+		Status:  ready,
+		Reason:  reason,
+		Message: message,
+	})
+
+	if status.State == state && status.LastTransitionTime != nil {
+		return
+	}
+
+	now := metav1.Now()
+	status.State = state
+	status.LastTransitionTime = &now
+}
+
+// readyReason returns the reason of the Ready condition, empty when it isn't set
+func readyReason(status *cachev1alpha1.CachedCertificateStatus) string {
+	if condition := meta.FindStatusCondition(status.Conditions, cachev1alpha1.ConditionReady); condition != nil {
+		return condition.Reason
+	}
+	return ""
+}
+
+// errorReason picks the Ready condition reason for an error during sync
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, errUpstreamInvalid):
+		return cachev1alpha1.ReasonUpstreamInvalid
+	case errors.Is(err, ErrSecretOwnershipConflict):
+		return cachev1alpha1.ReasonSecretConflict
+	case errors.Is(err, ErrSecretTooLarge):
+		return cachev1alpha1.ReasonSecretTooLarge
+	case isQuotaExceeded(err):
+		return cachev1alpha1.ReasonQuotaExceeded
+	default:
+		return cachev1alpha1.ReasonSyncError
+	}
+}
+
+// isQuotaExceeded reports if the api server refused a write because it would go over a ResourceQuota in the namespace
+// The quota admission plugin only sets a Forbidden status, the quota is named in its message. Only the message of a
+// Forbidden status is matched so other errors mentioning a quota, e.g. from a webhook, aren't mistaken for it
+func isQuotaExceeded(err error) bool {
+	if !k8serr.IsForbidden(err) {
+		return false
+	}
+	var status k8serr.APIStatus
+	return errors.As(err, &status) && strings.Contains(status.Status().Message, "exceeded quota")
+}
+
+// expectedSecretKeys returns the keys the target secret must hold once KeyMapping is applied, the cert then the key
+// ca.crt isn't expected since not every issuer sets it and OmitCA drops it, unless it's listed in Keys
+func expectedSecretKeys(cachedCert *cachev1alpha1.CachedCertificate) []string {
+	if len(cachedCert.Spec.Keys) > 0 {
+		keys := make([]string, 0, len(cachedCert.Spec.Keys))
+		for _, key := range cachedCert.Spec.Keys {
+			keys = append(keys, mappedKey(cachedCert.Spec.KeyMapping, string(key)))
+		}
+		return keys
+	}
+
+	return []string{
+		mappedKey(cachedCert.Spec.KeyMapping, "tls.crt"),
+		mappedKey(cachedCert.Spec.KeyMapping, "tls.key"),
+	}
+}
+
+// validateSecret checks the target secret has every key from expectedSecretKeys
+func validateSecret(secret *v1.Secret, cachedCert *cachev1alpha1.CachedCertificate) error {
 	if secret == nil {
 		return errors.New("secret cannot be nil")
 	}
 
-	if _, ok := secret.Data["tls.crt"]; !ok {
-		return errors.New("tls.cert not found")
+	for _, key := range expectedSecretKeys(cachedCert) {
+		if _, ok := secret.Data[key]; !ok {
+			return errors.New(key + " not found")
+		}
 	}
 
-	if _, ok := secret.Data["tls.key"]; !ok {
-		return errors.New("tls.key not found")
+	return nil
+}
+
+// SharedUpstreamStrategy decides which CachedCertificates share a single upstream Certificate
+type SharedUpstreamStrategy string
+
+const (
+	// SharedUpstreamStrategyDNSOnly shares an upstream across identical dnsNames regardless of issuer, the last writer's issuer wins
+	SharedUpstreamStrategyDNSOnly SharedUpstreamStrategy = "dns-only"
+
+	// SharedUpstreamStrategyDNSPlusIssuer only shares an upstream across identical dnsNames with the same issuer
+	SharedUpstreamStrategyDNSPlusIssuer SharedUpstreamStrategy = "dns-plus-issuer"
+)
+
+// ParseSharedUpstreamStrategy validates the given strategy, an empty value defaults to SharedUpstreamStrategyDNSOnly
+func ParseSharedUpstreamStrategy(s string) (SharedUpstreamStrategy, error) {
+	switch strategy := SharedUpstreamStrategy(s); strategy {
+	case "":
+		return SharedUpstreamStrategyDNSOnly, nil
+	case SharedUpstreamStrategyDNSOnly, SharedUpstreamStrategyDNSPlusIssuer:
+		return strategy, nil
+	default:
+		return "", errors.New("unknown shared upstream strategy " + s)
 	}
+}
 
-	// ca.crt may not be required in all cases so it is not checked here
+// UpstreamNamingStrategy decides how upstream Certificate names are built from dnsNames
+type UpstreamNamingStrategy string
 
-	return nil
+const (
+	// UpstreamNamingJoined joins all the sorted dnsNames, hashing the end of names too long for a Certificate
+	UpstreamNamingJoined UpstreamNamingStrategy = "joined"
+
+	// UpstreamNamingFirstPlusHash uses the first of the sorted dnsNames and a hash of all of them, which keeps names of
+	// long dnsNames lists readable. A single dns name is named the same as with UpstreamNamingJoined
+	UpstreamNamingFirstPlusHash UpstreamNamingStrategy = "first-plus-hash"
+)
+
+// ParseUpstreamNamingStrategy validates the given strategy, an empty value defaults to UpstreamNamingJoined
+func ParseUpstreamNamingStrategy(s string) (UpstreamNamingStrategy, error) {
+	switch strategy := UpstreamNamingStrategy(s); strategy {
+	case "":
+		return UpstreamNamingJoined, nil
+	case UpstreamNamingJoined, UpstreamNamingFirstPlusHash:
+		return strategy, nil
+	default:
+		return "", errors.New("unknown upstream naming strategy " + s)
+	}
 }
 
 // getUpstreamCertificateName is used to get a deterministic upstream cert name
-// based on the given dns names
-func getUpstreamCertificateName(dnsNames ...string) string {
+// based on the given dns names, the issuer is only included with SharedUpstreamStrategyDNSPlusIssuer
+func getUpstreamCertificateName(strategy SharedUpstreamStrategy, issuerRef cachev1alpha1.IssuerRef, dnsNames ...string) string {
 	// this shouldn't be possible for a live cluster because
 	// the CRD requires the input dnsNames to have a len > 0
 	if len(dnsNames) == 0 {
@@ -105,7 +285,38 @@ func getUpstreamCertificateName(dnsNames ...string) string {
 	// so we sort the copied slice before processing
 	sort.Strings(names)
 
-	resourceName := strings.Join(names, "-")
+	return finishUpstreamCertificateName(strategy, issuerRef, strings.Join(names, "-"))
+}
+
+// getFirstPlusHashUpstreamCertificateName is getUpstreamCertificateName for UpstreamNamingFirstPlusHash. extraNames, e.g. a
+// hashed commonName, only go into the hash so the readable part is always a dns name
+func getFirstPlusHashUpstreamCertificateName(strategy SharedUpstreamStrategy, issuerRef cachev1alpha1.IssuerRef, dnsNames []string, extraNames ...string) string {
+	if len(dnsNames) == 0 {
+		return ""
+	}
+	if len(dnsNames)+len(extraNames) == 1 {
+		return getUpstreamCertificateName(strategy, issuerRef, dnsNames...)
+	}
+
+	sortedDNSNames := append([]string{}, dnsNames...)
+	sort.Strings(sortedDNSNames)
+	all := append(append([]string{}, sortedDNSNames...), extraNames...)
+	sort.Strings(all)
+
+	// the hash keeps the name unique, so the wildcard only has to be spelled out to be a valid name
+	first := strings.ReplaceAll(sortedDNSNames[0], "*", "wildcard")
+	return finishUpstreamCertificateName(strategy, issuerRef, first+"-"+genHash(strings.Join(all, ",")))
+}
+
+// finishUpstreamCertificateName adds the issuer for SharedUpstreamStrategyDNSPlusIssuer and the "cc-" prefix to resourceName,
+// hashing the end of it when too long
+func finishUpstreamCertificateName(strategy SharedUpstreamStrategy, issuerRef cachev1alpha1.IssuerRef, resourceName string) string {
+	if strategy == SharedUpstreamStrategyDNSPlusIssuer {
+		// the issuer is hashed up front so it survives truncation of long names, the group tells apart external issuers
+		// with the same kind and name
+		issuerRef = normalizeIssuerRef(issuerRef)
+		resourceName = genHash(issuerRef.Group+"/"+issuerRef.Kind+"/"+issuerRef.Name) + "-" + resourceName
+	}
 
 	if len(resourceName) > maxSecretNameLength {
 		// the "-3" is to ensure space for the "cc-" prefix
@@ -115,7 +326,27 @@ func getUpstreamCertificateName(dnsNames ...string) string {
 	return "cc-" + resourceName
 }
 
-func genSecretForSync(cachedCert *cachev1alpha1.CachedCertificate, upstreamCert *unstructured.Unstructured, upstreamSecret *v1.Secret) (*v1.Secret, error) {
+// wildcardMarker is an extra name hashed from every dns name, added when any of them is a wildcard
+// a hashed wildcard is a plain number which a literal dns name could spell out, the marker keeps the two apart
+// the input order doesn't matter, like the upstream name itself. Empty when there is no wildcard
+func wildcardMarker(dnsNames []string) string {
+	wildcard := false
+	for _, name := range dnsNames {
+		if strings.Contains(name, "*") {
+			wildcard = true
+			break
+		}
+	}
+	if !wildcard {
+		return ""
+	}
+
+	sorted := append([]string{}, dnsNames...)
+	sort.Strings(sorted)
+	return "w-" + genHash(strings.Join(sorted, ","))
+}
+
+func genSecretForSync(cachedCert *cachev1alpha1.CachedCertificate, upstreamCert *unstructured.Unstructured, upstreamSecret *v1.Secret, owner metav1.OwnerReference, chains *ParsedChainCache) (*v1.Secret, error) {
 	if cachedCert == nil {
 		return nil, errors.New("a CachedCertificate is required for secret generation")
 	}
@@ -130,39 +361,337 @@ func genSecretForSync(cachedCert *cachev1alpha1.CachedCertificate, upstreamCert
 
 	}
 
+	data := upstreamSecret.Data
+	if cachedCert.Spec.ChainOrder != "" || cachedCert.Spec.OmitCA || len(cachedCert.Spec.Keys) > 0 {
+		// copy before changing the data so the upstream secret is left untouched
+		data = make(map[string][]byte, len(upstreamSecret.Data))
+		for k, v := range upstreamSecret.Data {
+			data[k] = v
+		}
+	}
+
+	if cachedCert.Spec.ChainOrder != "" {
+		ordered, err := orderChain(chains, data["tls.crt"], cachedCert.Spec.ChainOrder)
+		if err != nil {
+			return nil, errors.New("tls.crt: " + err.Error())
+		}
+		data["tls.crt"] = ordered
+	}
+
+	if cachedCert.Spec.OmitCA {
+		delete(data, "ca.crt")
+	}
+
+	if len(cachedCert.Spec.Keys) > 0 {
+		// keys not listed are dropped, listed keys missing upstream are caught by validateSecret below
+		listed := make(map[string]bool, len(cachedCert.Spec.Keys))
+		for _, key := range cachedCert.Spec.Keys {
+			listed[string(key)] = true
+		}
+		for k := range data {
+			if !listed[k] {
+				delete(data, k)
+			}
+		}
+	}
+
 	// create new secret from select parts of the upstream secret
 	secret := &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        cachedCert.Spec.SecretName,
 			Namespace:   cachedCert.GetNamespace(),
-			Labels:      upstreamSecret.GetLabels(),
-			Annotations: upstreamSecret.GetAnnotations(),
+			Labels:      syncedLabels(cachedCert, upstreamSecret),
+			Annotations: filterAnnotations(upstreamSecret.GetAnnotations(), cachedCert.Spec.AnnotationPrefixAllowlist),
 
 			// Contrary to standard `Certificate` resources, CachedCertificate resources *do* mark their secrets
 			// to be garbaged collected by k8s. This is because the secret created here is not the source of truth
 			// and is just a copy so it does not need to be preserved
-			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(cachedCert, cachedCert.GroupVersionKind()),
-			},
+			OwnerReferences: []metav1.OwnerReference{owner},
 		},
 		Type: upstreamSecret.Type,
-		Data: upstreamSecret.Data,
+		Data: remapKeys(data, cachedCert.Spec.KeyMapping),
+	}
+	if cachedCert.Spec.SecretType != "" {
+		secret.Type = cachedCert.Spec.SecretType
 	}
 
 	// Additionaly, we mark the secret with a label and annotation indicating where it came from
-	if secret.Labels == nil {
-		secret.Labels = map[string]string{}
-	}
 	secret.Labels[SyncedLabelKey] = "true"
 
 	if secret.Annotations == nil {
 		secret.Annotations = map[string]string{}
 	}
 	secret.Annotations[SourceAnnotationKey] = cachedCert.Namespace + "/" + cachedCert.Name
+	secret.Annotations[UpstreamAnnotationKey] = upstreamCert.GetNamespace() + "/" + upstreamCert.GetName()
+
+	// cert-manager only sets the renewal time once the certificate is issued, leave it off until then
+	if renewalTime, found, _ := unstructured.NestedString(upstreamCert.Object, "status", "renewalTime"); found && renewalTime != "" {
+		secret.Annotations[RenewalTimeAnnotationKey] = renewalTime
+	} else {
+		delete(secret.Annotations, RenewalTimeAnnotationKey)
+	}
+
+	// taken from the upstream tls.crt since Keys may leave it out of the target secret
+	notBefore, notAfter := validityAnnotations(chains, upstreamSecret.Data["tls.crt"], upstreamCert)
+	for key, value := range map[string]string{NotBeforeAnnotationKey: notBefore, NotAfterAnnotationKey: notAfter} {
+		if value != "" {
+			secret.Annotations[key] = value
+		} else {
+			delete(secret.Annotations, key)
+		}
+	}
+
+	// the generated secret is checked against the same keys validation uses so the two can't drift
+	if err := validateSecret(secret, cachedCert); err != nil {
+		return nil, err
+	}
 
 	return secret, nil
 }
 
+// syncedLabels returns the labels for the target secret, the upstream secret labels on top of the CachedCertificate's
+// own when PropagateLabels is set. The result is always a new map so the upstream secret is left untouched
+func syncedLabels(cachedCert *cachev1alpha1.CachedCertificate, upstreamSecret *v1.Secret) map[string]string {
+	labels := map[string]string{}
+	if cachedCert.Spec.PropagateLabels {
+		for k, v := range cachedCert.GetLabels() {
+			labels[k] = v
+		}
+	}
+	for k, v := range upstreamSecret.GetLabels() {
+		labels[k] = v
+	}
+	return labels
+}
+
+// publishedMetadata is the PublishedMetadataKey layout, fields are only ever added so consumers can rely on it
+type publishedMetadata struct {
+	SecretName      string   `json:"secretName"`
+	SecretNamespace string   `json:"secretNamespace"`
+	Keys            []string `json:"keys"`
+	NotBefore       string   `json:"notBefore,omitempty"`
+	NotAfter        string   `json:"notAfter,omitempty"`
+	RenewalTime     string   `json:"renewalTime,omitempty"`
+}
+
+// genConfigMapForSync builds the ConfigMap of public certificate material from the synced secret
+// only tls.crt and ca.crt are copied, the private key must never end up in a ConfigMap
+// With PublishMetadata the secret's metadata is added, naming its keys but never holding their values
+func genConfigMapForSync(cachedCert *cachev1alpha1.CachedCertificate, secret *v1.Secret, blockOwnerDeletion bool) *v1.ConfigMap {
+	data := map[string]string{}
+	for _, key := range []string{"tls.crt", "ca.crt"} {
+		if value, ok := secret.Data[mappedKey(cachedCert.Spec.KeyMapping, key)]; ok {
+			data[key] = string(value)
+		}
+	}
+
+	annotations := map[string]string{
+		SourceAnnotationKey: cachedCert.Namespace + "/" + cachedCert.Name,
+	}
+	if cachedCert.Spec.PublishMetadata {
+		metadata := publishedMetadata{
+			SecretName:      secret.Name,
+			SecretNamespace: secret.Namespace,
+			Keys:            make([]string, 0, len(secret.Data)),
+			NotBefore:       secret.Annotations[NotBeforeAnnotationKey],
+			NotAfter:        secret.Annotations[NotAfterAnnotationKey],
+			RenewalTime:     secret.Annotations[RenewalTimeAnnotationKey],
+		}
+		for key := range secret.Data {
+			metadata.Keys = append(metadata.Keys, key)
+		}
+		sort.Strings(metadata.Keys)
+		// strings only, so it always marshals
+		encoded, _ := json.Marshal(metadata)
+		data[PublishedMetadataKey] = string(encoded)
+
+		for _, key := range []string{NotBeforeAnnotationKey, NotAfterAnnotationKey, RenewalTimeAnnotationKey} {
+			if value, ok := secret.Annotations[key]; ok {
+				annotations[key] = value
+			}
+		}
+	}
+
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cachedCert.Spec.PublishCAConfigMap,
+			Namespace: cachedCert.GetNamespace(),
+			Labels: map[string]string{
+				SyncedLabelKey: "true",
+			},
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				ownerReference(cachedCert, blockOwnerDeletion),
+			},
+		},
+		Data: data,
+	}
+}
+
+// ownerReference is the controller reference set on synced objects
+// blockOwnerDeletion can be turned off where foreground deletion of a CachedCertificate shouldn't wait on the synced objects
+func ownerReference(cachedCert *cachev1alpha1.CachedCertificate, blockOwnerDeletion bool) metav1.OwnerReference {
+	ref := metav1.NewControllerRef(cachedCert, cachedCert.GroupVersionKind())
+	ref.BlockOwnerDeletion = &blockOwnerDeletion
+	return *ref
+}
+
+// syncedFrom reports if the existing object was made by the controller for the same CachedCertificate as desired
+// The source annotation is also accepted so objects that lost the synced label are repaired by the update, which re-adds it
+func syncedFrom(existing, desired metav1.Object) bool {
+	if _, ok := existing.GetLabels()[SyncedLabelKey]; ok {
+		return true
+	}
+
+	source, ok := existing.GetAnnotations()[SourceAnnotationKey]
+	return ok && source != "" && source == desired.GetAnnotations()[SourceAnnotationKey]
+}
+
+// mappedKey returns the new name for the key if it is renamed by the mapping
+func mappedKey(keyMapping map[string]string, key string) string {
+	if mapped, ok := keyMapping[key]; ok && mapped != "" {
+		return mapped
+	}
+	return key
+}
+
+// filterAnnotations keeps the annotations starting with one of the prefixes, annotations are returned as is without prefixes
+// Annotations of this operator are always kept
+func filterAnnotations(annotations map[string]string, prefixes []string) map[string]string {
+	if len(prefixes) == 0 || annotations == nil {
+		return annotations
+	}
+
+	prefixes = append([]string{cachev1alpha1.GroupVersion.Group + "/"}, prefixes...)
+
+	filtered := map[string]string{}
+	for key, value := range annotations {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				filtered[key] = value
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// remapKeys returns a copy of data with keys renamed by the mapping, data is returned as is without a mapping
+func remapKeys(data map[string][]byte, keyMapping map[string]string) map[string][]byte {
+	if len(keyMapping) == 0 {
+		return data
+	}
+
+	remapped := make(map[string][]byte, len(data))
+	for key, value := range data {
+		remapped[mappedKey(keyMapping, key)] = value
+	}
+
+	return remapped
+}
+
+// formatReferences sorts and joins the references, summarizing any past maxReferencesListed
+func formatReferences(refs []string) string {
+	sorted := make([]string, len(refs))
+	copy(sorted, refs)
+	sort.Strings(sorted)
+
+	if len(sorted) <= maxReferencesListed {
+		return strings.Join(sorted, ",")
+	}
+
+	return strings.Join(sorted[:maxReferencesListed], ",") + " (+" + strconv.Itoa(len(sorted)-maxReferencesListed) + " more)"
+}
+
+// activeIssuer returns the issuer at the status IssuerIndex, clamped to the issuers in the spec in case the fallbacks were removed
+func activeIssuer(cachedCert *cachev1alpha1.CachedCertificate) (cachev1alpha1.IssuerRef, int) {
+	index := cachedCert.Status.IssuerIndex
+	if index > len(cachedCert.Spec.IssuerRefs) {
+		index = len(cachedCert.Spec.IssuerRefs)
+	}
+
+	if index <= 0 {
+		return cachedCert.Spec.IssuerRef, 0
+	}
+
+	return cachedCert.Spec.IssuerRefs[index-1], index
+}
+
+// issuerRefToUnstructured converts the issuer to the map used in unstructured Certificates
+func issuerRefToUnstructured(issuerRef cachev1alpha1.IssuerRef) map[string]interface{} {
+	ref := map[string]interface{}{
+		"name": issuerRef.Name,
+		"kind": issuerRef.Kind,
+	}
+	if issuerRef.Group != "" {
+		ref["group"] = issuerRef.Group
+	}
+
+	return ref
+}
+
+// stringsToUnstructured converts the slice to the type used in unstructured objects
+func stringsToUnstructured(in []string) []interface{} {
+	out := make([]interface{}, 0, len(in))
+	for _, s := range in {
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// checkSecretSize returns an error wrapping ErrSecretTooLarge when the secret data is over v1.MaxSecretSize, counted the
+// same way the api server does so the write isn't attempted only to be rejected
+func checkSecretSize(secret *v1.Secret) error {
+	size := 0
+	for _, value := range secret.Data {
+		size += len(value)
+	}
+
+	if size > v1.MaxSecretSize {
+		return fmt.Errorf("secret %s data is %d bytes, over the %d byte limit: %w", secret.Name, size, v1.MaxSecretSize, ErrSecretTooLarge)
+	}
+	return nil
+}
+
+// secretDataHash hashes the secret data in a stable order to compare secret contents
+func secretDataHash(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	hasher := sha256.New()
+	for _, k := range keys {
+		// lengths keep the boundaries between keys and values unambiguous
+		hasher.Write([]byte(strconv.Itoa(len(k)) + ":" + k + strconv.Itoa(len(data[k])) + ":"))
+		hasher.Write(data[k])
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// secretMetadataInSync reports if the secret has the labels and annotations of expected. With exact nothing else is allowed
+// either, as updates replace both maps and drop anything not written
+func secretMetadataInSync(secret, expected *v1.Secret, exact bool) bool {
+	return stringMapInSync(secret.GetLabels(), expected.GetLabels(), exact) &&
+		stringMapInSync(secret.GetAnnotations(), expected.GetAnnotations(), exact)
+}
+
+// stringMapInSync reports if got has every entry of want, and with exact no others
+func stringMapInSync(got, want map[string]string, exact bool) bool {
+	if exact && len(got) != len(want) {
+		return false
+	}
+	for k, v := range want {
+		if value, ok := got[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
 func genHash(s string) string {
 	hasher := fnv.New64a()
 	hasher.Write(([]byte(s)))
@@ -17,13 +17,22 @@ limitations under the License.
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
 	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
 )
 
@@ -66,18 +75,217 @@ func Test_getUpstreamName(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := getUpstreamCertificateName(tt.args.dnsNames...); got != tt.want {
+			if got := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachev1alpha1.IssuerRef{}, tt.args.dnsNames...); got != tt.want {
 				t.Errorf("getUpstreamName() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func Test_getUpstreamNameStrategy(t *testing.T) {
+	issuerA := cachev1alpha1.IssuerRef{Name: "a", Kind: "Issuer"}
+	issuerB := cachev1alpha1.IssuerRef{Name: "b", Kind: "Issuer"}
+	longNames := []string{
+		strings.Repeat("a", 63) + ".example.com",
+		strings.Repeat("b", 63) + ".example.com",
+		strings.Repeat("c", 63) + ".example.com",
+		strings.Repeat("d", 63) + ".example.com",
+	}
+
+	tests := []struct {
+		name     string
+		strategy SharedUpstreamStrategy
+		dnsNames []string
+		wantSame bool
+	}{
+		{"dns-only shares across issuers", SharedUpstreamStrategyDNSOnly, []string{"example.com"}, true},
+		{"empty strategy shares across issuers", "", []string{"example.com"}, true},
+		{"dns-plus-issuer separates issuers", SharedUpstreamStrategyDNSPlusIssuer, []string{"example.com"}, false},
+		{"dns-plus-issuer separates truncated names", SharedUpstreamStrategyDNSPlusIssuer, longNames, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := getUpstreamCertificateName(tt.strategy, issuerA, tt.dnsNames...)
+			b := getUpstreamCertificateName(tt.strategy, issuerB, tt.dnsNames...)
+			if (a == b) != tt.wantSame {
+				t.Errorf("getUpstreamCertificateName() = %v and %v, want same %v", a, b, tt.wantSame)
+			}
+			if len(a) > maxSecretNameLength {
+				t.Errorf("getUpstreamCertificateName() length = %v, want <= %v", len(a), maxSecretNameLength)
+			}
+		})
+	}
+
+	// dns-only must keep the original names so existing upstreams are reused
+	if got := getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, issuerA, "example.com"); got != "cc-example.com" {
+		t.Errorf("getUpstreamCertificateName() = %v, want cc-example.com", got)
+	}
+}
+
+func Test_getUpstreamNameIssuerGroup(t *testing.T) {
+	issuer := cachev1alpha1.IssuerRef{Name: "ca", Kind: "Issuer"}
+	explicitGroup := cachev1alpha1.IssuerRef{Name: "ca", Kind: "Issuer", Group: "cert-manager.io"}
+	external := cachev1alpha1.IssuerRef{Name: "ca", Kind: "Issuer", Group: "awspca.cert-manager.io"}
+	otherExternal := cachev1alpha1.IssuerRef{Name: "ca", Kind: "Issuer", Group: "origin-ca-issuer.k8s.cloudflare.com"}
+
+	name := func(ref cachev1alpha1.IssuerRef) string {
+		return getUpstreamCertificateName(SharedUpstreamStrategyDNSPlusIssuer, ref, "example.com")
+	}
+
+	if a, b := name(issuer), name(explicitGroup); a != b {
+		t.Errorf("getUpstreamCertificateName() = %v and %v, want the default group to share an upstream", a, b)
+	}
+	if a, b := name(issuer), name(external); a == b {
+		t.Errorf("getUpstreamCertificateName() = %v for a cert-manager and an external issuer of the same kind and name", a)
+	}
+	if a, b := name(external), name(otherExternal); a == b {
+		t.Errorf("getUpstreamCertificateName() = %v for external issuers from different groups", a)
+	}
+}
+
+func Test_ParseSharedUpstreamStrategy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SharedUpstreamStrategy
+		wantErr bool
+	}{
+		{"", SharedUpstreamStrategyDNSOnly, false},
+		{"dns-only", SharedUpstreamStrategyDNSOnly, false},
+		{"dns-plus-issuer", SharedUpstreamStrategyDNSPlusIssuer, false},
+		{"issuer-only", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSharedUpstreamStrategy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSharedUpstreamStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSharedUpstreamStrategy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ParseUpstreamNamingStrategy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    UpstreamNamingStrategy
+		wantErr bool
+	}{
+		{"", UpstreamNamingJoined, false},
+		{"joined", UpstreamNamingJoined, false},
+		{"first-plus-hash", UpstreamNamingFirstPlusHash, false},
+		{"hash-only", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseUpstreamNamingStrategy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseUpstreamNamingStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseUpstreamNamingStrategy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_upstreamCertificateNameNaming(t *testing.T) {
+	many := make([]string, 0, 30)
+	for i := 0; i < 30; i++ {
+		many = append(many, "service-"+strconv.Itoa(i)+".internal.example.com")
+	}
+	sortedMany := append([]string{}, many...)
+	sort.Strings(sortedMany)
+
+	tests := []struct {
+		name       string
+		dnsNames   []string
+		wantJoined string
+		wantFirst  string
+	}{
+		{
+			"single name is the same in both",
+			[]string{"test.example.com"},
+			"cc-test.example.com",
+			"cc-test.example.com",
+		},
+		{
+			"first sorted name and a hash",
+			[]string{"c.example.com", "a.example.com", "b.example.com"},
+			"cc-a.example.com-b.example.com-c.example.com",
+			"cc-a.example.com-" + genHash("a.example.com,b.example.com,c.example.com"),
+		},
+		{
+			"wildcard spelled out",
+			[]string{"*.example.com", "example.com"},
+			"cc-" + genHash("*.example.com") + "-example.com",
+			"cc-wildcard.example.com-" + genHash("*.example.com,example.com"),
+		},
+		{
+			"long lists stay readable",
+			many,
+			"",
+			"cc-service-0.internal.example.com-" + genHash(strings.Join(sortedMany, ",")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cachedCert := newTestCachedCertificate("naming", tt.dnsNames...)
+
+			joined := (&CachedCertificateReconciler{}).upstreamCertificateName(cachedCert)
+			if tt.wantJoined != "" && joined != tt.wantJoined {
+				t.Errorf("joined upstreamCertificateName() = %v, want %v", joined, tt.wantJoined)
+			}
+
+			got := (&CachedCertificateReconciler{UpstreamNaming: UpstreamNamingFirstPlusHash}).upstreamCertificateName(cachedCert)
+			if got != tt.wantFirst {
+				t.Errorf("first-plus-hash upstreamCertificateName() = %v, want %v", got, tt.wantFirst)
+			}
+			if errs := validation.IsDNS1123Subdomain(got); len(errs) > 0 {
+				t.Errorf("first-plus-hash upstreamCertificateName() = %v is not a valid name: %v", got, errs)
+			}
+		})
+	}
+}
+
+func Test_upstreamCertificateNameFirstPlusHashUnique(t *testing.T) {
+	r := &CachedCertificateReconciler{UpstreamNaming: UpstreamNamingFirstPlusHash}
+	names := map[string]string{}
+	for _, cachedCert := range []*cachev1alpha1.CachedCertificate{
+		newTestCachedCertificate("one", "a.example.com", "b.example.com"),
+		// same first name
+		newTestCachedCertificate("two", "a.example.com", "c.example.com"),
+		newTestCachedCertificate("three", "a.example.com", "b.example.com", "c.example.com"),
+		// a literal name spelling out the wildcard
+		newTestCachedCertificate("four", "*.example.com", "b.example.com"),
+		newTestCachedCertificate("five", "wildcard.example.com", "b.example.com"),
+	} {
+		name := r.upstreamCertificateName(cachedCert)
+		if other, ok := names[name]; ok {
+			t.Errorf("upstreamCertificateName() = %v for both %v and %v", name, other, cachedCert.Name)
+		}
+		names[name] = cachedCert.Name
+	}
+
+	// the order doesn't matter, and a commonName still gets its own upstream
+	a := newTestCachedCertificate("a", "b.example.com", "a.example.com")
+	b := newTestCachedCertificate("b", "a.example.com", "b.example.com")
+	if x, y := r.upstreamCertificateName(a), r.upstreamCertificateName(b); x != y {
+		t.Errorf("upstreamCertificateName() = %v and %v, want the same name regardless of order", x, y)
+	}
+	b.Spec.CommonName = "a.example.com"
+	if x, y := r.upstreamCertificateName(a), r.upstreamCertificateName(b); x == y {
+		t.Errorf("upstreamCertificateName() = %v with and without a commonName", x)
+	}
+}
+
 func Test_getUpstreamNameSort(t *testing.T) {
 	dnsNames := []string{"b", "a", "c"}
 
 	// call the func
-	getUpstreamCertificateName(dnsNames...)
+	getUpstreamCertificateName(SharedUpstreamStrategyDNSOnly, cachev1alpha1.IssuerRef{}, dnsNames...)
 
 	// order of the referenced slice should not be altered
 	if dnsNames[0] != "b" {
@@ -85,9 +293,163 @@ func Test_getUpstreamNameSort(t *testing.T) {
 	}
 }
 
+func Test_upstreamCertificateNameWildcard(t *testing.T) {
+	wildcard := newTestCachedCertificate("wildcard", "*.example.com", "secondary.example.com")
+	// a literal name spelling out the hashed wildcard
+	literal := newTestCachedCertificate("literal", genHash("*.example.com"), "secondary.example.com")
+	reordered := newTestCachedCertificate("reordered", "secondary.example.com", "*.example.com")
+	plain := newTestCachedCertificate("plain", "test.example.com")
+
+	r := &CachedCertificateReconciler{}
+	if a, b := r.upstreamCertificateName(wildcard), r.upstreamCertificateName(literal); a != b {
+		t.Fatalf("upstreamCertificateName() = %v and %v, want the collision without disambiguation", a, b)
+	}
+
+	r.DisambiguateWildcardNames = true
+	if a, b := r.upstreamCertificateName(wildcard), r.upstreamCertificateName(literal); a == b {
+		t.Errorf("upstreamCertificateName() = %v for both the wildcard and the literal name", a)
+	}
+	if a, b := r.upstreamCertificateName(wildcard), r.upstreamCertificateName(reordered); a != b {
+		t.Errorf("upstreamCertificateName() = %v and %v, want the same name regardless of order", a, b)
+	}
+	// names without a wildcard keep their existing upstream
+	if got := r.upstreamCertificateName(plain); got != "cc-test.example.com" {
+		t.Errorf("upstreamCertificateName() = %v, want cc-test.example.com", got)
+	}
+}
+
+func Test_upstreamCertificateNameFunc(t *testing.T) {
+	r := &CachedCertificateReconciler{
+		// CachedCertificates labeled with a team share one upstream per team and dnsNames, the rest keep the default name
+		UpstreamNameFunc: func(cachedCert *cachev1alpha1.CachedCertificate) string {
+			team := cachedCert.GetLabels()["team"]
+			if team == "" {
+				return ""
+			}
+			return "team-" + team + "-" + genHash(strings.Join(cachedCert.Spec.DNSNames, ","))
+		},
+	}
+
+	a := newTestCachedCertificate("a", "test.example.com")
+	a.Labels = map[string]string{"team": "red"}
+	b := newTestCachedCertificate("b", "test.example.com")
+	b.Labels = map[string]string{"team": "red"}
+	other := newTestCachedCertificate("other", "test.example.com")
+	other.Labels = map[string]string{"team": "blue"}
+	unlabeled := newTestCachedCertificate("unlabeled", "test.example.com")
+
+	want := "team-red-" + genHash("test.example.com")
+	if got := r.upstreamCertificateName(a); got != want {
+		t.Errorf("upstreamCertificateName() = %v, want %v", got, want)
+	}
+	if x, y := r.upstreamCertificateName(a), r.upstreamCertificateName(b); x != y {
+		t.Errorf("upstreamCertificateName() = %v and %v, want the same team to share", x, y)
+	}
+	if x, y := r.upstreamCertificateName(a), r.upstreamCertificateName(other); x == y {
+		t.Errorf("upstreamCertificateName() = %v for different teams, want them kept apart", x)
+	}
+	// an empty name falls back to the default
+	if got := r.upstreamCertificateName(unlabeled); got != "cc-test.example.com" {
+		t.Errorf("upstreamCertificateName() = %v, want cc-test.example.com", got)
+	}
+}
+
+func Test_setState(t *testing.T) {
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name        string
+		status      cachev1alpha1.CachedCertificateStatus
+		state       cachev1alpha1.CachedCertificateState
+		wantUpdated bool
+	}{
+		{
+			"same state keeps the timestamp",
+			cachev1alpha1.CachedCertificateStatus{State: cachev1alpha1.CachedCertificateStateSynced, LastTransitionTime: &earlier},
+			cachev1alpha1.CachedCertificateStateSynced,
+			false,
+		},
+		{
+			"new state moves the timestamp",
+			cachev1alpha1.CachedCertificateStatus{State: cachev1alpha1.CachedCertificateStatePending, LastTransitionTime: &earlier},
+			cachev1alpha1.CachedCertificateStateSynced,
+			true,
+		},
+		{
+			"missing timestamp is set",
+			cachev1alpha1.CachedCertificateStatus{State: cachev1alpha1.CachedCertificateStatePending},
+			cachev1alpha1.CachedCertificateStatePending,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setState(&tt.status, tt.state)
+
+			if tt.status.State != tt.state {
+				t.Errorf("setState() state = %v, want %v", tt.status.State, tt.state)
+			}
+			if tt.status.LastTransitionTime == nil {
+				t.Fatal("setState() left LastTransitionTime nil")
+			}
+			if updated := !tt.status.LastTransitionTime.Equal(&earlier); updated != tt.wantUpdated {
+				t.Errorf("setState() updated timestamp = %v, want %v", updated, tt.wantUpdated)
+			}
+		})
+	}
+}
+
+func Test_expectedSecretKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		spec cachev1alpha1.CachedCertificateSpec
+		want []string
+	}{
+		{"defaults", cachev1alpha1.CachedCertificateSpec{}, []string{"tls.crt", "tls.key"}},
+		{"ca omitted", cachev1alpha1.CachedCertificateSpec{OmitCA: true}, []string{"tls.crt", "tls.key"}},
+		{
+			"remapped",
+			cachev1alpha1.CachedCertificateSpec{KeyMapping: map[string]string{"tls.crt": "cert.pem", "tls.key": "key.pem"}},
+			[]string{"cert.pem", "key.pem"},
+		},
+		{
+			"partially remapped with ca",
+			cachev1alpha1.CachedCertificateSpec{KeyMapping: map[string]string{"tls.key": "key.pem", "ca.crt": "ca.pem"}},
+			[]string{"tls.crt", "key.pem"},
+		},
+		{
+			"empty mapping ignored",
+			cachev1alpha1.CachedCertificateSpec{KeyMapping: map[string]string{"tls.crt": ""}},
+			[]string{"tls.crt", "tls.key"},
+		},
+		{
+			"key only",
+			cachev1alpha1.CachedCertificateSpec{Keys: []cachev1alpha1.SecretKey{cachev1alpha1.SecretKeyKey}},
+			[]string{"tls.key"},
+		},
+		{
+			"chain with ca remapped",
+			cachev1alpha1.CachedCertificateSpec{
+				Keys:       []cachev1alpha1.SecretKey{cachev1alpha1.SecretKeyCert, cachev1alpha1.SecretKeyCA},
+				KeyMapping: map[string]string{"ca.crt": "ca.pem"},
+			},
+			[]string{"tls.crt", "ca.pem"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expectedSecretKeys(&cachev1alpha1.CachedCertificate{Spec: tt.spec})
+			if diff := deep.Equal(got, tt.want); diff != nil {
+				t.Errorf("expectedSecretKeys() diff %v", diff)
+			}
+		})
+	}
+}
+
 func Test_secretIsValid(t *testing.T) {
 	type args struct {
-		secret *v1.Secret
+		secret     *v1.Secret
+		keyMapping map[string]string
 	}
 	tests := []struct {
 		name    string
@@ -99,6 +461,7 @@ func Test_secretIsValid(t *testing.T) {
 			"missing all data",
 			args{
 				&v1.Secret{},
+				nil,
 			},
 			false,
 		},
@@ -108,6 +471,7 @@ func Test_secretIsValid(t *testing.T) {
 				&v1.Secret{
 					Data: map[string][]byte{"tls.crt": nil},
 				},
+				nil,
 			},
 			false,
 		},
@@ -117,6 +481,7 @@ func Test_secretIsValid(t *testing.T) {
 				&v1.Secret{
 					Data: map[string][]byte{"tls.crt": nil},
 				},
+				nil,
 			},
 			false,
 		},
@@ -126,19 +491,54 @@ func Test_secretIsValid(t *testing.T) {
 				&v1.Secret{
 					Data: map[string][]byte{"tls.crt": nil, "tls.key": nil},
 				},
+				nil,
+			},
+			true,
+		},
+		{
+			"remapped keys missing",
+			args{
+				&v1.Secret{
+					Data: map[string][]byte{"tls.crt": nil, "tls.key": nil},
+				},
+				map[string]string{"tls.crt": "cert.pem", "tls.key": "key.pem"},
+			},
+			false,
+		},
+		{
+			"remapped valid",
+			args{
+				&v1.Secret{
+					Data: map[string][]byte{"cert.pem": nil, "key.pem": nil},
+				},
+				map[string]string{"tls.crt": "cert.pem", "tls.key": "key.pem"},
+			},
+			true,
+		},
+		{
+			"partially remapped valid",
+			args{
+				&v1.Secret{
+					Data: map[string][]byte{"tls.crt": nil, "key.pem": nil},
+				},
+				map[string]string{"tls.key": "key.pem"},
 			},
 			true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := validateSecret(tt.args.secret); (got == nil) != tt.wantErr {
+			cachedCert := &cachev1alpha1.CachedCertificate{Spec: cachev1alpha1.CachedCertificateSpec{KeyMapping: tt.args.keyMapping}}
+			if got := validateSecret(tt.args.secret, cachedCert); (got == nil) != tt.wantErr {
 				t.Errorf("secretIsValid() = unexpected err %v", got)
 			}
 		})
 	}
 }
 
+// testTLSData is the minimal data of an upstream secret for tests that don't care about it
+var testTLSData = map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")}
+
 func Test_getNewSecret(t *testing.T) {
 	type args struct {
 		cachedCert     *cachev1alpha1.CachedCertificate
@@ -161,7 +561,9 @@ func Test_getNewSecret(t *testing.T) {
 			"missing cachedCert invalid",
 			args{
 				nil,
-				&unstructured.Unstructured{},
+				&unstructured.Unstructured{Object: map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "cc-upstream", "namespace": "cache"},
+				}},
 				&v1.Secret{},
 			},
 			nil,
@@ -181,7 +583,9 @@ func Test_getNewSecret(t *testing.T) {
 			"missing upstreamSecret",
 			args{
 				&cachev1alpha1.CachedCertificate{},
-				&unstructured.Unstructured{},
+				&unstructured.Unstructured{Object: map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "cc-upstream", "namespace": "cache"},
+				}},
 				nil,
 			},
 			nil,
@@ -199,8 +603,88 @@ func Test_getNewSecret(t *testing.T) {
 						SecretName: "cached-cert-secret-name",
 					},
 				},
-				&unstructured.Unstructured{},
-				&v1.Secret{},
+				&unstructured.Unstructured{Object: map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "cc-upstream", "namespace": "cache"},
+				}},
+				&v1.Secret{
+					Data: map[string][]byte{
+						"tls.crt": []byte("cert"),
+						"tls.key": []byte("key"),
+					},
+				},
+			},
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "cached-cert-secret-name",
+					Namespace: "cached-cert-namespace",
+					Labels: map[string]string{
+						SyncedLabelKey: "true",
+					},
+					OwnerReferences: []metav1.OwnerReference{{
+						Name:               "cached-cert-name",
+						Controller:         boolP(true),
+						BlockOwnerDeletion: boolP(true),
+					}},
+					Annotations: map[string]string{
+						SourceAnnotationKey:   "cached-cert-namespace/cached-cert-name",
+						UpstreamAnnotationKey: "cache/cc-upstream",
+					},
+				},
+				Data: map[string][]byte{
+					"tls.crt": []byte("cert"),
+					"tls.key": []byte("key"),
+				},
+			},
+			false,
+		},
+		{
+			"missing key invalid",
+			args{
+				&cachev1alpha1.CachedCertificate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cached-cert-name",
+						Namespace: "cached-cert-namespace",
+					},
+					Spec: cachev1alpha1.CachedCertificateSpec{
+						SecretName: "cached-cert-secret-name",
+					},
+				},
+				&unstructured.Unstructured{Object: map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "cc-upstream", "namespace": "cache"},
+				}},
+				&v1.Secret{
+					Data: map[string][]byte{"tls.crt": []byte("cert")},
+				},
+			},
+			nil,
+			true,
+		},
+		{
+			"remapped keys",
+			args{
+				&cachev1alpha1.CachedCertificate{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cached-cert-name",
+						Namespace: "cached-cert-namespace",
+					},
+					Spec: cachev1alpha1.CachedCertificateSpec{
+						SecretName: "cached-cert-secret-name",
+						KeyMapping: map[string]string{
+							"tls.crt": "cert.pem",
+							"tls.key": "key.pem",
+						},
+					},
+				},
+				&unstructured.Unstructured{Object: map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "cc-upstream", "namespace": "cache"},
+				}},
+				&v1.Secret{
+					Data: map[string][]byte{
+						"tls.crt": []byte("cert"),
+						"tls.key": []byte("key"),
+						"ca.crt":  []byte("ca"),
+					},
+				},
 			},
 			&v1.Secret{
 				ObjectMeta: metav1.ObjectMeta{
@@ -215,22 +699,238 @@ func Test_getNewSecret(t *testing.T) {
 						BlockOwnerDeletion: boolP(true),
 					}},
 					Annotations: map[string]string{
-						SourceAnnotationKey: "cached-cert-namespace/cached-cert-name",
+						SourceAnnotationKey:   "cached-cert-namespace/cached-cert-name",
+						UpstreamAnnotationKey: "cache/cc-upstream",
 					},
 				},
+				Data: map[string][]byte{
+					"cert.pem": []byte("cert"),
+					"key.pem":  []byte("key"),
+					"ca.crt":   []byte("ca"),
+				},
 			},
 			false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := genSecretForSync(tt.args.cachedCert, tt.args.upstreamCert, tt.args.upstreamSecret)
+			var owner metav1.OwnerReference
+			if tt.args.cachedCert != nil {
+				owner = ownerReference(tt.args.cachedCert, true)
+			}
+
+			got, err := genSecretForSync(tt.args.cachedCert, tt.args.upstreamCert, tt.args.upstreamSecret, owner, nil)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("genSecretForSync() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("genSecretForSync(, nil) error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			for _, diff := range deep.Equal(got, tt.want) {
-				t.Errorf("genSecretForSync() diff %v", diff)
+				t.Errorf("genSecretForSync(, nil) diff %v", diff)
+			}
+		})
+	}
+}
+
+func Test_genSecretForSyncOmitCA(t *testing.T) {
+	upstreamData := map[string][]byte{
+		"tls.crt": []byte("cert"),
+		"tls.key": []byte("key"),
+		"ca.crt":  []byte("ca"),
+	}
+
+	tests := []struct {
+		name   string
+		omitCA bool
+		want   map[string][]byte
+	}{
+		{"ca kept by default", false, upstreamData},
+		{"ca omitted", true, map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cachedCert := &cachev1alpha1.CachedCertificate{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "testing"},
+				Spec: cachev1alpha1.CachedCertificateSpec{
+					SecretName: "test",
+					OmitCA:     tt.omitCA,
+				},
+			}
+			upstreamSecret := &v1.Secret{Data: upstreamData}
+
+			got, err := genSecretForSync(cachedCert, &unstructured.Unstructured{}, upstreamSecret, ownerReference(cachedCert, true), nil)
+			if err != nil {
+				t.Fatalf("genSecretForSync(, nil) error = %v", err)
+			}
+			if diff := deep.Equal(got.Data, tt.want); diff != nil {
+				t.Errorf("genSecretForSync(, nil) diff %v", diff)
+			}
+			if _, ok := upstreamSecret.Data["ca.crt"]; !ok {
+				t.Error("genSecretForSync(, nil) removed ca.crt from the upstream secret")
+			}
+		})
+	}
+}
+
+func Test_genSecretForSyncAnnotationPrefixAllowlist(t *testing.T) {
+	upstreamAnnotations := map[string]string{
+		CertificateNameAnnotationKey:      "upstream",
+		"reloader.stakater.com/match":     "true",
+		ReferencedByAnnotationKey:         "testing/test",
+		"unrelated.example.com/something": "value",
+	}
+
+	tests := []struct {
+		name      string
+		allowlist []string
+		want      map[string]string
+	}{
+		{
+			"everything copied by default",
+			nil,
+			map[string]string{
+				CertificateNameAnnotationKey:      "upstream",
+				"reloader.stakater.com/match":     "true",
+				ReferencedByAnnotationKey:         "testing/test",
+				"unrelated.example.com/something": "value",
+				SourceAnnotationKey:               "testing/test",
+				UpstreamAnnotationKey:             "cache/upstream",
+			},
+		},
+		{
+			"only matching prefixes and our own",
+			[]string{"reloader.stakater.com/"},
+			map[string]string{
+				"reloader.stakater.com/match": "true",
+				ReferencedByAnnotationKey:     "testing/test",
+				SourceAnnotationKey:           "testing/test",
+				UpstreamAnnotationKey:         "cache/upstream",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cachedCert := &cachev1alpha1.CachedCertificate{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "testing"},
+				Spec: cachev1alpha1.CachedCertificateSpec{
+					SecretName:                "test",
+					AnnotationPrefixAllowlist: tt.allowlist,
+				},
+			}
+			upstreamSecret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}, Data: testTLSData}
+			for k, v := range upstreamAnnotations {
+				upstreamSecret.Annotations[k] = v
+			}
+
+			upstreamCert := &unstructured.Unstructured{}
+			upstreamCert.SetName("upstream")
+			upstreamCert.SetNamespace("cache")
+			got, err := genSecretForSync(cachedCert, upstreamCert, upstreamSecret, ownerReference(cachedCert, true), nil)
+			if err != nil {
+				t.Fatalf("genSecretForSync(, nil) error = %v", err)
+			}
+			if diff := deep.Equal(got.Annotations, tt.want); diff != nil {
+				t.Errorf("genSecretForSync(, nil) diff %v", diff)
+			}
+		})
+	}
+}
+
+func Test_genSecretForSyncRenewalTime(t *testing.T) {
+	cachedCert := &cachev1alpha1.CachedCertificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "testing"},
+		Spec:       cachev1alpha1.CachedCertificateSpec{SecretName: "test"},
+	}
+
+	tests := []struct {
+		name         string
+		upstreamCert *unstructured.Unstructured
+		want         string
+		wantFound    bool
+	}{
+		{
+			"renewal time copied",
+			&unstructured.Unstructured{Object: map[string]interface{}{
+				"status": map[string]interface{}{"renewalTime": "2021-11-01T12:00:00Z"},
+			}},
+			"2021-11-01T12:00:00Z",
+			true,
+		},
+		{
+			"not issued yet",
+			&unstructured.Unstructured{Object: map[string]interface{}{}},
+			"",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a stale value copied from the upstream secret must not survive
+			upstreamSecret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{RenewalTimeAnnotationKey: "stale"}}, Data: testTLSData}
+
+			got, err := genSecretForSync(cachedCert, tt.upstreamCert, upstreamSecret, ownerReference(cachedCert, true), nil)
+			if err != nil {
+				t.Fatalf("genSecretForSync(, nil) error = %v", err)
+			}
+			renewalTime, found := got.Annotations[RenewalTimeAnnotationKey]
+			if renewalTime != tt.want || found != tt.wantFound {
+				t.Errorf("genSecretForSync(, nil) renewal time = %q (found %v), want %q (found %v)", renewalTime, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func Test_genSecretForSyncPropagateLabels(t *testing.T) {
+	tests := []struct {
+		name            string
+		propagateLabels bool
+		want            map[string]string
+	}{
+		{
+			"upstream labels only by default",
+			false,
+			map[string]string{
+				"upstream":     "label",
+				SyncedLabelKey: "true",
+			},
+		},
+		{
+			"CachedCertificate labels propagated",
+			true,
+			map[string]string{
+				"team":         "payments",
+				"upstream":     "label",
+				SyncedLabelKey: "true",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cachedCert := &cachev1alpha1.CachedCertificate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "testing",
+					Labels: map[string]string{
+						"team":         "payments",
+						"upstream":     "overridden",
+						SyncedLabelKey: "false",
+					},
+				},
+				Spec: cachev1alpha1.CachedCertificateSpec{
+					SecretName:      "test",
+					PropagateLabels: tt.propagateLabels,
+				},
+			}
+			upstreamSecret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"upstream": "label"}}, Data: testTLSData}
+
+			got, err := genSecretForSync(cachedCert, &unstructured.Unstructured{}, upstreamSecret, ownerReference(cachedCert, true), nil)
+			if err != nil {
+				t.Fatalf("genSecretForSync(, nil) error = %v", err)
+			}
+			if diff := deep.Equal(got.Labels, tt.want); diff != nil {
+				t.Errorf("genSecretForSync(, nil) diff %v", diff)
+			}
+			if _, ok := upstreamSecret.Labels[SyncedLabelKey]; ok {
+				t.Error("genSecretForSync(, nil) changed the upstream secret labels")
 			}
 		})
 	}
@@ -325,3 +1025,199 @@ func Test_slicesEqualAfterSort(t *testing.T) {
 		})
 	}
 }
+
+func Test_ResourceVersionChangesOnly(t *testing.T) {
+	p := ResourceVersionChangesOnly{}
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "1"}}
+	changed := &v1.Secret{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "2"}}
+
+	if p.Create(event.CreateEvent{Object: secret}) {
+		t.Error("Create() should skip all events")
+	}
+	if p.Generic(event.GenericEvent{Object: secret}) {
+		t.Error("Generic() should skip all events")
+	}
+	if !p.Delete(event.DeleteEvent{Object: secret}) {
+		t.Error("Delete() should pass all events")
+	}
+	if p.Update(event.UpdateEvent{ObjectOld: secret, ObjectNew: secret}) {
+		t.Error("Update() should skip events without a resource version change")
+	}
+	if !p.Update(event.UpdateEvent{ObjectOld: secret, ObjectNew: changed}) {
+		t.Error("Update() should pass events with a resource version change")
+	}
+}
+
+func Test_formatReferences(t *testing.T) {
+	many := make([]string, 0, maxReferencesListed+2)
+	for i := 0; i < maxReferencesListed+2; i++ {
+		many = append(many, "ns/"+strconv.Itoa(1000+i))
+	}
+
+	tests := []struct {
+		name string
+		refs []string
+		want string
+	}{
+		{
+			"empty",
+			nil,
+			"",
+		},
+		{
+			"sorted",
+			[]string{"b/cert", "a/cert"},
+			"a/cert,b/cert",
+		},
+		{
+			"capped",
+			many,
+			strings.Join(many[:maxReferencesListed], ",") + " (+2 more)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatReferences(tt.refs); got != tt.want {
+				t.Errorf("formatReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cachedNamespaces(t *testing.T) {
+	tests := []struct {
+		name            string
+		watchNamespaces []string
+		want            []string
+	}{
+		{
+			"nothing watched",
+			nil,
+			nil,
+		},
+		{
+			"only empty values",
+			[]string{"", " "},
+			nil,
+		},
+		{
+			"cache namespace added",
+			[]string{"team-b", " team-a "},
+			[]string{"cache", "team-a", "team-b"},
+		},
+		{
+			"duplicates removed",
+			[]string{"team-a", "cache", "team-a"},
+			[]string{"cache", "team-a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, diff := range deep.Equal(cachedNamespaces("cache", tt.watchNamespaces), tt.want) {
+				t.Errorf("cachedNamespaces() diff %v", diff)
+			}
+		})
+	}
+}
+
+func Test_genConfigMapForSync(t *testing.T) {
+	secret := &v1.Secret{
+		Data: map[string][]byte{
+			"tls.crt": []byte("crt"),
+			"tls.key": []byte("key"),
+			"ca.crt":  []byte("ca"),
+		},
+	}
+	remappedSecret := &v1.Secret{
+		Data: map[string][]byte{
+			"cert.pem": []byte("crt"),
+			"key.pem":  []byte("key"),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		keyMapping map[string]string
+		secret     *v1.Secret
+		want       map[string]string
+	}{
+		{"public material only", nil, secret, map[string]string{"tls.crt": "crt", "ca.crt": "ca"}},
+		{"remapped keys", map[string]string{"tls.crt": "cert.pem", "tls.key": "key.pem"}, remappedSecret, map[string]string{"tls.crt": "crt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cachedCert := &cachev1alpha1.CachedCertificate{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "testing"},
+				Spec: cachev1alpha1.CachedCertificateSpec{
+					KeyMapping:         tt.keyMapping,
+					PublishCAConfigMap: "test-ca",
+				},
+			}
+
+			got := genConfigMapForSync(cachedCert, tt.secret, true)
+			if diff := deep.Equal(got.Data, tt.want); diff != nil {
+				t.Errorf("genConfigMapForSync() diff %v", diff)
+			}
+			if got.Name != "test-ca" || got.Namespace != "testing" {
+				t.Errorf("genConfigMapForSync() = %v/%v, want testing/test-ca", got.Namespace, got.Name)
+			}
+			if got.Labels[SyncedLabelKey] != "true" {
+				t.Error("genConfigMapForSync() missing synced label")
+			}
+		})
+	}
+}
+
+func Test_ownerReferenceBlockOwnerDeletion(t *testing.T) {
+	cachedCert := &cachev1alpha1.CachedCertificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "testing", UID: "uid"},
+		Spec:       cachev1alpha1.CachedCertificateSpec{SecretName: "test", PublishCAConfigMap: "test-ca"},
+	}
+	upstreamCert := &unstructured.Unstructured{}
+	upstreamCert.SetName("upstream")
+	upstreamSecret := &v1.Secret{Data: map[string][]byte{"tls.crt": nil, "tls.key": nil}}
+
+	for _, block := range []bool{true, false} {
+		t.Run(strconv.FormatBool(block), func(t *testing.T) {
+			secret, err := genSecretForSync(cachedCert, upstreamCert, upstreamSecret, ownerReference(cachedCert, block), nil)
+			if err != nil {
+				t.Fatalf("genSecretForSync(, nil) error = %v", err)
+			}
+			configMap := genConfigMapForSync(cachedCert, secret, block)
+
+			for kind, refs := range map[string][]metav1.OwnerReference{"secret": secret.OwnerReferences, "configmap": configMap.OwnerReferences} {
+				if len(refs) != 1 || refs[0].BlockOwnerDeletion == nil || *refs[0].BlockOwnerDeletion != block {
+					t.Errorf("%v ownerReferences = %v, want blockOwnerDeletion %v", kind, refs, block)
+				}
+				if refs[0].Controller == nil || !*refs[0].Controller {
+					t.Errorf("%v ownerReferences = %v, want a controller reference", kind, refs)
+				}
+			}
+		})
+	}
+}
+
+func Test_isQuotaExceeded(t *testing.T) {
+	secrets := schema.GroupResource{Resource: "secrets"}
+	quota := errors.New("exceeded quota: secrets, requested: secrets=1, used: secrets=10, limited: secrets=10")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{name: "quota admission", err: k8serr.NewForbidden(secrets, "a", quota), want: true},
+		{name: "wrapped quota admission", err: fmt.Errorf("writing secret: %w", k8serr.NewForbidden(secrets, "a", quota)), want: true},
+		{name: "other forbidden", err: k8serr.NewForbidden(secrets, "a", errors.New("not allowed"))},
+		{name: "not forbidden", err: k8serr.NewBadRequest("denied by webhook: exceeded quota of certificates per team")},
+		{name: "plain error", err: quota},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isQuotaExceeded(tt.err); got != tt.want {
+				t.Errorf("isQuotaExceeded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package importer converts existing cert-manager Certificates into CachedCertificates
+package importer
+
+import (
+	"context"
+	"io"
+
+	v1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/controllers"
+)
+
+// CertificateListGVK identifies the cert-manager Certificate list type scanned during import
+var CertificateListGVK = schema.GroupVersionKind{
+	Group:   "cert-manager.io",
+	Kind:    "CertificateList",
+	Version: "v1",
+}
+
+// Import lists all cert-manager Certificates in the given namespace and returns an equivalent CachedCertificate for each.
+// Certificates without any dnsNames can not be represented and are returned by name in skipped.
+func Import(ctx context.Context, c client.Client, namespace string) (certs []cachev1alpha1.CachedCertificate, skipped []string, err error) {
+	certList := &unstructured.UnstructuredList{}
+	certList.SetGroupVersionKind(CertificateListGVK)
+
+	err = c.List(ctx, certList, client.InNamespace(namespace))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, upstreamCert := range certList.Items {
+		cachedCert, ok := fromCertificate(&upstreamCert)
+		if !ok {
+			skipped = append(skipped, upstreamCert.GetName())
+			continue
+		}
+
+		certs = append(certs, *cachedCert)
+	}
+
+	return certs, skipped, nil
+}
+
+// fromCertificate copies the dnsNames, issuerRef and secretName of a Certificate into a new CachedCertificate
+func fromCertificate(upstreamCert *unstructured.Unstructured) (*cachev1alpha1.CachedCertificate, bool) {
+	dnsNames, _, _ := unstructured.NestedStringSlice(upstreamCert.Object, "spec", "dnsNames")
+	if len(dnsNames) == 0 {
+		return nil, false
+	}
+
+	secretName, _, _ := unstructured.NestedString(upstreamCert.Object, "spec", "secretName")
+	issuerName, _, _ := unstructured.NestedString(upstreamCert.Object, "spec", "issuerRef", "name")
+	issuerKind, _, _ := unstructured.NestedString(upstreamCert.Object, "spec", "issuerRef", "kind")
+	issuerGroup, _, _ := unstructured.NestedString(upstreamCert.Object, "spec", "issuerRef", "group")
+
+	// cert-manager defaults the kind when not set, but it is required on a CachedCertificate
+	if issuerKind == "" {
+		issuerKind = "Issuer"
+	}
+
+	return &cachev1alpha1.CachedCertificate{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: cachev1alpha1.GroupVersion.String(),
+			Kind:       "CachedCertificate",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upstreamCert.GetName(),
+			Namespace: upstreamCert.GetNamespace(),
+		},
+		Spec: cachev1alpha1.CachedCertificateSpec{
+			SecretName: secretName,
+			IssuerRef: cachev1alpha1.IssuerRef{
+				Name:  issuerName,
+				Kind:  issuerKind,
+				Group: issuerGroup,
+			},
+			DNSNames: dnsNames,
+		},
+	}, true
+}
+
+// SkippedSecret is a secret AdoptSecrets left alone and why
+type SkippedSecret struct {
+	// Secret is the namespace and name of the secret
+	Secret types.NamespacedName
+
+	// Reason explains why it wasn't adopted
+	Reason string
+}
+
+// AdoptSecrets marks the existing secret of each CachedCertificate as synced by the operator
+// so the first sync will update it rather than refusing to touch a secret it did not make.
+// Secrets a Certificate that isn't being deleted still uses are skipped, cert-manager keeps renewing them so both would
+// write the same secret. Secrets that do not exist yet are skipped since the operator will create them.
+func AdoptSecrets(ctx context.Context, c client.Client, certs []cachev1alpha1.CachedCertificate) (adopted []types.NamespacedName, skipped []SkippedSecret, err error) {
+	// the Certificates using each secret name, listed once per namespace
+	inUse := map[string]map[string]string{}
+
+	for _, cert := range certs {
+		secretName := cert.Spec.SecretName
+		if secretName == "" {
+			secretName = cert.GetName()
+		}
+		key := types.NamespacedName{Name: secretName, Namespace: cert.GetNamespace()}
+
+		if _, ok := inUse[key.Namespace]; !ok {
+			if inUse[key.Namespace], err = certificateSecrets(ctx, c, key.Namespace); err != nil {
+				return adopted, skipped, err
+			}
+		}
+		if certName, ok := inUse[key.Namespace][key.Name]; ok {
+			skipped = append(skipped, SkippedSecret{Secret: key, Reason: "still used by Certificate " + certName + ", delete it before adopting"})
+			continue
+		}
+
+		secret := &v1.Secret{}
+		err = c.Get(ctx, key, secret)
+		if k8serr.IsNotFound(err) {
+			skipped = append(skipped, SkippedSecret{Secret: key, Reason: "not found, the operator will create it"})
+			continue
+		} else if err != nil {
+			return adopted, skipped, err
+		}
+
+		patch := client.MergeFrom(secret.DeepCopy())
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		secret.Labels[controllers.SyncedLabelKey] = "true"
+
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[controllers.SourceAnnotationKey] = cert.GetNamespace() + "/" + cert.GetName()
+
+		err = c.Patch(ctx, secret, patch)
+		if err != nil {
+			return adopted, skipped, err
+		}
+		adopted = append(adopted, key)
+	}
+
+	return adopted, skipped, nil
+}
+
+// certificateSecrets maps the secretName of every Certificate in the namespace that isn't being deleted to its name
+func certificateSecrets(ctx context.Context, c client.Client, namespace string) (map[string]string, error) {
+	certList := &unstructured.UnstructuredList{}
+	certList.SetGroupVersionKind(CertificateListGVK)
+	if err := c.List(ctx, certList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	secrets := map[string]string{}
+	for _, upstreamCert := range certList.Items {
+		if upstreamCert.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if secretName, _, _ := unstructured.NestedString(upstreamCert.Object, "spec", "secretName"); secretName != "" {
+			secrets[secretName] = upstreamCert.GetName()
+		}
+	}
+
+	return secrets, nil
+}
+
+// ReadManifests reads back CachedCertificates written by WriteManifests, e.g. to adopt their secrets once the original
+// Certificates are deleted
+func ReadManifests(r io.Reader) ([]cachev1alpha1.CachedCertificate, error) {
+	var certs []cachev1alpha1.CachedCertificate
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		cert := cachev1alpha1.CachedCertificate{}
+		err := decoder.Decode(&cert)
+		if err == io.EOF {
+			return certs, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		// empty documents decode to an empty object
+		if cert.GetName() == "" {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// WriteManifests writes the CachedCertificates as a multi-document yaml stream
+func WriteManifests(w io.Writer, certs []cachev1alpha1.CachedCertificate) error {
+	for i := range certs {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&certs[i])
+		if err != nil {
+			return err
+		}
+
+		// only the desired state is useful in a manifest
+		delete(obj, "status")
+		unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(w, "---\n"+string(out))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
+	"weavelab.xyz/cached-certificate-operator/controllers"
+)
+
+func newCertificate(name, namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "cert-manager.io/v1",
+			"kind":       "Certificate",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+			"spec": spec,
+		},
+	}
+}
+
+func newFakeClient(objs ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = cachev1alpha1.AddToScheme(s)
+
+	// the fake client needs to know about the cert-manager types, unstructured is enough
+	s.AddKnownTypeWithName(CertificateListGVK.GroupVersion().WithKind("Certificate"), &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(CertificateListGVK, &unstructured.UnstructuredList{})
+
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
+
+func TestImport(t *testing.T) {
+	c := newFakeClient(
+		newCertificate("web", "apps", map[string]interface{}{
+			"dnsNames":   []interface{}{"web.example.com", "www.example.com"},
+			"secretName": "web-tls",
+			"issuerRef": map[string]interface{}{
+				"name":  "letsencrypt",
+				"kind":  "ClusterIssuer",
+				"group": "cert-manager.io",
+			},
+		}),
+		newCertificate("api", "apps", map[string]interface{}{
+			"dnsNames":   []interface{}{"api.example.com"},
+			"secretName": "api-tls",
+			"issuerRef": map[string]interface{}{
+				"name": "internal",
+			},
+		}),
+		newCertificate("ip-only", "apps", map[string]interface{}{
+			"ipAddresses": []interface{}{"10.0.0.1"},
+			"secretName":  "ip-only-tls",
+		}),
+		newCertificate("elsewhere", "other", map[string]interface{}{
+			"dnsNames":   []interface{}{"other.example.com"},
+			"secretName": "other-tls",
+		}),
+	)
+
+	certs, skipped, err := Import(context.Background(), c, "apps")
+	if err != nil {
+		t.Fatalf("Import() unexpected err %v", err)
+	}
+
+	want := []cachev1alpha1.CachedCertificate{
+		{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "cache.weavelab.xyz/v1alpha1", Kind: "CachedCertificate"},
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "apps"},
+			Spec: cachev1alpha1.CachedCertificateSpec{
+				SecretName: "api-tls",
+				IssuerRef:  cachev1alpha1.IssuerRef{Name: "internal", Kind: "Issuer"},
+				DNSNames:   []string{"api.example.com"},
+			},
+		},
+		{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "cache.weavelab.xyz/v1alpha1", Kind: "CachedCertificate"},
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"},
+			Spec: cachev1alpha1.CachedCertificateSpec{
+				SecretName: "web-tls",
+				IssuerRef:  cachev1alpha1.IssuerRef{Name: "letsencrypt", Kind: "ClusterIssuer", Group: "cert-manager.io"},
+				DNSNames:   []string{"web.example.com", "www.example.com"},
+			},
+		},
+	}
+	for _, diff := range deep.Equal(certs, want) {
+		t.Errorf("Import() diff %v", diff)
+	}
+	for _, diff := range deep.Equal(skipped, []string{"ip-only"}) {
+		t.Errorf("Import() skipped diff %v", diff)
+	}
+}
+
+func TestAdoptSecrets(t *testing.T) {
+	c := newFakeClient(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-tls",
+			Namespace: "apps",
+			Labels:    map[string]string{"keep": "me"},
+		},
+	})
+
+	certs := []cachev1alpha1.CachedCertificate{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"},
+			Spec:       cachev1alpha1.CachedCertificateSpec{SecretName: "web-tls"},
+		},
+		{
+			// no secret exists for this one, it should be skipped
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "apps"},
+		},
+	}
+
+	adopted, skipped, err := AdoptSecrets(context.Background(), c, certs)
+	if err != nil {
+		t.Fatalf("AdoptSecrets() unexpected err %v", err)
+	}
+	for _, diff := range deep.Equal(adopted, []types.NamespacedName{{Name: "web-tls", Namespace: "apps"}}) {
+		t.Errorf("AdoptSecrets() adopted diff %v", diff)
+	}
+	for _, diff := range deep.Equal(skipped, []SkippedSecret{{Secret: types.NamespacedName{Name: "api", Namespace: "apps"}, Reason: "not found, the operator will create it"}}) {
+		t.Errorf("AdoptSecrets() skipped diff %v", diff)
+	}
+
+	secret := &v1.Secret{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "web-tls", Namespace: "apps"}, secret); err != nil {
+		t.Fatalf("unable to get adopted secret %v", err)
+	}
+
+	for _, diff := range deep.Equal(secret.Labels, map[string]string{"keep": "me", controllers.SyncedLabelKey: "true"}) {
+		t.Errorf("AdoptSecrets() labels diff %v", diff)
+	}
+	if got := secret.Annotations[controllers.SourceAnnotationKey]; got != "apps/web" {
+		t.Errorf("AdoptSecrets() source annotation = %v, want apps/web", got)
+	}
+}
+
+func TestAdoptSecretsInUse(t *testing.T) {
+	c := newFakeClient(
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "web-tls", Namespace: "apps"}},
+		newCertificate("web", "apps", map[string]interface{}{
+			"dnsNames":   []interface{}{"web.example.com"},
+			"secretName": "web-tls",
+		}),
+	)
+
+	certs := []cachev1alpha1.CachedCertificate{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"},
+			Spec:       cachev1alpha1.CachedCertificateSpec{SecretName: "web-tls"},
+		},
+	}
+
+	adopted, skipped, err := AdoptSecrets(context.Background(), c, certs)
+	if err != nil {
+		t.Fatalf("AdoptSecrets() unexpected err %v", err)
+	}
+	if len(adopted) != 0 {
+		t.Errorf("AdoptSecrets() adopted %v, want none while the Certificate exists", adopted)
+	}
+	for _, diff := range deep.Equal(skipped, []SkippedSecret{{
+		Secret: types.NamespacedName{Name: "web-tls", Namespace: "apps"},
+		Reason: "still used by Certificate web, delete it before adopting",
+	}}) {
+		t.Errorf("AdoptSecrets() skipped diff %v", diff)
+	}
+
+	// cert-manager still owns the secret, it must not be marked as synced
+	secret := &v1.Secret{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "web-tls", Namespace: "apps"}, secret); err != nil {
+		t.Fatalf("unable to get secret %v", err)
+	}
+	if _, ok := secret.Labels[controllers.SyncedLabelKey]; ok {
+		t.Errorf("AdoptSecrets() labeled a secret a Certificate still uses")
+	}
+	if _, ok := secret.Annotations[controllers.SourceAnnotationKey]; ok {
+		t.Errorf("AdoptSecrets() annotated a secret a Certificate still uses")
+	}
+}
+
+func TestReadManifests(t *testing.T) {
+	certs := []cachev1alpha1.CachedCertificate{
+		{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "cache.weavelab.xyz/v1alpha1", Kind: "CachedCertificate"},
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "apps"},
+			Spec: cachev1alpha1.CachedCertificateSpec{
+				SecretName: "api-tls",
+				IssuerRef:  cachev1alpha1.IssuerRef{Name: "internal", Kind: "Issuer"},
+				DNSNames:   []string{"api.example.com"},
+			},
+		},
+		{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "cache.weavelab.xyz/v1alpha1", Kind: "CachedCertificate"},
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"},
+			Spec: cachev1alpha1.CachedCertificateSpec{
+				SecretName: "web-tls",
+				IssuerRef:  cachev1alpha1.IssuerRef{Name: "letsencrypt", Kind: "ClusterIssuer"},
+				DNSNames:   []string{"web.example.com"},
+			},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteManifests(out, certs); err != nil {
+		t.Fatalf("WriteManifests() unexpected err %v", err)
+	}
+
+	got, err := ReadManifests(out)
+	if err != nil {
+		t.Fatalf("ReadManifests() unexpected err %v", err)
+	}
+	for _, diff := range deep.Equal(got, certs) {
+		t.Errorf("ReadManifests() diff %v", diff)
+	}
+}
+
+func TestWriteManifests(t *testing.T) {
+	certs := []cachev1alpha1.CachedCertificate{
+		{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "cache.weavelab.xyz/v1alpha1", Kind: "CachedCertificate"},
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"},
+			Spec: cachev1alpha1.CachedCertificateSpec{
+				SecretName: "web-tls",
+				IssuerRef:  cachev1alpha1.IssuerRef{Name: "letsencrypt", Kind: "ClusterIssuer"},
+				DNSNames:   []string{"web.example.com"},
+			},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteManifests(out, certs); err != nil {
+		t.Fatalf("WriteManifests() unexpected err %v", err)
+	}
+
+	want := `---
+apiVersion: cache.weavelab.xyz/v1alpha1
+kind: CachedCertificate
+metadata:
+  name: web
+  namespace: apps
+spec:
+  dnsNames:
+  - web.example.com
+  issuerRef:
+    kind: ClusterIssuer
+    name: letsencrypt
+  secretName: web-tls
+`
+	if out.String() != want {
+		t.Errorf("WriteManifests() = %v, want %v", out.String(), want)
+	}
+}
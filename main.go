@@ -17,22 +17,42 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"text/template"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	cachev1alpha1 "weavelab.xyz/cached-certificate-operator/api/v1alpha1"
 	"weavelab.xyz/cached-certificate-operator/controllers"
+	"weavelab.xyz/cached-certificate-operator/importer"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -49,16 +69,138 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var cacheNamespace string
+	var watchAllUpstreamSecretEvents bool
+	var maxDNSNames int
+	var watchNamespaces string
+	var watchLabelSelector string
+	var sharedUpstreamStrategy string
+	var upstreamNamingStrategy string
+	var disambiguateWildcardNames bool
+	var issuerFallbackTimeout time.Duration
+	var circuitBreakerThreshold int
+	var quotaExceededBackoff time.Duration
+	var circuitBreakerCooldown time.Duration
+	var allowedIssuers string
+	var allowedDNSSuffixes string
+	var allowCommonNameOutsideDNSNames bool
+	var allowSecretNamespaceSelector bool
+	var namespaceCopiesPerReconcile int
+	var immutableDNSNames bool
+	var verifyKeyPair bool
+	var verifyDNSNames bool
+	var gracefulShutdownTimeout time.Duration
+	var blockOwnerDeletion bool
+	var metricsPerObject bool
+	var certificateNameAnnotation string
+	var clusterTrustBundleName string
+	var secretProviderClassProvider string
+	var upstreamPollInterval time.Duration
+	var enableTracing bool
+	var summaryConfigMap string
+	var summaryInterval time.Duration
+	var orphanGracePeriod time.Duration
+	var staleSecretInterval time.Duration
+	var upstreamSecretCacheTTL time.Duration
+	var parsedCertificateCacheSize int
+	var fieldManager string
+	var waitForIssuance time.Duration
+	var enableAuditLog bool
+	var watchIssuers bool
+	var defaultSecretNameTemplate string
+	var upstreamSecretNameTemplate string
+	var reKeyDebounce time.Duration
+	var upstreamKubeconfig string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
-	flag.StringVar(&cacheNamespace, "cache-namespace", "cached-certificate-operator-system", "The name of the namespace where all upstream Certificates will be created")
+	flag.StringVar(&cacheNamespace, "cache-namespace", "", "The name of the namespace where all upstream Certificates will be created. "+
+		"Defaults to the POD_NAMESPACE environment variable.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "A comma separated list of namespaces to watch for CachedCertificates. "+
+		"When set, only these namespaces and the cache namespace are cached, removing the need for cluster-wide secret access.")
+	flag.StringVar(&watchLabelSelector, "watch-label-selector", "", "Only reconcile CachedCertificates matching this label selector. "+
+		"Allows running multiple instances of the operator side by side.")
+	flag.StringVar(&sharedUpstreamStrategy, "shared-upstream-strategy", string(controllers.SharedUpstreamStrategyDNSOnly), "Which CachedCertificates share an upstream Certificate. "+
+		"dns-only shares across identical dnsNames with the last writer's issuer, dns-plus-issuer also requires the same issuer.")
+	flag.StringVar(&upstreamNamingStrategy, "upstream-naming-strategy", string(controllers.UpstreamNamingJoined), "How upstream Certificate names are built from dnsNames. "+
+		"joined joins all the names, first-plus-hash uses the first name and a hash of all of them to keep long lists readable. "+
+		"Changing it re-issues upstreams with several dnsNames.")
+	flag.BoolVar(&disambiguateWildcardNames, "disambiguate-wildcard-names", false, "Add a marker to the names of upstream Certificates with a wildcard "+
+		"so the hashed wildcard can't collide with a literal dns name. Changes the names of existing wildcard upstreams, which are re-issued once.")
+	flag.DurationVar(&reKeyDebounce, "rekey-debounce", 0, "How long a CachedCertificate's spec has to stay unchanged before a dnsNames or commonName "+
+		"change moves it to a new upstream Certificate, so a burst of edits is issued once. Zero moves right away.")
+	flag.IntVar(&circuitBreakerThreshold, "circuit-breaker-threshold", 0, "How many failed issuance attempts in a row on an upstream Certificate "+
+		"stop new upstreams being created for its CachedCertificates. Zero disables the circuit breaker.")
+	flag.DurationVar(&circuitBreakerCooldown, "circuit-breaker-cooldown", time.Hour, "How long an open circuit breaker waits before issuing again.")
+	flag.DurationVar(&quotaExceededBackoff, "quota-exceeded-backoff", 5*time.Minute, "How long to wait before writing a target secret again "+
+		"after a ResourceQuota in its namespace refused it.")
+	flag.DurationVar(&issuerFallbackTimeout, "issuer-fallback-timeout", 10*time.Minute, "How long to wait for an upstream Certificate to be ready "+
+		"before falling back to the next issuer in a CachedCertificate's issuerRefs. Zero disables fallback.")
+	flag.StringVar(&allowedIssuers, "allowed-issuers", "", "A comma separated list of issuers CachedCertificates may use, "+
+		"formatted as kind/name or kind.group/name e.g. ClusterIssuer/letsencrypt. Empty allows any issuer.")
+	flag.StringVar(&allowedDNSSuffixes, "allowed-dns-suffixes", "", "A comma separated list of domains CachedCertificate dnsNames must be within, "+
+		"e.g. internal.example.com. Empty allows any dns name.")
+	flag.BoolVar(&allowCommonNameOutsideDNSNames, "allow-common-name-outside-dns-names", false, "Allow a CachedCertificate commonName that isn't one of its dnsNames. "+
+		"Some TLS stacks reject certificates with a common name that isn't also a SAN.")
+	flag.BoolVar(&allowSecretNamespaceSelector, "allow-secret-namespace-selector", false, "Allow CachedCertificates to copy their target secret into every namespace "+
+		"matching their secretNamespaceSelector. Needs cluster-wide access so it can't be combined with --watch-namespaces.")
+	flag.IntVar(&namespaceCopiesPerReconcile, "namespace-copies-per-reconcile", 0, "The most namespaces a reconcile copies a target secret into, "+
+		"the rest are written on the following reconciles. 0 writes every namespace at once.")
+	flag.BoolVar(&immutableDNSNames, "immutable-dns-names", false, "Reject updates changing the dnsNames of an existing CachedCertificate. "+
+		"Only enforced by the webhook.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 30*time.Second, "How long to let in-flight reconciles finish on shutdown before exiting.")
+	flag.BoolVar(&blockOwnerDeletion, "block-owner-deletion", true, "Set blockOwnerDeletion on the owner references of synced secrets. "+
+		"Disable to keep foreground deletion of a CachedCertificate from waiting on its secret.")
+	flag.BoolVar(&metricsPerObject, "metrics-per-object", false, "Report state and certificate expiry metric series for every CachedCertificate labeled by namespace and name. "+
+		"Series grow with the number of CachedCertificates so only enable this when per-certificate alerting is worth the cardinality.")
+	flag.StringVar(&secretProviderClassProvider, "secret-provider-class-provider", "", "Generate a secrets-store CSI driver SecretProviderClass with "+
+		"this provider for CachedCertificates annotated with cache.weavelab.xyz/secret-provider-class. Empty disables it.")
+	flag.StringVar(&clusterTrustBundleName, "cluster-trust-bundle-name", "", "Add the ca.crt of every synced upstream secret to the "+
+		"ClusterTrustBundle of this name. Needs the alpha certificates.k8s.io/v1alpha1 api enabled. Empty disables it.")
+	flag.StringVar(&certificateNameAnnotation, "certificate-name-annotation", controllers.CertificateNameAnnotationKey, "The annotation cert-manager sets on issued secrets "+
+		"pointing at their Certificate. Only change this for cert-manager forks using a different key.")
+	flag.DurationVar(&upstreamPollInterval, "upstream-poll-interval", time.Hour, "How often CachedCertificates with upstreamSecretSync set to poll re-sync from their upstream secret.")
+	flag.DurationVar(&upstreamSecretCacheTTL, "upstream-secret-cache-ttl", 0, "How long an upstream secret read is reused by other CachedCertificates "+
+		"sharing the upstream, cutting reads during renewals. New versions seen by the upstream secret watch replace it. Zero disables the cache.")
+	flag.IntVar(&parsedCertificateCacheSize, "parsed-certificate-cache-size", 0, "How many parsed tls.crt chains are kept so reconciles of "+
+		"unchanged secrets don't parse them again. Chains are keyed by their content so renewals are always parsed. Zero disables the cache.")
+	flag.BoolVar(&enableTracing, "enable-tracing", false, "Export OpenTelemetry traces of reconciles over OTLP/HTTP to the endpoint in the OTEL_EXPORTER_OTLP_ENDPOINT env.")
+	flag.StringVar(&summaryConfigMap, "summary-configmap", "", "The name of a ConfigMap in the cache namespace to keep updated with the number of CachedCertificates "+
+		"in each state. Empty disables the summary.")
+	flag.DurationVar(&summaryInterval, "summary-interval", time.Minute, "How often the summary ConfigMap is refreshed.")
+	flag.DurationVar(&orphanGracePeriod, "orphan-grace-period", 0, "Delete upstream Certificates and their secrets once no CachedCertificate "+
+		"has used them for this long. Zero keeps upstream Certificates forever.")
+	flag.DurationVar(&staleSecretInterval, "stale-secret-interval", 0, "How often to delete target secrets whose CachedCertificate no longer exists "+
+		"or now uses a different secretName. Zero disables the cleanup.")
+	flag.StringVar(&fieldManager, "field-manager", "cached-certificate-operator", "The field manager target secrets are written with using server-side apply, "+
+		"keeping fields set by other controllers. Empty replaces target secrets with plain updates instead.")
+	flag.DurationVar(&waitForIssuance, "wait-for-issuance", 0, "How long a reconcile keeps polling for a new upstream secret before requeueing, "+
+		"so CachedCertificates sync as soon as they are issued. Intended for CI, zero disables the wait.")
+	flag.BoolVar(&enableAuditLog, "audit-log", false, "Log a line under the audit logger for every write creating a target secret or changing its data, "+
+		"with the CachedCertificate, secret, content hash and time.")
+	flag.BoolVar(&watchIssuers, "watch-issuers", false, "Reconcile CachedCertificates as soon as the cert-manager Issuer or ClusterIssuer they reference becomes ready. "+
+		"Needs the cert-manager issuer CRDs installed.")
+	flag.BoolVar(&verifyKeyPair, "verify-key-pair", false, "Check the private key in each upstream secret matches its certificate before syncing it. "+
+		"Guards against corrupt upstream secrets at the cost of parsing both on every sync.")
+	flag.BoolVar(&verifyDNSNames, "verify-dns-names", false, "Check the certificate in each upstream secret covers every dnsName of the CachedCertificate "+
+		"before syncing it. Guards against issuers leaving names out at the cost of parsing the chain on every sync.")
+	flag.StringVar(&defaultSecretNameTemplate, "default-secret-name-template", "", "A Go template for the secretName of CachedCertificates that don't set one, "+
+		"rendered with .Name e.g. {{ .Name }}-tls. Empty uses the CachedCertificate name.")
+	flag.StringVar(&upstreamKubeconfig, "upstream-kubeconfig", "", "A kubeconfig for a cluster holding the upstream Certificates and secrets, which are only read from it. "+
+		"Upstreams have to be created in that cluster and synced CachedCertificates re-sync every --upstream-poll-interval. Empty uses the local cluster.")
+	flag.StringVar(&upstreamSecretNameTemplate, "upstream-secret-name-template", "", "A Go template for the secretName of new upstream Certificates, "+
+		"rendered with the upstream name as .Name e.g. {{ .Name }}-tls. Empty uses the upstream name.")
+	flag.IntVar(&maxDNSNames, "max-dns-names", 0, "The maximum number of dnsNames allowed on a CachedCertificate. Zero means no limit.")
+	flag.BoolVar(&watchAllUpstreamSecretEvents, "watch-all-upstream-secret-events", false, "Reconcile on every upstream secret event rather than only changes. Intended for debugging.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -67,27 +209,251 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if enableTracing {
+		shutdownTracing, err := setupTracing(context.Background())
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		// flush the remaining spans once the manager stops
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				setupLog.Error(err, "unable to flush traces")
+			}
+		}()
+	}
+
+	var watchSelector labels.Selector
+	if watchLabelSelector != "" {
+		var err error
+		watchSelector, err = labels.Parse(watchLabelSelector)
+		if err != nil {
+			setupLog.Error(err, "unable to parse watch label selector")
+			os.Exit(1)
+		}
+	}
+
+	cacheNamespace, err := resolveCacheNamespace(cacheNamespace, os.Getenv)
+	if err != nil {
+		setupLog.Error(err, "unable to determine cache namespace")
+		os.Exit(1)
+	}
+
+	upstreamStrategy, err := controllers.ParseSharedUpstreamStrategy(sharedUpstreamStrategy)
+	if err != nil {
+		setupLog.Error(err, "unable to parse shared upstream strategy")
+		os.Exit(1)
+	}
+
+	upstreamNaming, err := controllers.ParseUpstreamNamingStrategy(upstreamNamingStrategy)
+	if err != nil {
+		setupLog.Error(err, "unable to parse upstream naming strategy")
+		os.Exit(1)
+	}
+
+	var secretNameTemplate *template.Template
+	if defaultSecretNameTemplate != "" {
+		secretNameTemplate, err = controllers.ParseSecretNameTemplate(defaultSecretNameTemplate)
+		if err != nil {
+			setupLog.Error(err, "unable to parse default secret name template")
+			os.Exit(1)
+		}
+	}
+
+	var upstreamSecretName *template.Template
+	if upstreamSecretNameTemplate != "" {
+		upstreamSecretName, err = controllers.ParseUpstreamSecretNameTemplate(upstreamSecretNameTemplate)
+		if err != nil {
+			setupLog.Error(err, "unable to parse upstream secret name template")
+			os.Exit(1)
+		}
+	}
+
+	issuers, err := cachev1alpha1.ParseIssuerRefs(allowedIssuers)
+	if err != nil {
+		setupLog.Error(err, "unable to parse allowed issuers")
+		os.Exit(1)
+	}
+
+	// shared by the webhook and the reconciler so resources admitted before a config change are still checked
+	validator := &cachev1alpha1.CachedCertificateValidator{
+		MaxDNSNames:        maxDNSNames,
+		AllowedIssuers:     issuers,
+		AllowedDNSSuffixes: cachev1alpha1.ParseDNSSuffixes(allowedDNSSuffixes),
+
+		AllowCommonNameOutsideDNSNames: allowCommonNameOutsideDNSNames,
+		AllowSecretNamespaceSelector:   allowSecretNamespaceSelector,
+		ImmutableDNSNames:              immutableDNSNames,
+	}
+
+	if allowSecretNamespaceSelector && strings.TrimSpace(watchNamespaces) != "" {
+		// copies go to namespaces outside the watched set, which the namespaced cache can't see
+		setupLog.Error(errors.New("--allow-secret-namespace-selector can't be combined with --watch-namespaces"), "invalid flags")
+		os.Exit(1)
+	}
+
+	if upstreamKubeconfig != "" && (orphanGracePeriod > 0 || watchIssuers) {
+		// both act on cert-manager resources in the local cluster, which holds none in this mode
+		setupLog.Error(errors.New("--upstream-kubeconfig can't be combined with --orphan-grace-period or --watch-issuers"), "invalid flags")
+		os.Exit(1)
+	}
+
+	var upstreamReader client.Reader
+	if upstreamKubeconfig != "" {
+		upstreamConfig, err := clientcmd.BuildConfigFromFlags("", upstreamKubeconfig)
+		if err != nil {
+			setupLog.Error(err, "unable to load upstream kubeconfig")
+			os.Exit(1)
+		}
+		if upstreamReader, err = client.New(upstreamConfig, client.Options{Scheme: scheme}); err != nil {
+			setupLog.Error(err, "unable to create upstream client")
+			os.Exit(1)
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "32f15f9c.weavelab.xyz",
+		Scheme:                  scheme,
+		MetricsBindAddress:      metricsAddr,
+		Port:                    9443,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "32f15f9c.weavelab.xyz",
+		NewCache:                controllers.NewNamespacedCache(cacheNamespace, strings.Split(watchNamespaces, ",")),
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.CachedCertificateReconciler{
+	resyncEvents := make(chan event.GenericEvent)
+	if err = mgr.AddMetricsExtraHandler(controllers.ResyncPath, &controllers.ResyncHandler{
+		Reader: mgr.GetClient(),
+		Events: resyncEvents,
+	}); err != nil {
+		setupLog.Error(err, "unable to register resync handler")
+		os.Exit(1)
+	}
+
+	if err = mgr.AddMetricsExtraHandler(controllers.DuplicatesPath, &controllers.DuplicatesHandler{
+		Reader:         mgr.GetClient(),
 		CacheNamespace: cacheNamespace,
-		Client:         mgr.GetClient(),
-		Scheme:         mgr.GetScheme(),
+	}); err != nil {
+		setupLog.Error(err, "unable to register duplicates handler")
+		os.Exit(1)
+	}
+
+	if err = metrics.Registry.Register(&controllers.MetricsCollector{
+		Reader:                    mgr.GetClient(),
+		PerObject:                 metricsPerObject,
+		DefaultSecretNameTemplate: secretNameTemplate,
+	}); err != nil {
+		setupLog.Error(err, "unable to register metrics")
+		os.Exit(1)
+	}
+
+	issuanceLatency := controllers.NewIssuanceLatencyHistogram()
+	if err = metrics.Registry.Register(issuanceLatency); err != nil {
+		setupLog.Error(err, "unable to register metrics")
+		os.Exit(1)
+	}
+
+	if summaryConfigMap != "" {
+		if err = mgr.Add(&controllers.SummaryWriter{
+			Client:   mgr.GetClient(),
+			Key:      types.NamespacedName{Name: summaryConfigMap, Namespace: cacheNamespace},
+			Interval: summaryInterval,
+		}); err != nil {
+			setupLog.Error(err, "unable to add summary writer")
+			os.Exit(1)
+		}
+	}
+
+	if orphanGracePeriod > 0 {
+		if err = mgr.Add(&controllers.OrphanCollector{
+			Client:         mgr.GetClient(),
+			CacheNamespace: cacheNamespace,
+			GracePeriod:    orphanGracePeriod,
+		}); err != nil {
+			setupLog.Error(err, "unable to add orphan collector")
+			os.Exit(1)
+		}
+	}
+
+	if staleSecretInterval > 0 {
+		if err = mgr.Add(&controllers.StaleSecretCollector{
+			Client:                    mgr.GetClient(),
+			Interval:                  staleSecretInterval,
+			DefaultSecretNameTemplate: secretNameTemplate,
+		}); err != nil {
+			setupLog.Error(err, "unable to add stale secret collector")
+			os.Exit(1)
+		}
+	}
+
+	var upstreamSecretCache *controllers.UpstreamSecretCache
+	if upstreamSecretCacheTTL > 0 {
+		upstreamSecretCache = controllers.NewUpstreamSecretCache(upstreamSecretCacheTTL)
+	}
+
+	var parsedChainCache *controllers.ParsedChainCache
+	if parsedCertificateCacheSize > 0 {
+		parsedChainCache = controllers.NewParsedChainCache(parsedCertificateCacheSize)
+	}
+
+	var auditLog logr.Logger
+	if enableAuditLog {
+		auditLog = ctrl.Log.WithName("audit")
+	}
+
+	if err = (&controllers.CachedCertificateReconciler{
+		CacheNamespace:               cacheNamespace,
+		WatchAllUpstreamSecretEvents: watchAllUpstreamSecretEvents,
+		WatchLabelSelector:           watchSelector,
+		WatchNamespaces:              strings.Split(watchNamespaces, ","),
+		SharedUpstreamStrategy:       upstreamStrategy,
+		UpstreamNaming:               upstreamNaming,
+		DisambiguateWildcardNames:    disambiguateWildcardNames,
+		ReKeyDebounce:                reKeyDebounce,
+		IssuerFallbackTimeout:        issuerFallbackTimeout,
+		CircuitBreakerThreshold:      circuitBreakerThreshold,
+		QuotaExceededBackoff:         quotaExceededBackoff,
+		CircuitBreakerCooldown:       circuitBreakerCooldown,
+		Validator:                    validator,
+		ResyncEvents:                 resyncEvents,
+		CertificateNameAnnotation:    certificateNameAnnotation,
+		ClusterTrustBundleName:       clusterTrustBundleName,
+		SecretProviderClassProvider:  secretProviderClassProvider,
+		UpstreamPollInterval:         upstreamPollInterval,
+		NonBlockingOwnerReferences:   !blockOwnerDeletion,
+		FieldManager:                 fieldManager,
+		DefaultSecretNameTemplate:    secretNameTemplate,
+		UpstreamSecretNameTemplate:   upstreamSecretName,
+		WaitForIssuance:              waitForIssuance,
+		AuditLog:                     auditLog,
+		UpstreamReader:               upstreamReader,
+		NamespaceReader:              mgr.GetAPIReader(),
+		WatchIssuers:                 watchIssuers,
+		UpstreamSecretCache:          upstreamSecretCache,
+		ParsedChainCache:             parsedChainCache,
+		NamespaceCopies:              allowSecretNamespaceSelector,
+		NamespaceCopiesPerReconcile:  namespaceCopiesPerReconcile,
+		VerifyKeyPair:                verifyKeyPair,
+		VerifyDNSNames:               verifyDNSNames,
+		IssuanceLatency:              issuanceLatency,
+		Recorder:                     mgr.GetEventRecorderFor("cachedcertificate-controller"),
+		Client:                       mgr.GetClient(),
+		Scheme:                       mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CachedCertificate")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = validator.SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CachedCertificate")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -105,3 +471,107 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// resolveCacheNamespace prefers the flag value, falling back to the POD_NAMESPACE env set by the downward API
+func resolveCacheNamespace(flagValue string, getenv func(string) string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+
+	if ns := getenv("POD_NAMESPACE"); ns != "" {
+		return ns, nil
+	}
+
+	return "", errors.New("--cache-namespace or the POD_NAMESPACE env must be set")
+}
+
+// setupTracing exports spans over OTLP/HTTP, the endpoint is read from the standard OTEL_EXPORTER_OTLP_ENDPOINT env
+func setupTracing(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("cached-certificate-operator"))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// runImport prints CachedCertificate manifests for the existing cert-manager Certificates in a namespace
+func runImport(args []string) int {
+	var namespace string
+	var adoptSecrets bool
+	var manifests string
+	importFlags := flag.NewFlagSet("import", flag.ExitOnError)
+	importFlags.StringVar(&namespace, "namespace", "", "The namespace to scan for existing Certificates")
+	importFlags.BoolVar(&adoptSecrets, "adopt-secrets", false, "Mark the existing Certificate secrets as synced so the operator will take them over. "+
+		"Secrets a Certificate still uses are skipped.")
+	importFlags.StringVar(&manifests, "manifests", "", "Read the CachedCertificates from manifests written by an earlier import instead of scanning "+
+		"Certificates, e.g. to adopt their secrets once the Certificates are deleted")
+	_ = importFlags.Parse(args)
+
+	if namespace == "" && manifests == "" {
+		fmt.Fprintln(os.Stderr, "--namespace or --manifests is required")
+		return 1
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unable to create client:", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	var certs []cachev1alpha1.CachedCertificate
+	if manifests != "" {
+		f, err := os.Open(manifests)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "unable to open manifests:", err)
+			return 1
+		}
+		certs, err = importer.ReadManifests(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "unable to read manifests:", err)
+			return 1
+		}
+	} else {
+		var skipped []string
+		certs, skipped, err = importer.Import(ctx, c, namespace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "unable to list Certificates:", err)
+			return 1
+		}
+
+		for _, name := range skipped {
+			fmt.Fprintln(os.Stderr, "skipping Certificate without dnsNames:", name)
+		}
+	}
+
+	// written before anything in the cluster changes so a failed adoption still leaves the manifests
+	if err := importer.WriteManifests(os.Stdout, certs); err != nil {
+		fmt.Fprintln(os.Stderr, "unable to write manifests:", err)
+		return 1
+	}
+
+	if adoptSecrets {
+		adopted, skipped, err := importer.AdoptSecrets(ctx, c, certs)
+		for _, key := range adopted {
+			fmt.Fprintln(os.Stderr, "adopted secret:", key)
+		}
+		for _, skip := range skipped {
+			fmt.Fprintf(os.Stderr, "skipping secret %s: %s\n", skip.Secret, skip.Reason)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "unable to adopt secrets:", err)
+			return 1
+		}
+	}
+
+	return 0
+}
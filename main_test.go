@@ -0,0 +1,46 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "testing"
+
+func Test_resolveCacheNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		flagValue string
+		env       map[string]string
+		want      string
+		wantErr   bool
+	}{
+		{"flag wins over env", "from-flag", map[string]string{"POD_NAMESPACE": "from-env"}, "from-flag", false},
+		{"env used when flag empty", "", map[string]string{"POD_NAMESPACE": "from-env"}, "from-env", false},
+		{"flag used without env", "from-flag", nil, "from-flag", false},
+		{"error when neither set", "", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+			got, err := resolveCacheNamespace(tt.flagValue, getenv)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveCacheNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveCacheNamespace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
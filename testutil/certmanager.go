@@ -0,0 +1,145 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testutil provides helpers for testing against the operator without a running cert-manager
+package testutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CertificateNameAnnotationKey is the annotation cert-manager sets on a secret to point at its Certificate
+const CertificateNameAnnotationKey = "cert-manager.io/certificate-name"
+
+// CertificateGVK is the cert-manager Certificate kind the operator creates upstream
+var CertificateGVK = schema.GroupVersionKind{
+	Group:   "cert-manager.io",
+	Kind:    "Certificate",
+	Version: "v1",
+}
+
+// IssueCertificate simulates cert-manager issuing the Certificate at key by creating its secret
+func IssueCertificate(ctx context.Context, c client.Client, key types.NamespacedName) (*v1.Secret, error) {
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(CertificateGVK)
+	if err := c.Get(ctx, key, cert); err != nil {
+		return nil, err
+	}
+
+	secret, err := NewCertificateSecret(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Create(ctx, secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// NewCertificateSecret builds the secret cert-manager would issue for the Certificate
+// The secret holds a self signed certificate for the Certificate dnsNames
+func NewCertificateSecret(cert *unstructured.Unstructured) (*v1.Secret, error) {
+	if cert == nil {
+		return nil, errors.New("a Certificate is required")
+	}
+
+	secretName, _, err := unstructured.NestedString(cert.Object, "spec", "secretName")
+	if err != nil {
+		return nil, err
+	}
+	if secretName == "" {
+		return nil, errors.New("the Certificate has no secretName")
+	}
+
+	dnsNames, _, err := unstructured.NestedStringSlice(cert.Object, "spec", "dnsNames")
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, keyPEM, err := selfSigned(dnsNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: cert.GetNamespace(),
+			Annotations: map[string]string{
+				CertificateNameAnnotationKey: cert.GetName(),
+			},
+		},
+		Type: v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": certPEM,
+			"tls.key": keyPEM,
+			"ca.crt":  certPEM,
+		},
+	}, nil
+}
+
+// selfSigned generates a PEM encoded certificate and key for the dns names
+func selfSigned(dnsNames []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if len(dnsNames) > 0 {
+		template.Subject = pkix.Name{CommonName: dnsNames[0]}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
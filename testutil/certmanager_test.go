@@ -0,0 +1,97 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-test/deep"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newCertificate(name, secretName string, dnsNames ...interface{}) *unstructured.Unstructured {
+	cert := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"secretName": secretName,
+				"dnsNames":   dnsNames,
+			},
+		},
+	}
+	cert.SetGroupVersionKind(CertificateGVK)
+	cert.SetName(name)
+	cert.SetNamespace("cache")
+	return cert
+}
+
+func TestIssueCertificate(t *testing.T) {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	s.AddKnownTypeWithName(CertificateGVK, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(CertificateGVK.GroupVersion().WithKind("CertificateList"), &unstructured.UnstructuredList{})
+
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(newCertificate("cc-example.com", "cc-example.com", "example.com", "www.example.com")).Build()
+
+	ctx := context.Background()
+	if _, err := IssueCertificate(ctx, c, types.NamespacedName{Name: "cc-example.com", Namespace: "cache"}); err != nil {
+		t.Fatalf("IssueCertificate() unexpected err %v", err)
+	}
+
+	secret := &v1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "cc-example.com", Namespace: "cache"}, secret); err != nil {
+		t.Fatalf("unable to get issued secret %v", err)
+	}
+
+	if got := secret.Annotations[CertificateNameAnnotationKey]; got != "cc-example.com" {
+		t.Errorf("IssueCertificate() annotation = %v, want cc-example.com", got)
+	}
+
+	if _, err := tls.X509KeyPair(secret.Data["tls.crt"], secret.Data["tls.key"]); err != nil {
+		t.Errorf("IssueCertificate() created an invalid key pair %v", err)
+	}
+
+	block, _ := pem.Decode(secret.Data["tls.crt"])
+	if block == nil {
+		t.Fatal("IssueCertificate() tls.crt is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("IssueCertificate() tls.crt is invalid %v", err)
+	}
+	if diff := deep.Equal(cert.DNSNames, []string{"example.com", "www.example.com"}); diff != nil {
+		t.Errorf("IssueCertificate() dnsNames diff %v", diff)
+	}
+
+	if _, err := IssueCertificate(ctx, c, types.NamespacedName{Name: "missing", Namespace: "cache"}); err == nil {
+		t.Error("IssueCertificate() expected an error for a missing Certificate")
+	}
+}
+
+func TestNewCertificateSecretRequiresSecretName(t *testing.T) {
+	if _, err := NewCertificateSecret(newCertificate("cc-example.com", "", "example.com")); err == nil {
+		t.Error("NewCertificateSecret() expected an error without a secretName")
+	}
+}